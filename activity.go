@@ -0,0 +1,162 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	applicationKey = label.Key("sql.application")
+	stateKey       = label.Key("sql.state")
+)
+
+type sessionCount struct {
+	Application string
+	State       string
+	Sessions    int64
+}
+
+type applicationActivity struct {
+	Application      string
+	OldestXact       float64
+	OldestIdleInXact float64
+}
+
+type activityStats struct {
+	sessions     []sessionCount
+	applications []applicationActivity
+}
+
+// ActivityCollector periodically reads pg_stat_activity and reports the
+// number of server sessions by state (active, idle, idle in transaction,
+// ...) and the age of the oldest transaction and of the oldest idle
+// transaction in seconds, labeled by instance and application_name, so pool
+// statistics can be reconciled with the server:
+//
+//   c := &pgext.ActivityCollector{DB: db}
+//   c.Start()
+//   defer c.Shutdown(ctx)
+type ActivityCollector struct {
+	// DB is the database to report sessions of.
+	DB *pg.DB
+	// Instance is the sql.instance label. Defaults to the database name.
+	Instance string
+	// Interval is the time between samples. Defaults to 1m.
+	Interval time.Duration
+	// Logger is used to print sampling errors. Defaults to the standard logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the sampled values against threshold rules.
+	Alerter *Alerter
+
+	poller poller
+	mu     sync.Mutex
+	stats  activityStats
+}
+
+var _ Shutdowner = (*ActivityCollector)(nil)
+
+type activityInstruments struct {
+	sessions               metric.Int64ValueObserver
+	oldestXact, oldestIdle metric.Float64ValueObserver
+}
+
+// Start starts sampling in the background and reporting the metrics.
+func (c *ActivityCollector) Start() {
+	if !c.poller.start(c.Interval, c.collect) {
+		return
+	}
+
+	c.poller.onShutdown(observeBatch("go.sql.sessions",
+		func(batch metric.BatchObserver) interface{} {
+			var i activityInstruments
+			i.sessions, _ = batch.NewInt64ValueObserver("go.sql.sessions",
+				metric.WithDescription("The number of server sessions by state"))
+			i.oldestXact, _ = batch.NewFloat64ValueObserver("go.sql.oldest_transaction_age",
+				metric.WithDescription("The age of the oldest open transaction in seconds"))
+			i.oldestIdle, _ = batch.NewFloat64ValueObserver("go.sql.oldest_idle_in_transaction_age",
+				metric.WithDescription("The time the oldest idle in transaction session has been idle in seconds"))
+			return &i
+		},
+		func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			i := instruments.(*activityInstruments)
+			c.mu.Lock()
+			stats := c.stats
+			c.mu.Unlock()
+
+			instance := instanceKey.String(instanceName(c.DB, c.Instance))
+			for _, s := range stats.sessions {
+				result.Observe([]label.KeyValue{instance, applicationKey.String(s.Application), stateKey.String(s.State)},
+					i.sessions.Observation(s.Sessions))
+			}
+			for _, a := range stats.applications {
+				result.Observe([]label.KeyValue{instance, applicationKey.String(a.Application)},
+					i.oldestXact.Observation(a.OldestXact),
+					i.oldestIdle.Observation(a.OldestIdleInXact),
+				)
+			}
+		}))
+}
+
+// Shutdown stops sampling and reporting the metrics.
+func (c *ActivityCollector) Shutdown(ctx context.Context) error {
+	return c.poller.shutdown(ctx)
+}
+
+func (c *ActivityCollector) collect(ctx context.Context) {
+	var stats activityStats
+
+	if _, err := c.DB.QueryContext(ctx, &stats.sessions, `
+		SELECT application_name AS application,
+			coalesce(state, 'unknown') AS state,
+			count(*) AS sessions
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend' AND datname = current_database()
+		GROUP BY 1, 2`); err != nil {
+		c.failed(ctx, err)
+		return
+	}
+
+	if _, err := c.DB.QueryContext(ctx, &stats.applications, `
+		SELECT application_name AS application,
+			coalesce(extract(epoch FROM max(now() - xact_start)), 0) AS oldest_xact,
+			coalesce(extract(epoch FROM max(now() - state_change)
+				FILTER (WHERE state LIKE 'idle in transaction%')), 0) AS oldest_idle_in_xact
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend' AND datname = current_database()
+		GROUP BY 1`); err != nil {
+		c.failed(ctx, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.stats = stats
+	c.mu.Unlock()
+
+	instance := instanceKey.String(instanceName(c.DB, c.Instance))
+	samples := make([]sample, 0, len(stats.sessions)+2*len(stats.applications))
+	for _, s := range stats.sessions {
+		samples = append(samples, sample{"go.sql.sessions",
+			[]label.KeyValue{instance, applicationKey.String(s.Application), stateKey.String(s.State)},
+			float64(s.Sessions)})
+	}
+	for _, a := range stats.applications {
+		labels := []label.KeyValue{instance, applicationKey.String(a.Application)}
+		samples = append(samples,
+			sample{"go.sql.oldest_transaction_age", labels, a.OldestXact},
+			sample{"go.sql.oldest_idle_in_transaction_age", labels, a.OldestIdleInXact},
+		)
+	}
+	c.Alerter.check(ctx, samples)
+}
+
+func (c *ActivityCollector) failed(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		logf(c.Logger, "pgext: sampling activity failed: %s", err)
+	}
+}
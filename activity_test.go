@@ -0,0 +1,91 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestActivityCollector(t *testing.T) {
+	var down int32
+	db := fakeDB(t, func(query string) fakeResult {
+		if atomic.LoadInt32(&down) != 0 {
+			return fakeResult{Err: "57P01"}
+		}
+		if strings.Contains(query, "GROUP BY 1, 2") {
+			return fakeResult{
+				Columns: []string{"application", "state", "sessions"},
+				Rows: [][]string{
+					{"orders", "active", "3"},
+					{"orders", "idle in transaction", "1"},
+				},
+			}
+		}
+		return fakeResult{
+			Columns: []string{"application", "oldest_xact", "oldest_idle_in_xact"},
+			Rows:    [][]string{{"orders", "600.5", "420"}},
+		}
+	})
+
+	var (
+		buf    bytes.Buffer
+		alerts []Alert
+	)
+	c := &ActivityCollector{
+		DB:     db,
+		Logger: log.New(&buf, "", 0),
+		Alerter: &Alerter{
+			Rules: []AlertRule{{Name: "idle", Metric: "go.sql.oldest_idle_in_transaction_age", Threshold: 300}},
+			Notify: func(_ context.Context, alert Alert) {
+				alerts = append(alerts, alert)
+			},
+		},
+	}
+	ctx := context.Background()
+	c.collect(ctx)
+
+	if len(c.stats.sessions) != 2 || c.stats.sessions[1].State != "idle in transaction" {
+		t.Errorf("got sessions %+v", c.stats.sessions)
+	}
+	if len(alerts) != 1 || alerts[0].Labels["sql.application"] != "orders" || alerts[0].Value != 420 {
+		t.Errorf("got alerts %+v, want the idle transaction of orders", alerts)
+	}
+
+	atomic.StoreInt32(&down, 1)
+	c.collect(ctx)
+	if len(c.stats.sessions) != 2 {
+		t.Error("failed sample replaces the last one")
+	}
+	if !strings.Contains(buf.String(), "sampling activity failed") {
+		t.Errorf("failed sample is not logged, got %q", buf.String())
+	}
+}
+
+func TestActivityCollectorMetrics(t *testing.T) {
+	db := fakeDB(t, func(query string) fakeResult {
+		if strings.Contains(query, "GROUP BY 1, 2") {
+			return fakeResult{
+				Columns: []string{"application", "state", "sessions"},
+				Rows:    [][]string{{"orders", "active", "3"}},
+			}
+		}
+		return fakeResult{
+			Columns: []string{"application", "oldest_xact", "oldest_idle_in_xact"},
+			Rows:    [][]string{{"orders", "600.5", "0"}},
+		}
+	})
+
+	testCollectorMetrics(t, "go.sql.sessions", map[string]string{"sql.application": "orders", "sql.state": "active"},
+		func(instance string) (Shutdowner, func() bool) {
+			c := &ActivityCollector{DB: db, Instance: instance}
+			c.Start()
+			return c, func() bool {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return c.stats.applications != nil
+			}
+		})
+}
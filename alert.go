@@ -0,0 +1,166 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+// sample is a value reported by a collector.
+type sample struct {
+	metric string
+	labels []label.KeyValue
+	value  float64
+}
+
+// AlertRule is a threshold on a metric reported by a collector, e.g.
+//
+//   pgext.AlertRule{Name: "idle in transaction", Metric: "go.sql.oldest_idle_in_transaction_age", Threshold: 300}
+type AlertRule struct {
+	// Name identifies the rule in alerts.
+	Name string
+	// Metric is the name of the collector metric, e.g.
+	// go.sql.replication.lag_seconds.
+	Metric string
+	// Threshold is the value above which the rule is breached.
+	Threshold float64
+}
+
+// Alert is a breached AlertRule.
+type Alert struct {
+	Rule AlertRule
+	// Labels of the breaching value, e.g. the table or the replica.
+	Labels map[string]string
+	Value  float64
+	// Resolved is set when the value dropped back to the threshold or below.
+	Resolved bool
+}
+
+// Alerter checks the values sampled by collectors against threshold rules
+// and notifies when a rule is breached and when it is resolved, for
+// deployments without an alerting stack. Set it on every collector:
+//
+//   alerter := &pgext.Alerter{
+//       Rules: []pgext.AlertRule{
+//           {Name: "replica lag", Metric: "go.sql.replication.lag_seconds", Threshold: 30},
+//           {Name: "idle in transaction", Metric: "go.sql.oldest_idle_in_transaction_age", Threshold: 300},
+//       },
+//       Notify: pgext.WebhookNotifier("https://hooks.example.com/pg"),
+//   }
+//   wal := &pgext.WALCollector{DB: db, Alerter: alerter}
+//   activity := &pgext.ActivityCollector{DB: db, Alerter: alerter}
+type Alerter struct {
+	// Rules to check.
+	Rules []AlertRule
+	// Notify is called for every breach and resolution. Defaults to logging.
+	Notify func(ctx context.Context, alert Alert)
+	// Logger is used by the default Notify. Defaults to the standard logger.
+	Logger *log.Logger
+
+	mu     sync.Mutex
+	firing map[string]bool
+}
+
+// check notifies about rules breached or resolved by the samples of
+// a collector. Values missing from a sample are not resolved.
+func (a *Alerter) check(ctx context.Context, samples []sample) {
+	if a == nil {
+		return
+	}
+
+	var alerts []Alert
+	a.mu.Lock()
+	if a.firing == nil {
+		a.firing = make(map[string]bool)
+	}
+	for _, rule := range a.Rules {
+		for _, s := range samples {
+			if s.metric != rule.Metric {
+				continue
+			}
+
+			key := alertKey(rule, s.labels)
+			breached := s.value > rule.Threshold
+			if breached == a.firing[key] {
+				continue
+			}
+			if breached {
+				a.firing[key] = true
+			} else {
+				delete(a.firing, key)
+			}
+
+			labels := make(map[string]string, len(s.labels))
+			for _, kv := range s.labels {
+				labels[string(kv.Key)] = kv.Value.Emit()
+			}
+			alerts = append(alerts, Alert{Rule: rule, Labels: labels, Value: s.value, Resolved: !breached})
+		}
+	}
+	a.mu.Unlock()
+
+	for _, alert := range alerts {
+		a.notify(ctx, alert)
+	}
+}
+
+func (a *Alerter) notify(ctx context.Context, alert Alert) {
+	if a.Notify != nil {
+		a.Notify(ctx, alert)
+		return
+	}
+
+	state := "breached"
+	if alert.Resolved {
+		state = "resolved"
+	}
+	logf(a.Logger, "pgext: alert %q %s: %s=%g %v (threshold %g)",
+		alert.Rule.Name, state, alert.Rule.Metric, alert.Value, alert.Labels, alert.Rule.Threshold)
+}
+
+func alertKey(rule AlertRule, labels []label.KeyValue) string {
+	var b strings.Builder
+	b.WriteString(rule.Name)
+	for _, kv := range labels {
+		b.WriteByte(0)
+		b.WriteString(string(kv.Key))
+		b.WriteByte('=')
+		b.WriteString(kv.Value.Emit())
+	}
+	return b.String()
+}
+
+// WebhookNotifier returns a Notify function that posts alerts as JSON to the
+// URL.
+func WebhookNotifier(url string) func(ctx context.Context, alert Alert) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context, alert Alert) {
+		b, err := json.Marshal(alert)
+		if err != nil {
+			return
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			log.Printf("pgext: posting alert failed: %s", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("pgext: posting alert failed: %s", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("pgext: posting alert failed: %s", resp.Status)
+		}
+	}
+}
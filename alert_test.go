@@ -0,0 +1,41 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestAlerter(t *testing.T) {
+	var alerts []Alert
+	a := &Alerter{
+		Rules: []AlertRule{{Name: "lag", Metric: "go.sql.replication.lag_seconds", Threshold: 30}},
+		Notify: func(_ context.Context, alert Alert) {
+			alerts = append(alerts, alert)
+		},
+	}
+	ctx := context.Background()
+
+	lag := func(replica string, v float64) sample {
+		return sample{"go.sql.replication.lag_seconds", []label.KeyValue{replicaKey.String(replica)}, v}
+	}
+
+	a.check(ctx, []sample{lag("r1", 10), lag("r2", 10), {"go.sql.wal.bytes", nil, 100}})
+	a.check(ctx, []sample{lag("r1", 45), lag("r2", 10)})
+	a.check(ctx, []sample{lag("r1", 60), lag("r2", 10)})
+	a.check(ctx, []sample{lag("r1", 20), lag("r2", 10)})
+
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2", len(alerts))
+	}
+	if alerts[0].Resolved || alerts[0].Value != 45 || alerts[0].Labels["sql.replica"] != "r1" {
+		t.Errorf("got %+v, want breach of r1", alerts[0])
+	}
+	if !alerts[1].Resolved || alerts[1].Value != 20 {
+		t.Errorf("got %+v, want resolution of r1", alerts[1])
+	}
+
+	var nilAlerter *Alerter
+	nilAlerter.check(ctx, []sample{lag("r1", 100)})
+}
@@ -0,0 +1,47 @@
+package pgext
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// maxApplicationName is the limit of application_name, NAMEDATALEN - 1.
+const maxApplicationName = 63
+
+// ApplicationName returns the service followed by the short trace ID of the
+// span in ctx, e.g. "orders trace=4bf92f3577b34da6", for matching
+// pg_stat_activity and server logs, with %a in log_line_prefix, to traces.
+// The result is limited to the 63 bytes PostgreSQL keeps.
+func ApplicationName(ctx context.Context, service string) string {
+	name := service
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.HasTraceID() {
+		id := sc.TraceID.String()
+		suffix := " trace=" + id[:16]
+		if len(name)+len(suffix) > maxApplicationName {
+			name = truncate(name, maxApplicationName-len(suffix))
+		}
+		name += suffix
+	}
+	return truncate(name, maxApplicationName)
+}
+
+// SetApplicationName sets application_name to ApplicationName for the rest
+// of the transaction, so the statements of a traced request can be found on
+// the server:
+//
+//   err := db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+//       if err := pgext.SetApplicationName(ctx, tx, "orders"); err != nil {
+//           return err
+//       }
+//       ...
+//   })
+//
+// Set pg.Options.ApplicationName to the service for connections outside of
+// transactions.
+func SetApplicationName(ctx context.Context, tx *pg.Tx, service string) error {
+	_, err := tx.ExecContext(ctx, `SELECT set_config('application_name', ?, true)`,
+		ApplicationName(ctx, service))
+	return err
+}
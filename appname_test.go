@@ -0,0 +1,18 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestApplicationName(t *testing.T) {
+	ctx := context.Background()
+
+	if got := ApplicationName(ctx, "orders"); got != "orders" {
+		t.Errorf("got %q, want orders", got)
+	}
+	if got := ApplicationName(ctx, strings.Repeat("x", 100)); len(got) != maxApplicationName {
+		t.Errorf("got %d bytes, want %d", len(got), maxApplicationName)
+	}
+}
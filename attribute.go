@@ -0,0 +1,114 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// AttributeFilter removes span attributes and metric labels before they reach
+// exporters. Entries are attribute keys or key prefixes ending with '*',
+// e.g. "db.user" or "frame.*".
+type AttributeFilter struct {
+	// Allow, if not empty, lists the only attributes that are kept.
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	// Deny lists attributes that are removed. It takes precedence over Allow.
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+func matchAttribute(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(key, p[:len(p)-1]) {
+				return true
+			}
+		} else if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether the attribute with the key is kept.
+func (f *AttributeFilter) Allowed(key label.Key) bool {
+	if f == nil {
+		return true
+	}
+	if matchAttribute(f.Deny, string(key)) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchAttribute(f.Allow, string(key))
+}
+
+var attributeFilter atomic.Value
+
+// SetAttributeFilter sets the AttributeFilter applied to the span attributes,
+// span events and metric labels recorded by all hooks of the package. Passing
+// nil turns filtering off. The attributes of a single OpenTelemetryHook are
+// filtered by the Attributes of its Config instead.
+func SetAttributeFilter(f *AttributeFilter) {
+	attributeFilter.Store(&f)
+}
+
+// filterAttributes returns the attributes allowed by the filter set by
+// SetAttributeFilter and by the filters, e.g. the filter of a hook. kvs is
+// never modified.
+func filterAttributes(kvs []label.KeyValue, filters ...*AttributeFilter) []label.KeyValue {
+	global, _ := attributeFilter.Load().(**AttributeFilter)
+	if (global == nil || *global == nil) && !anyFilter(filters) {
+		return kvs
+	}
+
+	var filtered []label.KeyValue
+	for i, kv := range kvs {
+		if allowed(kv.Key, global, filters) {
+			if filtered != nil {
+				filtered = append(filtered, kv)
+			}
+			continue
+		}
+		if filtered == nil {
+			filtered = make([]label.KeyValue, i, len(kvs))
+			copy(filtered, kvs[:i])
+		}
+	}
+	if filtered == nil {
+		return kvs
+	}
+	return filtered
+}
+
+func anyFilter(filters []*AttributeFilter) bool {
+	for _, f := range filters {
+		if f != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func allowed(key label.Key, global **AttributeFilter, filters []*AttributeFilter) bool {
+	if global != nil && !(*global).Allowed(key) {
+		return false
+	}
+	for _, f := range filters {
+		if !f.Allowed(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// setAttributes sets the attributes allowed by the filter on the span.
+func setAttributes(span trace.Span, kvs ...label.KeyValue) {
+	span.SetAttributes(filterAttributes(kvs)...)
+}
+
+// addEvent adds the event with the attributes allowed by the filter to the
+// span.
+func addEvent(ctx context.Context, span trace.Span, name string, kvs ...label.KeyValue) {
+	span.AddEvent(ctx, name, filterAttributes(kvs)...)
+}
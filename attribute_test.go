@@ -0,0 +1,41 @@
+package pgext
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestFilterAttributes(t *testing.T) {
+	defer SetAttributeFilter(nil)
+
+	kvs := []label.KeyValue{
+		label.String("db.statement", "SELECT 1"),
+		label.String("db.user", "app"),
+		label.String("frame.func", "main"),
+		label.Int("frame.line", 1),
+	}
+	if got := filterAttributes(kvs); !reflect.DeepEqual(got, kvs) {
+		t.Errorf("attributes are filtered without a filter: %v", got)
+	}
+
+	SetAttributeFilter(&AttributeFilter{Deny: []string{"db.user", "frame.*"}})
+	if got, want := filterAttributes(kvs), kvs[:1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if kvs[1].Key != "db.user" {
+		t.Errorf("input is modified: %v", kvs)
+	}
+
+	SetAttributeFilter(&AttributeFilter{Allow: []string{"db.*"}, Deny: []string{"db.user"}})
+	if got, want := filterAttributes(kvs), kvs[:1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	SetAttributeFilter(&AttributeFilter{Deny: []string{"db.user"}})
+	hook := &AttributeFilter{Deny: []string{"frame.*"}}
+	if got, want := filterAttributes(kvs, hook), kvs[:1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v with the filter of a hook, want %v", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// AuditEvent describes a write executed by the application.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Table     string    `json:"table,omitempty"`
+	Statement string    `json:"statement"`
+	Database  string    `json:"database,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Rows      int       `json:"rows"`
+	Error     string    `json:"error,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+
+	// Sequence, PrevHash and Hash are set by ChainSink.
+	Sequence uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// AuditSink receives audit events. Write is called synchronously after every
+// audited query, so sinks that talk to remote systems should buffer and send
+// asynchronously. Sinks that buffer should implement Shutdowner.
+type AuditSink interface {
+	Write(ctx context.Context, evt *AuditEvent) error
+}
+
+// AuditHook is a pg.QueryHook that sends an AuditEvent for every INSERT,
+// UPDATE, DELETE and DDL statement to the sink, e.g. to feed writes to a data
+// pipeline:
+//
+//   audit := &pgext.AuditHook{Sink: sink}
+//   db.AddQueryHook(audit)
+//   defer audit.Shutdown(ctx)
+type AuditHook struct {
+	// Sink receives the events.
+	Sink AuditSink
+	// Logger is used to print sink errors. Defaults to the standard logger.
+	Logger *log.Logger
+}
+
+var (
+	_ pg.QueryHook = (*AuditHook)(nil)
+	_ Shutdowner   = (*AuditHook)(nil)
+)
+
+func (h *AuditHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *AuditHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return err
+	}
+	query := strings.TrimSpace(string(b))
+
+	operation := spanName(query)
+	if v, ok := evt.Query.(queryOperation); ok {
+		operation = string(v.Operation())
+	}
+	operation = strings.ToUpper(operation)
+
+	table, write := writeTable(query)
+	if !write && !isDDL(operation) {
+		return nil
+	}
+
+	audit := &AuditEvent{
+		Time:      evt.StartTime,
+		Operation: operation,
+		Table:     table,
+		Statement: redact(query),
+	}
+	if db, ok := evt.DB.(*pg.DB); ok {
+		opt := db.Options()
+		audit.Database, audit.User = opt.Database, opt.User
+	}
+	if evt.Result != nil {
+		audit.Rows = evt.Result.RowsAffected()
+	}
+	if evt.Err != nil {
+		audit.Error = evt.Err.Error()
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.HasTraceID() {
+		audit.TraceID = sc.TraceID.String()
+	}
+
+	if err := h.Sink.Write(ctx, audit); err != nil {
+		logf(h.Logger, "pgext: writing audit event failed: %s", err)
+	}
+	return nil
+}
+
+// Shutdown shuts down the sink if it implements Shutdowner.
+func (h *AuditHook) Shutdown(ctx context.Context) error {
+	if s, ok := h.Sink.(Shutdowner); ok {
+		return s.Shutdown(ctx)
+	}
+	return nil
+}
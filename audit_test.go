@@ -0,0 +1,45 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+type auditRecorder []*AuditEvent
+
+func (r *auditRecorder) Write(_ context.Context, evt *AuditEvent) error {
+	*r = append(*r, evt)
+	return nil
+}
+
+func TestAuditHook(t *testing.T) {
+	var sink auditRecorder
+	h := &AuditHook{Sink: &sink}
+	db := pg.Connect(&pg.Options{User: "app", Database: "shop"})
+
+	for _, query := range []string{
+		`SELECT * FROM users`,
+		`INSERT INTO "users" (name) VALUES ('x')`,
+		`delete from sessions`,
+		`DROP TABLE tmp`,
+	} {
+		if err := h.AfterQuery(context.Background(), &pg.QueryEvent{DB: db, Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sink) != 3 {
+		t.Fatalf("got %d events, want 3", len(sink))
+	}
+	if e := sink[0]; e.Operation != "INSERT" || e.Table != "users" || e.User != "app" || e.Database != "shop" {
+		t.Errorf("got %+v", e)
+	}
+	if e := sink[1]; e.Operation != "DELETE" || e.Table != "sessions" {
+		t.Errorf("got %+v", e)
+	}
+	if e := sink[2]; e.Operation != "DROP" {
+		t.Errorf("got %+v", e)
+	}
+}
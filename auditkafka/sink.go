@@ -0,0 +1,194 @@
+// Package auditkafka publishes pgext audit events to Kafka.
+package auditkafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/metric"
+
+	"github.com/j2gg0s/pgext"
+)
+
+// ErrClosed is returned by Write after Shutdown.
+var ErrClosed = errors.New("auditkafka: sink is shut down")
+
+var (
+	meter = global.Meter("github.com/j2gg0s/pgext/auditkafka")
+
+	deliveredCounter, _ = meter.NewInt64Counter(
+		"go.sql.audit.kafka.delivered",
+		metric.WithDescription("The number of audit events delivered to Kafka"),
+	)
+	failedCounter, _ = meter.NewInt64Counter(
+		"go.sql.audit.kafka.failed",
+		metric.WithDescription("The number of audit events Kafka failed to accept"),
+	)
+	droppedCounter, _ = meter.NewInt64Counter(
+		"go.sql.audit.kafka.dropped",
+		metric.WithDescription("The number of audit events dropped because the buffer was full"),
+	)
+	writeLatencyRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.audit.kafka.write_latency",
+		metric.WithDescription("The latency of writing a batch to Kafka in microsecond"),
+	)
+)
+
+// Sink is a pgext.AuditSink that publishes audit events as JSON to Kafka.
+// Events are buffered and written in batches in the background, so queries
+// never wait for Kafka. Events are dropped when the buffer is full.
+//
+//   sink := &auditkafka.Sink{Writer: &kafka.Writer{
+//       Addr:  kafka.TCP("localhost:9092"),
+//       Topic: "pg-audit",
+//   }}
+//   audit := &pgext.AuditHook{Sink: sink}
+//   db.AddQueryHook(audit)
+//   defer audit.Shutdown(ctx)
+type Sink struct {
+	// Writer writes messages to Kafka. It is closed by Shutdown.
+	Writer *kafka.Writer
+	// BufferSize is the maximum number of buffered events. Defaults to 10000.
+	BufferSize int
+	// BatchSize is the maximum number of events per write. Defaults to 100.
+	BatchSize int
+	// FlushInterval is the maximum time an event is buffered. Defaults to 1s.
+	FlushInterval time.Duration
+	// Key returns the message key of the event. Defaults to the table, so
+	// events of a table stay in order.
+	Key func(evt *pgext.AuditEvent) []byte
+
+	once   sync.Once
+	mu     sync.RWMutex
+	closed bool
+	events chan kafka.Message
+	wg     sync.WaitGroup
+}
+
+var (
+	_ pgext.AuditSink  = (*Sink)(nil)
+	_ pgext.Shutdowner = (*Sink)(nil)
+)
+
+func (s *Sink) start() {
+	s.once.Do(func() {
+		size := s.BufferSize
+		if size <= 0 {
+			size = 10000
+		}
+		s.events = make(chan kafka.Message, size)
+
+		s.wg.Add(1)
+		go s.run()
+	})
+}
+
+// Write buffers the event.
+func (s *Sink) Write(ctx context.Context, evt *pgext.AuditEvent) error {
+	s.start()
+
+	value, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	key := []byte(evt.Table)
+	if s.Key != nil {
+		key = s.Key(evt)
+	}
+	msg := kafka.Message{Key: key, Value: value, Time: evt.Time}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	select {
+	case s.events <- msg:
+	default:
+		droppedCounter.Add(ctx, 1)
+	}
+	return nil
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	interval := s.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]kafka.Message, 0, batchSize)
+	for {
+		select {
+		case msg, ok := <-s.events:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (s *Sink) flush(batch []kafka.Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	err := s.Writer.WriteMessages(ctx, batch...)
+	writeLatencyRecorder.Record(ctx, time.Since(start).Microseconds())
+
+	if err != nil {
+		failedCounter.Add(ctx, int64(len(batch)))
+		return
+	}
+	deliveredCounter.Add(ctx, int64(len(batch)))
+}
+
+// Shutdown stops accepting events, writes the buffered ones and closes the
+// writer.
+func (s *Sink) Shutdown(ctx context.Context) error {
+	s.start()
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return s.Writer.Close()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
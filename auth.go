@@ -0,0 +1,121 @@
+package pgext
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var (
+	tokenRefreshCounter, _ = meter.NewInt64Counter(
+		"go.sql.auth.token_refreshes",
+		metric.WithDescription("The number of refreshed auth tokens"),
+	)
+	tokenRefreshErrorCounter, _ = meter.NewInt64Counter(
+		"go.sql.auth.token_refresh_errors",
+		metric.WithDescription("The number of failed auth token refreshes"),
+	)
+	dialLatencyRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.dial.latency",
+		metric.WithDescription("The latency of dialing a connection in microsecond"),
+	)
+)
+
+// AuthTokenDialer dials connections with short-lived credentials, e.g. AWS
+// RDS IAM tokens or Cloud SQL IAM access tokens, used as the password. The
+// token is refreshed before a dial when it is about to expire:
+//
+//   d := &pgext.AuthTokenDialer{
+//       Token: func(ctx context.Context) (string, time.Time, error) {
+//           token, err := auth.BuildAuthToken(endpoint, region, user, creds)
+//           return token, time.Now().Add(15 * time.Minute), err
+//       },
+//   }
+//   opt := &pg.Options{Addr: endpoint, User: user, TLSConfig: tlsConfig}
+//   d.Apply(opt)
+//   db := pg.Connect(opt)
+type AuthTokenDialer struct {
+	// Token returns a new token and its expiry.
+	Token func(ctx context.Context) (token string, expiry time.Time, err error)
+	// RefreshBefore is how long before the expiry the token is refreshed.
+	// Defaults to 1m.
+	RefreshBefore time.Duration
+	// Dialer dials the connection. Defaults to net.Dialer.
+	Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Clock, if set, is used instead of the system clock.
+	Clock Clock
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Apply makes opt dial with d. go-pg reads the password from opt after
+// dialing, so d updates opt.Password whenever the token changes.
+func (d *AuthTokenDialer) Apply(opt *pg.Options) {
+	opt.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		token, err := d.refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if opt.Password != token {
+			opt.Password = token
+		}
+		return d.dial(ctx, network, addr)
+	}
+}
+
+func (d *AuthTokenDialer) now() time.Time {
+	if d.Clock != nil {
+		return d.Clock.Now()
+	}
+	return time.Now()
+}
+
+// refresh returns the current token, fetching a new one if it expires
+// within RefreshBefore.
+func (d *AuthTokenDialer) refresh(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	before := d.RefreshBefore
+	if before <= 0 {
+		before = time.Minute
+	}
+	if d.token != "" && d.now().Add(before).Before(d.expiry) {
+		return d.token, nil
+	}
+
+	token, expiry, err := d.Token(ctx)
+	if err != nil {
+		tokenRefreshErrorCounter.Add(ctx, 1)
+		// Keep using the old token while it is valid.
+		if d.token != "" && d.now().Before(d.expiry) {
+			return d.token, nil
+		}
+		return "", err
+	}
+	tokenRefreshCounter.Add(ctx, 1)
+	d.token, d.expiry = token, expiry
+	return token, nil
+}
+
+func (d *AuthTokenDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := d.Dialer
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	start := time.Now()
+	cn, err := dial(ctx, network, addr)
+	status := statusOKLabel
+	if err != nil {
+		status = statusErrorLabel
+	}
+	dialLatencyRecorder.Record(ctx, time.Since(start).Microseconds(), status)
+	return cn, err
+}
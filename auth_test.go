@@ -0,0 +1,64 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestAuthTokenDialer(t *testing.T) {
+	clock := pgexttest.NewClock(time.Unix(0, 0))
+	var calls int
+	var tokenErr error
+	d := &AuthTokenDialer{
+		Token: func(context.Context) (string, time.Time, error) {
+			if tokenErr != nil {
+				return "", time.Time{}, tokenErr
+			}
+			calls++
+			return fmt.Sprintf("token-%d", calls), clock.Now().Add(15 * time.Minute), nil
+		},
+		Dialer: func(context.Context, string, string) (net.Conn, error) {
+			cn, _ := net.Pipe()
+			return cn, nil
+		},
+		Clock: clock,
+	}
+	opt := &pg.Options{}
+	d.Apply(opt)
+
+	dial := func(want string) {
+		t.Helper()
+		cn, err := opt.Dialer(context.Background(), "tcp", "localhost:5432")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cn.Close()
+		if opt.Password != want {
+			t.Errorf("got password %q, want %q", opt.Password, want)
+		}
+	}
+
+	dial("token-1")
+	clock.Advance(10 * time.Minute)
+	dial("token-1")
+	clock.Advance(4*time.Minute + time.Second)
+	dial("token-2")
+
+	// A failed refresh keeps the old token while it is valid.
+	tokenErr = errors.New("throttled")
+	clock.Advance(14*time.Minute + time.Second)
+	dial("token-2")
+
+	clock.Advance(time.Minute)
+	if _, err := opt.Dialer(context.Background(), "tcp", "localhost:5432"); err != tokenErr {
+		t.Errorf("got error %v, want %v", err, tokenErr)
+	}
+}
@@ -0,0 +1,40 @@
+package pgext
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/correlation"
+	"go.opentelemetry.io/otel/label"
+)
+
+// baggageAttributes returns the baggage entries of the context with the keys.
+func baggageAttributes(ctx context.Context, keys []label.Key) []label.KeyValue {
+	if len(keys) == 0 {
+		return nil
+	}
+	m := correlation.MapFromContext(ctx)
+	if m.Len() == 0 {
+		return nil
+	}
+
+	var kvs []label.KeyValue
+	for _, k := range keys {
+		if v, ok := m.Value(k); ok {
+			kvs = append(kvs, label.KeyValue{Key: k, Value: v})
+		}
+	}
+	return kvs
+}
+
+// BaggageComment returns the baggage entries of the context with the keys as
+// an sqlcommenter style SQL comment, e.g. /*user.tier='gold'*/, or an empty
+// string if there are none. See Commenter for the full key set.
+//
+//   _, err := db.ExecContext(ctx, pgext.BaggageComment(ctx, "user.tier")+query)
+func BaggageComment(ctx context.Context, keys ...label.Key) string {
+	kvs := make(map[string]string)
+	for _, kv := range baggageAttributes(ctx, keys) {
+		kvs[string(kv.Key)] = kv.Value.Emit()
+	}
+	return sqlComment(kvs)
+}
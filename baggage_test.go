@@ -0,0 +1,25 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/correlation"
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestBaggageComment(t *testing.T) {
+	ctx := correlation.NewContext(context.Background(),
+		label.String("user.tier", "gold"),
+		label.String("note", "it's */ done"),
+		label.String("ignored", "x"),
+	)
+
+	if got := BaggageComment(context.Background(), "user.tier"); got != "" {
+		t.Errorf("got %q without baggage", got)
+	}
+	got := BaggageComment(ctx, "user.tier", "note", "missing")
+	if want := `/*note='it%27s%20%2A%2F%20done',user.tier='gold'*/`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var batchSizeRecorder, _ = meter.NewInt64ValueRecorder(
+	"go.sql.insert.batch_size",
+	metric.WithDescription("The number of rows per INSERT statement of InsertBatches"),
+)
+
+// BatchOptions controls how InsertBatches splits inserts.
+type BatchOptions struct {
+	// MaxRows is the maximum number of rows per statement. Defaults to 1000.
+	MaxRows int
+	// MaxBytes, if set, is the maximum size of a statement. Batches with
+	// larger statements are split further.
+	MaxBytes int
+	// InTx runs all statements in one transaction when db is a *pg.DB.
+	InTx bool
+}
+
+// InsertBatches inserts a slice of models with multiple statements of at most
+// MaxRows rows and MaxBytes bytes, instead of one huge INSERT that stalls the
+// server. The number of rows per statement is recorded in
+// go.sql.insert.batch_size:
+//
+//   err := pgext.InsertBatches(ctx, db, &events, pgext.BatchOptions{MaxRows: 500, InTx: true})
+func InsertBatches(ctx context.Context, db orm.DB, slice interface{}, opt BatchOptions) error {
+	v := reflect.Indirect(reflect.ValueOf(slice))
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("pgext: InsertBatches(non-slice %T)", slice)
+	}
+	if v.Len() == 0 {
+		return nil
+	}
+
+	if pdb, ok := db.(*pg.DB); ok && opt.InTx {
+		return pdb.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			return insertBatches(ctx, tx, v, opt)
+		})
+	}
+	return insertBatches(ctx, db, v, opt)
+}
+
+func insertBatches(ctx context.Context, db orm.DB, v reflect.Value, opt BatchOptions) error {
+	maxRows := opt.MaxRows
+	if maxRows <= 0 {
+		maxRows = 1000
+	}
+
+	for i := 0; i < v.Len(); i += maxRows {
+		j := i + maxRows
+		if j > v.Len() {
+			j = v.Len()
+		}
+		if err := insertBatch(ctx, db, v.Slice(i, j), opt.MaxBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertBatch inserts the rows, halving the batch while its statement is
+// larger than maxBytes.
+func insertBatch(ctx context.Context, db orm.DB, rows reflect.Value, maxBytes int) error {
+	// go-pg needs a pointer to the slice to scan returned columns.
+	ptr := reflect.New(rows.Type())
+	ptr.Elem().Set(rows)
+	q := db.ModelContext(ctx, ptr.Interface())
+
+	if maxBytes > 0 && rows.Len() > 1 {
+		b, err := orm.NewInsertQuery(q).AppendQuery(db.Formatter(), nil)
+		if err != nil {
+			return err
+		}
+		if len(b) > maxBytes {
+			half := rows.Len() / 2
+			if err := insertBatch(ctx, db, rows.Slice(0, half), maxBytes); err != nil {
+				return err
+			}
+			return insertBatch(ctx, db, rows.Slice(half, rows.Len()), maxBytes)
+		}
+	}
+
+	if _, err := q.Insert(); err != nil {
+		return err
+	}
+	batchSizeRecorder.Record(ctx, int64(rows.Len()))
+	return nil
+}
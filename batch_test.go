@@ -0,0 +1,80 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type batchRow struct {
+	ID   int64
+	Name string
+}
+
+func TestInsertBatches(t *testing.T) {
+	rows := make([]batchRow, 7)
+	for i := range rows {
+		rows[i] = batchRow{ID: int64(i + 1), Name: fmt.Sprintf("row%d", i)}
+	}
+	// Statements with two rows have 71 bytes, with three rows 84 bytes.
+	const maxBytes = 75
+
+	tests := []struct {
+		opt   BatchOptions
+		sizes []int
+	}{
+		{BatchOptions{}, []int{7}},
+		{BatchOptions{MaxRows: 3}, []int{3, 3, 1}},
+		{BatchOptions{MaxRows: 4, MaxBytes: maxBytes}, []int{2, 2, 1, 2}},
+		{BatchOptions{MaxBytes: 1}, []int{1, 1, 1, 1, 1, 1, 1}},
+		{BatchOptions{MaxRows: 3, InTx: true}, []int{3, 3, 1}},
+	}
+
+	for _, test := range tests {
+		var (
+			mu      sync.Mutex
+			queries []string
+		)
+		db := fakeDB(t, func(query string) fakeResult {
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+			return fakeResult{Tag: "INSERT 0 1"}
+		})
+
+		if err := InsertBatches(context.Background(), db, &rows, test.opt); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		var sizes []int
+		var tx []string
+		inserted := 0
+		for _, query := range queries {
+			if !strings.HasPrefix(query, "INSERT") {
+				tx = append(tx, query)
+				continue
+			}
+			if limit := test.opt.MaxBytes; limit > 0 && len(query) > limit && strings.Count(query, "'row") > 1 {
+				t.Errorf("%+v: got a statement of %d bytes", test.opt, len(query))
+			}
+			for n := strings.Count(query, "'row"); n > 0; n-- {
+				if want := fmt.Sprintf("'row%d'", inserted); !strings.Contains(query, want) {
+					t.Errorf("%+v: row %s is missing or out of order in %q", test.opt, want, query)
+				}
+				inserted++
+			}
+			sizes = append(sizes, strings.Count(query, "'row"))
+		}
+		mu.Unlock()
+
+		if fmt.Sprint(sizes) != fmt.Sprint(test.sizes) {
+			t.Errorf("%+v: got statements of %v rows, want %v", test.opt, sizes, test.sizes)
+		}
+		if test.opt.InTx != (len(tx) == 2) {
+			t.Errorf("%+v: got transaction statements %q", test.opt, tx)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package pgext
+
+// Workload is the kind of queries a database serves, used to pick the
+// histogram buckets of go.sql.latency.
+type Workload int
+
+const (
+	// WorkloadOLTP is short transactional queries, 100µs to 1s.
+	WorkloadOLTP Workload = iota
+	// WorkloadBatch is batch jobs and bulk writes, 1ms to 1m.
+	WorkloadBatch
+	// WorkloadAnalytics is reporting and analytical queries, 10ms to 10m.
+	WorkloadAnalytics
+)
+
+var latencyBoundaries = map[Workload][]float64{
+	WorkloadOLTP: {
+		100, 250, 500, 1e3, 2.5e3, 5e3, 1e4, 2.5e4, 5e4, 1e5, 2.5e5, 5e5, 1e6,
+	},
+	WorkloadBatch: {
+		1e3, 5e3, 1e4, 5e4, 1e5, 5e5, 1e6, 5e6, 1e7, 3e7, 6e7,
+	},
+	WorkloadAnalytics: {
+		1e4, 1e5, 5e5, 1e6, 5e6, 1e7, 3e7, 6e7, 1.2e8, 3e8, 6e8,
+	},
+}
+
+// LatencyBoundaries returns the recommended histogram bucket boundaries of
+// go.sql.latency, in microseconds, for the workload. The OpenTelemetry SDK
+// has no views yet, so pass them to the aggregator selector of the
+// exporter:
+//
+//   selector := simple.NewWithHistogramDistribution(pgext.LatencyBoundaries(pgext.WorkloadOLTP))
+//
+// The selector applies to every value recorder; the other pgext value
+// recorders measured in microseconds, e.g. go.sql.queue.wait, fit the same
+// buckets. Unknown workloads get the OLTP buckets.
+func LatencyBoundaries(w Workload) []float64 {
+	b, ok := latencyBoundaries[w]
+	if !ok {
+		b = latencyBoundaries[WorkloadOLTP]
+	}
+	return append([]float64(nil), b...)
+}
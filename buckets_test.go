@@ -0,0 +1,21 @@
+package pgext
+
+import "testing"
+
+func TestLatencyBoundaries(t *testing.T) {
+	for _, w := range []Workload{WorkloadOLTP, WorkloadBatch, WorkloadAnalytics} {
+		b := LatencyBoundaries(w)
+		for i := 1; i < len(b); i++ {
+			if b[i] <= b[i-1] {
+				t.Errorf("workload %d: boundaries %v are not increasing", w, b)
+				break
+			}
+		}
+	}
+
+	b := LatencyBoundaries(WorkloadOLTP)
+	b[0] = -1
+	if LatencyBoundaries(WorkloadOLTP)[0] == -1 {
+		t.Error("changing the returned boundaries changed the preset")
+	}
+}
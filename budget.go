@@ -0,0 +1,83 @@
+package pgext
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var (
+	retryBudgetConsumedCounter, _ = meter.NewInt64Counter(
+		"go.sql.tx.retry_budget.consumed",
+		metric.WithDescription("The number of retries allowed by the retry budget"),
+	)
+	retryBudgetRejectedCounter, _ = meter.NewInt64Counter(
+		"go.sql.tx.retry_budget.rejected",
+		metric.WithDescription("The number of retries rejected because the retry budget was exhausted"),
+	)
+)
+
+// RetryBudget is a token bucket that limits the rate of retries. Share one
+// budget between all transactions on a DB, so retries can not amplify the
+// load during an outage:
+//
+//   budget := &pgext.RetryBudget{Rate: 5, Burst: 20}
+//   policy := pgext.RetryPolicy{Budget: budget}
+type RetryBudget struct {
+	// Rate is the number of retries per second the budget refills.
+	// Defaults to 10.
+	Rate float64
+	// Burst is the maximum number of retries that can be spent at once.
+	// Defaults to 100.
+	Burst int
+	// Clock, if set, is used to refill the budget instead of the system clock.
+	Clock Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take spends a token and reports whether the retry is allowed.
+func (b *RetryBudget) take(ctx context.Context) bool {
+	rate, burst := b.Rate, float64(b.Burst)
+	if rate <= 0 {
+		rate = 10
+	}
+	if burst <= 0 {
+		burst = 100
+	}
+
+	var now time.Time
+	if b.Clock != nil {
+		now = b.Clock.Now()
+	} else {
+		now = time.Now()
+	}
+
+	b.mu.Lock()
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+
+	ok := b.tokens >= 1
+	if ok {
+		b.tokens--
+	}
+	b.mu.Unlock()
+
+	if ok {
+		retryBudgetConsumedCounter.Add(ctx, 1)
+	} else {
+		retryBudgetRejectedCounter.Add(ctx, 1)
+	}
+	return ok
+}
@@ -0,0 +1,40 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestRetryBudget(t *testing.T) {
+	ctx := context.Background()
+	clock := pgexttest.NewClock(time.Unix(0, 0))
+	b := &RetryBudget{Rate: 2, Burst: 3, Clock: clock}
+
+	for i := 0; i < 3; i++ {
+		if !b.take(ctx) {
+			t.Fatalf("retry %d rejected within the burst", i+1)
+		}
+	}
+	if b.take(ctx) {
+		t.Fatal("retry allowed after the burst is spent")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if !b.take(ctx) {
+		t.Fatal("retry rejected after the budget is refilled")
+	}
+	if b.take(ctx) {
+		t.Fatal("budget refilled more than the rate")
+	}
+
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		b.take(ctx)
+	}
+	if b.take(ctx) {
+		t.Fatal("budget refilled more than the burst")
+	}
+}
@@ -0,0 +1,168 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+// ErrBulkheadFull is returned by BulkheadHook for queries that could not get
+// a slot in their bulkhead in time.
+var ErrBulkheadFull = errors.New("pgext: bulkhead full")
+
+var bulkheadKey = label.Key("sql.bulkhead")
+
+var (
+	bulkheadInFlightCounter, _ = meter.NewInt64UpDownCounter(
+		"go.sql.bulkhead.in_flight",
+		metric.WithDescription("The number of queries running in the bulkhead"),
+	)
+	bulkheadRejectedCounter, _ = meter.NewInt64Counter(
+		"go.sql.bulkhead.rejected",
+		metric.WithDescription("The number of queries rejected because the bulkhead was full"),
+	)
+)
+
+// Bulkhead limits the concurrency of a class of queries.
+type Bulkhead struct {
+	// Name labels the metrics of the bulkhead.
+	Name string
+	// Tables lists the tables whose queries belong to the bulkhead. Tables
+	// without schema match in every schema.
+	Tables []string
+	// Match, if set, adds queries matching it to the bulkhead.
+	Match *regexp.Regexp
+	// MaxConcurrent is the maximum number of queries in flight.
+	MaxConcurrent int
+	// MaxWait is how long a query waits for a slot before it fails with
+	// ErrBulkheadFull. Zero fails immediately.
+	MaxWait time.Duration
+}
+
+func (b *Bulkhead) matches(query, table string) bool {
+	unqualified := table[strings.LastIndexByte(table, '.')+1:]
+	for _, t := range b.Tables {
+		if strings.EqualFold(t, table) || strings.EqualFold(t, unqualified) {
+			return true
+		}
+	}
+	return b.Match != nil && b.Match.MatchString(query)
+}
+
+type bulkheadSlotKey struct{}
+
+type bulkheadSlot struct {
+	h   *BulkheadHook
+	sem chan struct{}
+	b   *Bulkhead
+}
+
+// BulkheadHook is a pg.QueryHook that enforces separate concurrency limits
+// per table or query class, so slow queries on one table can not take the
+// whole pool and starve the others:
+//
+//   db.AddQueryHook(&pgext.BulkheadHook{Bulkheads: []pgext.Bulkhead{
+//       {Name: "analytics", Tables: []string{"events", "page_views"}, MaxConcurrent: 4},
+//       {Name: "reports", Match: regexp.MustCompile(`(?i)\bGROUP BY\b`), MaxConcurrent: 2, MaxWait: time.Second},
+//   }})
+//
+// A query belongs to the first bulkhead it matches. Other queries are not
+// limited. The saturation of every bulkhead, the queries in flight divided by
+// MaxConcurrent, is reported as go.sql.bulkhead.saturation.
+type BulkheadHook struct {
+	Bulkheads []Bulkhead
+
+	once sync.Once
+	sems []chan struct{}
+}
+
+var _ pg.QueryHook = (*BulkheadHook)(nil)
+
+func (h *BulkheadHook) init() {
+	h.sems = make([]chan struct{}, len(h.Bulkheads))
+	for i, b := range h.Bulkheads {
+		if b.MaxConcurrent > 0 {
+			h.sems[i] = make(chan struct{}, b.MaxConcurrent)
+		}
+	}
+
+	_, _ = meter.NewFloat64ValueObserver("go.sql.bulkhead.saturation",
+		func(_ context.Context, result metric.Float64ObserverResult) {
+			for i, b := range h.Bulkheads {
+				if sem := h.sems[i]; sem != nil {
+					result.Observe(float64(len(sem))/float64(cap(sem)), bulkheadKey.String(b.Name))
+				}
+			}
+		},
+		metric.WithDescription("The queries in flight in the bulkhead divided by its limit"),
+	)
+}
+
+func (h *BulkheadHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	h.once.Do(h.init)
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+	query := strings.TrimSpace(string(b))
+	table := queryTable(query)
+
+	for i := range h.Bulkheads {
+		bh := &h.Bulkheads[i]
+		if h.sems[i] == nil || !bh.matches(query, table) {
+			continue
+		}
+		if err := h.acquire(ctx, bh, h.sems[i]); err != nil {
+			return ctx, err
+		}
+		return context.WithValue(ctx, bulkheadSlotKey{}, bulkheadSlot{h: h, sem: h.sems[i], b: bh}), nil
+	}
+	return ctx, nil
+}
+
+func (h *BulkheadHook) acquire(ctx context.Context, b *Bulkhead, sem chan struct{}) error {
+	labels := []label.KeyValue{bulkheadKey.String(b.Name)}
+
+	select {
+	case sem <- struct{}{}:
+		bulkheadInFlightCounter.Add(ctx, 1, labels...)
+		return nil
+	default:
+	}
+
+	if b.MaxWait > 0 {
+		timer := time.NewTimer(b.MaxWait)
+		defer timer.Stop()
+
+		select {
+		case sem <- struct{}{}:
+			bulkheadInFlightCounter.Add(ctx, 1, labels...)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	bulkheadRejectedCounter.Add(ctx, 1, labels...)
+	return fmt.Errorf("%w: %s", ErrBulkheadFull, b.Name)
+}
+
+func (h *BulkheadHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	slot, ok := ctx.Value(bulkheadSlotKey{}).(bulkheadSlot)
+	if !ok || slot.h != h {
+		return nil
+	}
+	<-slot.sem
+	bulkheadInFlightCounter.Add(ctx, -1, bulkheadKey.String(slot.b.Name))
+	return nil
+}
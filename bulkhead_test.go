@@ -0,0 +1,44 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestBulkheadHook(t *testing.T) {
+	h := &BulkheadHook{Bulkheads: []Bulkhead{
+		{Name: "analytics", Tables: []string{"events"}, MaxConcurrent: 1, MaxWait: 10 * time.Millisecond},
+	}}
+	analytics := &pg.QueryEvent{Query: "SELECT * FROM public.events WHERE id = 1"}
+	checkout := &pg.QueryEvent{Query: "UPDATE orders SET paid = true WHERE id = 1"}
+
+	ctx, err := h.BeforeQuery(context.Background(), analytics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.BeforeQuery(context.Background(), analytics); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("got error %v, want ErrBulkheadFull", err)
+	}
+	if _, err := h.BeforeQuery(context.Background(), checkout); err != nil {
+		t.Errorf("query outside the bulkhead failed: %s", err)
+	}
+
+	if err := h.AfterQuery(ctx, analytics); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.BeforeQuery(context.Background(), analytics); err != nil {
+		t.Errorf("got error %v after release", err)
+	}
+
+	// Prepared statements and hand-built events have no formatted query.
+	prepared := pgexttest.NewQueryEvent(`SELECT * FROM events WHERE id = $1`).Build()
+	if _, err := h.BeforeQuery(context.Background(), prepared); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("unformatted query: got error %v, want ErrBulkheadFull", err)
+	}
+}
@@ -0,0 +1,114 @@
+package pgext
+
+import (
+	crand "crypto/rand"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// StatementCapture controls how the query is recorded in the db.statement
+// attribute.
+type StatementCapture int
+
+const (
+	// StatementCaptureFull records the formatted query with its parameters.
+	StatementCaptureFull StatementCapture = iota
+	// StatementCaptureNormalized records the query with literals replaced by '?'.
+	StatementCaptureNormalized
+	// StatementCaptureNone does not record the query.
+	StatementCaptureNone
+	// StatementCaptureHashed records the query with literals replaced by
+	// their salted hashes, so equal values, e.g. hot keys, can be correlated
+	// across queries without being recorded.
+	StatementCaptureHashed
+)
+
+// processSalt is the default StatementSalt. Hashes are only comparable
+// within the process.
+var processSalt = func() []byte {
+	b := make([]byte, 16)
+	_, _ = crand.Read(b)
+	return b
+}()
+
+// SetStatementCapture overrides Statement while the hook is installed.
+func (h *OpenTelemetryHook) SetStatementCapture(mode StatementCapture) {
+	atomic.StoreInt32(&h.statement, int32(mode)+1)
+}
+
+func (h *OpenTelemetryHook) statementCapture() StatementCapture {
+	if v := atomic.LoadInt32(&h.statement); v > 0 {
+		return StatementCapture(v - 1)
+	}
+	return h.Statement
+}
+
+// recordedStatement returns the query as recorded in db.statement, or false if the
+// query is not recorded.
+func (h *OpenTelemetryHook) recordedStatement(query string) (string, bool) {
+	switch h.statementCapture() {
+	case StatementCaptureFull:
+		return query, true
+	case StatementCaptureNormalized:
+		return normalizeQuery(query), true
+	case StatementCaptureHashed:
+		salt := h.StatementSalt
+		if len(salt) == 0 {
+			salt = processSalt
+		}
+		return hashLiterals(query, salt), true
+	}
+	return "", false
+}
+
+// truncate returns s limited to n bytes without splitting a multi-byte
+// character. Invalid UTF-8 sequences are replaced, so the result is always
+// valid UTF-8. A negative n yields an empty string.
+func truncate(s string, n int) string {
+	if n < 0 {
+		n = 0
+	}
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "\uFFFD")
+	}
+	if len(s) > n {
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	return s
+}
+
+// capQuery returns the query limited to about n bytes. A string literal cut
+// in half is dropped, so redaction still recognizes the literals that are
+// kept.
+func capQuery(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	b = b[:n]
+
+	open := -1
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] != '\'':
+		case open < 0:
+			open = i
+		case i+1 == len(b):
+			// The quote may be the first of an escaped quote.
+		case b[i+1] == '\'':
+			i++
+		default:
+			open = -1
+		}
+	}
+	if open >= 0 {
+		b = b[:open]
+	}
+	return string(b)
+}
@@ -0,0 +1,41 @@
+package pgext
+
+import "sync"
+
+// overflowValue replaces label values over the cardinality limit.
+const overflowValue = "other"
+
+// cardinalityLimiter caps the number of distinct values of a metric label.
+// The first max values seen are kept and the rest are reported as "other".
+type cardinalityLimiter struct {
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+func (l *cardinalityLimiter) value(v string, max int) string {
+	l.mu.RLock()
+	_, ok := l.seen[v]
+	n := len(l.seen)
+	l.mu.RUnlock()
+	if ok {
+		return v
+	}
+	if n >= max {
+		return overflowValue
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen == nil {
+		l.seen = make(map[string]struct{})
+	}
+	if _, ok := l.seen[v]; ok {
+		return v
+	}
+	if len(l.seen) >= max {
+		return overflowValue
+	}
+	l.seen[v] = struct{}{}
+	return v
+}
@@ -0,0 +1,19 @@
+package pgext
+
+import "testing"
+
+func TestCardinalityLimiter(t *testing.T) {
+	var l cardinalityLimiter
+
+	for _, v := range []string{"a", "b", "a"} {
+		if got := l.value(v, 2); got != v {
+			t.Errorf("got %q, want %q", got, v)
+		}
+	}
+	if got := l.value("c", 2); got != overflowValue {
+		t.Errorf("got %q, want %q", got, overflowValue)
+	}
+	if got := l.value("b", 2); got != "b" {
+		t.Errorf("got %q, want b", got)
+	}
+}
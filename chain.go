@@ -0,0 +1,156 @@
+package pgext
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"sync"
+	"time"
+)
+
+// AuditAnchor is the head of an audit hash chain. Anchors stored outside of
+// the audit log, e.g. in a ticket or a WORM bucket, prove that no entry up to
+// the sequence was modified or removed afterwards.
+type AuditAnchor struct {
+	Time     time.Time `json:"time"`
+	Sequence uint64    `json:"seq"`
+	Hash     string    `json:"hash"`
+}
+
+// ChainSink is an AuditSink that links events into a tamper-evident hash
+// chain before passing them to the sink: every event carries a sequence
+// number, the hash of the previous event and its own hash. Modifying,
+// inserting or removing an event breaks the chain, which VerifyAuditChain
+// detects.
+//
+//   audit := &pgext.AuditHook{Sink: &pgext.ChainSink{
+//       Sink:        sink,
+//       Key:         key,
+//       AnchorEvery: 1000,
+//       Anchor:      storeAnchor,
+//   }}
+type ChainSink struct {
+	Sink AuditSink
+	// Key, if set, makes the hashes HMACs, so the chain can not be rebuilt
+	// without the key after it has been modified.
+	Key []byte
+	// AnchorEvery is the number of events between anchors. Zero only emits
+	// an anchor on Shutdown.
+	AnchorEvery uint64
+	// Anchor receives the anchors. Defaults to logging them.
+	Anchor func(ctx context.Context, anchor AuditAnchor)
+	// Logger is used by the default Anchor. Defaults to the standard logger.
+	Logger *log.Logger
+
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+}
+
+var (
+	_ AuditSink  = (*ChainSink)(nil)
+	_ Shutdowner = (*ChainSink)(nil)
+)
+
+func (s *ChainSink) Write(ctx context.Context, evt *AuditEvent) error {
+	s.mu.Lock()
+	s.seq++
+	evt.Sequence, evt.PrevHash = s.seq, s.prev
+	h, err := chainHash(evt, s.Key)
+	if err != nil {
+		s.seq--
+		s.mu.Unlock()
+		return err
+	}
+	evt.Hash, s.prev = h, h
+
+	anchor := s.AnchorEvery > 0 && s.seq%s.AnchorEvery == 0
+	// Events are written under the lock, so the sink sees them in chain
+	// order.
+	err = s.Sink.Write(ctx, evt)
+	s.mu.Unlock()
+
+	if anchor {
+		s.anchor(ctx, AuditAnchor{Time: evt.Time, Sequence: evt.Sequence, Hash: evt.Hash})
+	}
+	return err
+}
+
+func (s *ChainSink) anchor(ctx context.Context, anchor AuditAnchor) {
+	if s.Anchor != nil {
+		s.Anchor(ctx, anchor)
+		return
+	}
+	logf(s.Logger, "pgext: audit chain anchor seq=%d hash=%s", anchor.Sequence, anchor.Hash)
+}
+
+// Shutdown emits the final anchor and shuts down the sink if it implements
+// Shutdowner.
+func (s *ChainSink) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	seq, prev := s.seq, s.prev
+	s.mu.Unlock()
+
+	if seq > 0 {
+		s.anchor(ctx, AuditAnchor{Time: time.Now(), Sequence: seq, Hash: prev})
+	}
+	if sd, ok := s.Sink.(Shutdowner); ok {
+		return sd.Shutdown(ctx)
+	}
+	return nil
+}
+
+// chainHash returns the hash of the event without its Hash field.
+func chainHash(evt *AuditEvent, key []byte) (string, error) {
+	e := *evt
+	e.Hash = ""
+	b, err := json.Marshal(&e)
+	if err != nil {
+		return "", err
+	}
+
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	_, _ = h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyAuditChain checks that the events, e.g. read back from an audit log,
+// form an unbroken chain written by ChainSink with the key. anchor, if not
+// nil, must match the event with its sequence number.
+func VerifyAuditChain(events []*AuditEvent, key []byte, anchor *AuditAnchor) error {
+	var prev *AuditEvent
+	anchored := anchor == nil
+	for _, evt := range events {
+		if prev != nil && (evt.Sequence != prev.Sequence+1 || evt.PrevHash != prev.Hash) {
+			return fmt.Errorf("pgext: audit chain broken between seq %d and %d", prev.Sequence, evt.Sequence)
+		}
+		h, err := chainHash(evt, key)
+		if err != nil {
+			return err
+		}
+		if h != evt.Hash {
+			return fmt.Errorf("pgext: audit event seq %d was modified", evt.Sequence)
+		}
+		if anchor != nil && evt.Sequence == anchor.Sequence {
+			if evt.Hash != anchor.Hash {
+				return fmt.Errorf("pgext: audit event seq %d does not match the anchor", evt.Sequence)
+			}
+			anchored = true
+		}
+		prev = evt
+	}
+	if !anchored {
+		return fmt.Errorf("pgext: audit events do not contain anchor seq %d", anchor.Sequence)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package pgext
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestChainSink(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("secret")
+
+	var sink auditRecorder
+	var anchors []AuditAnchor
+	chain := &ChainSink{
+		Sink:        &sink,
+		Key:         key,
+		AnchorEvery: 2,
+		Anchor: func(_ context.Context, a AuditAnchor) {
+			anchors = append(anchors, a)
+		},
+	}
+	for i := 0; i < 3; i++ {
+		evt := &AuditEvent{Time: time.Now(), Operation: "DELETE", Table: "payments", Rows: i}
+		if err := chain.Write(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := chain.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(anchors) != 2 || anchors[0].Sequence != 2 || anchors[1].Sequence != 3 {
+		t.Fatalf("got anchors %+v", anchors)
+	}
+
+	// Round trip through JSON like an audit log does.
+	events := make([]*AuditEvent, len(sink))
+	for i, evt := range sink {
+		b, err := json.Marshal(evt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[i] = new(AuditEvent)
+		if err := json.Unmarshal(b, events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := VerifyAuditChain(events, key, &anchors[1]); err != nil {
+		t.Fatalf("valid chain: %s", err)
+	}
+
+	events[1].Rows = 100
+	if err := VerifyAuditChain(events, key, nil); err == nil {
+		t.Errorf("modified event is not detected")
+	}
+	events[1].Rows = 1
+
+	if err := VerifyAuditChain([]*AuditEvent{events[0], events[2]}, key, nil); err == nil {
+		t.Errorf("removed event is not detected")
+	}
+	if err := VerifyAuditChain(events, []byte("other"), nil); err == nil {
+		t.Errorf("wrong key is not detected")
+	}
+}
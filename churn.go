@@ -0,0 +1,130 @@
+package pgext
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	connOpenedCounter, _ = meter.NewInt64Counter(
+		"go.sql.conn.opened",
+		metric.WithDescription("The number of opened connections"),
+	)
+	connClosedCounter, _ = meter.NewInt64Counter(
+		"go.sql.conn.closed",
+		metric.WithDescription("The number of closed connections"),
+	)
+	connDialErrorCounter, _ = meter.NewInt64Counter(
+		"go.sql.conn.dial_errors",
+		metric.WithDescription("The number of failed attempts to open a connection"),
+	)
+)
+
+// ConnectionStats are the connections opened and closed by a database.
+type ConnectionStats struct {
+	Opened     int64
+	Closed     int64
+	DialErrors int64
+	// Recycled is the number of stale connections closed by the pool, e.g.
+	// because they exceeded MaxConnAge or IdleTimeout.
+	Recycled int64
+}
+
+// ConnectionTracker counts the connections a database opens and closes as
+// go.sql.conn.opened, go.sql.conn.closed and go.sql.conn.dial_errors, and
+// the stale connections recycled by the pool as go.sql.conn.recycled, all
+// labeled by sql.instance. Churn, e.g. from a short MaxConnAge or a flapping
+// network, shows up directly:
+//
+//   t := &pgext.ConnectionTracker{}
+//   t.Apply(opt)
+//   db := pg.Connect(opt)
+//   t.Observe(db)
+//
+// Apply it after other dialers, e.g. AuthTokenDialer, which it wraps.
+type ConnectionTracker struct {
+	opened     int64
+	closed     int64
+	dialErrors int64
+
+	labels []label.KeyValue
+	db     atomic.Value
+}
+
+// Apply makes opt count the connections it dials. Metrics are labeled with
+// the database name.
+func (t *ConnectionTracker) Apply(opt *pg.Options) {
+	if len(opt.Database) > 0 {
+		t.labels = []label.KeyValue{instanceKey.String(opt.Database)}
+	}
+
+	dial := opt.Dialer
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	opt.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		cn, err := dial(ctx, network, addr)
+		if err != nil {
+			atomic.AddInt64(&t.dialErrors, 1)
+			connDialErrorCounter.Add(ctx, 1, t.labels...)
+			return nil, err
+		}
+		atomic.AddInt64(&t.opened, 1)
+		connOpenedCounter.Add(ctx, 1, t.labels...)
+		return &trackedConn{Conn: cn, tracker: t}, nil
+	}
+}
+
+// Observe reports the stale connections recycled by the pool of the
+// database.
+func (t *ConnectionTracker) Observe(db *pg.DB) {
+	t.db.Store(db)
+	_, _ = meter.NewInt64SumObserver("go.sql.conn.recycled",
+		func(_ context.Context, result metric.Int64ObserverResult) {
+			result.Observe(t.recycled(), t.labels...)
+		},
+		metric.WithDescription("The number of stale connections recycled by the pool"),
+	)
+}
+
+func (t *ConnectionTracker) recycled() int64 {
+	db, ok := t.db.Load().(*pg.DB)
+	if !ok {
+		return 0
+	}
+	if stats := db.PoolStats(); stats != nil {
+		return int64(stats.StaleConns)
+	}
+	return 0
+}
+
+// Stats returns the connections opened and closed so far.
+func (t *ConnectionTracker) Stats() ConnectionStats {
+	return ConnectionStats{
+		Opened:     atomic.LoadInt64(&t.opened),
+		Closed:     atomic.LoadInt64(&t.closed),
+		DialErrors: atomic.LoadInt64(&t.dialErrors),
+		Recycled:   t.recycled(),
+	}
+}
+
+// trackedConn counts its first Close.
+type trackedConn struct {
+	net.Conn
+	tracker *ConnectionTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.tracker.closed, 1)
+		connClosedCounter.Add(context.Background(), 1, c.tracker.labels...)
+	})
+	return c.Conn.Close()
+}
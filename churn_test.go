@@ -0,0 +1,52 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestConnectionTracker(t *testing.T) {
+	errDial := errors.New("dial failed")
+	var fail bool
+	opt := &pg.Options{
+		Database: "app",
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if fail {
+				return nil, errDial
+			}
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		},
+	}
+	tracker := &ConnectionTracker{}
+	tracker.Apply(opt)
+	tracker.Observe(pg.Connect(opt))
+
+	ctx := context.Background()
+	cn1, err := opt.Dialer(ctx, "tcp", "localhost:5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn2, err := opt.Dialer(ctx, "tcp", "localhost:5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn2.Close()
+	fail = true
+	if _, err := opt.Dialer(ctx, "tcp", "localhost:5432"); err != errDial {
+		t.Errorf("got error %v, want the dial error", err)
+	}
+
+	cn1.Close()
+	cn1.Close()
+
+	got := tracker.Stats()
+	if got.Opened != 2 || got.Closed != 1 || got.DialErrors != 1 {
+		t.Errorf("got %+v, want 2 opened, 1 closed and 1 dial error", got)
+	}
+}
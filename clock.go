@@ -0,0 +1,18 @@
+package pgext
+
+import "time"
+
+// Clock tells the current time. Hooks use it to measure query latency, so
+// tests can control time instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// since returns the time elapsed since start according to the clock or the
+// system clock if it is nil.
+func since(clock Clock, start time.Time) time.Duration {
+	if clock == nil {
+		return time.Since(start)
+	}
+	return clock.Now().Sub(start)
+}
@@ -0,0 +1,83 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// poller calls collect in the background every interval until it is shut
+// down. It is shared by the collectors that sample catalog views.
+type poller struct {
+	once   sync.Once
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	onStop []func()
+}
+
+// start reports whether the poller was started by this call.
+func (p *poller) start(interval time.Duration, collect func(ctx context.Context)) bool {
+	var started bool
+	p.once.Do(func() {
+		started = true
+		if interval <= 0 {
+			interval = time.Minute
+		}
+
+		var ctx context.Context
+		ctx, p.cancel = context.WithCancel(context.Background())
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				collect(ctx)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+	return started
+}
+
+// onShutdown registers fn, e.g. to stop reporting metrics, to be called on
+// shutdown.
+func (p *poller) onShutdown(fn func()) {
+	p.mu.Lock()
+	p.onStop = append(p.onStop, fn)
+	p.mu.Unlock()
+}
+
+func (p *poller) shutdown(ctx context.Context) error {
+	p.once.Do(func() {})
+	if p.cancel != nil {
+		p.cancel()
+	}
+
+	p.mu.Lock()
+	fns := p.onStop
+	p.onStop = nil
+	p.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+	return waitGroup(ctx, &p.wg)
+}
+
+func logf(logger *log.Logger, format string, args ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
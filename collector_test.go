@@ -0,0 +1,87 @@
+package pgext
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestPoller(t *testing.T) {
+	var p poller
+	var n int32
+	collect := func(context.Context) { atomic.AddInt32(&n, 1) }
+
+	if !p.start(time.Millisecond, collect) {
+		t.Fatal("poller is not started")
+	}
+	if p.start(time.Millisecond, collect) {
+		t.Fatal("poller is started twice")
+	}
+
+	for atomic.LoadInt32(&n) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	collected := atomic.LoadInt32(&n)
+	time.Sleep(5 * time.Millisecond)
+	if atomic.LoadInt32(&n) != collected {
+		t.Error("poller collects after shutdown")
+	}
+}
+
+// testCollectorMetrics starts a collector with the instances a and b, and
+// checks both report the metric with the labels until they are shut down.
+// start returns the started collector and whether it collected a sample.
+func testCollectorMetrics(t *testing.T, name string, labels map[string]string,
+	start func(instance string) (c Shutdowner, collected func() bool)) {
+	t.Helper()
+
+	mr := pgexttest.RecordMetrics(t)
+	ctx := context.Background()
+	started := func(instance string) Shutdowner {
+		c, collected := start(instance)
+		// Shutdown cancels a running sample, which the fake server does not
+		// support.
+		deadline := time.Now().Add(time.Second)
+		for !collected() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: no sample was collected", instance)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return c
+	}
+	a, b := started("collector-a"), started("collector-b")
+	defer b.Shutdown(ctx)
+
+	opts := func(instance string) []pgexttest.MetricOption {
+		opts := []pgexttest.MetricOption{
+			pgexttest.WithMetricName(name),
+			pgexttest.WithLabel("sql.instance", instance),
+		}
+		for k, v := range labels {
+			opts = append(opts, pgexttest.WithLabel(k, v))
+		}
+		return opts
+	}
+
+	mr.Observe(ctx)
+	pgexttest.AssertMeasurement(t, mr.Measurements(), opts("collector-a")...)
+	pgexttest.AssertMeasurement(t, mr.Measurements(), opts("collector-b")...)
+
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mr = pgexttest.RecordMetrics(t)
+	mr.Observe(ctx)
+	if _, ok := pgexttest.FindMeasurement(mr.Measurements(), opts("collector-a")...); ok {
+		t.Errorf("%s: got the collector reported after its shutdown", name)
+	}
+	pgexttest.AssertMeasurement(t, mr.Measurements(), opts("collector-b")...)
+}
@@ -0,0 +1,157 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// Commenter renders the sqlcommenter key set, e.g.
+//
+//   /*application='orders',controller='checkout',db_driver='go-pg',
+//     framework='gin',route='%2Fcheckout',traceparent='00-...-01'*/
+//
+// which Cloud SQL Insights and other tools parse from pg_stat_activity and
+// server logs. go-pg formats queries before hooks run, so the comment is
+// added by the caller:
+//
+//   c := &pgext.Commenter{Application: "orders", Framework: "gin", Route: routeFromContext}
+//   _, err := db.ExecContext(ctx, c.Apply(ctx, `UPDATE orders SET ...`))
+type Commenter struct {
+	Application string
+	Framework   string
+	// DBDriver defaults to go-pg.
+	DBDriver string
+	// Route, Controller and Action, if set, extract the values from the
+	// query context. Empty values are skipped.
+	Route      func(context.Context) string
+	Controller func(context.Context) string
+	Action     func(context.Context) string
+	// BaggageKeys lists OpenTelemetry baggage entries added to the comment.
+	BaggageKeys []label.Key
+	// MaxLength, if set, limits the length of the comment. Baggage entries
+	// are dropped first, then action, controller, framework, route,
+	// db_driver and application. traceparent is dropped last.
+	MaxLength int
+}
+
+// commentDropOrder lists the keys in the order they are dropped to fit
+// MaxLength, after baggage entries.
+var commentDropOrder = []string{
+	"action", "controller", "framework", "route", "db_driver", "application", "traceparent",
+}
+
+// Comment returns the comment for the query context.
+func (c *Commenter) Comment(ctx context.Context) string {
+	kvs := make(map[string]string, 8)
+	add := func(k, v string) {
+		if v != "" {
+			kvs[k] = v
+		}
+	}
+	extract := func(k string, fn func(context.Context) string) {
+		if fn != nil {
+			add(k, fn(ctx))
+		}
+	}
+
+	add("application", c.Application)
+	add("framework", c.Framework)
+	if c.DBDriver != "" {
+		add("db_driver", c.DBDriver)
+	} else {
+		add("db_driver", "go-pg")
+	}
+	extract("route", c.Route)
+	extract("controller", c.Controller)
+	extract("action", c.Action)
+	add("traceparent", traceparent(trace.SpanFromContext(ctx).SpanContext()))
+	baggage := baggageAttributes(ctx, c.BaggageKeys)
+	for _, kv := range baggage {
+		add(string(kv.Key), kv.Value.Emit())
+	}
+
+	comment := sqlComment(kvs)
+	if c.MaxLength <= 0 {
+		return comment
+	}
+	for i := len(baggage) - 1; i >= 0 && len(comment) > c.MaxLength; i-- {
+		delete(kvs, string(baggage[i].Key))
+		comment = sqlComment(kvs)
+	}
+	for _, k := range commentDropOrder {
+		if len(comment) <= c.MaxLength {
+			break
+		}
+		delete(kvs, k)
+		comment = sqlComment(kvs)
+	}
+	return comment
+}
+
+// ContextAttributes returns the route, controller and action extractors
+// keyed by their sqlcommenter names, so spans carry the same tags as the
+// comments. Use it as OpenTelemetryHook.ContextAttributes.
+func (c *Commenter) ContextAttributes() map[label.Key]func(context.Context) string {
+	attrs := make(map[label.Key]func(context.Context) string, 3)
+	if c.Route != nil {
+		attrs["route"] = c.Route
+	}
+	if c.Controller != nil {
+		attrs["controller"] = c.Controller
+	}
+	if c.Action != nil {
+		attrs["action"] = c.Action
+	}
+	return attrs
+}
+
+// Apply returns the query with the comment appended.
+func (c *Commenter) Apply(ctx context.Context, query string) string {
+	comment := c.Comment(ctx)
+	if comment == "" {
+		return query
+	}
+	return strings.TrimRight(query, "; \t\n") + " " + comment
+}
+
+// traceparent returns the W3C traceparent header of the span context.
+func traceparent(sc trace.SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.TraceFlags&trace.FlagsSampled)
+}
+
+// sqlComment renders the key-values as an sqlcommenter comment: keys sorted,
+// keys and values URL encoded and values quoted. Escaping keeps quotes and
+// the comment terminator out of the comment.
+func sqlComment(kvs map[string]string) string {
+	if len(kvs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("/*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(url.PathEscape(k))
+		b.WriteString("='")
+		b.WriteString(url.PathEscape(kvs[k]))
+		b.WriteByte('\'')
+	}
+	b.WriteString("*/")
+	return b.String()
+}
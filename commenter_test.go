@@ -0,0 +1,57 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+func TestCommenter(t *testing.T) {
+	c := &Commenter{
+		Application: "orders",
+		Framework:   "gin",
+		Route:       func(context.Context) string { return "/orders/:id" },
+		Controller:  func(context.Context) string { return "" },
+	}
+
+	got := c.Apply(context.Background(), "SELECT 1;")
+	want := `SELECT 1 /*application='orders',db_driver='go-pg',framework='gin',route='%2Forders%2F:id'*/`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	sc := trace.SpanContext{
+		TraceID:    trace.ID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	}
+	if got, want := traceparent(sc), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := traceparent(trace.SpanContext{}); got != "" {
+		t.Errorf("got %q for an invalid span context", got)
+	}
+}
+
+func TestCommenterMaxLength(t *testing.T) {
+	c := &Commenter{
+		Application: "orders",
+		Framework:   "gin",
+		Action:      func(context.Context) string { return "create" },
+		MaxLength:   50,
+	}
+
+	got := c.Comment(context.Background())
+	want := `/*application='orders',db_driver='go-pg'*/`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	c.MaxLength = 5
+	if got := c.Comment(context.Background()); got != "" {
+		t.Errorf("got %q, want no comment", got)
+	}
+}
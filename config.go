@@ -0,0 +1,275 @@
+package pgext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the instrumentation policy that can be loaded from a JSON or
+// YAML file and applied to a running OpenTelemetryHook. Every field is
+// optional: unset fields keep the current settings of the hook, and an empty
+// ignore list clears the previous one.
+//
+//   {
+//       "tracing": true,
+//       "metrics": true,
+//       "statement": "normalized",
+//       "slow_query": "500ms",
+//       "sample_rate": 0.1,
+//       "ignore": ["^SELECT 1$"],
+//       "redact": {"columns": ["email"], "patterns": ["\\d{4}-\\d{4}"]},
+//       "attributes": {"deny": ["db.user", "frame.*"]}
+//   }
+type Config struct {
+	// Tracing turns query spans on or off.
+	Tracing *bool `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	// Metrics turns latency metrics on or off.
+	Metrics *bool `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	// Statement is the statement capture mode: full, normalized, hashed or
+	// none.
+	Statement string `json:"statement,omitempty" yaml:"statement,omitempty"`
+	// SlowQuery is the slow query threshold, e.g. "500ms".
+	SlowQuery string `json:"slow_query,omitempty" yaml:"slow_query,omitempty"`
+	// SampleRate is the fraction of queries that get a span.
+	SampleRate *float64 `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+	// Ignore lists regular expressions of queries that never get a span.
+	Ignore []string `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+	// Redact configures a Redactor masking the statements of the hook, on
+	// top of the Redactor set by SetRedactor. An empty one turns it off.
+	Redact *RedactConfig `json:"redact,omitempty" yaml:"redact,omitempty"`
+	// Attributes filters the span attributes and metric labels of the hook,
+	// on top of the filter set by SetAttributeFilter.
+	Attributes *AttributeFilter `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+// RedactConfig is the Redactor of a Config.
+type RedactConfig struct {
+	// Columns lists column names whose values are masked.
+	Columns []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	// Patterns lists regular expressions whose matches are masked.
+	Patterns []string `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+	// Secrets masks secrets found by DefaultSecretDetectors.
+	Secrets bool `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	// Mask replaces the redacted values. Defaults to '?'.
+	Mask string `json:"mask,omitempty" yaml:"mask,omitempty"`
+}
+
+// LoadConfig reads the config from a JSON file, or from a YAML file if its
+// extension is .yaml or .yml.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(Config)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, cfg)
+	default:
+		err = json.Unmarshal(b, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pgext: invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ApplyConfig applies the set fields of the config to the hook. It is safe
+// to call while the hook is in use. Nothing is changed if the config is
+// invalid.
+func (h *OpenTelemetryHook) ApplyConfig(cfg *Config) error {
+	dyn := new(dynamicConfig)
+	*dyn = *h.config()
+
+	var mode StatementCapture
+	if cfg.Statement != "" {
+		var err error
+		if mode, err = ParseStatementCapture(cfg.Statement); err != nil {
+			return fmt.Errorf("pgext: invalid statement: %w", err)
+		}
+	}
+
+	if cfg.SlowQuery != "" {
+		d, err := time.ParseDuration(cfg.SlowQuery)
+		if err != nil {
+			return fmt.Errorf("pgext: invalid slow_query: %w", err)
+		}
+		dyn.slowQuery = d
+	}
+
+	if cfg.SampleRate != nil {
+		if *cfg.SampleRate < 0 || *cfg.SampleRate > 1 {
+			return fmt.Errorf("pgext: invalid sample_rate %v", *cfg.SampleRate)
+		}
+		dyn.sampleRate = *cfg.SampleRate
+	}
+
+	if cfg.Ignore != nil {
+		dyn.ignore = nil
+		for _, s := range cfg.Ignore {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return fmt.Errorf("pgext: invalid ignore: %w", err)
+			}
+			dyn.ignore = append(dyn.ignore, re)
+		}
+	}
+
+	if cfg.Redact != nil {
+		r := &Redactor{Columns: cfg.Redact.Columns, Secrets: cfg.Redact.Secrets, Mask: cfg.Redact.Mask}
+		for _, s := range cfg.Redact.Patterns {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return fmt.Errorf("pgext: invalid redact pattern: %w", err)
+			}
+			r.Patterns = append(r.Patterns, re)
+		}
+		dyn.redactor = r
+	}
+
+	if cfg.Attributes != nil {
+		dyn.attributes = cfg.Attributes
+	}
+
+	if cfg.Tracing != nil {
+		h.SetTracingEnabled(*cfg.Tracing)
+	}
+	if cfg.Metrics != nil {
+		h.SetMetricsEnabled(*cfg.Metrics)
+	}
+	if cfg.Statement != "" {
+		h.SetStatementCapture(mode)
+	}
+	h.dynamic.Store(dyn)
+
+	return nil
+}
+
+// ConfigPollInterval is how often WatchConfig checks the config file.
+var ConfigPollInterval = 10 * time.Second
+
+// WatchConfig applies the config file to the hook and then reapplies it every
+// time the file changes until ctx is done. Errors after the first load are
+// logged and keep the previous config. Like ApplyConfig, a field removed from
+// the file keeps its last applied value.
+//
+//   if err := pgext.WatchConfig(ctx, "/etc/pgext.json", hook); err != nil {
+//       return err
+//   }
+func WatchConfig(ctx context.Context, path string, hook *OpenTelemetryHook) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := applyConfigFile(path, hook); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(ConfigPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			next, err := os.Stat(path)
+			if err != nil {
+				log.Printf("pgext: config %s: %s", path, err)
+				continue
+			}
+			if next.ModTime().Equal(stat.ModTime()) && next.Size() == stat.Size() {
+				continue
+			}
+			stat = next
+
+			if err := applyConfigFile(path, hook); err != nil {
+				log.Printf("pgext: config %s: %s", path, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func applyConfigFile(path string, hook *OpenTelemetryHook) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return hook.ApplyConfig(cfg)
+}
+
+// dynamicConfig is the part of Config that has no counterpart among the
+// exported fields of OpenTelemetryHook.
+type dynamicConfig struct {
+	slowQuery  time.Duration
+	sampleRate float64
+	ignore     []*regexp.Regexp
+	redactor   *Redactor
+	attributes *AttributeFilter
+}
+
+var defaultDynamicConfig = &dynamicConfig{sampleRate: 1}
+
+// SetTracingEnabled turns query spans on or off while the hook is installed.
+// Tracing is enabled by default.
+func (h *OpenTelemetryHook) SetTracingEnabled(enabled bool) {
+	var off int32
+	if !enabled {
+		off = 1
+	}
+	atomic.StoreInt32(&h.tracingOff, off)
+}
+
+// SetMetricsEnabled overrides AllowMetric while the hook is installed.
+func (h *OpenTelemetryHook) SetMetricsEnabled(enabled bool) {
+	v := int32(2)
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&h.metrics, v)
+}
+
+func (h *OpenTelemetryHook) tracingEnabled() bool {
+	return atomic.LoadInt32(&h.tracingOff) == 0
+}
+
+func (h *OpenTelemetryHook) metricsEnabled() bool {
+	switch atomic.LoadInt32(&h.metrics) {
+	case 1:
+		return true
+	case 2:
+		return false
+	}
+	return h.AllowMetric
+}
+
+func (h *OpenTelemetryHook) config() *dynamicConfig {
+	if cfg, ok := h.dynamic.Load().(*dynamicConfig); ok {
+		return cfg
+	}
+	return defaultDynamicConfig
+}
+
+func (h *OpenTelemetryHook) slowQueryThreshold() time.Duration {
+	if d := h.config().slowQuery; d != 0 {
+		return d
+	}
+	return h.SlowQueryThreshold
+}
@@ -0,0 +1,155 @@
+package pgext
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pgext.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"tracing": false,
+		"metrics": true,
+		"statement": "none",
+		"slow_query": "1s",
+		"sample_rate": 0.5,
+		"ignore": ["^SELECT 1$"],
+		"redact": {"columns": ["email"], "patterns": ["'[^']*@[^']*'"]}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := new(OpenTelemetryHook)
+	if err := h.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if h.tracingEnabled() || !h.metricsEnabled() || h.statementCapture() != StatementCaptureNone {
+		t.Errorf("toggles are not applied")
+	}
+	if h.slowQueryThreshold() != time.Second {
+		t.Errorf("got slow query threshold %s, want 1s", h.slowQueryThreshold())
+	}
+	dyn := h.config()
+	if dyn.sampleRate != 0.5 || len(dyn.ignore) != 1 || dyn.redactor == nil {
+		t.Errorf("got %+v", dyn)
+	}
+	if got, want := dyn.redactor.Redact("SELECT 'a@b.c' WHERE email = 'x'"), "SELECT ? WHERE email = ?"; got != want {
+		t.Errorf("got redacted %q, want %q", got, want)
+	}
+
+	cfg.Redact.Patterns = []string{"("}
+	if err := h.ApplyConfig(cfg); err == nil {
+		t.Errorf("invalid config is applied")
+	}
+	if h.config() != dyn {
+		t.Errorf("invalid config replaced the previous one")
+	}
+}
+
+func TestApplyConfigKeepsUnsetFields(t *testing.T) {
+	h := new(OpenTelemetryHook)
+	rate := 0.5
+	if err := h.ApplyConfig(&Config{
+		SlowQuery:  "1s",
+		SampleRate: &rate,
+		Ignore:     []string{"^SELECT 1$"},
+		Redact:     &RedactConfig{Columns: []string{"email"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rate = 0.1
+	if err := h.ApplyConfig(&Config{SampleRate: &rate}); err != nil {
+		t.Fatal(err)
+	}
+	dyn := h.config()
+	if dyn.sampleRate != 0.1 {
+		t.Errorf("got sample rate %v, want 0.1", dyn.sampleRate)
+	}
+	if dyn.slowQuery != time.Second || len(dyn.ignore) != 1 || dyn.redactor == nil {
+		t.Errorf("got %+v, want the unset fields kept", dyn)
+	}
+
+	if err := h.ApplyConfig(&Config{Ignore: []string{}, Redact: &RedactConfig{}}); err != nil {
+		t.Fatal(err)
+	}
+	dyn = h.config()
+	if len(dyn.ignore) != 0 {
+		t.Errorf("got ignore %v, want it cleared", dyn.ignore)
+	}
+	if got := dyn.redactor.Redact("SELECT 1 WHERE email = 'x'"); got != "SELECT 1 WHERE email = 'x'" {
+		t.Errorf("got redacted %q, want redaction turned off", got)
+	}
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pgext.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+tracing: false
+slow_query: 500ms
+sample_rate: 0.25
+ignore: []
+redact:
+  columns: [password]
+  secrets: true
+attributes:
+  deny: [db.user]
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tracing == nil || *cfg.Tracing || cfg.SlowQuery != "500ms" ||
+		cfg.SampleRate == nil || *cfg.SampleRate != 0.25 || cfg.Ignore == nil {
+		t.Errorf("got %+v", cfg)
+	}
+	if cfg.Redact == nil || len(cfg.Redact.Columns) != 1 || !cfg.Redact.Secrets {
+		t.Errorf("got redact %+v", cfg.Redact)
+	}
+	if cfg.Attributes == nil || len(cfg.Attributes.Deny) != 1 {
+		t.Errorf("got attributes %+v", cfg.Attributes)
+	}
+}
+
+func TestApplyConfigAttributes(t *testing.T) {
+	h := new(OpenTelemetryHook)
+	if err := h.ApplyConfig(&Config{Attributes: &AttributeFilter{Deny: []string{"db.user"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs := []label.KeyValue{label.String("db.user", "app")}
+	if got := h.filterAttributes(kvs); len(got) != 0 {
+		t.Errorf("got %v, want db.user removed", got)
+	}
+	if got := new(OpenTelemetryHook).filterAttributes(kvs); len(got) != 1 {
+		t.Errorf("got %v, want the attributes of other hooks kept", got)
+	}
+}
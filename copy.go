@@ -0,0 +1,138 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+// copyProgressInterval is the time between the progress events of CopyFrom.
+const copyProgressInterval = 10 * time.Second
+
+// copies holds the running copies of CopyFrom for the progress gauges.
+var copies sync.Map
+
+func init() {
+	var rows, size metric.Int64ValueObserver
+	batch := meter.NewBatchObserver(func(_ context.Context, result metric.BatchObserverResult) {
+		copies.Range(func(key, _ interface{}) bool {
+			r := key.(*copyReader)
+			result.Observe([]label.KeyValue{tableKey.String(r.table)},
+				rows.Observation(atomic.LoadInt64(&r.rows)),
+				size.Observation(atomic.LoadInt64(&r.bytes)),
+			)
+			return true
+		})
+	})
+	rows, _ = batch.NewInt64ValueObserver("go.sql.copy.rows",
+		metric.WithDescription("The number of rows copied so far by running COPY FROM statements"))
+	size, _ = batch.NewInt64ValueObserver("go.sql.copy.bytes",
+		metric.WithDescription("The number of bytes copied so far by running COPY FROM statements"))
+}
+
+// copyReader counts the bytes and lines read by COPY FROM.
+type copyReader struct {
+	r     io.Reader
+	table string
+	rows  int64
+	bytes int64
+}
+
+func (r *copyReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	atomic.AddInt64(&r.bytes, int64(n))
+	atomic.AddInt64(&r.rows, int64(bytes.Count(b[:n], []byte{'\n'})))
+	return n, err
+}
+
+// copyTable returns the table of a COPY statement.
+func copyTable(query interface{}) string {
+	s, ok := query.(string)
+	if !ok {
+		return ""
+	}
+	fields := strings.Fields(s)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "COPY") {
+		return ""
+	}
+	table := fields[1]
+	if idx := strings.IndexByte(table, '('); idx >= 0 {
+		table = table[:idx]
+	}
+	return strings.Trim(table, `"`)
+}
+
+// CopyFrom runs COPY FROM with the data of r like db.CopyFrom and reports
+// its progress, so a long COPY that is progressing can be told from a hung
+// one. While it runs, the rows and bytes copied so far are reported as
+// go.sql.copy.rows and go.sql.copy.bytes labeled by sql.table, and added as
+// pgext.copy.progress events every 10s to a pgext.copy span:
+//
+//   _, err := pgext.CopyFrom(ctx, db, f, "COPY events FROM STDIN WITH (FORMAT csv)")
+//
+// Rows are counted as lines, which is exact for the text format and for CSV
+// without line breaks in values.
+func CopyFrom(ctx context.Context, db orm.DB, r io.Reader, query interface{}, params ...interface{}) (res pg.Result, err error) {
+	ctx, span := tracer.Start(ctx, "pgext.copy")
+	cr := &copyReader{r: r, table: copyTable(query)}
+	start := time.Now()
+
+	progress := func() {
+		addEvent(ctx, span, "pgext.copy.progress",
+			label.Int64("db.copy.rows", atomic.LoadInt64(&cr.rows)),
+			label.Int64("db.copy.bytes", atomic.LoadInt64(&cr.bytes)),
+			label.Int64("db.copy.elapsed_ms", time.Since(start).Milliseconds()),
+		)
+	}
+
+	copies.Store(cr, struct{}{})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(copyProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				progress()
+			}
+		}
+	}()
+
+	defer func() {
+		close(done)
+		wg.Wait()
+		copies.Delete(cr)
+
+		setAttributes(span,
+			tableKey.String(cr.table),
+			label.Int64("db.copy.rows", atomic.LoadInt64(&cr.rows)),
+			label.Int64("db.copy.bytes", atomic.LoadInt64(&cr.bytes)),
+		)
+		if err != nil {
+			span.RecordError(ctx, err, trace.WithErrorStatus(codes.Internal))
+		}
+		span.End()
+	}()
+
+	// The query span of OpenTelemetryHook becomes a child of the copy span.
+	if pdb, ok := db.(*pg.DB); ok {
+		return pdb.WithContext(ctx).CopyFrom(cr, query, params...)
+	}
+	return db.CopyFrom(cr, query, params...)
+}
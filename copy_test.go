@@ -0,0 +1,56 @@
+package pgext
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// copyDB reads the data of CopyFrom and reports the running copies.
+type copyDB struct {
+	orm.DB
+	running []*copyReader
+}
+
+func (db *copyDB) CopyFrom(r io.Reader, query interface{}, params ...interface{}) (pg.Result, error) {
+	if _, err := ioutil.ReadAll(r); err != nil {
+		return nil, err
+	}
+	copies.Range(func(key, _ interface{}) bool {
+		db.running = append(db.running, key.(*copyReader))
+		return true
+	})
+	return nil, nil
+}
+
+func TestCopyFrom(t *testing.T) {
+	db := &copyDB{}
+	data := "1,a\n2,b\n3,c\n"
+	if _, err := CopyFrom(context.Background(), db, strings.NewReader(data), `COPY "events"(id, name) FROM STDIN WITH (FORMAT csv)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.running) != 1 {
+		t.Fatalf("got %d running copies, want 1", len(db.running))
+	}
+	r := db.running[0]
+	if r.table != "events" || atomic.LoadInt64(&r.rows) != 3 || atomic.LoadInt64(&r.bytes) != int64(len(data)) {
+		t.Errorf("got table %q, %d rows and %d bytes, want events, 3 rows and %d bytes",
+			r.table, r.rows, r.bytes, len(data))
+	}
+
+	var running int
+	copies.Range(func(_, _ interface{}) bool {
+		running++
+		return true
+	})
+	if running != 0 {
+		t.Errorf("got %d running copies after the copy, want 0", running)
+	}
+}
@@ -0,0 +1,65 @@
+package pgext
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	costTeamKey    = label.Key("cost.team")
+	costServiceKey = label.Key("cost.service")
+	costFeatureKey = label.Key("cost.feature")
+)
+
+// CostTags attribute database load to the team, service and feature that own
+// it, enabling chargeback reports on a shared cluster. They are added to
+// query metrics and spans by OpenTelemetryHook.
+type CostTags struct {
+	Team    string
+	Service string
+	Feature string
+}
+
+type costTagsKey struct{}
+
+// WithCostTags returns a copy of ctx with the tags. Empty fields keep the
+// values already present in ctx, so e.g. a handler can only set Feature.
+//
+//   ctx = pgext.WithCostTags(ctx, pgext.CostTags{Feature: "checkout"})
+func WithCostTags(ctx context.Context, tags CostTags) context.Context {
+	return context.WithValue(ctx, costTagsKey{}, CostTagsFromContext(ctx).merge(tags))
+}
+
+// CostTagsFromContext returns the tags set with WithCostTags.
+func CostTagsFromContext(ctx context.Context) CostTags {
+	tags, _ := ctx.Value(costTagsKey{}).(CostTags)
+	return tags
+}
+
+// merge returns t overridden by the non-empty fields of other.
+func (t CostTags) merge(other CostTags) CostTags {
+	if other.Team != "" {
+		t.Team = other.Team
+	}
+	if other.Service != "" {
+		t.Service = other.Service
+	}
+	if other.Feature != "" {
+		t.Feature = other.Feature
+	}
+	return t
+}
+
+func (t CostTags) appendLabels(labels []label.KeyValue) []label.KeyValue {
+	if t.Team != "" {
+		labels = append(labels, costTeamKey.String(t.Team))
+	}
+	if t.Service != "" {
+		labels = append(labels, costServiceKey.String(t.Service))
+	}
+	if t.Feature != "" {
+		labels = append(labels, costFeatureKey.String(t.Feature))
+	}
+	return labels
+}
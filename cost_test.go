@@ -0,0 +1,17 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCostTags(t *testing.T) {
+	ctx := WithCostTags(context.Background(), CostTags{Team: "payments", Feature: "refund"})
+	ctx = WithCostTags(ctx, CostTags{Feature: "checkout"})
+
+	got := CostTags{Service: "api"}.merge(CostTagsFromContext(ctx))
+	want := CostTags{Team: "payments", Service: "api", Feature: "checkout"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
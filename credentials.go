@@ -0,0 +1,175 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var rotationCounter, _ = meter.NewInt64Counter(
+	"go.sql.auth.rotations",
+	metric.WithDescription("The number of database credential rotations"),
+)
+
+// Credentials are a database user and password valid until Expiry. A zero
+// Expiry never expires.
+type Credentials struct {
+	User     string
+	Password string
+	Expiry   time.Time
+}
+
+// CredentialsProvider issues database credentials, e.g. HashiCorp Vault
+// dynamic secrets implemented by the vaultcreds module.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (*Credentials, error)
+}
+
+// CredentialRotator rotates the credentials of a database before they
+// expire without restarting the application. New connections use the new
+// credentials and MaxConnAge is capped at RefreshBefore, so connections
+// opened with the old credentials are recycled before they expire:
+//
+//   r := &pgext.CredentialRotator{Provider: provider}
+//   if err := r.Apply(ctx, opt); err != nil {
+//       panic(err)
+//   }
+//   defer r.Shutdown(ctx)
+//   db := pg.Connect(opt)
+//
+// Every rotation is recorded as a pgext.credentials.rotate span and counted.
+type CredentialRotator struct {
+	Provider CredentialsProvider
+	// RefreshBefore is how long before the expiry the credentials are
+	// rotated. Defaults to 5m.
+	RefreshBefore time.Duration
+	// RetryInterval is the delay before retrying a failed rotation.
+	// Defaults to 10s.
+	RetryInterval time.Duration
+	// Logger is used to print rotation errors. Defaults to the standard
+	// logger.
+	Logger *log.Logger
+
+	mu     sync.Mutex
+	creds  *Credentials
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ Shutdowner = (*CredentialRotator)(nil)
+
+func (r *CredentialRotator) refreshBefore() time.Duration {
+	if r.RefreshBefore > 0 {
+		return r.RefreshBefore
+	}
+	return 5 * time.Minute
+}
+
+func (r *CredentialRotator) retryInterval() time.Duration {
+	if r.RetryInterval > 0 {
+		return r.RetryInterval
+	}
+	return 10 * time.Second
+}
+
+// Apply fetches the initial credentials, makes opt dial with the current
+// ones and starts rotating them in the background.
+func (r *CredentialRotator) Apply(ctx context.Context, opt *pg.Options) error {
+	if err := r.rotate(ctx); err != nil {
+		return err
+	}
+
+	creds := r.credentials()
+	opt.User, opt.Password = creds.User, creds.Password
+	if opt.MaxConnAge <= 0 || opt.MaxConnAge > r.refreshBefore() {
+		opt.MaxConnAge = r.refreshBefore()
+	}
+
+	dial := opt.Dialer
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	// go-pg reads the user and password from opt after dialing.
+	opt.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		creds := r.credentials()
+		if opt.User != creds.User || opt.Password != creds.Password {
+			opt.User, opt.Password = creds.User, creds.Password
+		}
+		return dial(ctx, network, addr)
+	}
+
+	var bg context.Context
+	bg, r.cancel = context.WithCancel(context.Background())
+	r.wg.Add(1)
+	go r.run(bg)
+	return nil
+}
+
+func (r *CredentialRotator) credentials() *Credentials {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.creds
+}
+
+func (r *CredentialRotator) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	for {
+		creds := r.credentials()
+		if creds.Expiry.IsZero() {
+			return
+		}
+		wait := time.Until(creds.Expiry) - r.refreshBefore()
+		if wait < r.retryInterval() {
+			wait = r.retryInterval()
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		if err := r.rotate(ctx); err != nil {
+			logf(r.Logger, "pgext: rotating database credentials failed: %s", err)
+		}
+	}
+}
+
+func (r *CredentialRotator) rotate(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "pgext.credentials.rotate")
+	defer span.End()
+
+	creds, err := r.Provider.Credentials(ctx)
+	if err != nil {
+		span.RecordError(ctx, err)
+		rotationCounter.Add(ctx, 1, statusErrorLabel)
+		return err
+	}
+	setAttributes(span,
+		label.String("db.user", creds.User),
+		label.String("credentials.expiry", creds.Expiry.Format(time.RFC3339)),
+	)
+	rotationCounter.Add(ctx, 1, statusOKLabel)
+
+	r.mu.Lock()
+	r.creds = creds
+	r.mu.Unlock()
+	return nil
+}
+
+// Shutdown stops rotating the credentials.
+func (r *CredentialRotator) Shutdown(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return waitGroup(ctx, &r.wg)
+}
@@ -0,0 +1,67 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+type credentialsFunc func(ctx context.Context) (*Credentials, error)
+
+func (fn credentialsFunc) Credentials(ctx context.Context) (*Credentials, error) {
+	return fn(ctx)
+}
+
+func TestCredentialRotator(t *testing.T) {
+	var n int32
+	r := &CredentialRotator{
+		Provider: credentialsFunc(func(context.Context) (*Credentials, error) {
+			i := atomic.AddInt32(&n, 1)
+			return &Credentials{
+				User:     fmt.Sprintf("v-app-%d", i),
+				Password: "secret",
+				Expiry:   time.Now().Add(time.Hour),
+			}, nil
+		}),
+		RefreshBefore: time.Hour,
+		RetryInterval: 10 * time.Millisecond,
+		Logger:        log.New(ioutil.Discard, "", 0),
+	}
+	opt := &pg.Options{
+		Dialer: func(context.Context, string, string) (net.Conn, error) {
+			cn, _ := net.Pipe()
+			return cn, nil
+		},
+	}
+	if err := r.Apply(context.Background(), opt); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Shutdown(context.Background())
+
+	if opt.User != "v-app-1" || opt.MaxConnAge != time.Hour {
+		t.Fatalf("got user %q and max conn age %s", opt.User, opt.MaxConnAge)
+	}
+
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&n) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("credentials are not rotated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cn, err := opt.Dialer(context.Background(), "tcp", "localhost:5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+	if opt.User == "v-app-1" {
+		t.Errorf("new connections use the old credentials")
+	}
+}
@@ -0,0 +1,108 @@
+package pgext
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// DB wraps a pg.DB and runs Middleware around the execution of queries.
+// Unlike MiddlewareHook, the middleware can skip or replace the execution,
+// e.g. to serve results from a cache, reject queries or run them dry:
+//
+//   db := &pgext.DB{DB: pg.Connect(opt), Middleware: pgext.Chain(guard, cache)}
+//   err := db.ModelContext(ctx, &users).Where("active").Select()
+//
+// Executed queries still run the hooks of the pg.DB. A middleware that
+// returns without calling next may set evt.Result, which is then returned
+// to the caller, and fill evt.Model. Transactions started with Begin or
+// RunInTransaction use the pg.DB directly.
+type DB struct {
+	*pg.DB
+	Middleware Middleware
+}
+
+var _ orm.DB = (*DB)(nil)
+
+type execFunc func(ctx context.Context) (pg.Result, error)
+
+func (db *DB) run(ctx context.Context, model, query interface{}, params []interface{}, exec execFunc) (pg.Result, error) {
+	if db.Middleware == nil {
+		return exec(ctx)
+	}
+
+	evt := &pg.QueryEvent{
+		StartTime: time.Now(),
+		DB:        db.DB,
+		Model:     model,
+		Query:     query,
+		Params:    params,
+		Stash:     make(map[interface{}]interface{}),
+	}
+	// Unlike with MiddlewareHook, next may be called again, e.g. to retry.
+	err := db.Middleware.Handle(ctx, evt, func(ctx context.Context) error {
+		evt.Result, evt.Err = exec(ctx)
+		return evt.Err
+	})
+	return evt.Result, err
+}
+
+func (db *DB) Model(model ...interface{}) *orm.Query {
+	return orm.NewQuery(db, model...)
+}
+
+func (db *DB) ModelContext(c context.Context, model ...interface{}) *orm.Query {
+	return orm.NewQueryContext(c, db, model...)
+}
+
+func (db *DB) Exec(query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.ExecContext(db.DB.Context(), query, params...)
+}
+
+func (db *DB) ExecContext(c context.Context, query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.run(c, nil, query, params, func(ctx context.Context) (pg.Result, error) {
+		return db.DB.ExecContext(ctx, query, params...)
+	})
+}
+
+func (db *DB) ExecOne(query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.ExecOneContext(db.DB.Context(), query, params...)
+}
+
+func (db *DB) ExecOneContext(c context.Context, query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.run(c, nil, query, params, func(ctx context.Context) (pg.Result, error) {
+		return db.DB.ExecOneContext(ctx, query, params...)
+	})
+}
+
+func (db *DB) Query(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.QueryContext(db.DB.Context(), model, query, params...)
+}
+
+func (db *DB) QueryContext(c context.Context, model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.run(c, model, query, params, func(ctx context.Context) (pg.Result, error) {
+		return db.DB.QueryContext(ctx, model, query, params...)
+	})
+}
+
+func (db *DB) QueryOne(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.QueryOneContext(db.DB.Context(), model, query, params...)
+}
+
+func (db *DB) QueryOneContext(c context.Context, model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return db.run(c, model, query, params, func(ctx context.Context) (pg.Result, error) {
+		return db.DB.QueryOneContext(ctx, model, query, params...)
+	})
+}
+
+// WithContext returns a copy of the DB that uses the context.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	return &DB{DB: db.DB.WithContext(ctx), Middleware: db.Middleware}
+}
+
+// WithTimeout returns a copy of the DB that uses the timeout for every query.
+func (db *DB) WithTimeout(d time.Duration) *DB {
+	return &DB{DB: db.DB.WithTimeout(d), Middleware: db.Middleware}
+}
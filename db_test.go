@@ -0,0 +1,60 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+type cachedResult struct{ rows int }
+
+func (r cachedResult) Model() orm.Model  { return nil }
+func (r cachedResult) RowsAffected() int { return r.rows }
+func (r cachedResult) RowsReturned() int { return r.rows }
+
+func TestDBMiddleware(t *testing.T) {
+	errDryRun := errors.New("dry run")
+	var executed int
+	var served int32
+	db := &DB{
+		DB: fakeDB(t, func(string) fakeResult {
+			atomic.AddInt32(&served, 1)
+			return fakeResult{}
+		}),
+		Middleware: MiddlewareFunc(func(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+			switch evt.Query {
+			case "SELECT cached":
+				evt.Result = cachedResult{rows: 3}
+				return nil
+			case "DELETE FROM users":
+				return errDryRun
+			}
+			executed++
+			return next(ctx)
+		}),
+	}
+	ctx := context.Background()
+
+	res, err := db.QueryContext(ctx, nil, "SELECT cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.RowsReturned() != 3 {
+		t.Errorf("got result %v, want the cached result", res)
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM users"); err != errDryRun {
+		t.Errorf("got error %v, want dry run", err)
+	}
+
+	if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&served); executed != 1 || n != 1 {
+		t.Errorf("executed %d queries, served %d, want 1", executed, n)
+	}
+}
@@ -0,0 +1,94 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// isDDL reports whether the statement starting with the method, e.g. the
+// span name, changes the schema.
+func isDDL(method string) bool {
+	if idx := strings.IndexByte(method, ' '); idx > 0 {
+		method = method[:idx]
+	}
+	switch strings.ToUpper(method) {
+	case "CREATE", "ALTER", "DROP", "TRUNCATE":
+		return true
+	}
+	return false
+}
+
+type allowDDLKey struct{}
+
+// AllowDDL returns a context in which DDLHook does not alert, e.g. for
+// running migrations:
+//
+//   err := migrations.Run(pgext.AllowDDL(ctx), db)
+func AllowDDL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowDDLKey{}, true)
+}
+
+func ddlAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowDDLKey{}).(bool)
+	return allowed
+}
+
+// DDLHook is a pg.QueryHook that alerts when DDL (CREATE, ALTER, DROP or
+// TRUNCATE) runs outside of a migration, e.g. an accidental schema change
+// executed in a request path.
+//
+//   db.AddQueryHook(&pgext.DDLHook{})
+type DDLHook struct {
+	// Allowed reports whether DDL may run in the context, e.g. during
+	// a maintenance window. Defaults to contexts returned by AllowDDL.
+	Allowed func(ctx context.Context) bool
+	// Alert is called with the query of every DDL statement that is not
+	// allowed. Defaults to logging the query together with the caller.
+	Alert func(ctx context.Context, query string)
+	// Logger is used by the default Alert. Defaults to the standard logger.
+	Logger *log.Logger
+}
+
+var _ pg.QueryHook = (*DDLHook)(nil)
+
+func (h *DDLHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+	query := strings.TrimSpace(string(b))
+	if !isDDL(query) {
+		return ctx, nil
+	}
+
+	allowed := ddlAllowed
+	if h.Allowed != nil {
+		allowed = h.Allowed
+	}
+	if allowed(ctx) {
+		return ctx, nil
+	}
+
+	query = redact(query)
+	if h.Alert != nil {
+		h.Alert(ctx, query)
+		return ctx, nil
+	}
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+
+	printf := log.Printf
+	if h.Logger != nil {
+		printf = h.Logger.Printf
+	}
+	printf("pgext: DDL executed outside of a migration at %s (%s:%d):\n%s", fn, file, line, query)
+
+	return ctx, nil
+}
+
+func (h *DDLHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestIsDDL(t *testing.T) {
+	tests := []struct {
+		method string
+		ddl    bool
+	}{
+		{"CREATE TABLE", true},
+		{"alter", true},
+		{"DROP", true},
+		{"TRUNCATE", true},
+		{"SELECT", false},
+		{"INSERT", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := isDDL(test.method); got != test.ddl {
+			t.Errorf("isDDL(%q) = %t, want %t", test.method, got, test.ddl)
+		}
+	}
+}
+
+func TestDDLHook(t *testing.T) {
+	var alerts []string
+	h := &DDLHook{
+		Alert: func(_ context.Context, query string) {
+			alerts = append(alerts, query)
+		},
+	}
+
+	run := func(ctx context.Context, query string) {
+		evt := &pg.QueryEvent{Query: query}
+		if _, err := h.BeforeQuery(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	run(ctx, "SELECT 1")
+	run(AllowDDL(ctx), "ALTER TABLE users ADD COLUMN age int")
+	run(ctx, "  DROP TABLE users")
+
+	if len(alerts) != 1 || alerts[0] != "DROP TABLE users" {
+		t.Errorf("got alerts %q, want the DROP only", alerts)
+	}
+}
@@ -0,0 +1,39 @@
+package pgext
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+// defaultDeadlineBudgetRatio is the default DeadlineBudgetRatio.
+const defaultDeadlineBudgetRatio = 0.5
+
+// deadlineAttributes returns the time that was left until the deadline of
+// ctx when the query started and the fraction of it the query consumed.
+// Queries that consumed more than ratio are flagged with
+// db.deadline.budget_exceeded.
+func deadlineAttributes(ctx context.Context, start time.Time, dur time.Duration, ratio float64) []label.KeyValue {
+	deadline, ok := ctx.Deadline()
+	if !ok || start.IsZero() {
+		return nil
+	}
+	remaining := deadline.Sub(start)
+	attrs := []label.KeyValue{
+		label.Int64("db.deadline.remaining_us", remaining.Microseconds()),
+	}
+	if remaining <= 0 {
+		return append(attrs, label.Bool("db.deadline.budget_exceeded", true))
+	}
+
+	consumed := float64(dur) / float64(remaining)
+	attrs = append(attrs, label.Float64("db.deadline.budget_ratio", consumed))
+	if ratio <= 0 {
+		ratio = defaultDeadlineBudgetRatio
+	}
+	if consumed > ratio {
+		attrs = append(attrs, label.Bool("db.deadline.budget_exceeded", true))
+	}
+	return attrs
+}
@@ -0,0 +1,37 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestDeadlineAttributes(t *testing.T) {
+	start := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(100*time.Millisecond))
+	defer cancel()
+
+	exceeded := func(attrs []label.KeyValue) bool {
+		for _, kv := range attrs {
+			if kv.Key == "db.deadline.budget_exceeded" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if attrs := deadlineAttributes(ctx, start, 20*time.Millisecond, 0); exceeded(attrs) {
+		t.Errorf("query using 20%% of the budget is flagged: %v", attrs)
+	}
+	if attrs := deadlineAttributes(ctx, start, 80*time.Millisecond, 0); !exceeded(attrs) {
+		t.Errorf("query using 80%% of the budget is not flagged: %v", attrs)
+	}
+	if attrs := deadlineAttributes(ctx, start, 80*time.Millisecond, 0.9); exceeded(attrs) {
+		t.Errorf("query using 80%% of the budget is flagged with ratio 0.9: %v", attrs)
+	}
+	if attrs := deadlineAttributes(context.Background(), start, time.Second, 0); attrs != nil {
+		t.Errorf("got attributes %v without deadline", attrs)
+	}
+}
@@ -3,10 +3,18 @@ package pgext
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-pg/pg/v10"
 )
 
+// EnvDebug is the environment variable read by DebugHookFromEnv.
+const EnvDebug = "PGEXT_DEBUG"
+
 // DebugHook is a query hook that logs an error with a query if there are any.
 // It can be installed with:
 //
@@ -14,25 +22,105 @@ import (
 type DebugHook struct {
 	// Verbose causes hook to print all queries (even those without an error).
 	Verbose bool
+	// Pretty causes hook to print colorized and formatted queries together
+	// with duration, number of rows and the caller once they are executed.
+	Pretty bool
+	// NoColor disables ANSI colors in pretty output.
+	NoColor bool
+	// Writer is where pretty output goes. Defaults to os.Stderr.
+	Writer io.Writer
+	// Clock, if set, is used to measure duration instead of the system clock.
+	Clock Clock
 }
 
 var _ pg.QueryHook = (*DebugHook)(nil)
 
+// DebugHookFromEnv returns a pretty DebugHook configured by the PGEXT_DEBUG
+// environment variable and reports whether it is enabled. "1" or "true"
+// print failed queries, "verbose" or "all" print every query:
+//
+//   if hook, ok := pgext.DebugHookFromEnv(); ok {
+//       db.AddQueryHook(hook)
+//   }
+func DebugHookFromEnv() (DebugHook, bool) {
+	hook := DebugHook{Pretty: true}
+
+	switch v := strings.ToLower(os.Getenv(EnvDebug)); v {
+	case "verbose", "all":
+		hook.Verbose = true
+	default:
+		if ok, _ := strconv.ParseBool(v); !ok {
+			return hook, false
+		}
+	}
+
+	return hook, true
+}
+
 func (h DebugHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	if h.Pretty {
+		return ctx, nil
+	}
+
 	q, err := evt.FormattedQuery()
 	if err != nil {
 		return nil, err
 	}
 
 	if evt.Err != nil {
-		fmt.Printf("%s executing a query:\n%s\n", evt.Err, q)
+		fmt.Printf("%s executing a query:\n%s\n", evt.Err, redact(string(q)))
 	} else if h.Verbose {
-		fmt.Println(string(q))
+		fmt.Println(redact(string(q)))
 	}
 
 	return ctx, nil
 }
 
-func (DebugHook) AfterQuery(context.Context, *pg.QueryEvent) error {
-	return nil
+func (h DebugHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if !h.Pretty || (evt.Err == nil && !h.Verbose) {
+		return nil
+	}
+
+	q, err := evt.FormattedQuery()
+	if err != nil {
+		return err
+	}
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+	color := !h.NoColor
+
+	var b strings.Builder
+	paint := func(c, s string) {
+		if color {
+			s = c + s + colorReset
+		}
+		b.WriteString(s)
+	}
+
+	paint(colorGray, fmt.Sprintf("%s %s:%d", fn, file, line))
+	b.WriteByte('\n')
+	b.WriteString(prettyQuery(redact(string(q)), color))
+	b.WriteByte('\n')
+
+	dur := since(h.Clock, evt.StartTime).Round(time.Microsecond)
+	if evt.Err != nil {
+		paint(colorRed+colorBold, fmt.Sprintf("-- %s: %s", dur, evt.Err))
+	} else {
+		var rows int
+		if evt.Result != nil {
+			rows = evt.Result.RowsAffected()
+			if rows == 0 {
+				rows = evt.Result.RowsReturned()
+			}
+		}
+		paint(colorGray, fmt.Sprintf("-- %s, %d rows", dur, rows))
+	}
+	b.WriteString("\n\n")
+
+	w := h.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
 }
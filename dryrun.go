@@ -0,0 +1,113 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+var dryRunCounter, _ = meter.NewInt64Counter(
+	"go.sql.dry_run.statements",
+	metric.WithDescription("The number of writes skipped in dry-run mode"),
+)
+
+var cteWriteRe = regexp.MustCompile(`(?i)\b(?:INSERT\s+INTO|UPDATE\s+\S+\s+SET|DELETE\s+FROM)\b`)
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context in which DryRun skips writes even when it is
+// not enabled.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// DryRunResult is the result returned for skipped writes. No rows are
+// affected or returned and models are not filled.
+type DryRunResult struct{}
+
+var _ pg.Result = DryRunResult{}
+
+func (DryRunResult) Model() orm.Model  { return nil }
+func (DryRunResult) RowsAffected() int { return 0 }
+func (DryRunResult) RowsReturned() int { return 0 }
+
+// DryRun is a Middleware for DB that logs INSERT, UPDATE, DELETE and DDL
+// statements instead of executing them and returns DryRunResult, to verify
+// batch jobs before the first real run. Reads are executed:
+//
+//   dryRun := &pgext.DryRun{}
+//   db := &pgext.DB{DB: pg.Connect(opt), Middleware: dryRun}
+//   dryRun.SetEnabled(os.Getenv("DRY_RUN") != "")
+//
+// Dry-run can also be enabled for a context with WithDryRun. Writes inside
+// transactions started on the pg.DB are not intercepted.
+type DryRun struct {
+	// Logger is used to print the skipped statements. Defaults to the
+	// standard logger.
+	Logger *log.Logger
+	// Record, if set, is called with every skipped statement instead of
+	// logging it.
+	Record func(ctx context.Context, statement string)
+
+	enabled int32
+}
+
+var _ Middleware = (*DryRun)(nil)
+
+// SetEnabled turns dry-run on or off for all queries.
+func (d *DryRun) SetEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&d.enabled, v)
+}
+
+func (d *DryRun) Handle(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+	if on, _ := ctx.Value(dryRunKey{}).(bool); !on && atomic.LoadInt32(&d.enabled) == 0 {
+		return next(ctx)
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return err
+	}
+	query := strings.TrimSpace(string(b))
+	if !isWrite(query) {
+		return next(ctx)
+	}
+
+	evt.Result = DryRunResult{}
+	method := spanName(query)
+	dryRunCounter.Add(ctx, 1, methodLabel(method))
+	addEvent(ctx, trace.SpanFromContext(ctx), "pgext.dry_run",
+		label.String("db.statement", truncate(redact(query), 5000)),
+	)
+
+	if d.Record != nil {
+		d.Record(ctx, query)
+		return nil
+	}
+	logf(d.Logger, "pgext: dry-run skipped:\n%s", redact(query))
+	return nil
+}
+
+// isWrite reports whether the query changes data or schema.
+func isWrite(query string) bool {
+	if _, ok := writeTable(query); ok {
+		return true
+	}
+	method := spanName(query)
+	if isDDL(method) {
+		return true
+	}
+	return strings.EqualFold(method, "WITH") && cteWriteRe.MatchString(query)
+}
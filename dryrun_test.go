@@ -0,0 +1,84 @@
+package pgext
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestDryRun(t *testing.T) {
+	var recorded []string
+	dryRun := &DryRun{
+		Record: func(_ context.Context, statement string) {
+			recorded = append(recorded, statement)
+		},
+	}
+	var (
+		mu     sync.Mutex
+		served []string
+	)
+	var executed int
+	db := &DB{
+		DB: fakeDB(t, func(query string) fakeResult {
+			mu.Lock()
+			served = append(served, query)
+			mu.Unlock()
+			return fakeResult{}
+		}),
+		Middleware: Chain(dryRun, MiddlewareFunc(func(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+			executed++
+			return next(ctx)
+		})),
+	}
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	if executed != 1 || len(recorded) != 0 {
+		t.Fatalf("executed %d, recorded %v, want the write executed while disabled", executed, recorded)
+	}
+
+	dryRun.SetEnabled(true)
+	for _, query := range []string{
+		"INSERT INTO users (id) VALUES (1)",
+		"UPDATE users SET name = 'x'",
+		"ALTER TABLE users ADD COLUMN age int",
+		"WITH moved AS (DELETE FROM users RETURNING *) SELECT count(*) FROM moved",
+	} {
+		res, err := db.ExecContext(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := res.(DryRunResult); !ok {
+			t.Errorf("%q: got result %T, want DryRunResult", query, res)
+		}
+	}
+	if executed != 1 || len(recorded) != 4 {
+		t.Errorf("executed %d, recorded %d, want only reads executed", executed, len(recorded))
+	}
+
+	if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if executed != 2 {
+		t.Errorf("executed %d queries, want the read executed", executed)
+	}
+
+	dryRun.SetEnabled(false)
+	if _, err := db.ExecContext(WithDryRun(ctx), "TRUNCATE users"); err != nil {
+		t.Fatal(err)
+	}
+	if executed != 2 || len(recorded) != 5 {
+		t.Errorf("executed %d, recorded %d, want the write skipped in the context", executed, len(recorded))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"DELETE FROM users", "SELECT 1"}; !reflect.DeepEqual(served, want) {
+		t.Errorf("server got %q, want %q", served, want)
+	}
+}
@@ -0,0 +1,89 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// DuplicateQueryHook is a development-mode pg.QueryHook that reports the exact
+// same statement, including its parameters, executed more than once within a
+// single request. That usually means a missing in-request memoization or an
+// accidental double load.
+//
+// Requests are told apart the same way as in NPlusOneHook.
+//
+//   db.AddQueryHook(&pgext.DuplicateQueryHook{})
+type DuplicateQueryHook struct {
+	// Threshold is the number of executions of the same statement within one
+	// request that triggers a report. Defaults to 2.
+	Threshold int
+	// Logger is used to print reports. Defaults to the standard logger.
+	Logger *log.Logger
+
+	scopes traceScopes
+}
+
+var _ pg.QueryHook = (*DuplicateQueryHook)(nil)
+
+func (h *DuplicateQueryHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *DuplicateQueryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	scope := h.scopes.get(ctx)
+	if scope == nil {
+		return nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return err
+	}
+	query := string(b)
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+	caller := fmt.Sprintf("%s (%s:%d)", fn, file, line)
+
+	threshold := h.Threshold
+	if threshold <= 1 {
+		threshold = 2
+	}
+
+	scope.mu.Lock()
+	callers := scope.statements[query]
+	if len(callers) >= threshold {
+		scope.mu.Unlock()
+		return nil
+	}
+	callers = append(callers, caller)
+	scope.statements[query] = callers
+	scope.mu.Unlock()
+
+	if len(callers) < threshold {
+		return nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if span.IsRecording() {
+		addEvent(ctx, span, "pgext.duplicate_query",
+			label.String("db.statement", redact(query)),
+			label.Int("db.query_count", len(callers)),
+			label.String("frame.callers", strings.Join(callers, "\n")),
+		)
+	}
+
+	printf := log.Printf
+	if h.Logger != nil {
+		printf = h.Logger.Printf
+	}
+	printf("pgext: duplicate query: executed %d times in one request from:\n\t%s\n%s",
+		len(callers), strings.Join(callers, "\n\t"), redact(query))
+
+	return nil
+}
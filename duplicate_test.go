@@ -0,0 +1,37 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestDuplicateQueryHook(t *testing.T) {
+	var buf bytes.Buffer
+	h := &DuplicateQueryHook{Logger: log.New(&buf, "", 0)}
+	ctx := WithRequestScope(context.Background())
+
+	for _, query := range []string{
+		"SELECT * FROM users WHERE id = 1",
+		"SELECT * FROM users WHERE id = 2",
+		"SELECT * FROM users WHERE id = 1",
+		"SELECT * FROM users WHERE id = 1",
+	} {
+		// Events built outside of pg.DB have no formatted query.
+		if err := h.AfterQuery(ctx, &pg.QueryEvent{Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := buf.String()
+	if n := strings.Count(out, "pgext:"); n != 1 {
+		t.Fatalf("got %d reports, want 1 for the statement executed twice:\n%s", n, out)
+	}
+	if !strings.Contains(out, "id = 1") || strings.Contains(out, "id = 2") {
+		t.Errorf("got %q, want a report of id = 1", out)
+	}
+}
@@ -0,0 +1,138 @@
+package pgext
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables read by FromEnv.
+const (
+	EnvMetrics   = "PGEXT_METRICS"
+	EnvCaller    = "PGEXT_CALLER"
+	EnvStatement = "PGEXT_STATEMENT"
+	EnvSlowQuery = "PGEXT_SLOW_QUERY"
+	EnvInstance  = "PGEXT_INSTANCE"
+	EnvSalt      = "PGEXT_STATEMENT_SALT"
+	EnvAllow     = "PGEXT_ATTRIBUTES_ALLOW"
+	EnvDeny      = "PGEXT_ATTRIBUTES_DENY"
+)
+
+// FromEnv returns an OpenTelemetryHook configured by environment variables,
+// so telemetry can be tuned per deployment without code changes:
+//
+//   PGEXT_METRICS=true        record latency metrics
+//   PGEXT_CALLER=true         add the caller to spans
+//   PGEXT_STATEMENT=full      full, normalized, hashed or none
+//   PGEXT_STATEMENT_SALT=...  salt of hashed statements
+//   PGEXT_SLOW_QUERY=500ms    slow query threshold
+//   PGEXT_INSTANCE=orders     sql.instance metric label
+//   PGEXT_ATTRIBUTES_ALLOW=   comma separated attributes to keep
+//   PGEXT_ATTRIBUTES_DENY=    comma separated attributes to drop, e.g. frame.*
+//
+// Unset variables keep the defaults. The attribute lists filter the
+// attributes and labels of the returned hook only, like the Attributes of
+// a Config; use SetAttributeFilter to filter those of all hooks.
+func FromEnv() (*OpenTelemetryHook, error) {
+	return hookFromEnv(os.LookupEnv)
+}
+
+func hookFromEnv(lookup func(string) (string, bool)) (*OpenTelemetryHook, error) {
+	h := new(OpenTelemetryHook)
+
+	if v, ok := lookup(EnvMetrics); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("pgext: invalid %s: %w", EnvMetrics, err)
+		}
+		h.AllowMetric = b
+	}
+
+	if v, ok := lookup(EnvCaller); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("pgext: invalid %s: %w", EnvCaller, err)
+		}
+		h.Caller = b
+	}
+
+	if v, ok := lookup(EnvStatement); ok {
+		mode, err := ParseStatementCapture(v)
+		if err != nil {
+			return nil, fmt.Errorf("pgext: invalid %s: %w", EnvStatement, err)
+		}
+		h.Statement = mode
+	}
+
+	if v, ok := lookup(EnvSlowQuery); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("pgext: invalid %s: %w", EnvSlowQuery, err)
+		}
+		h.SlowQueryThreshold = d
+	}
+
+	if v, ok := lookup(EnvInstance); ok {
+		h.Instance = v
+	}
+
+	if v, ok := lookup(EnvSalt); ok {
+		h.StatementSalt = []byte(v)
+	}
+
+	allow, okAllow := lookup(EnvAllow)
+	deny, okDeny := lookup(EnvDeny)
+	if okAllow || okDeny {
+		cfg := &Config{Attributes: &AttributeFilter{
+			Allow: splitList(allow),
+			Deny:  splitList(deny),
+		}}
+		if err := h.ApplyConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// ParseStatementCapture parses "full", "normalized", "hashed" or "none".
+func ParseStatementCapture(s string) (StatementCapture, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "full":
+		return StatementCaptureFull, nil
+	case "normalized":
+		return StatementCaptureNormalized, nil
+	case "hashed":
+		return StatementCaptureHashed, nil
+	case "none":
+		return StatementCaptureNone, nil
+	}
+	return 0, fmt.Errorf("unknown statement capture mode %q", s)
+}
+
+func (m StatementCapture) String() string {
+	switch m {
+	case StatementCaptureFull:
+		return "full"
+	case StatementCaptureNormalized:
+		return "normalized"
+	case StatementCaptureHashed:
+		return "hashed"
+	case StatementCaptureNone:
+		return "none"
+	}
+	return "StatementCapture(" + strconv.Itoa(int(m)) + ")"
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
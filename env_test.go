@@ -0,0 +1,51 @@
+package pgext
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestHookFromEnv(t *testing.T) {
+	env := map[string]string{
+		EnvMetrics:   "true",
+		EnvCaller:    "1",
+		EnvStatement: "normalized",
+		EnvSlowQuery: "250ms",
+		EnvInstance:  "orders",
+		EnvDeny:      "db.user, frame.*",
+	}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	h, err := hookFromEnv(lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.AllowMetric || !h.Caller {
+		t.Errorf("metrics and caller are not enabled: %+v", h)
+	}
+	if h.Statement != StatementCaptureNormalized {
+		t.Errorf("got statement capture %s, want normalized", h.Statement)
+	}
+	if h.SlowQueryThreshold != 250*time.Millisecond {
+		t.Errorf("got slow query threshold %s, want 250ms", h.SlowQueryThreshold)
+	}
+	if h.Instance != "orders" {
+		t.Errorf("got instance %q, want orders", h.Instance)
+	}
+	if kvs := h.filterAttributes([]label.KeyValue{label.String("frame.func", "main")}); len(kvs) != 0 {
+		t.Errorf("attributes are not filtered: %v", kvs)
+	}
+	if kvs := new(OpenTelemetryHook).filterAttributes([]label.KeyValue{label.String("frame.func", "main")}); len(kvs) != 1 {
+		t.Errorf("attributes of other hooks are filtered: %v", kvs)
+	}
+
+	env[EnvStatement] = "everything"
+	if _, err := hookFromEnv(lookup); err == nil {
+		t.Errorf("invalid statement capture mode is accepted")
+	}
+}
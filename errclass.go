@@ -0,0 +1,75 @@
+package pgext
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+// The go-pg pool errors are internal, so they are recognized by message.
+const (
+	poolTimeoutMessage = "pg: connection pool timeout"
+	poolClosedMessage  = "pg: database is closed"
+)
+
+// Error classes of failed queries, reported as the db.error_class attribute
+// and the sql.error_class metric label.
+const (
+	errorClassPoolTimeout = "pool_timeout"
+	errorClassClosed      = "closed"
+	errorClassConnection  = "connection"
+	errorClassServer      = "server"
+	errorClassNoRows      = "no_rows"
+	errorClassOther       = "other"
+)
+
+var errorClassLabels = func() map[string]label.KeyValue {
+	m := make(map[string]label.KeyValue)
+	for _, class := range []string{
+		errorClassPoolTimeout, errorClassClosed, errorClassConnection,
+		errorClassServer, errorClassNoRows, errorClassOther,
+	} {
+		m[class] = label.String("sql.error_class", class)
+	}
+	return m
+}()
+
+// errorClass tells client side capacity problems, i.e. pool timeouts and
+// closed databases, and unreachable servers apart from errors returned by
+// the server, so a pool that is too small is not mistaken for a failing
+// database.
+func errorClass(err error) string {
+	switch err {
+	case pg.ErrNoRows, pg.ErrMultiRows:
+		return errorClassNoRows
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e.Error() {
+		case poolTimeoutMessage:
+			return errorClassPoolTimeout
+		case poolClosedMessage:
+			return errorClassClosed
+		}
+	}
+	if isConnectionError(err) {
+		return errorClassConnection
+	}
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		return errorClassServer
+	}
+	return errorClassOther
+}
+
+// errorClassCode returns the span status of the error class.
+func errorClassCode(class string) codes.Code {
+	switch class {
+	case errorClassPoolTimeout:
+		return codes.ResourceExhausted
+	case errorClassClosed, errorClassConnection:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
@@ -0,0 +1,36 @@
+package pgext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestErrorClass(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		class string
+		code  codes.Code
+	}{
+		{errors.New(poolTimeoutMessage), errorClassPoolTimeout, codes.ResourceExhausted},
+		{fmt.Errorf("query: %w", errors.New(poolTimeoutMessage)), errorClassPoolTimeout, codes.ResourceExhausted},
+		{errors.New(poolClosedMessage), errorClassClosed, codes.Unavailable},
+		{io.EOF, errorClassConnection, codes.Unavailable},
+		{sqlStateError("08006"), errorClassConnection, codes.Unavailable},
+		{sqlStateError("23505"), errorClassServer, codes.Internal},
+		{pg.ErrNoRows, errorClassNoRows, codes.Internal},
+		{errors.New("test"), errorClassOther, codes.Internal},
+	} {
+		class := errorClass(c.err)
+		if class != c.class {
+			t.Errorf("%v: got class %q, want %q", c.err, class, c.class)
+		}
+		if code := errorClassCode(class); code != c.code {
+			t.Errorf("%v: got code %v, want %v", c.err, code, c.code)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package pgext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+// ErrExplainNoDB is logged once by ExplainHook when its DB is not set.
+var ErrExplainNoDB = errors.New("pgext: ExplainHook requires DB")
+
+var (
+	seqScanCounter, _ = meter.NewInt64Counter(
+		"go.sql.plan.seq_scans",
+		metric.WithDescription("The number of sampled queries with a sequential scan over a large table"),
+	)
+	misestimateCounter, _ = meter.NewInt64Counter(
+		"go.sql.plan.misestimates",
+		metric.WithDescription("The number of sampled queries with misestimated rows"),
+	)
+	planChangeCounter, _ = meter.NewInt64Counter(
+		"go.sql.plan.changes",
+		metric.WithDescription("The number of sampled queries whose plan shape changed"),
+	)
+)
+
+// rawQuery makes go-pg send the query passed as pg.Safe as is, without
+// formatting:
+//
+//   db.ExecContext(ctx, rawQuery, pg.Safe(query))
+const rawQuery = "?"
+
+// planNode is a node of the plan returned by EXPLAIN (FORMAT JSON).
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	IndexName    string     `json:"Index Name"`
+	PlanRows     int64      `json:"Plan Rows"`
+	Plans        []planNode `json:"Plans"`
+}
+
+func (n *planNode) walk(fn func(*planNode)) {
+	fn(n)
+	for i := range n.Plans {
+		n.Plans[i].walk(fn)
+	}
+}
+
+// shape returns the plan without estimates, e.g.
+// "Nested Loop(Seq Scan users, Index Scan books_pkey)". Plans with the same
+// shape are executed the same way.
+func (n *planNode) shape() string {
+	var b strings.Builder
+	n.appendShape(&b)
+	return b.String()
+}
+
+func (n *planNode) appendShape(b *strings.Builder) {
+	b.WriteString(n.NodeType)
+	if n.IndexName != "" {
+		b.WriteByte(' ')
+		b.WriteString(n.IndexName)
+	} else if n.RelationName != "" {
+		b.WriteByte(' ')
+		b.WriteString(n.RelationName)
+	}
+
+	if len(n.Plans) == 0 {
+		return
+	}
+	b.WriteByte('(')
+	for i := range n.Plans {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		n.Plans[i].appendShape(b)
+	}
+	b.WriteByte(')')
+}
+
+// ExplainHook is a pg.QueryHook that runs EXPLAIN (FORMAT JSON) for a sample
+// of SELECTs and reports sequential scans over large tables and row estimates
+// that are far off from the number of returned rows. It is an early warning
+// for missing indexes and stale statistics.
+//
+// The hook also remembers the plan shape of every sampled query and reports
+// when it changes, e.g. from an index scan to a sequential scan after ANALYZE.
+//
+// EXPLAIN runs in the background, at most one at a time.
+//
+//   db.AddQueryHook(&pgext.ExplainHook{DB: pg.Connect(opt)})
+type ExplainHook struct {
+	// DB is the side connection used to run EXPLAIN. It must not have the hook
+	// installed, otherwise EXPLAIN would be sampled and explained again.
+	// Required; without it the hook logs ErrExplainNoDB once and does nothing.
+	DB *pg.DB
+	// SampleRate is the fraction of SELECTs that are explained. Defaults to 0.01.
+	SampleRate float64
+	// LargeTableRows is the estimated number of rows that makes a table large.
+	// Defaults to 100000.
+	LargeTableRows int64
+	// MisestimateFactor is how many times the estimated and returned rows may
+	// differ before it is reported. Defaults to 10.
+	MisestimateFactor float64
+	// Logger is used to print findings. Defaults to the standard logger.
+	Logger *log.Logger
+
+	running  int32
+	closed   int32
+	wg       sync.WaitGroup
+	tables   sync.Map
+	noDBOnce sync.Once
+	// plans maps normalized queries to their plan shapes. It is bounded by
+	// the memory budget, see SetMemoryLimit.
+	plansOnce sync.Once
+	plans     *lruCache
+}
+
+var (
+	_ pg.QueryHook = (*ExplainHook)(nil)
+	_ Shutdowner   = (*ExplainHook)(nil)
+)
+
+// Shutdown stops sampling and waits for the running EXPLAIN to finish.
+func (h *ExplainHook) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&h.closed, 1)
+	return waitGroup(ctx, &h.wg)
+}
+
+func (h *ExplainHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *ExplainHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if h.DB == nil {
+		h.noDBOnce.Do(func() { logf(h.Logger, "%s", ErrExplainNoDB) })
+		return nil
+	}
+	if evt.Err != nil || atomic.LoadInt32(&h.closed) != 0 {
+		return nil
+	}
+	if v, ok := evt.Query.(queryOperation); ok && v.Operation() != orm.SelectOp {
+		return nil
+	}
+
+	rate := h.SampleRate
+	if rate <= 0 {
+		rate = 0.01
+	}
+	if rand.Float64() >= rate {
+		return nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return nil
+	}
+	query := string(b)
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		return nil
+	}
+
+	returned := -1
+	if evt.Result != nil {
+		returned = evt.Result.RowsReturned()
+	}
+
+	if !atomic.CompareAndSwapInt32(&h.running, 0, 1) {
+		return nil
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer atomic.StoreInt32(&h.running, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		h.explain(ctx, h.DB, query, returned)
+	}()
+
+	return nil
+}
+
+func (h *ExplainHook) explain(ctx context.Context, db *pg.DB, query string, returned int) {
+	plan, err := explainQuery(ctx, db, query)
+	if err != nil {
+		h.printf("pgext: explain failed: %s", err)
+		return
+	}
+
+	large := h.LargeTableRows
+	if large <= 0 {
+		large = 100000
+	}
+	plan.walk(func(n *planNode) {
+		if n.NodeType != "Seq Scan" || n.RelationName == "" {
+			return
+		}
+		rows := h.tableRows(ctx, db, n.RelationName)
+		if rows < large {
+			return
+		}
+		seqScanCounter.Add(ctx, 1, tableKey.String(n.RelationName))
+		h.printf("pgext: sequential scan over %s (~%d rows):\n%s", n.RelationName, rows, redact(query))
+	})
+
+	key, shape := normalizeQuery(query), plan.shape()
+	h.plansOnce.Do(func() { h.plans = newLRUCache("explain_plans") })
+	if prev, loaded := h.plans.loadOrStore(key, shape); loaded && prev.(string) != shape {
+		h.plans.store(key, shape)
+		planChangeCounter.Add(ctx, 1)
+		h.printf("pgext: plan changed from %s to %s:\n%s", prev, shape, redact(query))
+	}
+
+	factor := h.MisestimateFactor
+	if factor <= 1 {
+		factor = 10
+	}
+	if returned >= 0 && misestimated(plan.PlanRows, int64(returned), factor) {
+		misestimateCounter.Add(ctx, 1, label.String("sql.node", plan.NodeType))
+		h.printf("pgext: planner estimated %d rows, query returned %d:\n%s",
+			plan.PlanRows, returned, redact(query))
+	}
+}
+
+// tableRows returns the estimated number of rows in the table. Estimates are
+// cached for the lifetime of the hook.
+func (h *ExplainHook) tableRows(ctx context.Context, db *pg.DB, table string) int64 {
+	if v, ok := h.tables.Load(table); ok {
+		return v.(int64)
+	}
+
+	var rows float64
+	_, err := db.QueryOneContext(ctx, pg.Scan(&rows),
+		`SELECT reltuples FROM pg_class WHERE oid = to_regclass(?)::oid`, table)
+	if err != nil {
+		return 0
+	}
+
+	h.tables.Store(table, int64(rows))
+	return int64(rows)
+}
+
+func (h *ExplainHook) printf(format string, args ...interface{}) {
+	if h.Logger != nil {
+		h.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func explainQuery(ctx context.Context, db orm.DB, query string) (*planNode, error) {
+	var out string
+	_, err := db.QueryOneContext(ctx, pg.Scan(&out), rawQuery, pg.Safe("EXPLAIN (FORMAT JSON) "+query))
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(out), &plans); err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return &planNode{}, nil
+	}
+	return &plans[0].Plan, nil
+}
+
+func misestimated(estimated, actual int64, factor float64) bool {
+	const minRows = 100
+	if estimated < minRows && actual < minRows {
+		return false
+	}
+	if estimated < 1 {
+		estimated = 1
+	}
+	if actual < 1 {
+		actual = 1
+	}
+	ratio := float64(estimated) / float64(actual)
+	return ratio > factor || ratio < 1/factor
+}
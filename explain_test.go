@@ -0,0 +1,88 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestExplainHookRequiresDB(t *testing.T) {
+	var buf bytes.Buffer
+	h := ExplainHook{Logger: log.New(&buf, "", 0)}
+	evt := &pg.QueryEvent{Query: "SELECT 1"}
+	for i := 0; i < 2; i++ {
+		if err := h.AfterQuery(context.Background(), evt); err != nil {
+			t.Fatalf("AfterQuery: %v", err)
+		}
+	}
+	if got, want := buf.String(), ErrExplainNoDB.Error()+"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPlanShape(t *testing.T) {
+	const plan = `{
+		"Node Type": "Nested Loop",
+		"Plan Rows": 10,
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "users", "Plan Rows": 10},
+			{"Node Type": "Index Scan", "Relation Name": "books", "Index Name": "books_pkey", "Plan Rows": 1}
+		]
+	}`
+
+	var node planNode
+	if err := json.Unmarshal([]byte(plan), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Nested Loop(Seq Scan users, Index Scan books_pkey)"
+	if got := node.shape(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	var got string
+	db := fakeDB(t, func(query string) fakeResult {
+		got = query
+		return fakeResult{
+			Columns: []string{"QUERY PLAN"},
+			Rows:    [][]string{{`[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "users"}}]`}},
+		}
+	})
+
+	const query = "SELECT * FROM users WHERE name = '?'"
+	plan, err := explainQuery(context.Background(), db, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "EXPLAIN (FORMAT JSON) " + query; got != want {
+		t.Errorf("got query %q, want %q", got, want)
+	}
+	if shape := plan.shape(); shape != "Seq Scan users" {
+		t.Errorf("got plan %q, want %q", shape, "Seq Scan users")
+	}
+}
+
+func TestMisestimated(t *testing.T) {
+	tests := []struct {
+		estimated, actual int64
+		want              bool
+	}{
+		{1, 50, false},
+		{100, 1000, false},
+		{100, 1001, true},
+		{100000, 5, true},
+		{0, 0, false},
+	}
+
+	for _, test := range tests {
+		if got := misestimated(test.estimated, test.actual, 10); got != test.want {
+			t.Errorf("misestimated(%d, %d) = %v, want %v", test.estimated, test.actual, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package pgext
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var inListRe = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+
+// fingerprint returns a short hash of the normalized query that identifies
+// the query shape.
+func fingerprint(normalized string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(normalized))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// normalizeQuery returns the shape of the query: literals and placeholders
+// are replaced with '?', comments are dropped, whitespace is collapsed and
+// lists of values are folded into a single '(?)'. Queries that differ only in
+// their parameters share the same normalized form.
+func normalizeQuery(query string) string {
+	q := replaceLiterals(query, func(string) string { return "?" })
+	return inListRe.ReplaceAllString(q, "(?)")
+}
+
+// hashLiterals returns the query with comments dropped, whitespace collapsed
+// and literals replaced by their salted hashes, so equal values can be
+// correlated across queries without being revealed.
+func hashLiterals(query string, salt []byte) string {
+	return replaceLiterals(query, func(lit string) string {
+		if lit[0] == '$' {
+			return "?"
+		}
+		mac := hmac.New(sha256.New, salt)
+		_, _ = mac.Write([]byte(lit))
+		return "#" + hex.EncodeToString(mac.Sum(nil)[:8])
+	})
+}
+
+// replaceLiterals drops comments, collapses whitespace and replaces string
+// and numeric literals and placeholders with the result of replace.
+func replaceLiterals(query string, replace func(lit string) string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case isSpace(c):
+			space = true
+			continue
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+			space = true
+			continue
+		}
+
+		if space {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+		}
+
+		start := i
+		switch {
+		case c == '\'':
+			i = skipQuoted(query, i, '\'')
+			b.WriteString(replace(query[start : i+1]))
+		case c == '"':
+			end := skipQuoted(query, i, '"')
+			b.WriteString(query[i : end+1])
+			i = end
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			b.WriteString(replace(query[start : i+1]))
+		case isDigit(c) && !prevIsIdent(query, i):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteString(replace(query[start : i+1]))
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// skipQuoted returns the index of the closing quote for the quoted section
+// starting at i. Doubled quotes are treated as escapes.
+func skipQuoted(s string, i int, quote byte) int {
+	for i++; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(s) - 1
+}
+
+func prevIsIdent(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	c := s[i-1]
+	return c == '_' || isDigit(c) || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,46 @@
+package pgext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT * FROM users WHERE id = 1`, `SELECT * FROM users WHERE id = ?`},
+		{`SELECT * FROM users WHERE id = $1`, `SELECT * FROM users WHERE id = ?`},
+		{"SELECT *\n\tFROM  users   -- comment\nWHERE name = 'it''s'", `SELECT * FROM users WHERE name = ?`},
+		{`SELECT /* hint */ 1.5`, `SELECT ?`},
+		{`SELECT * FROM t1 WHERE id IN (1, 2, 3)`, `SELECT * FROM t1 WHERE id IN (?)`},
+		{`SELECT "col1" FROM "table2"`, `SELECT "col1" FROM "table2"`},
+		{`SELECT 'unterminated`, `SELECT ?`},
+	}
+
+	for _, test := range tests {
+		if got := normalizeQuery(test.query); got != test.want {
+			t.Errorf("normalizeQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	salt := []byte("salt")
+
+	a := hashLiterals(`SELECT * FROM users WHERE id = 42 AND name = 'bob'`, salt)
+	b := hashLiterals(`SELECT * FROM orders WHERE user_id = 42`, salt)
+	if a == `SELECT * FROM users WHERE id = 42 AND name = 'bob'` || strings.Contains(a, "bob") {
+		t.Fatalf("literals are not hashed: %q", a)
+	}
+	if hash := b[strings.LastIndexByte(b, '#'):]; !strings.Contains(a, hash) {
+		t.Errorf("equal values have different hashes: %q, %q", a, b)
+	}
+	if c := hashLiterals(`SELECT * FROM orders WHERE user_id = 42`, []byte("other")); c == b {
+		t.Errorf("hash does not depend on the salt: %q", c)
+	}
+	if got := hashLiterals(`SELECT * FROM users WHERE id = $1`, salt); got != `SELECT * FROM users WHERE id = ?` {
+		t.Errorf("placeholder is hashed: %q", got)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+package pgext
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var fuzzQueries = []string{
+	`SELECT * FROM users WHERE id = 1`,
+	"SELECT\t*\nFROM  \"users\"  -- comment\nWHERE name = 'it''s'",
+	`INSERT INTO books (title) VALUES ('Война и мир'), ('日本語')`,
+	`SELECT * FROM t WHERE id IN (` + strings.Repeat(`1, `, 1000) + `1)`,
+	`/* unterminated`,
+	`'unterminated`,
+	"\xff\xfe SELECT",
+	" SELECT 1",
+}
+
+func FuzzSpanName(f *testing.F) {
+	for _, query := range fuzzQueries {
+		f.Add(query)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		name := spanName(query)
+		if len(name) > 20 {
+			t.Errorf("span name %q is longer than 20 bytes", name)
+		}
+		if !utf8.ValidString(name) {
+			t.Errorf("span name %q is not valid UTF-8", name)
+		}
+	})
+}
+
+func FuzzTruncate(f *testing.F) {
+	for _, query := range fuzzQueries {
+		f.Add(query, 10)
+	}
+	f.Add(strings.Repeat("я", 3000), 5000)
+	f.Add("SELECT 1", -1)
+	f.Fuzz(func(t *testing.T, s string, n int) {
+		got := truncate(s, n)
+		if n < 0 && got != "" {
+			t.Errorf("truncate(%q, %d) = %q, want empty", s, n, got)
+		}
+		if n >= 0 && len(got) > n {
+			t.Errorf("truncate(%q, %d) = %q is too long", s, n, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q is not valid UTF-8", s, n, got)
+		}
+	})
+}
+
+func FuzzNormalizeQuery(f *testing.F) {
+	for _, query := range fuzzQueries {
+		f.Add(query)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		normalized := normalizeQuery(query)
+		if utf8.ValidString(query) && !utf8.ValidString(normalized) {
+			t.Errorf("normalizeQuery(%q) = %q is not valid UTF-8", query, normalized)
+		}
+		if again := normalizeQuery(normalized); again != normalized {
+			t.Errorf("normalizeQuery is not idempotent: %q != %q", again, normalized)
+		}
+	})
+}
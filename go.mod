@@ -7,5 +7,5 @@ require (
 	github.com/segmentio/encoding v0.1.17
 	go.opencensus.io v0.22.4
 	go.opentelemetry.io/otel v0.11.0
-	go.opentelemetry.io/otel/exporters/stdout v0.11.0
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,10 @@
+module github.com/j2gg0s/pgext/grpcmw
+
+go 1.16
+
+require (
+	github.com/j2gg0s/pgext v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.31.0
+)
+
+replace github.com/j2gg0s/pgext => ../
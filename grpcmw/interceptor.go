@@ -0,0 +1,120 @@
+// Package grpcmw provides gRPC server interceptors that mark the request
+// context for the query hooks of pgext, the companion of httpmw for gRPC
+// services.
+package grpcmw
+
+import (
+	"context"
+	"time"
+
+	"github.com/j2gg0s/pgext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type methodKey struct{}
+
+type tenantKey struct{}
+
+// MethodFromContext returns the full gRPC method of the request, e.g.
+// /shop.Orders/Create, or an empty string. Use it as the Route of
+// pgext.Commenter.
+func MethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(methodKey{}).(string)
+	return method
+}
+
+// TenantFromContext returns the tenant of the request, or an empty string.
+// Use it as the Tenant of pgext.OpenTelemetryHook.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Interceptor marks the request context with the method, the tenant and the
+// request ID from the incoming metadata, the priority and a pgext request
+// scope. The zero value is ready to use:
+//
+//   mw := &grpcmw.Interceptor{}
+//   srv := grpc.NewServer(grpc.UnaryInterceptor(mw.Unary()), grpc.StreamInterceptor(mw.Stream()))
+//
+//   db.AddQueryHook(&pgext.OpenTelemetryHook{
+//       Tenant:            grpcmw.TenantFromContext,
+//       RequestID:         pgext.RequestIDFromContext,
+//       ContextAttributes: (&pgext.Commenter{Route: grpcmw.MethodFromContext}).ContextAttributes(),
+//   })
+//
+// gRPC propagates the deadline of the client in the context, which
+// OpenTelemetryHook reports as db.deadline.* attributes.
+type Interceptor struct {
+	// TenantKey is the metadata key of the tenant. Defaults to x-tenant.
+	TenantKey string
+	// RequestIDKey is the metadata key of the request ID. Defaults to
+	// x-request-id.
+	RequestIDKey string
+	// Priority, if set, returns the query priority of the method.
+	Priority func(fullMethod string) pgext.Priority
+	// DefaultTimeout, if set, is the deadline of requests without one, so
+	// their queries have a budget too.
+	DefaultTimeout time.Duration
+}
+
+// Unary returns the unary server interceptor.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := i.context(ctx, info.FullMethod)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the stream server interceptor.
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := i.context(ss.Context(), info.FullMethod)
+		defer cancel()
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (i *Interceptor) context(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, methodKey{}, method)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tenant := first(md, i.TenantKey, "x-tenant"); tenant != "" {
+		ctx = context.WithValue(ctx, tenantKey{}, tenant)
+	}
+	if id := first(md, i.RequestIDKey, "x-request-id"); id != "" {
+		ctx = pgext.WithRequestID(ctx, id)
+	}
+	if i.Priority != nil {
+		ctx = pgext.WithPriority(ctx, i.Priority(method))
+	}
+	ctx = pgext.WithRequestScope(ctx)
+
+	if _, ok := ctx.Deadline(); !ok && i.DefaultTimeout > 0 {
+		return context.WithTimeout(ctx, i.DefaultTimeout)
+	}
+	return ctx, func() {}
+}
+
+// first returns the first value of the key, or of def if key is empty.
+func first(md metadata.MD, key, def string) string {
+	if key == "" {
+		key = def
+	}
+	if vs := md.Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// serverStream is a grpc.ServerStream with the marked context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,64 @@
+package grpcmw
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/j2gg0s/pgext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInterceptorUnary(t *testing.T) {
+	i := &Interceptor{
+		TenantKey: "tenant",
+		Priority:  func(string) pgext.Priority { return pgext.PriorityBatch },
+	}
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("tenant", "acme", "x-request-id", "req-1"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/shop.Orders/Create"}
+
+	var method, tenant, requestID string
+	var priority pgext.Priority
+	_, err := i.Unary()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		method, tenant = MethodFromContext(ctx), TenantFromContext(ctx)
+		requestID, priority = pgext.RequestIDFromContext(ctx), pgext.PriorityFromContext(ctx)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "/shop.Orders/Create" || tenant != "acme" || requestID != "req-1" || priority != pgext.PriorityBatch {
+		t.Errorf("got method %q, tenant %q, request ID %q and priority %s", method, tenant, requestID, priority)
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestInterceptorStream(t *testing.T) {
+	i := &Interceptor{DefaultTimeout: time.Minute}
+	ss := &testStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))}
+	info := &grpc.StreamServerInfo{FullMethod: "/shop.Orders/Watch"}
+
+	err := i.Stream()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		ctx := stream.Context()
+		if method, tenant := MethodFromContext(ctx), TenantFromContext(ctx); method != "/shop.Orders/Watch" || tenant != "acme" {
+			t.Errorf("got method %q and tenant %q", method, tenant)
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("got no deadline, want the default timeout")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,245 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var unhealthyCounter, _ = meter.NewInt64Counter(
+	"go.sql.instance.unhealthy",
+	metric.WithDescription("The number of times an instance was marked unhealthy"),
+)
+
+// isConnectionError reports whether err means the instance could not be
+// reached, as opposed to a failed statement.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exception, 57P01-57P03 are shutdown and
+		// startup of the server.
+		code := pgErr.Field('C')
+		return strings.HasPrefix(code, "08") ||
+			code == "57P01" || code == "57P02" || code == "57P03"
+	}
+	return false
+}
+
+// HealthTracker is a pg.QueryHook that counts consecutive connection level
+// failures per instance and marks instances unhealthy, so traffic can be
+// drained from a dying replica. Instances are identified by their address.
+// Install the same tracker on every DB:
+//
+//   health := &pgext.HealthTracker{}
+//   primary.AddQueryHook(health)
+//   replica.AddQueryHook(health)
+//
+//   if !health.Healthy(replicaAddr) {
+//       db = primary
+//   }
+//
+// A successful query marks the instance healthy again. Unhealthy instances
+// usually get no traffic, so the tracker probes them in the background until
+// they answer. Call Shutdown to stop probing.
+type HealthTracker struct {
+	// FailureThreshold is the number of consecutive connection failures that
+	// make an instance unhealthy. Defaults to 3.
+	FailureThreshold int
+	// OnChange, if set, is called when an instance becomes unhealthy or
+	// healthy again.
+	OnChange func(instance string, healthy bool)
+	// ProbeInterval is how often unhealthy instances are probed.
+	// Defaults to 5s.
+	ProbeInterval time.Duration
+	// Probe checks whether an unhealthy instance answers. Defaults to db.Ping.
+	Probe func(ctx context.Context, db *pg.DB) error
+
+	mu       sync.Mutex
+	failures map[string]int
+	probing  map[string]bool
+	closed   bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+var (
+	_ pg.QueryHook = (*HealthTracker)(nil)
+	_ Shutdowner   = (*HealthTracker)(nil)
+)
+
+// Healthy reports whether the instance is healthy. Unknown instances are
+// healthy.
+func (t *HealthTracker) Healthy(instance string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failures[instance] < t.threshold()
+}
+
+// Unhealthy returns the sorted addresses of the unhealthy instances.
+func (t *HealthTracker) Unhealthy() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var instances []string
+	for instance, n := range t.failures {
+		if n >= t.threshold() {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Strings(instances)
+	return instances
+}
+
+func (t *HealthTracker) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+// Shutdown stops probing unhealthy instances.
+func (t *HealthTracker) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.mu.Unlock()
+	return waitGroup(ctx, &t.wg)
+}
+
+func (t *HealthTracker) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	db, ok := evt.DB.(*pg.DB)
+	if !ok {
+		return nil
+	}
+	t.record(ctx, db, isConnectionError(evt.Err))
+	return nil
+}
+
+// record records the outcome of a query on db.
+func (t *HealthTracker) record(ctx context.Context, db *pg.DB, failed bool) {
+	instance := db.Options().Addr
+
+	var changed, healthy bool
+
+	t.mu.Lock()
+	if t.failures == nil {
+		t.failures = make(map[string]int)
+	}
+	n, threshold := t.failures[instance], t.threshold()
+	if failed {
+		t.failures[instance] = n + 1
+		changed = n+1 == threshold
+	} else if n > 0 {
+		delete(t.failures, instance)
+		changed, healthy = n >= threshold, true
+	}
+	if changed && !healthy {
+		t.startProbe(db, instance)
+	}
+	t.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if !healthy {
+		unhealthyCounter.Add(ctx, 1, instanceKey.String(instance))
+	}
+	if t.OnChange != nil {
+		t.OnChange(instance, healthy)
+	}
+}
+
+// startProbe starts probing the instance unless it is probed already.
+// It must be called with t.mu held.
+func (t *HealthTracker) startProbe(db *pg.DB, instance string) {
+	if t.closed || t.probing[instance] {
+		return
+	}
+	if t.probing == nil {
+		t.probing = make(map[string]bool)
+		t.ctx, t.cancel = context.WithCancel(context.Background())
+	}
+	t.probing[instance] = true
+
+	t.wg.Add(1)
+	go t.probe(t.ctx, db, instance)
+}
+
+// probe probes the unhealthy instance until it answers or becomes healthy
+// otherwise.
+func (t *HealthTracker) probe(ctx context.Context, db *pg.DB, instance string) {
+	defer t.wg.Done()
+
+	interval := t.ProbeInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	probe := t.Probe
+	if probe == nil {
+		probe = func(ctx context.Context, db *pg.DB) error {
+			return db.Ping(ctx)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, interval)
+		err := probe(probeCtx, db)
+		cancel()
+		if !t.stopProbe(instance, err == nil) {
+			continue
+		}
+		if err == nil {
+			t.record(ctx, db, false)
+		}
+		return
+	}
+}
+
+// stopProbe stops probing the instance if it answered or is healthy again
+// and reports whether probing stopped.
+func (t *HealthTracker) stopProbe(instance string, answered bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !answered && t.failures[instance] >= t.threshold() {
+		return false
+	}
+	delete(t.probing, instance)
+	return true
+}
+
+func (t *HealthTracker) threshold() int {
+	if t.FailureThreshold > 0 {
+		return t.FailureThreshold
+	}
+	return 3
+}
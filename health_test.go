@@ -0,0 +1,127 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		conn bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{sqlStateError("08006"), true},
+		{sqlStateError("57P01"), true},
+		{sqlStateError("23505"), false},
+		{pg.ErrNoRows, false},
+		{errors.New("boom"), false},
+	}
+
+	for _, test := range tests {
+		if got := isConnectionError(test.err); got != test.conn {
+			t.Errorf("isConnectionError(%v) = %t, want %t", test.err, got, test.conn)
+		}
+	}
+}
+
+func TestHealthTracker(t *testing.T) {
+	const addr = "replica:5432"
+
+	var changes []bool
+	h := &HealthTracker{
+		FailureThreshold: 2,
+		OnChange: func(instance string, healthy bool) {
+			if instance != addr {
+				t.Errorf("got instance %q, want %q", instance, addr)
+			}
+			changes = append(changes, healthy)
+		},
+	}
+	defer h.Shutdown(context.Background())
+
+	db := pg.Connect(&pg.Options{Addr: addr})
+	run := func(err error) {
+		if err := h.AfterQuery(context.Background(), &pg.QueryEvent{DB: db, Err: err}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(io.EOF)
+	if !h.Healthy(addr) {
+		t.Fatal("instance is unhealthy below the threshold")
+	}
+	// A failed statement means the instance is reachable.
+	run(sqlStateError("23505"))
+	run(io.EOF)
+	if !h.Healthy(addr) {
+		t.Fatal("failures are not reset by a failed statement")
+	}
+	run(io.EOF)
+	if h.Healthy(addr) {
+		t.Fatal("instance is healthy after consecutive failures")
+	}
+	if got := h.Unhealthy(); len(got) != 1 || got[0] != addr {
+		t.Errorf("got unhealthy %q, want %q", got, addr)
+	}
+	run(io.EOF)
+	run(nil)
+	if !h.Healthy(addr) {
+		t.Fatal("instance is unhealthy after a successful query")
+	}
+
+	if len(changes) != 2 || changes[0] || !changes[1] {
+		t.Errorf("got changes %v, want [false true]", changes)
+	}
+}
+
+func TestHealthTrackerProbe(t *testing.T) {
+	const addr = "replica:5432"
+
+	var probes int32
+	changes := make(chan bool, 2)
+	h := &HealthTracker{
+		FailureThreshold: 1,
+		ProbeInterval:    time.Millisecond,
+		Probe: func(context.Context, *pg.DB) error {
+			if atomic.AddInt32(&probes, 1) < 3 {
+				return io.EOF
+			}
+			return nil
+		},
+		OnChange: func(_ string, healthy bool) {
+			changes <- healthy
+		},
+	}
+	defer h.Shutdown(context.Background())
+
+	db := pg.Connect(&pg.Options{Addr: addr})
+	if err := h.AfterQuery(context.Background(), &pg.QueryEvent{DB: db, Err: io.EOF}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []bool{false, true} {
+		select {
+		case healthy := <-changes:
+			if healthy != want {
+				t.Fatalf("got healthy %t, want %t", healthy, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("instance did not recover")
+		}
+	}
+	if !h.Healthy(addr) {
+		t.Error("instance is unhealthy after a successful probe")
+	}
+	if n := atomic.LoadInt32(&probes); n != 3 {
+		t.Errorf("got %d probes, want 3", n)
+	}
+}
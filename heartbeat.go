@@ -0,0 +1,126 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var heartbeatRecorder, _ = meter.NewInt64ValueRecorder(
+	"go.sql.heartbeat.latency",
+	metric.WithDescription("The latency of the heartbeat probe in microsecond"),
+)
+
+// HeartbeatProbe runs a trivial query at a fixed interval on a connection of
+// its own and records its latency as go.sql.heartbeat.latency. It is
+// a baseline to tell a slow database from queries that got heavier:
+//
+//   p := &pgext.HeartbeatProbe{DB: db, Interval: 10 * time.Second}
+//   p.Start()
+//   defer p.Shutdown(ctx)
+//
+// The probe connects with the options of DB but with a pool of one
+// connection and without its hooks, so the probes are neither queued behind
+// the queries of the application nor counted in their metrics.
+type HeartbeatProbe struct {
+	// DB is the database to probe.
+	DB *pg.DB
+	// Query is the probe. Defaults to SELECT 1.
+	Query string
+	// Interval is the time between probes. Defaults to 10s.
+	Interval time.Duration
+	// Timeout of a probe. Defaults to Interval.
+	Timeout time.Duration
+	// Instance is the sql.instance label. Defaults to the database name.
+	Instance string
+	// Logger is used to print failed probes. Defaults to the standard logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the probe latency in microseconds against
+	// threshold rules.
+	Alerter *Alerter
+
+	poller poller
+	mu     sync.Mutex
+	conn   *pg.DB
+}
+
+var _ Shutdowner = (*HeartbeatProbe)(nil)
+
+// Start starts probing in the background.
+func (p *HeartbeatProbe) Start() {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	p.poller.start(interval, p.probe)
+}
+
+// Shutdown stops probing and closes the connection of the probe.
+func (p *HeartbeatProbe) Shutdown(ctx context.Context) error {
+	err := p.poller.shutdown(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		if err2 := p.conn.Close(); err == nil {
+			err = err2
+		}
+		p.conn = nil
+	}
+	return err
+}
+
+func (p *HeartbeatProbe) connect() *pg.DB {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		opt := *p.DB.Options()
+		opt.PoolSize = 1
+		opt.MinIdleConns = 0
+		p.conn = pg.Connect(&opt)
+	}
+	return p.conn
+}
+
+func (p *HeartbeatProbe) probe(ctx context.Context) {
+	query := p.Query
+	if query == "" {
+		query = "SELECT 1"
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = p.Interval
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	instance := p.Instance
+	if instance == "" {
+		instance = p.DB.Options().Database
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.connect().ExecContext(ctx, query)
+	dur := time.Since(start)
+
+	labels := []label.KeyValue{instanceKey.String(instance)}
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			// Shut down while probing.
+			return
+		}
+		logf(p.Logger, "pgext: heartbeat probe failed: %s", err)
+		heartbeatRecorder.Record(ctx, dur.Microseconds(), append(labels, statusErrorLabel)...)
+	} else {
+		heartbeatRecorder.Record(ctx, dur.Microseconds(), append(labels, statusOKLabel)...)
+	}
+	p.Alerter.check(ctx, []sample{{"go.sql.heartbeat.latency", labels, float64(dur.Microseconds())}})
+}
@@ -0,0 +1,43 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestHeartbeatProbe(t *testing.T) {
+	probed := make(chan Alert, 1)
+	p := &HeartbeatProbe{
+		DB:       pgexttest.DB(),
+		Interval: time.Hour,
+		Alerter: &Alerter{
+			Rules: []AlertRule{{Name: "heartbeat", Metric: "go.sql.heartbeat.latency", Threshold: -1}},
+			Notify: func(_ context.Context, alert Alert) {
+				probed <- alert
+			},
+		},
+	}
+	p.Start()
+
+	select {
+	case alert := <-probed:
+		if alert.Labels["sql.instance"] != "pgexttest" {
+			t.Errorf("got labels %v, want the database as instance", alert.Labels)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no probe")
+	}
+
+	if p.connect() == pgexttest.DB() {
+		t.Error("the probe uses the pool of the application")
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.conn != nil {
+		t.Error("the connection of the probe is not closed")
+	}
+}
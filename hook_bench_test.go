@@ -0,0 +1,146 @@
+package pgext
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+// The benchmarks below run hooks against synthesized events without a
+// database, so they measure the cost of the instrumentation itself.
+
+type benchUser struct {
+	ID   int64
+	Name string
+}
+
+func BenchmarkHooks(b *testing.B) {
+	discard := log.New(ioutil.Discard, "", 0)
+
+	hooks := []struct {
+		name string
+		hook pg.QueryHook
+	}{
+		{"OpenTelemetryHook", &OpenTelemetryHook{}},
+		{"OpenTelemetryHook/Caller", &OpenTelemetryHook{Caller: true}},
+		{"OpenTelemetryHook/Metric", &OpenTelemetryHook{AllowMetric: true}},
+		{"DebugHook", DebugHook{}},
+		{"NPlusOneHook", &NPlusOneHook{Logger: discard}},
+		{"DuplicateQueryHook", &DuplicateQueryHook{Logger: discard}},
+		{"LintHook", &LintHook{Logger: discard}},
+	}
+
+	events := []struct {
+		name string
+		evt  *pg.QueryEvent
+	}{
+		{"Raw", pgexttest.NewQueryEvent(`SELECT * FROM users WHERE id = ?`, 1).
+			Result(0, 1).
+			Build()},
+		{"Model", pgexttest.NewQueryEvent(`SELECT "user"."id", "user"."name" FROM users AS "user" WHERE id = ?`, 1).
+			Operation(orm.SelectOp).
+			Model(&benchUser{}).
+			Result(0, 1).
+			Build()},
+		{"Insert", pgexttest.NewQueryEvent(`INSERT INTO users (id, name) VALUES (?, ?)`, 1, "name").
+			Operation(orm.InsertOp).
+			Model(&benchUser{}).
+			Result(1, 0).
+			Build()},
+	}
+
+	ctx, span := global.Tracer(instrumentationName).Start(
+		context.Background(), "root", trace.WithNewRoot())
+	defer span.End()
+
+	for _, h := range hooks {
+		for _, e := range events {
+			b.Run(h.name+"/"+e.name, func(b *testing.B) {
+				benchHook(b, ctx, h.hook, e.evt)
+			})
+		}
+		b.Run(h.name+"/NoParent", func(b *testing.B) {
+			benchHook(b, context.Background(), h.hook, events[0].evt)
+		})
+	}
+}
+
+func benchHook(b *testing.B, ctx context.Context, hook pg.QueryHook, tmpl *pg.QueryEvent) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// Copy the event, so the formatted query is not cached between iterations.
+		evt := *tmpl
+		if _, err := pgexttest.Run(ctx, hook, &evt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMetricsOnly measures the metrics path of OpenTelemetryHook for
+// queries without a recording span. It should not allocate.
+func BenchmarkMetricsOnly(b *testing.B) {
+	h := &OpenTelemetryHook{AllowMetric: true, SlowQueryThreshold: time.Second}
+	evt := pgexttest.NewQueryEvent(`SELECT "user"."id" FROM users AS "user" WHERE id = ?`, 1).
+		Operation(orm.SelectOp).
+		Result(0, 1).
+		Build()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := h.recordMetrics(ctx, evt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMetricsOnlyAllocs(t *testing.T) {
+	// The meter of pgexttest does not allocate outside of RecordMetrics,
+	// unlike an SDK, so only the allocations of pgext are counted.
+	t.Run("Install", func(t *testing.T) { pgexttest.RecordMetrics(t) })
+
+	h := &OpenTelemetryHook{AllowMetric: true, SlowQueryThreshold: time.Second, Instance: "main"}
+	ctx := WithCostTags(context.Background(), CostTags{Team: "payments"})
+
+	// The server version of detected is known, the one of undetected is not.
+	detected := pg.Connect(&pg.Options{Addr: "detected:5432"})
+	defer servers.Delete("detected:5432")
+	serverInfoOf("detected:5432").setVersion(130004)
+	undetected := pg.Connect(&pg.Options{Addr: "undetected:5432"})
+
+	for name, evt := range map[string]*pg.QueryEvent{
+		"Raw": pgexttest.NewQueryEvent(`SELECT * FROM users WHERE id = ?`, 1).
+			Result(0, 1).
+			Build(),
+		"Model": pgexttest.NewQueryEvent(`SELECT "user"."id" FROM users AS "user" WHERE id = ?`, 1).
+			Operation(orm.SelectOp).
+			Result(0, 1).
+			Build(),
+		"ServerVersion": pgexttest.NewQueryEvent(`SELECT 1`).
+			DB(detected).
+			Result(0, 1).
+			Build(),
+		"UndetectedServerVersion": pgexttest.NewQueryEvent(`SELECT 1`).
+			DB(undetected).
+			Result(0, 1).
+			Build(),
+	} {
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := h.recordMetrics(ctx, evt); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: got %v allocations per query, want 0", name, allocs)
+		}
+	}
+}
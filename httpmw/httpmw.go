@@ -0,0 +1,153 @@
+// Package httpmw provides an HTTP middleware that starts a span per request
+// and marks the request context for the query hooks of pgext, for services
+// without OpenTelemetry HTTP instrumentation.
+package httpmw
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/j2gg0s/pgext"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+const instrumentationName = "github.com/j2gg0s/pgext/httpmw"
+
+type routeKey struct{}
+
+type tenantKey struct{}
+
+// RouteFromContext returns the route of the request, or an empty string.
+// Use it as the Route of pgext.Commenter.
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeKey{}).(string)
+	return route
+}
+
+// TenantFromContext returns the tenant of the request, or an empty string.
+// Use it as the Tenant of pgext.OpenTelemetryHook.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Middleware starts a server span per request, the parent of the query spans,
+// and marks the request context with the route, the tenant, the priority,
+// the request ID and a pgext request scope:
+//
+//   mw := &httpmw.Middleware{
+//       Tenant: func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+//   }
+//   http.ListenAndServe(addr, mw.Handler(mux))
+//
+//   db.AddQueryHook(&pgext.OpenTelemetryHook{
+//       Tenant:            httpmw.TenantFromContext,
+//       RequestID:         pgext.RequestIDFromContext,
+//       ContextAttributes: (&pgext.Commenter{Route: httpmw.RouteFromContext}).ContextAttributes(),
+//   })
+//
+// The span is a child of a span already in the request context. Trace
+// context in the request headers is not extracted.
+type Middleware struct {
+	// Route returns the route of the request, e.g. /users/{id}. Keep its
+	// cardinality low. Defaults to the URL path.
+	Route func(r *http.Request) string
+	// Tenant, if set, returns the tenant of the request.
+	Tenant func(r *http.Request) string
+	// Priority, if set, returns the query priority of the request.
+	Priority func(r *http.Request) pgext.Priority
+	// RequestIDHeader is the header with the request ID. Defaults to
+	// X-Request-ID.
+	RequestIDHeader string
+	// Tracer, if set, is used instead of the global tracer.
+	Tracer trace.Tracer
+}
+
+// Handler wraps next with the middleware.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		route := r.URL.Path
+		if m.Route != nil {
+			route = m.Route(r)
+		}
+		ctx = context.WithValue(ctx, routeKey{}, route)
+		if m.Tenant != nil {
+			if tenant := m.Tenant(r); tenant != "" {
+				ctx = context.WithValue(ctx, tenantKey{}, tenant)
+			}
+		}
+		if m.Priority != nil {
+			ctx = pgext.WithPriority(ctx, m.Priority(r))
+		}
+		header := m.RequestIDHeader
+		if header == "" {
+			header = "X-Request-ID"
+		}
+		requestID := r.Header.Get(header)
+		if requestID != "" {
+			ctx = pgext.WithRequestID(ctx, requestID)
+		}
+		ctx = pgext.WithRequestScope(ctx)
+
+		tracer := m.Tracer
+		if tracer == nil {
+			tracer = global.Tracer(instrumentationName)
+		}
+		attrs := []label.KeyValue{
+			label.String("http.method", r.Method),
+			label.String("http.route", route),
+		}
+		if requestID != "" {
+			attrs = append(attrs, label.String("request.id", requestID))
+		}
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(label.Int("http.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Internal, http.StatusText(sw.status))
+		}
+	})
+}
+
+// statusWriter records the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wrote {
+		w.status, w.wrote = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the response if the underlying writer supports it.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,48 @@
+package httpmw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/j2gg0s/pgext"
+)
+
+func TestMiddleware(t *testing.T) {
+	mw := &Middleware{
+		Route:    func(r *http.Request) string { return "/users/{id}" },
+		Tenant:   func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		Priority: func(r *http.Request) pgext.Priority { return pgext.PriorityBatch },
+	}
+
+	var route, tenant, requestID string
+	var priority pgext.Priority
+	h := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		route, tenant = RouteFromContext(ctx), TenantFromContext(ctx)
+		requestID, priority = pgext.RequestIDFromContext(ctx), pgext.PriorityFromContext(ctx)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	r := httptest.NewRequest("GET", "/users/42", nil)
+	r.Header.Set("X-Tenant", "acme")
+	r.Header.Set("X-Request-ID", "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if route != "/users/{id}" || tenant != "acme" || requestID != "req-1" || priority != pgext.PriorityBatch {
+		t.Errorf("got route %q, tenant %q, request ID %q and priority %s", route, tenant, requestID, priority)
+	}
+	if w.Code != http.StatusTeapot {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusTeapot)
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	sw := &statusWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	sw.Write([]byte("ok"))
+	sw.WriteHeader(http.StatusInternalServerError)
+	if sw.status != http.StatusOK {
+		t.Errorf("got status %d after the body was written, want 200", sw.status)
+	}
+}
@@ -0,0 +1,65 @@
+package pgext
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var idempotencyHitCounter, _ = meter.NewInt64Counter(
+	"go.sql.idempotency.hits",
+	metric.WithDescription("The number of inserts skipped because their idempotency key was already used"),
+)
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context with the idempotency key of the
+// request, e.g. taken from the Idempotency-Key HTTP header.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key set with
+// WithIdempotencyKey.
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// InsertIdempotent inserts the model and protects against double submits.
+// If the context has an idempotency key, it is stored in the column, which
+// must have a unique index, and the insert becomes ON CONFLICT DO NOTHING.
+// It reports whether the model was inserted; false means the key was
+// already used and is counted in go.sql.idempotency.hits:
+//
+//   ctx = pgext.WithIdempotencyKey(ctx, req.Header.Get("Idempotency-Key"))
+//   inserted, err := pgext.InsertIdempotent(ctx, db, order, "idempotency_key")
+func InsertIdempotent(ctx context.Context, db orm.DB, model interface{}, column string) (bool, error) {
+	q := db.ModelContext(ctx, model)
+
+	key, ok := IdempotencyKeyFromContext(ctx)
+	if !ok {
+		_, err := q.Insert()
+		return err == nil, err
+	}
+
+	res, err := q.
+		Value(column, "?", key).
+		OnConflict("(?) DO NOTHING", pg.Ident(column)).
+		Insert()
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() > 0 {
+		return true, nil
+	}
+
+	var table string
+	if tm := q.TableModel(); tm != nil {
+		table = tm.Table().ModelName
+	}
+	idempotencyHitCounter.Add(ctx, 1, tableKey.String(table))
+	return false, nil
+}
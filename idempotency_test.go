@@ -0,0 +1,63 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInsertIdempotent(t *testing.T) {
+	type Order struct {
+		ID             int64
+		IdempotencyKey string
+	}
+
+	var queries []string
+	conflict := false
+	db := fakeDB(t, func(query string) fakeResult {
+		queries = append(queries, query)
+		if conflict {
+			return fakeResult{Columns: []string{"id", "idempotency_key"}, Tag: "INSERT 0 0"}
+		}
+		return fakeResult{
+			Columns: []string{"id", "idempotency_key"},
+			Rows:    [][]string{{"1", "key"}},
+			Tag:     "INSERT 0 1",
+		}
+	})
+
+	tests := []struct {
+		key        string
+		conflict   bool
+		inserted   bool
+		onConflict bool
+	}{
+		{"", false, true, false},
+		{"key", false, true, true},
+		{"key", true, false, true},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.key != "" {
+			ctx = WithIdempotencyKey(ctx, test.key)
+		}
+		queries, conflict = nil, test.conflict
+
+		order := &Order{}
+		inserted, err := InsertIdempotent(ctx, db, order, "idempotency_key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inserted != test.inserted {
+			t.Errorf("key %q, conflict %t: got inserted %t, want %t",
+				test.key, test.conflict, inserted, test.inserted)
+		}
+		if test.inserted && order.ID != 1 {
+			t.Errorf("key %q: got ID %d, want the returned one", test.key, order.ID)
+		}
+		if len(queries) != 1 || strings.Contains(queries[0], "ON CONFLICT") != test.onConflict {
+			t.Errorf("key %q: got queries %q", test.key, queries)
+		}
+	}
+}
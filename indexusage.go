@@ -0,0 +1,176 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var indexKey = label.Key("sql.index")
+
+type indexUsage struct {
+	Schema string
+	Table  string
+	Index  string
+	Scans  int64
+	Bytes  int64
+	Unique bool
+}
+
+// IndexUsageCollector periodically reads pg_stat_user_indexes and reports
+// the number of scans and the size of every index of the tables, labeled by
+// instance, schema, table and index. Indexes
+// that were never scanned and do not enforce uniqueness are logged once and
+// returned by Unused, so owners can drop indexes that only slow down writes:
+//
+//   c := &pgext.IndexUsageCollector{DB: db, Tables: []string{"events"}}
+//   c.Start()
+//   defer c.Shutdown(ctx)
+//
+// Scans are counted since the statistics were last reset, so check
+// pg_stat_reset before dropping an index.
+type IndexUsageCollector struct {
+	// DB is the database the tables are in.
+	DB *pg.DB
+	// Tables lists the tables whose indexes are reported, optionally
+	// qualified by schema. Defaults to all user tables.
+	Tables []string
+	// Instance is the sql.instance label. Defaults to the database name.
+	Instance string
+	// Interval is the time between samples. Defaults to 1m.
+	Interval time.Duration
+	// Logger is used to print unused indexes and sampling errors. Defaults to
+	// the standard logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the sampled values against threshold rules.
+	Alerter *Alerter
+
+	poller   poller
+	mu       sync.Mutex
+	usage    []indexUsage
+	reported map[string]bool
+}
+
+var _ Shutdowner = (*IndexUsageCollector)(nil)
+
+type indexUsageInstruments struct {
+	scans metric.Int64SumObserver
+	size  metric.Int64ValueObserver
+}
+
+// Start starts sampling in the background and reporting the metrics.
+func (c *IndexUsageCollector) Start() {
+	if !c.poller.start(c.Interval, c.collect) {
+		return
+	}
+
+	c.poller.onShutdown(observeBatch("go.sql.index.scans",
+		func(batch metric.BatchObserver) interface{} {
+			var i indexUsageInstruments
+			i.scans, _ = batch.NewInt64SumObserver("go.sql.index.scans",
+				metric.WithDescription("The number of scans of the index"))
+			i.size, _ = batch.NewInt64ValueObserver("go.sql.index.bytes",
+				metric.WithDescription("The size of the index in bytes"))
+			return &i
+		},
+		func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			i := instruments.(*indexUsageInstruments)
+			c.mu.Lock()
+			usage := c.usage
+			c.mu.Unlock()
+
+			instance := instanceName(c.DB, c.Instance)
+			for _, u := range usage {
+				result.Observe(u.labels(instance),
+					i.scans.Observation(u.Scans),
+					i.size.Observation(u.Bytes),
+				)
+			}
+		}))
+}
+
+// Shutdown stops sampling and reporting the metrics.
+func (c *IndexUsageCollector) Shutdown(ctx context.Context) error {
+	return c.poller.shutdown(ctx)
+}
+
+// Unused returns the sorted names of the indexes that were never scanned
+// and do not enforce uniqueness, as of the last sample.
+func (c *IndexUsageCollector) Unused() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var unused []string
+	for _, u := range c.usage {
+		if u.Scans == 0 && !u.Unique {
+			unused = append(unused, u.Index)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+func (c *IndexUsageCollector) collect(ctx context.Context) {
+	query := `
+		SELECT s.schemaname AS schema,
+			s.relname AS "table",
+			s.indexrelname AS "index",
+			s.idx_scan AS scans,
+			pg_relation_size(s.indexrelid) AS bytes,
+			i.indisunique AS "unique"
+		FROM pg_stat_user_indexes AS s
+		JOIN pg_index AS i ON i.indexrelid = s.indexrelid`
+	var params []interface{}
+	if len(c.Tables) > 0 {
+		query += `
+		WHERE s.relid IN (SELECT to_regclass(t) FROM unnest(ARRAY[?]::text[]) AS t)`
+		params = append(params, pg.In(c.Tables))
+	}
+
+	var usage []indexUsage
+	if _, err := c.DB.QueryContext(ctx, &usage, query, params...); err != nil {
+		if ctx.Err() == nil {
+			logf(c.Logger, "pgext: sampling index usage failed: %s", err)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	c.usage = usage
+	if c.reported == nil {
+		c.reported = make(map[string]bool)
+	}
+	var unused []indexUsage
+	for _, u := range usage {
+		if key := u.Schema + "." + u.Index; u.Scans == 0 && !u.Unique && !c.reported[key] {
+			c.reported[key] = true
+			unused = append(unused, u)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, u := range unused {
+		logf(c.Logger, "pgext: index %s.%s on %s (%d bytes) was never used", u.Schema, u.Index, u.Table, u.Bytes)
+	}
+
+	instance := instanceName(c.DB, c.Instance)
+	samples := make([]sample, 0, 2*len(usage))
+	for _, u := range usage {
+		labels := u.labels(instance)
+		samples = append(samples,
+			sample{"go.sql.index.scans", labels, float64(u.Scans)},
+			sample{"go.sql.index.bytes", labels, float64(u.Bytes)},
+		)
+	}
+	c.Alerter.check(ctx, samples)
+}
+
+func (u indexUsage) labels(instance string) []label.KeyValue {
+	return append(tableLabels(instance, u.Schema, u.Table), indexKey.String(u.Index))
+}
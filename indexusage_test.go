@@ -0,0 +1,60 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexUsageCollector(t *testing.T) {
+	db := fakeDB(t, func(string) fakeResult {
+		return fakeResult{
+			Columns: []string{"schema", "table", "index", "scans", "bytes", "unique"},
+			Rows: [][]string{
+				{"public", "users", "users_pkey", "0", "8192", "t"},
+				{"public", "users", "users_name_idx", "0", "16384", "f"},
+				{"public", "users", "users_email_idx", "42", "16384", "f"},
+			},
+		}
+	})
+
+	var buf bytes.Buffer
+	c := &IndexUsageCollector{DB: db, Logger: log.New(&buf, "", 0)}
+	ctx := context.Background()
+	c.collect(ctx)
+	c.collect(ctx)
+
+	if got, want := c.Unused(), []string{"users_name_idx"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got unused %q, want %q", got, want)
+	}
+	if n := strings.Count(buf.String(), "was never used"); n != 1 {
+		t.Errorf("unused index is logged %d times, want once:\n%s", n, buf.String())
+	}
+}
+
+func TestIndexUsageCollectorMetrics(t *testing.T) {
+	db := fakeDB(t, func(string) fakeResult {
+		return fakeResult{
+			Columns: []string{"schema", "table", "index", "scans", "bytes", "unique"},
+			Rows: [][]string{
+				{"public", "events", "events_pkey", "42", "8192", "t"},
+				{"audit", "events", "events_pkey", "0", "8192", "t"},
+			},
+		}
+	})
+
+	testCollectorMetrics(t, "go.sql.index.scans",
+		map[string]string{"sql.schema": "public", "sql.table": "events", "sql.index": "events_pkey"},
+		func(instance string) (Shutdowner, func() bool) {
+			c := &IndexUsageCollector{DB: db, Instance: instance}
+			c.Start()
+			return c, func() bool {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return c.usage != nil
+			}
+		})
+}
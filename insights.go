@@ -0,0 +1,36 @@
+package pgext
+
+// CloudSQLInsightsQueryLength is the number of bytes of a query Cloud SQL
+// Query Insights keeps by default.
+const CloudSQLInsightsQueryLength = 1024
+
+// CloudSQLInsights returns a Commenter preset for Cloud SQL Query Insights:
+// the driver is go-pg and the comment is capped at a quarter of
+// CloudSQLInsightsQueryLength unless MaxLength is set.
+//
+//   c := pgext.CloudSQLInsights(pgext.Commenter{
+//       Application: "orders",
+//       Framework:   "gin",
+//       Route:       routeFromContext,
+//   })
+//   h := pgext.Wrap(db, pgext.WithCloudSQLInsights(c))
+//   _, err := db.ExecContext(ctx, c.Apply(ctx, query))
+func CloudSQLInsights(c Commenter) *Commenter {
+	if c.DBDriver == "" {
+		c.DBDriver = "go-pg"
+	}
+	if c.MaxLength <= 0 {
+		c.MaxLength = CloudSQLInsightsQueryLength / 4
+	}
+	return &c
+}
+
+// WithCloudSQLInsights adds the tags of the commenter to query spans under
+// their sqlcommenter names, so traces and Query Insights attribute queries
+// the same way.
+func WithCloudSQLInsights(c *Commenter) Option {
+	return func(cfg *wrapConfig) {
+		WithContextAttributes(c.ContextAttributes())(cfg)
+		WithBaggageKeys(c.BaggageKeys...)(cfg)
+	}
+}
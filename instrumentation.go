@@ -0,0 +1,118 @@
+package pgext
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// instrumentationVersion is the version of pgext in the build, reported as
+// the instrumentation version so backends can tell releases apart.
+var instrumentationVersion = moduleVersion(instrumentationName)
+
+// moduleVersion returns the version of the module from the build info, or
+// an empty string if it is unknown.
+func moduleVersion(path string) string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if bi.Main.Path == path {
+		return bi.Main.Version
+	}
+	for _, m := range bi.Deps {
+		if m.Path != path {
+			continue
+		}
+		if m.Replace != nil && m.Replace.Version != "" {
+			return m.Replace.Version
+		}
+		return m.Version
+	}
+	return ""
+}
+
+// instruments are the tracer and the query instruments of OpenTelemetryHook
+// for one instrumentation name and version.
+type instruments struct {
+	tracer trace.Tracer
+
+	// Method values of the instruments are bound once, so passing them to
+	// MetricQueue.record does not allocate.
+	recordLatency func(context.Context, int64, ...label.KeyValue)
+	addSlowQuery  func(context.Context, int64, ...label.KeyValue)
+	addCanceled   func(context.Context, int64, ...label.KeyValue)
+	addDDL        func(context.Context, int64, ...label.KeyValue)
+}
+
+// newInstruments creates the instruments with their go.sql.* names passed
+// through rename, if set.
+func newInstruments(tracer trace.Tracer, meter metric.Meter, rename func(string) string) *instruments {
+	if rename == nil {
+		rename = func(name string) string { return name }
+	}
+	latency, _ := meter.NewInt64ValueRecorder(
+		rename("go.sql.latency"),
+		metric.WithDescription("The latency of calls in microsecond"),
+	)
+	slowQueries, _ := meter.NewInt64Counter(
+		rename("go.sql.slow_queries"),
+		metric.WithDescription("The number of queries slower than the slow query threshold"),
+	)
+	canceled, _ := meter.NewInt64Counter(
+		rename("go.sql.canceled"),
+		metric.WithDescription("The number of queries whose context expired or was canceled while they ran"),
+	)
+	ddl, _ := meter.NewInt64Counter(
+		rename("go.sql.ddl"),
+		metric.WithDescription("The number of executed DDL statements"),
+	)
+	return &instruments{
+		tracer:        tracer,
+		recordLatency: latency.Record,
+		addSlowQuery:  slowQueries.Add,
+		addCanceled:   canceled.Add,
+		addDDL:        ddl.Add,
+	}
+}
+
+// instruments returns the instruments of the hook's instrumentation name
+// and metric names. Other instruments of pgext, e.g. of the collectors,
+// always use the pgext name and go.sql.* metric names.
+func (h *OpenTelemetryHook) instruments() *instruments {
+	if h.InstrumentationName == "" && h.MetricPrefix == "" && h.MetricName == nil {
+		return defaultInstruments
+	}
+	h.scopeOnce.Do(func() {
+		name, version := h.InstrumentationName, h.InstrumentationVersion
+		if name == "" {
+			name = instrumentationName
+		}
+		if version == "" {
+			version = instrumentationVersion
+		}
+		h.scope = newInstruments(
+			global.TraceProvider().Tracer(name, trace.WithInstrumentationVersion(version)),
+			global.MeterProvider().Meter(name, metric.WithInstrumentationVersion(version)),
+			h.metricName,
+		)
+	})
+	return h.scope
+}
+
+// metricName returns the name of the metric with the go.sql prefix replaced
+// by MetricPrefix and renamed by MetricName.
+func (h *OpenTelemetryHook) metricName(name string) string {
+	if h.MetricPrefix != "" {
+		name = strings.TrimSuffix(h.MetricPrefix, ".") + strings.TrimPrefix(name, "go.sql")
+	}
+	if h.MetricName != nil {
+		name = h.MetricName(name)
+	}
+	return name
+}
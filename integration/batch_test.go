@@ -0,0 +1,47 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10/orm"
+
+	"github.com/j2gg0s/pgext"
+)
+
+type Event struct {
+	ID   int64
+	Name string
+}
+
+func TestInsertBatches(t *testing.T) {
+	db := StartPostgres(t)
+	ctx := context.Background()
+
+	err := db.ModelContext(ctx, (*Event)(nil)).CreateTable(&orm.CreateTableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make([]*Event, 25)
+	for i := range events {
+		events[i] = &Event{Name: "event"}
+	}
+	opt := pgext.BatchOptions{MaxRows: 10, MaxBytes: 200, InTx: true}
+	if err := pgext.InsertBatches(ctx, db, &events, opt); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.ModelContext(ctx, (*Event)(nil)).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(events) {
+		t.Errorf("got %d rows, want %d", n, len(events))
+	}
+	for _, evt := range events {
+		if evt.ID == 0 {
+			t.Fatal("returned IDs are not scanned")
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/j2gg0s/pgext/integration
+
+go 1.16
+
+require (
+	github.com/go-pg/pg/v10 v10.0.6
+	github.com/j2gg0s/pgext v0.0.0-00010101000000-000000000000
+	github.com/testcontainers/testcontainers-go v0.9.0
+	go.opentelemetry.io/otel v0.11.0
+)
+
+replace github.com/j2gg0s/pgext => ../
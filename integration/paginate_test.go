@@ -0,0 +1,63 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10/orm"
+
+	"github.com/j2gg0s/pgext"
+)
+
+type Item struct {
+	ID   int64
+	Rank int
+}
+
+func TestPaginator(t *testing.T) {
+	db := StartPostgres(t)
+	ctx := context.Background()
+
+	err := db.ModelContext(ctx, (*Item)(nil)).CreateTable(&orm.CreateTableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]*Item, 7)
+	for i := range items {
+		items[i] = &Item{Rank: i % 3}
+	}
+	if _, err := db.ModelContext(ctx, &items).Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &pgext.Paginator{Column: "rank", Limit: 3}
+	seen := make(map[int64]bool)
+	var cursor string
+	for page := 0; ; page++ {
+		var got []*Item
+		q, err := p.Apply(ctx, db.ModelContext(ctx, &got), cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Select(); err != nil {
+			t.Fatal(err)
+		}
+
+		n, more := p.Page(ctx, len(got))
+		for _, item := range got[:n] {
+			if seen[item.ID] {
+				t.Fatalf("item %d is returned twice", item.ID)
+			}
+			seen[item.ID] = true
+		}
+		if !more {
+			break
+		}
+		last := got[n-1]
+		cursor = pgext.NewCursor(last.Rank, last.ID).String()
+	}
+
+	if len(seen) != len(items) {
+		t.Errorf("got %d items, want %d", len(seen), len(items))
+	}
+}
@@ -0,0 +1,94 @@
+// Package integration runs pgext hooks against a disposable PostgreSQL
+// started with testcontainers-go. It needs Docker.
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Image is the PostgreSQL image used by StartPostgres. It can be overridden
+// with the PGEXT_POSTGRES_IMAGE environment variable.
+var Image = "postgres:13-alpine"
+
+const (
+	user     = "pgext"
+	password = "pgext"
+	database = "pgext"
+)
+
+// StartPostgres starts a disposable PostgreSQL container and returns a
+// connected database. Both are cleaned up when the test finishes. The test is
+// skipped if the container can not be started, e.g. Docker is not available.
+func StartPostgres(t testing.TB) *pg.DB {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	image := Image
+	if v := os.Getenv("PGEXT_POSTGRES_IMAGE"); v != "" {
+		image = v
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        image,
+			ExposedPorts: []string{"5432/tcp"},
+			Env: map[string]string{
+				"POSTGRES_USER":     user,
+				"POSTGRES_PASSWORD": password,
+				"POSTGRES_DB":       database,
+			},
+			WaitingFor: wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Skipf("integration: can not start postgres: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = container.Terminate(context.Background())
+	})
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := pg.Connect(&pg.Options{
+		Addr:     fmt.Sprintf("%s:%s", host, port.Port()),
+		User:     user,
+		Password: password,
+		Database: database,
+	})
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	for {
+		err := db.Ping(ctx)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("integration: postgres is not ready: %s", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return db
+}
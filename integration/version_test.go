@@ -0,0 +1,49 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10/orm"
+
+	"github.com/j2gg0s/pgext"
+)
+
+type Document struct {
+	ID   int64
+	Body string
+	Rev  int64 `pg:",use_zero"`
+}
+
+func (d *Document) Version() int64     { return d.Rev }
+func (d *Document) SetVersion(v int64) { d.Rev = v }
+
+func TestUpdateVersioned(t *testing.T) {
+	db := StartPostgres(t)
+	ctx := context.Background()
+
+	err := db.ModelContext(ctx, (*Document)(nil)).CreateTable(&orm.CreateTableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &Document{Body: "v0"}
+	if _, err := db.ModelContext(ctx, doc).Insert(); err != nil {
+		t.Fatal(err)
+	}
+	stale := *doc
+
+	doc.Body = "v1"
+	if err := pgext.UpdateVersioned(ctx, db, doc, "rev"); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Rev != 1 {
+		t.Errorf("got version %d, want 1", doc.Rev)
+	}
+
+	stale.Body = "conflict"
+	if err := pgext.UpdateVersioned(ctx, db, &stale, "rev"); !errors.Is(err, pgext.ErrVersionConflict) {
+		t.Errorf("got %v, want ErrVersionConflict", err)
+	}
+}
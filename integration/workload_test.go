@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/j2gg0s/pgext"
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+type Book struct {
+	ID    int64
+	Title string
+}
+
+func TestOpenTelemetryHook(t *testing.T) {
+	db := StartPostgres(t)
+	sr := pgexttest.RecordSpans(t)
+	mr := pgexttest.RecordMetrics(t)
+	db.AddQueryHook(&pgext.OpenTelemetryHook{Caller: true, AllowMetric: true})
+
+	ctx, root := global.Tracer("integration").Start(context.Background(), "root")
+
+	err := db.ModelContext(ctx, (*Book)(nil)).CreateTable(&orm.CreateTableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book := &Book{Title: "go-pg"}
+	if _, err := db.ModelContext(ctx, book).Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ModelContext(ctx, book).WherePK().Select(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ModelContext(ctx, book).Set("title = ?", "pgext").WherePK().Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ModelContext(ctx, &Book{ID: -1}).WherePK().Select(); err != pg.ErrNoRows {
+		t.Fatalf("got %v, want pg.ErrNoRows", err)
+	}
+	if _, err := db.ExecContext(ctx, "SELECT * FROM missing_table"); err == nil {
+		t.Fatal("query on missing table succeeded")
+	}
+
+	root.End()
+	spans := sr.Completed()
+
+	pgexttest.AssertSpan(t, spans,
+		pgexttest.WithName("INSERT"),
+		pgexttest.WithAttr("db.system", "postgres"),
+		pgexttest.WithAttr("db.name", database),
+		pgexttest.WithAttr("db.rows_affected", 1),
+	)
+	pgexttest.AssertSpan(t, spans,
+		pgexttest.WithName("UPDATE"),
+		pgexttest.WithAttr("db.rows_affected", 1),
+	)
+	pgexttest.AssertSpan(t, spans,
+		pgexttest.WithName("SELECT"),
+		pgexttest.WithStatus(codes.NotFound),
+	)
+	pgexttest.AssertSpan(t, spans,
+		pgexttest.WithName("SELECT"),
+		pgexttest.WithStatus(codes.Internal),
+	)
+
+	ms := mr.Measurements()
+	pgexttest.AssertMeasurement(t, ms,
+		pgexttest.WithMetricName("go.sql.latency"),
+		pgexttest.WithLabel("sql.instance", database),
+		pgexttest.WithLabel("sql.method", "INSERT"),
+		pgexttest.WithLabel("sql.table", "book"),
+		pgexttest.WithLabel("sql.status", "OK"),
+	)
+	pgexttest.AssertMeasurement(t, ms,
+		pgexttest.WithMetricName("go.sql.latency"),
+		pgexttest.WithLabel("sql.method", "UPDATE"),
+		pgexttest.WithLabel("sql.status", "OK"),
+	)
+	pgexttest.AssertMeasurement(t, ms,
+		pgexttest.WithMetricName("go.sql.latency"),
+		pgexttest.WithLabel("sql.method", "SELECT"),
+		pgexttest.WithLabel("sql.status", "Error"),
+	)
+}
+
+func TestTableSizeCollector(t *testing.T) {
+	db := StartPostgres(t)
+	mr := pgexttest.RecordMetrics(t)
+	ctx := context.Background()
+
+	err := db.ModelContext(ctx, (*Book)(nil)).CreateTable(&orm.CreateTableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &pgext.TableSizeCollector{DB: db, Tables: []string{"public.books"}}
+	c.Start()
+	defer c.Shutdown(ctx)
+
+	opts := []pgexttest.MetricOption{
+		pgexttest.WithMetricName("go.sql.table.total_bytes"),
+		pgexttest.WithLabel("sql.instance", database),
+		pgexttest.WithLabel("sql.schema", "public"),
+		pgexttest.WithLabel("sql.table", "books"),
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mr.Observe(ctx)
+		if _, ok := pgexttest.FindMeasurement(mr.Measurements(), opts...); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			pgexttest.AssertMeasurement(t, mr.Measurements(), opts...)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestLinkFrom(t *testing.T) {
+	db := StartPostgres(t)
+	sr := pgexttest.RecordSpans(t)
+	db.AddQueryHook(&pgext.OpenTelemetryHook{})
+
+	ctx, root := global.Tracer("integration").Start(context.Background(), "root")
+	root.End()
+
+	if _, err := db.ExecContext(pgext.LinkFrom(ctx), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	span := pgexttest.AssertSpan(t, sr.Completed(), pgexttest.WithName("SELECT"))
+	if span == nil {
+		return
+	}
+	if span.SpanContext().TraceID == root.SpanContext().TraceID {
+		t.Errorf("detached query span is part of the originating trace")
+	}
+	if _, ok := span.Links()[root.SpanContext()]; !ok {
+		t.Errorf("detached query span is not linked to the originator: %v", span.Links())
+	}
+}
+
+func TestSetApplicationName(t *testing.T) {
+	db := StartPostgres(t)
+	pgexttest.RecordSpans(t)
+
+	ctx, span := global.Tracer("integration").Start(context.Background(), "root")
+	defer span.End()
+
+	var name string
+	err := db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := pgext.SetApplicationName(ctx, tx, "orders"); err != nil {
+			return err
+		}
+		_, err := tx.QueryOneContext(ctx, pg.Scan(&name), `SELECT current_setting('application_name')`)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "orders trace=" + span.SpanContext().TraceID.String()[:16]; name != want {
+		t.Errorf("got application_name %q, want %q", name, want)
+	}
+}
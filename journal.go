@@ -0,0 +1,252 @@
+package pgext
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var (
+	journaledCounter, _ = meter.NewInt64Counter(
+		"go.sql.journal.writes",
+		metric.WithDescription("The number of failed writes journaled for replay"),
+	)
+	replayedCounter, _ = meter.NewInt64Counter(
+		"go.sql.journal.replayed",
+		metric.WithDescription("The number of journaled writes replayed"),
+	)
+)
+
+type journalEntry struct {
+	Time  time.Time `json:"time"`
+	Query string    `json:"query"`
+}
+
+type replayKey struct{}
+
+// WriteJournal is a pg.QueryHook that appends writes which fail because the
+// database is unavailable to a local file, so they can be replayed once it
+// recovers. It is a stopgap for fire-and-forget writes, e.g. telemetry, and
+// must not be used for writes that depend on each other: writes in
+// transactions are not journaled and replay does not preserve atomicity.
+//
+// Only writes that fail before they are sent, e.g. because the database can
+// not be reached, are journaled. A write whose connection breaks afterwards
+// may have been applied, so replaying it could apply it twice.
+//
+//   journal := &pgext.WriteJournal{Path: "/var/lib/app/pg.journal"}
+//   db.AddQueryHook(journal)
+//
+//   // Once the database is healthy again:
+//   n, err := journal.Replay(ctx, db)
+type WriteJournal struct {
+	// Path is the file the journal is written to.
+	Path string
+	// ExcludeTables lists tables whose writes are never journaled.
+	ExcludeTables []string
+	// Logger is used to print journal errors. Defaults to the standard logger.
+	Logger *log.Logger
+
+	mu sync.Mutex
+}
+
+var _ pg.QueryHook = (*WriteJournal)(nil)
+
+func (j *WriteJournal) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (j *WriteJournal) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if !unsent(evt.Err) || ctx.Value(replayKey{}) != nil {
+		return nil
+	}
+	if _, ok := evt.DB.(*pg.Tx); ok {
+		return nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return nil
+	}
+	query := strings.TrimSpace(string(b))
+
+	table, ok := writeTable(query)
+	if !ok {
+		return nil
+	}
+	for _, excluded := range j.ExcludeTables {
+		if strings.EqualFold(table, excluded) {
+			return nil
+		}
+	}
+
+	if err := j.append(journalEntry{Time: evt.StartTime, Query: query}); err != nil {
+		j.printf("pgext: journaling failed write: %s", err)
+		return nil
+	}
+	journaledCounter.Add(ctx, 1, tableKey.String(table))
+	return nil
+}
+
+// unsent reports whether err means the query failed before it was sent,
+// because no connection to the server could be established.
+func unsent(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		// Errors during the startup of a connection: the server rejected the
+		// connection or is starting up.
+		switch pgErr.Field('C') {
+		case "08001", "08004", "57P03":
+			return true
+		}
+	}
+	return false
+}
+
+func (j *WriteJournal) append(entry journalEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Replay executes the journaled writes in order and removes them from the
+// journal. It stops at the first error and keeps the remaining writes. It
+// returns the number of replayed writes.
+func (j *WriteJournal) Replay(ctx context.Context, db orm.DB) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.read()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = context.WithValue(ctx, replayKey{}, true)
+	var n int
+	for _, entry := range entries {
+		if _, err = db.ExecContext(ctx, rawQuery, pg.Safe(entry.Query)); err != nil {
+			break
+		}
+		n++
+	}
+	if n > 0 {
+		replayedCounter.Add(ctx, int64(n))
+	}
+
+	if err2 := j.write(entries[n:]); err == nil {
+		err = err2
+	}
+	return n, err
+}
+
+func (j *WriteJournal) read() ([]journalEntry, error) {
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (j *WriteJournal) write(entries []journalEntry) error {
+	if len(entries) == 0 {
+		err := os.Remove(j.Path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var b []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+
+	tmp := j.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.Path)
+}
+
+func (j *WriteJournal) printf(format string, args ...interface{}) {
+	if j.Logger != nil {
+		j.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// writeTable returns the table of an INSERT, UPDATE or DELETE statement.
+func writeTable(query string) (string, bool) {
+	fields := strings.Fields(query)
+	var i int
+	switch {
+	case len(fields) >= 3 && strings.EqualFold(fields[0], "INSERT") && strings.EqualFold(fields[1], "INTO"),
+		len(fields) >= 3 && strings.EqualFold(fields[0], "DELETE") && strings.EqualFold(fields[1], "FROM"):
+		i = 2
+	case len(fields) >= 2 && strings.EqualFold(fields[0], "UPDATE"):
+		i = 1
+	default:
+		return "", false
+	}
+
+	table := fields[i]
+	if idx := strings.IndexByte(table, '('); idx >= 0 {
+		table = table[:idx]
+	}
+	return strings.Trim(table, `"`), true
+}
@@ -0,0 +1,119 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestWriteTable(t *testing.T) {
+	tests := []struct {
+		query string
+		table string
+		ok    bool
+	}{
+		{`INSERT INTO "events" ("id") VALUES (1)`, "events", true},
+		{`insert into events(id) values (1)`, "events", true},
+		{`UPDATE users SET name = 'x'`, "users", true},
+		{`DELETE FROM "sessions" WHERE id = 1`, "sessions", true},
+		{`SELECT * FROM users`, "", false},
+	}
+
+	for _, test := range tests {
+		table, ok := writeTable(test.query)
+		if table != test.table || ok != test.ok {
+			t.Errorf("writeTable(%q) = %q, %t, want %q, %t", test.query, table, ok, test.table, test.ok)
+		}
+	}
+}
+
+func TestUnsent(t *testing.T) {
+	tests := []struct {
+		err    error
+		unsent bool
+	}{
+		{nil, false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, false},
+		{sqlStateError("57P03"), true},
+		{sqlStateError("57P01"), false},
+		{io.EOF, false},
+		{io.ErrUnexpectedEOF, false},
+	}
+
+	for _, test := range tests {
+		if got := unsent(test.err); got != test.unsent {
+			t.Errorf("unsent(%v) = %t, want %t", test.err, got, test.unsent)
+		}
+	}
+}
+
+func TestWriteJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var replayed []string
+	db := fakeDB(t, func(query string) fakeResult {
+		replayed = append(replayed, query)
+		if strings.HasPrefix(query, "DELETE") {
+			return fakeResult{Err: "08006"}
+		}
+		return fakeResult{Tag: "INSERT 0 1"}
+	})
+
+	j := &WriteJournal{Path: filepath.Join(dir, "journal"), ExcludeTables: []string{"audit"}}
+	ctx := context.Background()
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	for _, evt := range []*pg.QueryEvent{
+		{DB: db, Query: `INSERT INTO events VALUES (1)`, Err: refused},
+		{DB: db, Query: `INSERT INTO events VALUES (2)`},
+		{DB: db, Query: `INSERT INTO events VALUES (3)`, Err: io.EOF},
+		{DB: db, Query: `INSERT INTO audit VALUES (4)`, Err: refused},
+		{DB: db, Query: `SELECT 1`, Err: refused},
+		{DB: db, Query: `UPDATE events SET n = 5`, Err: refused},
+		{DB: db, Query: `DELETE FROM events`, Err: refused},
+	} {
+		if err := j.AfterQuery(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := j.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 ||
+		entries[0].Query != `INSERT INTO events VALUES (1)` ||
+		entries[1].Query != `UPDATE events SET n = 5` ||
+		entries[2].Query != `DELETE FROM events` {
+		t.Fatalf("got journal %+v", entries)
+	}
+
+	n, err := j.Replay(ctx, db)
+	if err == nil {
+		t.Fatal("replay does not stop at the failed write")
+	}
+	if n != 2 || len(replayed) != 3 {
+		t.Errorf("replayed %d writes of %q, want 2", n, replayed)
+	}
+
+	entries, err = j.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Query != `DELETE FROM events` {
+		t.Errorf("got journal %+v after replay, want the failed write", entries)
+	}
+}
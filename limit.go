@@ -0,0 +1,76 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrNoLimit is returned by LimitGuardHook for SELECTs without LIMIT.
+var ErrNoLimit = errors.New("pgext: SELECT without LIMIT")
+
+var limitRe = regexp.MustCompile(`(?i)\b(?:LIMIT|FETCH)\b`)
+
+type allowFullScanKey struct{}
+
+// AllowFullScan returns a context in which LimitGuardHook lets SELECTs
+// without LIMIT through, for intentional full scans.
+func AllowFullScan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowFullScanKey{}, true)
+}
+
+// LimitGuardHook is a pg.QueryHook for development and tests that fails
+// SELECTs without LIMIT, so local tooling and tests do not accidentally
+// stream entire tables. Aggregates are allowed:
+//
+//   if os.Getenv("ENV") == "dev" {
+//       db.AddQueryHook(&pgext.LimitGuardHook{})
+//   }
+//
+// go-pg formats queries before hooks run, so the hook can not add a LIMIT
+// itself.
+type LimitGuardHook struct {
+	// LogOnly causes the hook to log the query instead of failing it.
+	LogOnly bool
+	// Logger is used when LogOnly is set. Defaults to the standard logger.
+	Logger *log.Logger
+}
+
+var _ pg.QueryHook = (*LimitGuardHook)(nil)
+
+func (h *LimitGuardHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	if allowed, _ := ctx.Value(allowFullScanKey{}).(bool); allowed {
+		return ctx, nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+	query := normalizeQuery(string(b))
+	if !selectFromRe.MatchString(query) || limitRe.MatchString(query) || aggregateRe.MatchString(query) {
+		return ctx, nil
+	}
+
+	if !h.LogOnly {
+		return ctx, fmt.Errorf("%w: %s", ErrNoLimit, query)
+	}
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+
+	printf := log.Printf
+	if h.Logger != nil {
+		printf = h.Logger.Printf
+	}
+	printf("pgext: SELECT without LIMIT at %s (%s:%d):\n%s", fn, file, line, query)
+
+	return ctx, nil
+}
+
+func (h *LimitGuardHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
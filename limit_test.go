@@ -0,0 +1,45 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestLimitGuardHook(t *testing.T) {
+	h := &LimitGuardHook{}
+	ctx := context.Background()
+
+	tests := []struct {
+		ctx   context.Context
+		query string
+		err   error
+	}{
+		{ctx, `SELECT id FROM users WHERE name = 'x'`, ErrNoLimit},
+		{ctx, `SELECT id FROM users LIMIT 10`, nil},
+		{ctx, `SELECT id FROM users FETCH FIRST 1 ROWS ONLY`, nil},
+		{ctx, `SELECT count(*) FROM users`, nil},
+		{ctx, `SELECT 1`, nil},
+		{ctx, `UPDATE users SET name = 'x'`, nil},
+		{AllowFullScan(ctx), `SELECT id FROM users`, nil},
+	}
+
+	for _, test := range tests {
+		_, err := h.BeforeQuery(test.ctx, &pg.QueryEvent{Query: test.query})
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: got %v, want %v", test.query, err, test.err)
+		}
+	}
+
+	// Prepared statements and hand-built events have no formatted query.
+	evt := pgexttest.NewQueryEvent(`SELECT id FROM users WHERE name = $1`).
+		Operation(orm.SelectOp).
+		Build()
+	if _, err := h.BeforeQuery(ctx, evt); !errors.Is(err, ErrNoLimit) {
+		t.Errorf("unformatted query: got %v, want %v", err, ErrNoLimit)
+	}
+}
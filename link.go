@@ -0,0 +1,30 @@
+package pgext
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type linkKey struct{}
+
+// LinkFrom returns a fresh context, without the deadline, cancellation and
+// span of ctx, for queries that run in a detached goroutine. Their spans are
+// new traces linked to the span in ctx instead of being orphaned:
+//
+//   go func(ctx context.Context) {
+//       _, err := db.ExecContext(ctx, `UPDATE stats SET ...`)
+//   }(pgext.LinkFrom(ctx))
+func LinkFrom(ctx context.Context) context.Context {
+	detached := context.Background()
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		detached = context.WithValue(detached, linkKey{}, sc)
+	}
+	return detached
+}
+
+// linkedSpanContext returns the span context stored by LinkFrom.
+func linkedSpanContext(ctx context.Context) (trace.SpanContext, bool) {
+	sc, ok := ctx.Value(linkKey{}).(trace.SpanContext)
+	return sc, ok
+}
@@ -0,0 +1,152 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/label"
+)
+
+// LintRule describes a query anti-pattern checked by LintHook.
+type LintRule struct {
+	// Name identifies the rule in reports.
+	Name string
+	// Message explains why the pattern is a problem.
+	Message string
+	// Match reports whether the formatted query contains the anti-pattern.
+	Match func(query string) bool
+}
+
+var (
+	selectStarRe      = regexp.MustCompile(`(?i)^\s*SELECT\s+(?:DISTINCT\s+)?(?:[\w"]+\.)?\*`)
+	leadingWildcardRe = regexp.MustCompile(`(?i)\bI?LIKE\s+'%`)
+	selectFromRe      = regexp.MustCompile(`(?i)^\s*SELECT\b.*\bFROM\b`)
+	whereOrLimitRe    = regexp.MustCompile(`(?i)\b(?:WHERE|LIMIT|FETCH)\b`)
+	aggregateRe       = regexp.MustCompile(`(?i)^\s*SELECT\s+(?:count|sum|min|max|avg|exists)\s*\(`)
+	castInConditionRe = regexp.MustCompile(`(?i)\b(?:WHERE|AND|OR|ON)\s+[\w".]+::\w+\s*(?:=|<|>|<=|>=|<>|!=|\bIN\b|\bI?LIKE\b)`)
+	// implicitCastRe matches a column compared with a numeric value, which
+	// casts the column, e.g. an integer one, to numeric. The literals of the
+	// query are replaced by numericLiterals first.
+	implicitCastRe = regexp.MustCompile(`(?i)\b(?:WHERE|AND|OR|ON)\s+[\w".]+\s*(?:(?:=|<>|!=|<=|>=|<|>)\s*|\bIN\s*\(\s*)(?:\?numeric\b|\?::(?:numeric|decimal|real|double precision|float[48]?)\b)`)
+)
+
+// DefaultLintRules are the rules used by LintHook when none are configured.
+var DefaultLintRules = []LintRule{
+	{
+		Name:    "select_star",
+		Message: "SELECT * fetches every column; list the needed columns instead",
+		Match: func(query string) bool {
+			return selectStarRe.MatchString(query)
+		},
+	},
+	{
+		Name:    "leading_wildcard",
+		Message: "LIKE with a leading wildcard cannot use a b-tree index",
+		Match: func(query string) bool {
+			return leadingWildcardRe.MatchString(query)
+		},
+	},
+	{
+		Name:    "unbounded_select",
+		Message: "SELECT without WHERE or LIMIT reads the whole table",
+		Match: func(query string) bool {
+			query = normalizeQuery(query)
+			return selectFromRe.MatchString(query) &&
+				!whereOrLimitRe.MatchString(query) &&
+				!aggregateRe.MatchString(query)
+		},
+	},
+	{
+		Name:    "column_cast",
+		Message: "casting a column in a condition prevents the use of an index on it",
+		Match: func(query string) bool {
+			return castInConditionRe.MatchString(normalizeQuery(query))
+		},
+	},
+	{
+		Name:    "implicit_cast",
+		Message: "comparing an integer column with a numeric value casts the column, which prevents the use of an index on it",
+		Match: func(query string) bool {
+			return implicitCastRe.MatchString(numericLiterals(query))
+		},
+	},
+}
+
+// numericLiterals returns the query with literals replaced by '?', except
+// numeric literals with a fraction, which are replaced by '?numeric'.
+func numericLiterals(query string) string {
+	return replaceLiterals(query, func(lit string) string {
+		if lit[0] != '\'' && lit[0] != '$' && strings.IndexByte(lit, '.') >= 0 {
+			return "?numeric"
+		}
+		return "?"
+	})
+}
+
+// LintHook is an opt-in pg.QueryHook that inspects outgoing queries and
+// reports anti-patterns as warnings and as events of the query span started
+// by OpenTelemetryHook. Every rule is logged at most once per query shape.
+//
+//   db.AddQueryHook(&pgext.LintHook{})
+type LintHook struct {
+	// Rules to check. Defaults to DefaultLintRules.
+	Rules []LintRule
+	// Logger is used to print warnings. Defaults to the standard logger.
+	Logger *log.Logger
+
+	// reported holds the reported rules and query shapes. It is bounded by
+	// the memory budget, see SetMemoryLimit.
+	reportedOnce sync.Once
+	reported     *lruCache
+}
+
+var _ pg.QueryHook = (*LintHook)(nil)
+
+func (h *LintHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+	query := string(b)
+
+	rules := h.Rules
+	if rules == nil {
+		rules = DefaultLintRules
+	}
+
+	var shape string
+	for _, rule := range rules {
+		if !rule.Match(query) {
+			continue
+		}
+
+		ctx = addQueryEvent(ctx, "pgext.lint",
+			label.String("lint.rule", rule.Name),
+			label.String("lint.message", rule.Message),
+		)
+
+		if shape == "" {
+			shape = normalizeQuery(query)
+		}
+		h.reportedOnce.Do(func() { h.reported = newLRUCache("lint") })
+		if _, loaded := h.reported.loadOrStore(rule.Name+"\x00"+shape, struct{}{}); loaded {
+			continue
+		}
+
+		printf := log.Printf
+		if h.Logger != nil {
+			printf = h.Logger.Printf
+		}
+		printf("pgext: %s: %s:\n%s", rule.Name, rule.Message, redact(strings.TrimSpace(query)))
+	}
+
+	return ctx, nil
+}
+
+func (h *LintHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/global"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestDefaultLintRules(t *testing.T) {
+	tests := []struct {
+		query string
+		rules []string
+	}{
+		{`SELECT * FROM users WHERE id = 1`, []string{"select_star"}},
+		{`SELECT "u".* FROM users AS u LIMIT 1`, []string{"select_star"}},
+		{`SELECT id FROM users WHERE name LIKE '%john'`, []string{"leading_wildcard"}},
+		{`SELECT id FROM users`, []string{"unbounded_select"}},
+		{`SELECT count(*) FROM users`, nil},
+		{`SELECT id FROM users WHERE id::text = '1'`, []string{"column_cast"}},
+		{`SELECT id FROM users WHERE id = 1.0`, []string{"implicit_cast"}},
+		{`SELECT id FROM users WHERE id IN (1.5, 2)`, []string{"implicit_cast"}},
+		{`SELECT id FROM users WHERE id = '1'::numeric`, []string{"implicit_cast"}},
+		{`SELECT id FROM users WHERE id = 1 AND name = '1.5'`, nil},
+		{`SELECT id FROM users WHERE name = 'select * from t'`, nil},
+		{`INSERT INTO users (name) VALUES ('%x')`, nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, rule := range DefaultLintRules {
+			if rule.Match(test.query) {
+				got = append(got, rule.Name)
+			}
+		}
+		if len(got) != len(test.rules) {
+			t.Errorf("%q matched %v, want %v", test.query, got, test.rules)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.rules[i] {
+				t.Errorf("%q matched %v, want %v", test.query, got, test.rules)
+				break
+			}
+		}
+	}
+}
+
+func TestLintHook(t *testing.T) {
+	var buf bytes.Buffer
+	h := &LintHook{Logger: log.New(&buf, "", 0)}
+
+	for _, query := range []string{
+		"SELECT * FROM users WHERE id = 1",
+		"SELECT * FROM users WHERE id = 2",
+		"SELECT id FROM users WHERE id = 3",
+	} {
+		if _, err := h.BeforeQuery(context.Background(), &pg.QueryEvent{Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := strings.Count(buf.String(), "select_star"); n != 1 {
+		t.Errorf("got %d select_star warnings, want 1 per query shape:\n%s", n, buf.String())
+	}
+}
+
+func TestLintHookSpanEvents(t *testing.T) {
+	sr := pgexttest.RecordSpans(t)
+	lint := &LintHook{Logger: log.New(ioutil.Discard, "", 0)}
+	otel := &OpenTelemetryHook{}
+
+	for _, hooks := range [][]pg.QueryHook{{lint, otel}, {otel, lint}} {
+		ctx, parent := global.Tracer("test").Start(context.Background(), "parent")
+		evt := &pg.QueryEvent{Query: "SELECT * FROM users WHERE id = 1", StartTime: time.Now()}
+		for _, hook := range hooks {
+			var err error
+			if ctx, err = hook.BeforeQuery(ctx, evt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i].AfterQuery(ctx, evt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parent.End()
+	}
+
+	var found int
+	for _, span := range sr.Completed() {
+		switch {
+		case span.Name() == "parent" && len(span.Events()) > 0:
+			t.Errorf("got events %v on the parent span, want them on the query span", span.Events())
+		case span.Name() != "parent" && len(span.Events()) > 0:
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("got lint events on %d query spans, want 2", found)
+	}
+}
@@ -0,0 +1,239 @@
+package pgext
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+// DefaultMemoryLimit is the default memory budget of the in-memory
+// aggregators.
+const DefaultMemoryLimit = 64 << 20
+
+var aggregatorKey = label.Key("sql.aggregator")
+
+var memoryEvictionCounter, _ = meter.NewInt64Counter(
+	"go.sql.memory.evictions",
+	metric.WithDescription("The number of entries evicted from in-memory aggregators to stay within the memory budget"),
+)
+
+// memoryAccount is an aggregator whose entries are accounted in the memory
+// budget.
+type memoryAccount interface {
+	// memoryUsage returns the estimated size of the entries in bytes.
+	memoryUsage() int64
+	// evictOldest removes the least recently used entry and returns its size,
+	// or 0 if there are no entries.
+	evictOldest() int64
+	name() string
+}
+
+// memoryBudget is the memory budget shared by all in-memory aggregators,
+// e.g. the statement counts of PrepareTracker and the plans of ExplainHook.
+// Aggregators must not hold their own locks while evicting, which is why
+// reserve is called after the entry is stored.
+type memoryBudget struct {
+	limit int64
+	used  int64
+
+	mu       sync.Mutex
+	accounts []memoryAccount
+}
+
+var memory = &memoryBudget{limit: DefaultMemoryLimit}
+
+func init() {
+	_, _ = meter.NewInt64ValueObserver("go.sql.memory.usage",
+		func(_ context.Context, result metric.Int64ObserverResult) {
+			result.Observe(MemoryUsage())
+		},
+		metric.WithDescription("The estimated memory used by in-memory aggregators in bytes"),
+	)
+}
+
+// SetMemoryLimit sets the total memory budget of the in-memory aggregators,
+// such as the statement counts of PrepareTracker, the plan shapes of
+// ExplainHook and the findings reported by LintHook, in bytes. When the
+// budget is exceeded the least recently used entries of the largest
+// aggregator are evicted. Defaults to DefaultMemoryLimit. Zero or less means
+// no limit.
+func SetMemoryLimit(bytes int64) {
+	atomic.StoreInt64(&memory.limit, bytes)
+	memory.reserve(0)
+}
+
+// MemoryUsage returns the estimated memory used by the in-memory aggregators
+// in bytes. It is reported as go.sql.memory.usage.
+func MemoryUsage() int64 {
+	return atomic.LoadInt64(&memory.used)
+}
+
+func (b *memoryBudget) register(a memoryAccount) {
+	b.mu.Lock()
+	b.accounts = append(b.accounts, a)
+	b.mu.Unlock()
+}
+
+// reserve accounts n bytes and evicts entries until the usage is within the
+// limit.
+func (b *memoryBudget) reserve(n int64) {
+	used := atomic.AddInt64(&b.used, n)
+	limit := atomic.LoadInt64(&b.limit)
+	if limit <= 0 || used <= limit {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for atomic.LoadInt64(&b.used) > limit {
+		var largest memoryAccount
+		var size int64
+		for _, a := range b.accounts {
+			if s := a.memoryUsage(); s > size {
+				largest, size = a, s
+			}
+		}
+		if largest == nil {
+			return
+		}
+		freed := largest.evictOldest()
+		if freed == 0 {
+			return
+		}
+		atomic.AddInt64(&b.used, -freed)
+		memoryEvictionCounter.Add(context.Background(), 1, aggregatorKey.String(largest.name()))
+	}
+}
+
+// entryOverhead is the estimated size of a cache entry without its key and
+// value.
+const entryOverhead = 96
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+// lruCache is a map that evicts its least recently used entries when the
+// shared memory budget is exceeded.
+type lruCache struct {
+	label string
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+}
+
+var _ memoryAccount = (*lruCache)(nil)
+
+// newLRUCache returns a cache accounted in the memory budget. The name labels
+// its evictions.
+func newLRUCache(name string) *lruCache {
+	c := &lruCache{
+		label: name,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+	memory.register(c)
+	return c
+}
+
+func (c *lruCache) name() string {
+	return c.label
+}
+
+// load returns the value of the key and marks it as recently used.
+func (c *lruCache) load(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// store sets the value of the key.
+func (c *lruCache) store(key string, value interface{}) {
+	c.mu.Lock()
+	delta := c.storeLocked(key, value)
+	c.mu.Unlock()
+
+	memory.reserve(delta)
+}
+
+// loadOrStore returns the existing value of the key, or stores value.
+func (c *lruCache) loadOrStore(key string, value interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*lruEntry).value, true
+	}
+	delta := c.storeLocked(key, value)
+	c.mu.Unlock()
+
+	memory.reserve(delta)
+	return value, false
+}
+
+// storeLocked sets the value of the key and returns the change in size.
+// c.mu must be held.
+func (c *lruCache) storeLocked(key string, value interface{}) int64 {
+	size := entryOverhead + int64(len(key))
+	if s, ok := value.(string); ok {
+		size += int64(len(s))
+	}
+
+	delta := size
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		delta -= entry.size
+		entry.value, entry.size = value, size
+		c.ll.MoveToFront(e)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, size: size})
+	}
+	c.bytes += delta
+	return delta
+}
+
+// rangeEntries calls fn for every entry, the most recently used first.
+func (c *lruCache) rangeEntries(fn func(key string, value interface{})) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*lruEntry)
+		fn(entry.key, entry.value)
+	}
+}
+
+func (c *lruCache) memoryUsage() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *lruCache) evictOldest() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.ll.Back()
+	if e == nil {
+		return 0
+	}
+	entry := e.Value.(*lruEntry)
+	c.ll.Remove(e)
+	delete(c.items, entry.key)
+	c.bytes -= entry.size
+	return entry.size
+}
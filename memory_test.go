@@ -0,0 +1,43 @@
+package pgext
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	defer SetMemoryLimit(DefaultMemoryLimit)
+
+	c := newLRUCache("test")
+	key := func(i int) string { return strconv.Itoa(i) + strings.Repeat("x", 1000) }
+	const entry = entryOverhead + 1001
+
+	SetMemoryLimit(MemoryUsage() + 3*entry)
+	for i := 0; i < 5; i++ {
+		c.store(key(i), i)
+	}
+	c.load(key(2))
+	c.store(key(5), 5)
+
+	if usage := c.memoryUsage(); usage != 3*entry {
+		t.Errorf("got cache usage %d, want %d", usage, 3*entry)
+	}
+	for _, i := range []int{2, 4, 5} {
+		if _, ok := c.load(key(i)); !ok {
+			t.Errorf("entry %d was evicted", i)
+		}
+	}
+	if _, ok := c.load(key(3)); ok {
+		t.Error("least recently used entry 3 was not evicted")
+	}
+
+	before := MemoryUsage()
+	SetMemoryLimit(0)
+	for i := 6; i < 10; i++ {
+		c.store(key(i), i)
+	}
+	if got := MemoryUsage() - before; got != 4*entry {
+		t.Errorf("usage grew by %d without limit, want %d", got, 4*entry)
+	}
+}
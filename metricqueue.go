@@ -0,0 +1,106 @@
+package pgext
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+type measurement struct {
+	ctx    context.Context
+	record func(context.Context, int64, ...label.KeyValue)
+	value  int64
+	labels []label.KeyValue
+}
+
+// MetricQueue records metric measurements on a background goroutine, so
+// aggregation and exporter latency stay off the query path. Enqueuing never
+// blocks: measurements are dropped when the queue is full and counted by
+// go.sql.metrics.dropped.
+//
+//   q := &pgext.MetricQueue{}
+//   db.AddQueryHook(&pgext.OpenTelemetryHook{AllowMetric: true, MetricQueue: q})
+//   defer q.Shutdown(ctx)
+type MetricQueue struct {
+	// Size is the maximum number of queued measurements. Defaults to 4096.
+	Size int
+
+	once    sync.Once
+	queue   chan measurement
+	done    chan struct{}
+	closed  int32
+	dropped int64
+	wg      sync.WaitGroup
+}
+
+var _ Shutdowner = (*MetricQueue)(nil)
+
+func (q *MetricQueue) start() {
+	q.once.Do(func() {
+		size := q.Size
+		if size <= 0 {
+			size = 4096
+		}
+		q.queue = make(chan measurement, size)
+		q.done = make(chan struct{})
+
+		_, _ = meter.NewInt64SumObserver("go.sql.metrics.dropped",
+			func(_ context.Context, result metric.Int64ObserverResult) {
+				result.Observe(atomic.LoadInt64(&q.dropped))
+			},
+			metric.WithDescription("The number of metric measurements dropped because the queue was full"),
+		)
+
+		q.wg.Add(1)
+		go q.run()
+	})
+}
+
+func (q *MetricQueue) run() {
+	defer q.wg.Done()
+	for {
+		select {
+		case m := <-q.queue:
+			m.record(m.ctx, m.value, m.labels...)
+		case <-q.done:
+			for {
+				select {
+				case m := <-q.queue:
+					m.record(m.ctx, m.value, m.labels...)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// record records the measurement in the background. Without a queue, or
+// after Shutdown, it records synchronously.
+func (q *MetricQueue) record(ctx context.Context, record func(context.Context, int64, ...label.KeyValue), value int64, labels []label.KeyValue) {
+	if q == nil || atomic.LoadInt32(&q.closed) != 0 {
+		record(ctx, value, labels...)
+		return
+	}
+	q.start()
+
+	select {
+	case q.queue <- measurement{ctx: ctx, record: record, value: value, labels: labels}:
+	default:
+		atomic.AddInt64(&q.dropped, 1)
+	}
+}
+
+// Shutdown records the queued measurements and stops the background
+// goroutine. Later measurements are recorded synchronously.
+func (q *MetricQueue) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&q.closed, 0, 1) {
+		return nil
+	}
+	q.start()
+	close(q.done)
+	return waitGroup(ctx, &q.wg)
+}
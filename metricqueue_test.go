@@ -0,0 +1,41 @@
+package pgext
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+func TestMetricQueue(t *testing.T) {
+	q := &MetricQueue{Size: 1}
+
+	var recorded int64
+	record := func(_ context.Context, v int64, _ ...label.KeyValue) {
+		atomic.AddInt64(&recorded, v)
+	}
+
+	block := make(chan struct{})
+	q.record(context.Background(), func(context.Context, int64, ...label.KeyValue) { <-block }, 0, nil)
+	for i := 0; i < 10; i++ {
+		q.record(context.Background(), record, 1, nil)
+	}
+	close(block)
+
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dropped := atomic.LoadInt64(&q.dropped)
+	if dropped == 0 {
+		t.Error("no measurements dropped from a full queue")
+	}
+	if got := atomic.LoadInt64(&recorded); got+dropped != 10 {
+		t.Errorf("got %d recorded and %d dropped measurements, want 10 in total", got, dropped)
+	}
+
+	q.record(context.Background(), record, 1, nil)
+	if got := atomic.LoadInt64(&recorded); got+dropped != 11 {
+		t.Error("measurement after Shutdown was not recorded synchronously")
+	}
+}
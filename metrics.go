@@ -0,0 +1,185 @@
+package pgext
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	// methodLabels holds the sql.method labels of the known operations, so
+	// they are not built per query.
+	methodLabels = func() map[string]label.KeyValue {
+		m := make(map[string]label.KeyValue)
+		for _, op := range []orm.QueryOp{
+			orm.SelectOp, orm.InsertOp, orm.UpdateOp, orm.DeleteOp,
+			orm.CreateTableOp, orm.DropTableOp, orm.CreateCompositeOp, orm.DropCompositeOp,
+		} {
+			m[string(op)] = methodKey.String(string(op))
+		}
+		for _, method := range []string{"BEGIN", "COMMIT", "ROLLBACK", "SAVEPOINT", "RELEASE", "WITH", "COPY"} {
+			m[method] = methodKey.String(method)
+		}
+		return m
+	}()
+	// statusCanceledLabel marks queries whose context expired or was
+	// canceled while they ran.
+	statusCanceledLabel = label.String("sql.status", "Canceled")
+	fingerprintKey      = label.Key("sql.fingerprint")
+	cancelReasonLabels  = map[string]label.KeyValue{
+		"deadline": label.String("sql.cancel_reason", "deadline"),
+		"canceled": label.String("sql.cancel_reason", "canceled"),
+	}
+)
+
+func (h *OpenTelemetryHook) metricSampled() bool {
+	rate := h.MetricSampleRate
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// appendMetricLabels appends the labels of the query metrics, except the
+// method and status, to labels.
+func (h *OpenTelemetryHook) appendMetricLabels(ctx context.Context, evt *pg.QueryEvent, labels []label.KeyValue) []label.KeyValue {
+	if db, ok := evt.DB.(optioner); ok {
+		if name, ok := serverVersionName(db); ok {
+			labels = append(labels, serverVersionKey.String(name))
+		}
+		if opt := db.Options(); len(h.Instance) == 0 && len(opt.Database) > 0 {
+			labels = append(labels, instanceKey.String(opt.Database))
+		}
+	}
+	if len(h.Instance) > 0 {
+		labels = append(labels, instanceKey.String(h.Instance))
+	}
+
+	labels = h.CostTags.merge(CostTagsFromContext(ctx)).appendLabels(labels)
+
+	if h.Tenant != nil {
+		if tenant := h.Tenant(ctx); tenant != "" {
+			max := h.MaxTenants
+			if max <= 0 {
+				max = 100
+			}
+			labels = append(labels, tenantKey.String(h.tenants.value(tenant, max)))
+		}
+	}
+
+	for _, key := range h.ContextMetricLabels {
+		if fn := h.ContextAttributes[key]; fn != nil {
+			if v := fn(ctx); v != "" {
+				labels = append(labels, key.String(v))
+			}
+		}
+	}
+
+	if len(evt.Params) > 0 {
+		if tableModel, ok := evt.Params[0].(orm.TableModel); ok {
+			if len(tableModel.Table().ModelName) > 0 {
+				labels = append(labels, tableKey.String(tableModel.Table().ModelName))
+			}
+		}
+	}
+	return labels
+}
+
+// labelPool holds label buffers of recordMetrics.
+var labelPool = sync.Pool{
+	New: func() interface{} {
+		labels := make([]label.KeyValue, 0, 16)
+		return &labels
+	},
+}
+
+// recordMetrics records the metrics of a query without a span. The query is
+// only formatted when its method can not be determined otherwise and label
+// buffers are reused, so the common case does not allocate.
+func (h *OpenTelemetryHook) recordMetrics(ctx context.Context, evt *pg.QueryEvent) error {
+	method, err := queryMethod(evt)
+	if err != nil {
+		return err
+	}
+
+	var pooled *[]label.KeyValue
+	var labels []label.KeyValue
+	if h.MetricQueue == nil {
+		// The labels are not retained after recording.
+		pooled = labelPool.Get().(*[]label.KeyValue)
+		labels = (*pooled)[:0]
+	} else {
+		labels = make([]label.KeyValue, 0, 8)
+	}
+
+	labels = append(labels, methodLabel(method))
+	labels = h.appendMetricLabels(ctx, evt, labels)
+	if len(h.Owners) > 0 {
+		if owner, ok := h.owner(callerFrame("github.com/go-pg/pg")); ok {
+			labels = append(labels, ownerKey.String(owner))
+		}
+	}
+
+	dur := since(h.Clock, evt.StartTime)
+	if threshold := h.slowQueryThreshold(); threshold > 0 && dur >= threshold {
+		h.MetricQueue.record(ctx, h.instruments().addSlowQuery, 1, h.filterAttributes(labels))
+	}
+
+	if evt.Err != nil {
+		if reason := cancelReason(ctx); reason != "" {
+			labels = append(labels, statusCanceledLabel)
+			b, err := formattedQuery(evt)
+			if err != nil {
+				return err
+			}
+			h.recordCanceled(ctx, redact(string(b)), reason, labels)
+		} else {
+			labels = append(labels, statusErrorLabel, errorClassLabels[errorClass(evt.Err)])
+		}
+	} else if evt.Result != nil {
+		labels = append(labels, statusOKLabel)
+	}
+	if isDDL(method) {
+		h.MetricQueue.record(ctx, h.instruments().addDDL, 1, h.filterAttributes(labels))
+	}
+	if h.metricSampled() {
+		h.MetricQueue.record(ctx, h.instruments().recordLatency, dur.Microseconds(), h.filterAttributes(labels))
+	}
+
+	if pooled != nil {
+		*pooled = labels[:0]
+		labelPool.Put(pooled)
+	}
+	return nil
+}
+
+// methodLabel returns the sql.method label of the method.
+func methodLabel(method string) label.KeyValue {
+	if kv, ok := methodLabels[method]; ok {
+		return kv
+	}
+	return methodKey.String(method)
+}
+
+// cancelReason returns deadline or canceled if the context of a failed query
+// is done, i.e. the caller gave up and the server did not fail.
+func cancelReason(ctx context.Context) string {
+	switch ctx.Err() {
+	case nil:
+		return ""
+	case context.DeadlineExceeded:
+		return "deadline"
+	}
+	return "canceled"
+}
+
+// recordCanceled counts a query canceled by its caller, labeled by its
+// fingerprint.
+func (h *OpenTelemetryHook) recordCanceled(ctx context.Context, query, reason string, labels []label.KeyValue) {
+	labels = append(labels[:len(labels):len(labels)],
+		fingerprintKey.String(fingerprint(normalizeQuery(query))),
+		cancelReasonLabels[reason],
+	)
+	h.MetricQueue.record(ctx, h.instruments().addCanceled, 1, h.filterAttributes(labels))
+}
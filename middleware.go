@@ -0,0 +1,122 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrNextCalled is returned by next when a Middleware installed with
+// MiddlewareHook calls it more than once. A hook can not execute the query
+// again.
+var ErrNextCalled = errors.New("pgext: next called more than once")
+
+// Next executes the query with the context.
+type Next func(ctx context.Context) error
+
+// Middleware wraps the execution of queries, for features that need to act
+// before and after the query in one place, e.g. timing, error mapping or
+// circuit breaking.
+type Middleware interface {
+	// Handle calls next to execute the query and returns its error, which
+	// may be replaced. Returning an error without calling next fails the
+	// query without executing it.
+	Handle(ctx context.Context, evt *pg.QueryEvent, next Next) error
+}
+
+// MiddlewareFunc is a function used as Middleware.
+type MiddlewareFunc func(ctx context.Context, evt *pg.QueryEvent, next Next) error
+
+func (f MiddlewareFunc) Handle(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+	return f(ctx, evt, next)
+}
+
+// Chain returns a Middleware that runs the middlewares in order, the first
+// one outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			m, inner := middlewares[i], next
+			next = func(ctx context.Context) error {
+				return m.Handle(ctx, evt, inner)
+			}
+		}
+		return next(ctx)
+	})
+}
+
+type middlewareCallKey struct{}
+
+// middlewareCall connects a Middleware running on its own goroutine to the
+// BeforeQuery and AfterQuery of the hook.
+type middlewareCall struct {
+	hook    *MiddlewareHook
+	entered chan context.Context
+	after   chan error
+	done    chan error
+	called  bool
+}
+
+func (c *middlewareCall) next(ctx context.Context) error {
+	if c.called {
+		return ErrNextCalled
+	}
+	c.called = true
+	c.entered <- ctx
+	return <-c.after
+}
+
+// MiddlewareHook is a pg.QueryHook that runs a Middleware around every
+// query:
+//
+//   db.AddQueryHook(&pgext.MiddlewareHook{Middleware: pgext.Chain(timing, errorMapping)})
+//
+// go-pg calls hooks before and after the query, so the middleware runs on
+// its own goroutine that waits in next until the query is done. The error
+// returned by the middleware becomes the error of the query. next executes
+// the query once; DB gives middlewares full control over the execution.
+type MiddlewareHook struct {
+	Middleware Middleware
+}
+
+var _ pg.QueryHook = (*MiddlewareHook)(nil)
+
+func (h *MiddlewareHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	if h.Middleware == nil {
+		return ctx, nil
+	}
+
+	call := &middlewareCall{
+		hook:    h,
+		entered: make(chan context.Context),
+		after:   make(chan error),
+		done:    make(chan error, 1),
+	}
+	go func() {
+		call.done <- h.Middleware.Handle(ctx, evt, call.next)
+	}()
+
+	select {
+	case ctx := <-call.entered:
+		return context.WithValue(ctx, middlewareCallKey{}, call), nil
+	case err := <-call.done:
+		if err == nil {
+			// The middleware let the query run without wrapping it.
+			return ctx, nil
+		}
+		return ctx, err
+	}
+}
+
+func (h *MiddlewareHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	call, ok := ctx.Value(middlewareCallKey{}).(*middlewareCall)
+	if !ok || call.hook != h {
+		return nil
+	}
+	call.after <- evt.Err
+	// Returning an error would skip the AfterQuery of the other hooks, so the
+	// error replaces the error of the event instead.
+	evt.Err = <-call.done
+	return nil
+}
@@ -0,0 +1,68 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestMiddlewareHook(t *testing.T) {
+	type key struct{}
+	var order []string
+	trace := func(name string) Middleware {
+		return MiddlewareFunc(func(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+			order = append(order, name+" before")
+			err := next(context.WithValue(ctx, key{}, name))
+			order = append(order, name+" after")
+			return err
+		})
+	}
+	errMapped := errors.New("mapped")
+	mapErr := MiddlewareFunc(func(ctx context.Context, evt *pg.QueryEvent, next Next) error {
+		err := next(ctx)
+		if err == pg.ErrNoRows {
+			return errMapped
+		}
+		return err
+	})
+
+	h := &MiddlewareHook{Middleware: Chain(trace("outer"), trace("inner"), mapErr)}
+	evt := &pg.QueryEvent{}
+	ctx, err := h.BeforeQuery(context.Background(), evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ctx.Value(key{}); got != "inner" {
+		t.Errorf("query runs with context of %v, want inner", got)
+	}
+
+	evt.Err = pg.ErrNoRows
+	if err := h.AfterQuery(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+	if evt.Err != errMapped {
+		t.Errorf("got error %v, want mapped", evt.Err)
+	}
+
+	want := []string{"outer before", "inner before", "inner after", "outer after"}
+	if len(order) != len(want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestMiddlewareHookReject(t *testing.T) {
+	errRejected := errors.New("rejected")
+	h := &MiddlewareHook{Middleware: MiddlewareFunc(func(context.Context, *pg.QueryEvent, Next) error {
+		return errRejected
+	})}
+	if _, err := h.BeforeQuery(context.Background(), &pg.QueryEvent{}); err != errRejected {
+		t.Errorf("got error %v, want rejected", err)
+	}
+}
@@ -0,0 +1,126 @@
+package pgext
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/label"
+)
+
+// modelAttr is a model field tagged with pgext:"attr".
+type modelAttr struct {
+	key   label.Key
+	index []int
+}
+
+// modelAttrs caches the []modelAttr of model types.
+var modelAttrs sync.Map
+
+// modelAttributes returns the span attributes of the fields of the query
+// model tagged with pgext:"attr", e.g.
+//
+//   type Order struct {
+//       ID     int64  `pgext:"attr"`
+//       Status string `pgext:"attr:order.state"`
+//   }
+//
+// adds order.id and order.state. The key defaults to the model name and the
+// column name. Zero values and models of slices are skipped.
+func modelAttributes(evt *pg.QueryEvent) []label.KeyValue {
+	if len(evt.Params) == 0 {
+		return nil
+	}
+	tm, ok := evt.Params[0].(orm.TableModel)
+	if !ok || tm.IsNil() {
+		return nil
+	}
+	table := tm.Table()
+	if table == nil {
+		return nil
+	}
+	fields := tableModelAttrs(table)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	v := tm.Value()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	attrs := make([]label.KeyValue, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || fv.IsZero() {
+			continue
+		}
+		attrs = append(attrs, attributeValue(f.key, fv))
+	}
+	return attrs
+}
+
+func tableModelAttrs(table *orm.Table) []modelAttr {
+	if v, ok := modelAttrs.Load(table.Type); ok {
+		return v.([]modelAttr)
+	}
+	var fields []modelAttr
+	for _, f := range table.Fields {
+		tag, ok := f.Field.Tag.Lookup("pgext")
+		if !ok {
+			continue
+		}
+		switch {
+		case tag == "attr":
+			fields = append(fields, modelAttr{
+				key:   label.Key(table.ModelName + "." + string(f.SQLName)),
+				index: f.Index,
+			})
+		case strings.HasPrefix(tag, "attr:"):
+			fields = append(fields, modelAttr{
+				key:   label.Key(strings.TrimPrefix(tag, "attr:")),
+				index: f.Index,
+			})
+		}
+	}
+	modelAttrs.Store(table.Type, fields)
+	return fields
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex that reports nil embedded
+// pointers instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func attributeValue(key label.Key, v reflect.Value) label.KeyValue {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return key.String(s.String())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return key.String(v.String())
+	case reflect.Bool:
+		return key.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return key.Int64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return key.Uint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return key.Float64(v.Float())
+	case reflect.Ptr:
+		return attributeValue(key, v.Elem())
+	}
+	return key.String(fmt.Sprint(v.Interface()))
+}
@@ -0,0 +1,61 @@
+package pgext
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/label"
+)
+
+type attrOrder struct {
+	ID     int64  `pgext:"attr"`
+	Status string `pgext:"attr:order.state"`
+	Note   string
+	Paid   bool `pgext:"attr"`
+}
+
+type structModel struct {
+	orm.TableModel
+	table *orm.Table
+	value reflect.Value
+}
+
+func (m structModel) IsNil() bool          { return false }
+func (m structModel) Table() *orm.Table    { return m.table }
+func (m structModel) Value() reflect.Value { return m.value }
+
+func newStructModel(v interface{}) structModel {
+	typ := reflect.TypeOf(v).Elem()
+	table := &orm.Table{Type: typ, ModelName: "attr_order"}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		table.Fields = append(table.Fields, &orm.Field{
+			Field:   f,
+			SQLName: strings.ToLower(f.Name),
+			Index:   f.Index,
+		})
+	}
+	return structModel{table: table, value: reflect.ValueOf(v).Elem()}
+}
+
+func TestModelAttributes(t *testing.T) {
+	model := newStructModel(&attrOrder{ID: 7, Status: "shipped", Note: "fragile"})
+	attrs := modelAttributes(&pg.QueryEvent{Params: []interface{}{model}})
+
+	want := []label.KeyValue{
+		label.Int64("attr_order.id", 7),
+		label.String("order.state", "shipped"),
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("got %v, want %v", attrs, want)
+	}
+
+	var orders []attrOrder
+	slice := structModel{table: model.table, value: reflect.ValueOf(&orders).Elem()}
+	if attrs := modelAttributes(&pg.QueryEvent{Params: []interface{}{slice}}); len(attrs) != 0 {
+		t.Errorf("got %v for a slice, want none", attrs)
+	}
+}
@@ -0,0 +1,91 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// NPlusOneHook is a development-mode pg.QueryHook that warns when the same
+// SELECT is executed many times within a single request. That usually means
+// related rows are loaded one by one instead of with Relation().
+//
+// Requests are told apart by WithRequestScope or, if it is not used, by trace ID.
+// Queries executed outside of both are ignored.
+//
+//   db.AddQueryHook(&pgext.NPlusOneHook{Threshold: 5})
+type NPlusOneHook struct {
+	// Threshold is the number of executions of the same query within one
+	// request that triggers a warning. Defaults to 10.
+	Threshold int
+	// Logger is used to print warnings. Defaults to the standard logger.
+	Logger *log.Logger
+
+	scopes traceScopes
+}
+
+var _ pg.QueryHook = (*NPlusOneHook)(nil)
+
+func (h *NPlusOneHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *NPlusOneHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if v, ok := evt.Query.(queryOperation); ok && v.Operation() != orm.SelectOp {
+		return nil
+	}
+
+	scope := h.scopes.get(ctx)
+	if scope == nil {
+		return nil
+	}
+
+	b, err := evt.UnformattedQuery()
+	if err != nil {
+		return err
+	}
+	query := normalizeQuery(string(b))
+	if !strings.HasPrefix(strings.ToUpper(query), "SELECT") {
+		return nil
+	}
+
+	scope.mu.Lock()
+	scope.queries[query]++
+	n := scope.queries[query]
+	scope.mu.Unlock()
+
+	threshold := h.Threshold
+	if threshold <= 0 {
+		threshold = 10
+	}
+	if n != threshold {
+		return nil
+	}
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+
+	span := trace.SpanFromContext(ctx)
+	if span.IsRecording() {
+		addEvent(ctx, span, "pgext.n_plus_one",
+			label.String("db.statement", redact(query)),
+			label.Int("db.query_count", n),
+			label.String("frame.func", fn),
+			label.String("frame.file", file),
+			label.Int("frame.line", line),
+		)
+	}
+
+	printf := log.Printf
+	if h.Logger != nil {
+		printf = h.Logger.Printf
+	}
+	printf("pgext: possible N+1 query: executed %d times in one request at %s (%s:%d), "+
+		"consider preloading with Relation():\n%s", n, fn, file, line, redact(query))
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestNPlusOneHook(t *testing.T) {
+	var buf bytes.Buffer
+	h := &NPlusOneHook{Threshold: 3, Logger: log.New(&buf, "", 0)}
+	ctx := WithRequestScope(context.Background())
+
+	run := func(ctx context.Context, query string) {
+		t.Helper()
+		if err := h.AfterQuery(ctx, &pg.QueryEvent{Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		run(ctx, "SELECT * FROM books WHERE author_id = ?")
+		run(ctx, "UPDATE books SET title = ? WHERE id = ?")
+	}
+	if n := strings.Count(buf.String(), "possible N+1 query"); n != 1 {
+		t.Fatalf("got %d warnings, want 1 when the threshold is reached:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "executed 3 times") || strings.Contains(buf.String(), "UPDATE") {
+		t.Errorf("got %q, want the SELECT executed 3 times", buf.String())
+	}
+
+	// Other requests and queries without a request are counted apart.
+	buf.Reset()
+	other := WithRequestScope(context.Background())
+	for i := 0; i < 2; i++ {
+		run(other, "SELECT * FROM books WHERE author_id = ?")
+		run(context.Background(), "SELECT * FROM books WHERE author_id = ?")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q, want no warning below the threshold", buf.String())
+	}
+}
@@ -0,0 +1,97 @@
+package pgext
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+// batchObserver is a batch observer shared by every source of the same
+// metrics, e.g. the pool statistics of several databases. OpenTelemetry
+// keeps the callback of the first instrument registered with a name, so
+// sources add their callback to the shared observer instead of registering
+// instruments of their own.
+type batchObserver struct {
+	mu sync.Mutex
+	// instruments is created by the first source.
+	instruments interface{}
+	callbacks   []*batchCallback
+}
+
+type batchCallback struct {
+	fn func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult)
+}
+
+// batchObservers maps the name of the first instrument of a batch observer
+// to the *batchObserver.
+var (
+	batchObserversMu sync.Mutex
+	batchObservers   = make(map[string]*batchObserver)
+)
+
+// observeBatch calls fn with the instruments of the batch observer on every
+// collection until the returned function is called. The instruments are
+// created by register when the first source is added under the name.
+func observeBatch(
+	name string,
+	register func(batch metric.BatchObserver) interface{},
+	fn func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult),
+) (remove func()) {
+	batchObserversMu.Lock()
+	o, ok := batchObservers[name]
+	if !ok {
+		o = new(batchObserver)
+		batchObservers[name] = o
+		o.mu.Lock()
+		o.instruments = register(meter.NewBatchObserver(o.observe))
+		o.mu.Unlock()
+	}
+	batchObserversMu.Unlock()
+
+	cb := &batchCallback{fn: fn}
+	o.mu.Lock()
+	o.callbacks = append(o.callbacks, cb)
+	o.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { o.remove(cb) })
+	}
+}
+
+func (o *batchObserver) observe(ctx context.Context, result metric.BatchObserverResult) {
+	o.mu.Lock()
+	instruments, callbacks := o.instruments, o.callbacks
+	o.mu.Unlock()
+
+	for _, cb := range callbacks {
+		cb.fn(ctx, instruments, result)
+	}
+}
+
+func (o *batchObserver) remove(cb *batchCallback) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	callbacks := make([]*batchCallback, 0, len(o.callbacks))
+	for _, c := range o.callbacks {
+		if c != cb {
+			callbacks = append(callbacks, c)
+		}
+	}
+	o.callbacks = callbacks
+}
+
+// instanceName returns the sql.instance label value of the database:
+// instance if set, the database name otherwise.
+func instanceName(db *pg.DB, instance string) string {
+	if instance != "" {
+		return instance
+	}
+	if opt := db.Options(); opt != nil {
+		return opt.Database
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+// Package opapolicy evaluates pgext policies with an embedded OPA policy.
+package opapolicy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/j2gg0s/pgext"
+)
+
+// DefaultQuery is the rule evaluated by New when query is empty.
+const DefaultQuery = "data.pgext.decision"
+
+// Policy is a pgext.Policy backed by a Rego module. The query evaluates to
+// either a boolean allowing the query or an object with the fields allow,
+// reason and annotations. The input is a pgext.PolicyInput:
+//
+//   package pgext
+//
+//   default decision = {"allow": true}
+//
+//   decision = {"allow": false, "reason": "billing may not delete payments"} {
+//       input.service == "billing"
+//       input.operation == "DELETE"
+//       input.table == "payments"
+//   }
+type Policy struct {
+	query rego.PreparedEvalQuery
+}
+
+var _ pgext.Policy = (*Policy)(nil)
+
+// New compiles the Rego module. query defaults to DefaultQuery.
+func New(ctx context.Context, module, query string) (*Policy, error) {
+	if query == "" {
+		query = DefaultQuery
+	}
+	pq, err := rego.New(
+		rego.Query(query),
+		rego.Module("pgext.rego", module),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("opapolicy: compiling policy failed: %w", err)
+	}
+	return &Policy{query: pq}, nil
+}
+
+// Evaluate evaluates the query. An undefined result denies the query.
+func (p *Policy) Evaluate(ctx context.Context, input *pgext.PolicyInput) (*pgext.PolicyDecision, error) {
+	rs, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return &pgext.PolicyDecision{Reason: "policy is undefined"}, nil
+	}
+
+	switch v := rs[0].Expressions[0].Value.(type) {
+	case bool:
+		return &pgext.PolicyDecision{Allow: v}, nil
+	case map[string]interface{}:
+		decision := new(pgext.PolicyDecision)
+		decision.Allow, _ = v["allow"].(bool)
+		decision.Reason, _ = v["reason"].(string)
+		if annotations, ok := v["annotations"].(map[string]interface{}); ok {
+			decision.Annotations = make(map[string]string, len(annotations))
+			for k, a := range annotations {
+				decision.Annotations[k] = fmt.Sprint(a)
+			}
+		}
+		return decision, nil
+	default:
+		return nil, fmt.Errorf("opapolicy: unexpected decision %T", v)
+	}
+}
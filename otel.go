@@ -2,8 +2,11 @@ package pgext
 
 import (
 	"context"
+	"math/rand"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-pg/pg/v10"
@@ -16,18 +19,20 @@ import (
 )
 
 var (
-	instrumentationName     = "github.com/j2gg0s/pgext"
-	tracer                  = global.Tracer(instrumentationName)
-	meter                   = global.Meter(instrumentationName)
-	latencyValueRecorder, _ = meter.NewInt64ValueRecorder(
-		"go.sql.latency",
-		metric.WithDescription("The latency of calls in microsecond"),
-	)
+	instrumentationName = "github.com/j2gg0s/pgext"
+	tracer              = global.TraceProvider().Tracer(instrumentationName,
+		trace.WithInstrumentationVersion(instrumentationVersion))
+	meter = global.MeterProvider().Meter(instrumentationName,
+		metric.WithInstrumentationVersion(instrumentationVersion))
 	instanceKey      = label.Key("sql.instance")
 	methodKey        = label.Key("sql.method")
 	tableKey         = label.Key("sql.table")
+	schemaKey        = label.Key("sql.schema")
+	tenantKey        = label.Key("sql.tenant")
 	statusOKLabel    = label.String("sql.status", "OK")
 	statusErrorLabel = label.String("sql.status", "Error")
+
+	defaultInstruments = newInstruments(tracer, meter, nil)
 )
 
 type queryOperation interface {
@@ -35,40 +40,235 @@ type queryOperation interface {
 }
 
 // OpenTelemetryHook is a pg.QueryHook that adds OpenTelemetry instrumentation.
+// It can be configured through its fields or built by NewOpenTelemetryHook
+// from the options of Wrap.
 type OpenTelemetryHook struct {
 	// Caller, if set to true, add caller to attribute
 	Caller bool
+	// SourceModule is the module whose callers are recorded with frame.file
+	// relative to the module root. Defaults to the module of the main
+	// package.
+	SourceModule string
+	// SourceURL, if set, links the callers of SourceModule as frame.url. The
+	// {file} and {line} placeholders are replaced, e.g.
+	// https://github.com/acme/shop/blob/v1.2.0/{file}#L{line}.
+	SourceURL string
 	// AllowMetric, if set to true, statsd operation's latency.
 	AllowMetric bool
+	// Clock, if set, is used to measure latency instead of the system clock.
+	Clock Clock
+	// Statement controls how the query is recorded. Defaults to the full query.
+	Statement StatementCapture
+	// StatementSalt is the salt of StatementCaptureHashed. Set the same salt
+	// on all instances to correlate values across processes. Defaults to
+	// a random salt per process.
+	StatementSalt []byte
+	// SlowQueryThreshold, if set, marks queries that take longer with
+	// a pgext.slow_query span event and counts them.
+	SlowQueryThreshold time.Duration
+	// MetricSampleRate, if between 0 and 1, is the fraction of queries whose
+	// latency is recorded, for workloads where recording every measurement
+	// shows up in profiles. The counters are not sampled.
+	MetricSampleRate float64
+	// MetricQueue, if set, records the metrics in the background.
+	MetricQueue *MetricQueue
+	// DeadlineBudgetRatio is the fraction of the time left until the context
+	// deadline at query start above which a query is flagged with
+	// db.deadline.budget_exceeded. Defaults to 0.5.
+	DeadlineBudgetRatio float64
+	// Instance, if set, is used as the sql.instance metric label instead of
+	// the database name.
+	Instance string
+	// ContextAttributes maps attribute keys to functions extracting request
+	// scoped values, e.g. user ID or route, from the query context. Empty
+	// values are skipped.
+	ContextAttributes map[label.Key]func(context.Context) string
+	// ContextMetricLabels lists keys of ContextAttributes that are also added
+	// to metrics. Keep their cardinality low.
+	ContextMetricLabels []label.Key
+	// BaggageKeys lists OpenTelemetry baggage entries copied from the query
+	// context to the span, e.g. user.tier set by an upstream service.
+	BaggageKeys []label.Key
+	// CostTags are the default cost attribution tags of the queries. Tags
+	// set with WithCostTags take precedence.
+	CostTags CostTags
+	// Tenant, if set, extracts the tenant from the query context. It is added
+	// as the sql.tenant attribute and metric label.
+	Tenant func(context.Context) string
+	// RequestID, if set, extracts the request ID from the query context,
+	// e.g. RequestIDFromContext. It is added as the request.id attribute.
+	RequestID func(context.Context) string
+	// MaxTenants limits the number of distinct sql.tenant metric values.
+	// Other tenants are reported as "other". Defaults to 100.
+	MaxTenants int
+	// RecordUnsampledErrors, if set to true, records failed queries without
+	// a sampled parent span as standalone spans linked to the parent, so
+	// errors are not lost to head-based sampling.
+	RecordUnsampledErrors bool
+	// SpanDecorator, if set, is called with every recorded query span just
+	// before it ends, so it can add events, rename the span or set its status.
+	SpanDecorator func(span trace.Span, evt *pg.QueryEvent)
+	// InstrumentationName, if set, replaces github.com/j2gg0s/pgext as the
+	// instrumentation name of the query spans and metrics, e.g. for libraries
+	// wrapping pgext.
+	InstrumentationName string
+	// InstrumentationVersion is the instrumentation version used with
+	// InstrumentationName. Defaults to the version of pgext.
+	InstrumentationVersion string
+	// MetricPrefix, if set, replaces the go.sql prefix of the query metrics,
+	// e.g. myapp.db for myapp.db.latency.
+	MetricPrefix string
+	// MetricName, if set, renames the query metrics. It is called with the
+	// name after MetricPrefix is applied.
+	MetricName func(name string) string
+	// Owners maps prefixes of the package paths, e.g.
+	// github.com/acme/shop/billing, or of the files of the code issuing
+	// queries to their owners, e.g. teams. The owner of the longest matching
+	// prefix is added as the sql.owner attribute and metric label. The
+	// caller is looked up on the stack of every query.
+	Owners map[string]string
+
+	// Runtime overrides set by SetTracingEnabled, SetMetricsEnabled and
+	// SetStatementCapture. Zero means no override.
+	tracingOff int32
+	metrics    int32
+	statement  int32
+	// dynamic holds *dynamicConfig set by ApplyConfig.
+	dynamic atomic.Value
+	tenants cardinalityLimiter
+
+	scopeOnce sync.Once
+	scope     *instruments
+
+	ownersOnce sync.Once
+	owners     []ownerPrefix
 }
 
 var _ pg.QueryHook = (*OpenTelemetryHook)(nil)
 
-func (h OpenTelemetryHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+// querySpanKey marks the span started by OpenTelemetryHook in the context,
+// so AfterQuery never touches the parent span.
+type querySpanKey struct{}
+
+// queryEventsKey holds the events added by hooks installed before
+// OpenTelemetryHook, which run before the query span is started.
+type queryEventsKey struct{}
+
+type queryEvent struct {
+	name string
+	kvs  []label.KeyValue
+}
+
+// addQueryEvent adds an event to the query span started by
+// OpenTelemetryHook. If the span is not started yet, the event is kept in
+// the returned context and added once it is.
+func addQueryEvent(ctx context.Context, name string, kvs ...label.KeyValue) context.Context {
+	if span, ok := ctx.Value(querySpanKey{}).(trace.Span); ok {
+		if span.IsRecording() {
+			addEvent(ctx, span, name, kvs...)
+		}
+		return ctx
+	}
+	events, _ := ctx.Value(queryEventsKey{}).([]queryEvent)
+	events = append(events[:len(events):len(events)], queryEvent{name: name, kvs: kvs})
+	return context.WithValue(ctx, queryEventsKey{}, events)
+}
+
+// noopProvider reports whether p is the noop trace or meter provider.
+func noopProvider(p interface{}) bool {
+	switch p.(type) {
+	case trace.NoopProvider, *trace.NoopProvider, metric.NoopProvider, *metric.NoopProvider:
+		return true
+	}
+	return false
+}
+
+// filterAttributes returns the attributes allowed by the filter set by
+// SetAttributeFilter and by the filter of the hook.
+func (h *OpenTelemetryHook) filterAttributes(kvs []label.KeyValue) []label.KeyValue {
+	return filterAttributes(kvs, h.config().attributes)
+}
+
+func (h *OpenTelemetryHook) setAttributes(span trace.Span, kvs ...label.KeyValue) {
+	span.SetAttributes(h.filterAttributes(kvs)...)
+}
+
+func (h *OpenTelemetryHook) addEvent(ctx context.Context, span trace.Span, name string, kvs ...label.KeyValue) {
+	span.AddEvent(ctx, name, h.filterAttributes(kvs)...)
+}
+
+func (h *OpenTelemetryHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	// With the noop provider installed spans are never recorded.
+	if !h.tracingEnabled() || noopProvider(global.TraceProvider()) || isServerVersionQuery(ctx) {
+		return ctx, nil
+	}
+	var opts []trace.StartOption
 	if !trace.SpanFromContext(ctx).IsRecording() {
+		sc, ok := linkedSpanContext(ctx)
+		if !ok {
+			return ctx, nil
+		}
+		opts = append(opts, trace.WithNewRoot(), trace.LinkedTo(sc))
+	}
+
+	cfg := h.config()
+	if cfg.sampleRate < 1 && rand.Float64() >= cfg.sampleRate {
 		return ctx, nil
 	}
+	if len(cfg.ignore) > 0 {
+		b, err := evt.UnformattedQuery()
+		if err != nil {
+			return ctx, err
+		}
+		for _, re := range cfg.ignore {
+			if re.Match(b) {
+				return ctx, nil
+			}
+		}
+	}
 
-	ctx, _ = tracer.Start(ctx, "")
-	return ctx, nil
+	ctx, span := h.instruments().tracer.Start(ctx, "", opts...)
+	if events, ok := ctx.Value(queryEventsKey{}).([]queryEvent); ok && span.IsRecording() {
+		for _, e := range events {
+			h.addEvent(ctx, span, e.name, e.kvs...)
+		}
+	}
+	return context.WithValue(ctx, querySpanKey{}, span), nil
 }
 
-func (h OpenTelemetryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
-	span := trace.SpanFromContext(ctx)
-	if !span.IsRecording() && !h.AllowMetric {
-		// fastpath
+func (h *OpenTelemetryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if isServerVersionQuery(ctx) {
 		return nil
 	}
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		span = trace.SpanFromContext(context.Background())
+		if h.RecordUnsampledErrors && h.tracingEnabled() && isQueryError(evt.Err) &&
+			!noopProvider(global.TraceProvider()) {
+			span = h.startErrorSpan(ctx, evt)
+		}
+	}
+	allowMetric := h.metricsEnabled() && !noopProvider(global.MeterProvider())
+	if !span.IsRecording() {
+		if !allowMetric {
+			// fastpath
+			return nil
+		}
+		return h.recordMetrics(ctx, evt)
+	}
 	defer span.End()
 
 	metricLabels := make([]label.KeyValue, 0, 4)
-	defer func() {
-		latencyValueRecorder.Record(
-			ctx,
-			time.Since(evt.StartTime).Microseconds(),
-			metricLabels...,
-		)
-	}()
+	if allowMetric && h.metricSampled() {
+		defer func() {
+			h.MetricQueue.record(
+				ctx,
+				h.instruments().recordLatency,
+				since(h.Clock, evt.StartTime).Microseconds(),
+				h.filterAttributes(metricLabels),
+			)
+		}()
+	}
 
 	var operation orm.QueryOp
 
@@ -76,122 +276,224 @@ func (h OpenTelemetryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) e
 		operation = v.Operation()
 	}
 
+	const queryLimit = 5000
+
+	// Multi-row inserts can be megabytes long, so only the recorded prefix
+	// is copied.
 	var query string
 	if operation == orm.InsertOp {
 		b, err := evt.UnformattedQuery()
 		if err != nil {
 			return err
 		}
-		query = string(b)
+		query = capQuery(b, queryLimit)
 	} else {
 		b, err := evt.FormattedQuery()
 		if err != nil {
 			return err
 		}
-		query = string(b)
+		query = capQuery(b, queryLimit)
 	}
 
-	if operation != "" {
-		span.SetName(string(operation))
-		metricLabels = append(metricLabels, methodKey.String(string(operation)))
-	} else {
-		name := query
-		if idx := strings.IndexByte(name, ' '); idx > 0 {
-			name = name[:idx]
-		}
-		if len(name) > 20 {
-			name = name[:20]
-		}
-		span.SetName(strings.TrimSpace(name))
-		metricLabels = append(metricLabels, methodKey.String(strings.TrimSpace(name)))
+	method := string(operation)
+	if method == "" {
+		method = spanName(query)
 	}
+	span.SetName(method)
+	metricLabels = append(metricLabels, methodLabel(method))
+	ddl := isDDL(method)
 
-	const queryLimit = 5000
-	if len(query) > queryLimit {
-		query = query[:queryLimit]
+	query = truncate(redact(query), queryLimit)
+
+	// The stack is walked once for both the caller attributes and the owner.
+	var caller runtime.Frame
+	if h.Caller || len(h.Owners) > 0 {
+		caller = callerFrame("github.com/go-pg/pg")
 	}
 
 	attrs := make([]label.KeyValue, 0, 10)
 	if h.Caller {
-		fn, file, line := funcFileLine("github.com/go-pg/pg")
-		attrs = append(attrs,
-			label.String("frame.func", fn),
-			label.String("frame.file", file),
-			label.Int("frame.line", line),
-		)
+		attrs = append(attrs, h.callerAttributes(caller)...)
 	}
 
-	attrs = append(attrs,
-		label.String("db.system", "postgres"),
-		label.String("db.statement", query),
-	)
+	attrs = append(attrs, label.String("db.system", "postgres"))
+	if ddl {
+		attrs = append(attrs, label.Bool("db.ddl", true))
+	}
+	query = h.config().redactor.Redact(query)
+	if relation, parent, ok := preloadRelation(evt); ok {
+		attrs = append(attrs, label.String("db.orm.relation", relation))
+		if parent != "" {
+			attrs = append(attrs, label.String("db.orm.parent", parent))
+		}
+	}
+	attrs = append(attrs, modelAttributes(evt)...)
+	if stmt, ok := h.recordedStatement(query); ok {
+		attrs = append(attrs, label.String("db.statement", stmt))
+	}
+	if strings.IndexByte(query, ';') >= 0 {
+		if stmts := splitStatements(query); len(stmts) > 1 {
+			attrs = append(attrs, label.Int("db.statement_count", len(stmts)))
+			addStatementEvents(ctx, span, stmts, h.recordedStatement, h.config().attributes)
+		}
+	}
 
-	if db, ok := evt.DB.(*pg.DB); ok {
+	// Other databases with options, e.g. the adapter for go-pg v9, get the
+	// connection attributes too.
+	if db, ok := evt.DB.(optioner); ok {
 		opt := db.Options()
 		attrs = append(attrs,
 			label.String("db.connection_string", opt.Addr),
 			label.String("db.user", opt.User),
 			label.String("db.name", opt.Database),
 		)
-		if len(opt.Database) > 0 {
-			metricLabels = append(metricLabels, instanceKey.String(opt.Database))
+		attrs = append(attrs, tlsAttributes(db)...)
+		if name, ok := serverVersionName(db); ok {
+			attrs = append(attrs, label.String("db.server_version", name))
+		}
+		if mode, ok := pgBouncerMode(db); ok {
+			attrs = append(attrs,
+				label.Bool("db.pgbouncer", true),
+				label.String("db.pgbouncer.pool_mode", string(mode)),
+			)
+		}
+	}
+	metricLabels = h.appendMetricLabels(ctx, evt, metricLabels)
+	if owner, ok := h.owner(caller); ok {
+		attrs = append(attrs, ownerKey.String(owner))
+		metricLabels = append(metricLabels, ownerKey.String(owner))
+	}
+
+	attrs = h.CostTags.merge(CostTagsFromContext(ctx)).appendLabels(attrs)
+	if h.Tenant != nil {
+		if tenant := h.Tenant(ctx); tenant != "" {
+			attrs = append(attrs, tenantKey.String(tenant))
+		}
+	}
+
+	if h.RequestID != nil {
+		if id := h.RequestID(ctx); id != "" {
+			attrs = append(attrs, requestIDKey.String(id))
+		}
+	}
+
+	attrs = append(attrs, baggageAttributes(ctx, h.BaggageKeys)...)
+
+	for key, fn := range h.ContextAttributes {
+		if v := fn(ctx); v != "" {
+			attrs = append(attrs, key.String(v))
 		}
 	}
 
-	if len(evt.Params) > 0 {
-		if tableModel, ok := evt.Params[0].(orm.TableModel); ok {
-			if len(tableModel.Table().ModelName) > 0 {
-				metricLabels = append(
-					metricLabels,
-					tableKey.String(tableModel.Table().ModelName))
+	if threshold := h.slowQueryThreshold(); threshold > 0 {
+		if dur := since(h.Clock, evt.StartTime); dur >= threshold {
+			h.addEvent(ctx, span, "pgext.slow_query",
+				label.Int64("db.duration_us", dur.Microseconds()),
+			)
+			if allowMetric {
+				h.MetricQueue.record(ctx, h.instruments().addSlowQuery, 1, h.filterAttributes(metricLabels))
 			}
 		}
 	}
 
+	attrs = append(attrs, deadlineAttributes(ctx, evt.StartTime, since(h.Clock, evt.StartTime), h.DeadlineBudgetRatio)...)
+
 	if evt.Err != nil {
-		switch evt.Err {
-		case pg.ErrNoRows, pg.ErrMultiRows:
+		class := errorClass(evt.Err)
+		if class == errorClassNoRows {
 			span.SetStatus(codes.NotFound, "")
-		default:
-			span.RecordError(ctx, evt.Err, trace.WithErrorStatus(codes.Internal))
+		} else {
+			span.RecordError(ctx, evt.Err, trace.WithErrorStatus(errorClassCode(class)))
+		}
+		attrs = append(attrs, label.String("db.error_class", class))
+		if reason := cancelReason(ctx); reason != "" {
+			h.setAttributes(span, label.String("db.canceled", reason))
+			metricLabels = append(metricLabels, statusCanceledLabel)
+			if allowMetric {
+				h.recordCanceled(ctx, query, reason, metricLabels)
+			}
+		} else {
+			metricLabels = append(metricLabels, statusErrorLabel, errorClassLabels[class])
 		}
-		metricLabels = append(metricLabels, statusErrorLabel)
 	} else if evt.Result != nil {
-		numRow := evt.Result.RowsAffected()
-		if numRow == 0 {
-			numRow = evt.Result.RowsReturned()
+		// PostgreSQL reports the number of selected rows as affected, so it
+		// is only meaningful for statements that change data.
+		if method != string(orm.SelectOp) {
+			attrs = append(attrs, label.Int("db.rows_affected", evt.Result.RowsAffected()))
+		}
+		if returned := evt.Result.RowsReturned(); returned > 0 || method == string(orm.SelectOp) {
+			attrs = append(attrs, label.Int("db.rows_returned", returned))
 		}
-		attrs = append(attrs, label.Int("db.rows_affected", numRow))
 		metricLabels = append(metricLabels, statusOKLabel)
 	}
+	if ddl && allowMetric {
+		h.MetricQueue.record(ctx, h.instruments().addDDL, 1, h.filterAttributes(metricLabels))
+	}
 
-	span.SetAttributes(attrs...)
+	h.setAttributes(span, attrs...)
+	if h.SpanDecorator != nil && span.IsRecording() {
+		h.SpanDecorator(span, evt)
+	}
 
 	return nil
 }
 
-func funcFileLine(pkg string) (string, string, int) {
-	const depth = 16
-	var pcs [depth]uintptr
-	n := runtime.Callers(3, pcs[:])
-	ff := runtime.CallersFrames(pcs[:n])
+// formattedQuery returns the formatted query of the event or, if it is empty,
+// the unformatted one. go-pg does not format prepared statements and events
+// built outside of pg.DB, e.g. in tests, have no formatted query.
+func formattedQuery(evt *pg.QueryEvent) ([]byte, error) {
+	if b, err := evt.FormattedQuery(); err != nil || len(b) > 0 {
+		return b, err
+	}
+	return evt.UnformattedQuery()
+}
 
-	var fn, file string
-	var line int
-	for {
-		f, ok := ff.Next()
-		if !ok {
-			break
-		}
-		fn, file, line = f.Function, f.File, f.Line
-		if !strings.Contains(fn, pkg) {
-			break
+// queryMethod returns the method of the query, e.g. SELECT. It formats the
+// query only if it is neither an orm query nor a string.
+func queryMethod(evt *pg.QueryEvent) (string, error) {
+	if v, ok := evt.Query.(queryOperation); ok {
+		if op := v.Operation(); op != "" {
+			return string(op), nil
 		}
 	}
+	if query, ok := evt.Query.(string); ok {
+		return spanName(query), nil
+	}
+	b, err := evt.FormattedQuery()
+	if err != nil {
+		return "", err
+	}
+	return spanName(string(b)), nil
+}
 
-	if ind := strings.LastIndexByte(fn, '/'); ind != -1 {
-		fn = fn[ind+1:]
+// startErrorSpan starts a standalone span for a failed query that has no
+// span because its parent was not sampled.
+func (h *OpenTelemetryHook) startErrorSpan(ctx context.Context, evt *pg.QueryEvent) trace.Span {
+	opts := []trace.StartOption{
+		trace.WithNewRoot(),
+		trace.WithRecord(),
+		trace.WithStartTime(evt.StartTime),
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		opts = append(opts, trace.LinkedTo(sc))
 	}
 
-	return fn, file, line
+	_, span := h.instruments().tracer.Start(ctx, "", opts...)
+	return span
 }
+
+// isQueryError reports whether err is a real failure and not pg.ErrNoRows
+// or pg.ErrMultiRows.
+func isQueryError(err error) bool {
+	return err != nil && err != pg.ErrNoRows && err != pg.ErrMultiRows
+}
+
+// spanName returns the first word of the query, e.g. SELECT, limited to 20 bytes.
+func spanName(query string) string {
+	name := query
+	if idx := strings.IndexByte(name, ' '); idx > 0 {
+		name = name[:idx]
+	}
+	return strings.TrimSpace(truncate(name, 20))
+}
+
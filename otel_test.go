@@ -2,14 +2,17 @@ package pgext
 
 import (
 	"context"
-	"io/ioutil"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/j2gg0s/pgext/pgexttest"
 
 	"go.opentelemetry.io/otel/api/global"
 	"go.opentelemetry.io/otel/api/trace"
-	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func BenchmarkOtelWithoutParent(b *testing.B) {
@@ -51,6 +54,27 @@ func BenchmarkOtelWithCaller(b *testing.B) {
 	benchOtel(ctx, b, db)
 }
 
+func TestOpenTelemetryHookToggles(t *testing.T) {
+	h := &OpenTelemetryHook{AllowMetric: true, Statement: StatementCaptureNormalized}
+
+	if !h.tracingEnabled() || !h.metricsEnabled() || h.statementCapture() != StatementCaptureNormalized {
+		t.Fatalf("defaults are not taken from the fields")
+	}
+
+	h.SetTracingEnabled(false)
+	h.SetMetricsEnabled(false)
+	h.SetStatementCapture(StatementCaptureFull)
+	if h.tracingEnabled() || h.metricsEnabled() || h.statementCapture() != StatementCaptureFull {
+		t.Errorf("overrides are not applied")
+	}
+
+	h.SetTracingEnabled(true)
+	h.SetMetricsEnabled(true)
+	if !h.tracingEnabled() || !h.metricsEnabled() {
+		t.Errorf("overrides can not be reverted")
+	}
+}
+
 func benchOtel(ctx context.Context, b *testing.B, db *pg.DB) {
 	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS otel_test(id SERIAL PRIMARY KEY)`)
 	if err != nil {
@@ -65,8 +89,180 @@ func benchOtel(ctx context.Context, b *testing.B, db *pg.DB) {
 	}
 }
 
-func init() {
-	stdout.InstallNewPipeline([]stdout.Option{
-		stdout.WithWriter(ioutil.Discard),
-	}, nil)
+func TestMetricSampleRate(t *testing.T) {
+	if !(&OpenTelemetryHook{}).metricSampled() {
+		t.Error("latency is sampled without MetricSampleRate")
+	}
+
+	h := &OpenTelemetryHook{MetricSampleRate: 0.1}
+	var sampled int
+	for i := 0; i < 10000; i++ {
+		if h.metricSampled() {
+			sampled++
+		}
+	}
+	if sampled < 500 || sampled > 1500 {
+		t.Errorf("got %d of 10000 sampled with rate 0.1", sampled)
+	}
+}
+
+type countingQuery struct{ formatted int }
+
+func (q *countingQuery) AppendQuery(fmter orm.QueryFormatter, b []byte) ([]byte, error) {
+	q.formatted++
+	return append(b, "SELECT 1"...), nil
+}
+
+func TestOpenTelemetryHookNoopProviders(t *testing.T) {
+	if !noopProvider(global.TraceProvider()) || !noopProvider(global.MeterProvider()) {
+		t.Skip("providers are installed")
+	}
+
+	h := &OpenTelemetryHook{AllowMetric: true, Caller: true}
+	q := &countingQuery{}
+	evt := &pg.QueryEvent{Query: q}
+	ctx, err := h.BeforeQuery(context.Background(), evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AfterQuery(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+	if q.formatted != 0 {
+		t.Errorf("query formatted %d times with noop providers", q.formatted)
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	for _, method := range []string{"SELECT", "CREATE TABLE", "COMMIT", "VACUUM"} {
+		if got, want := methodLabel(method), methodKey.String(method); got != want {
+			t.Errorf("methodLabel(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestCapQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		n     int
+		want  string
+	}{
+		{"SELECT 1", 100, "SELECT 1"},
+		{"INSERT INTO t VALUES (1), (2), (3)", 26, "INSERT INTO t VALUES (1), "},
+		{"INSERT INTO t VALUES ('a'), ('secret')", 33, "INSERT INTO t VALUES ('a'), ("},
+		{"INSERT INTO t VALUES ('it''s'), ('b')", 28, "INSERT INTO t VALUES ("},
+		{"INSERT INTO t VALUES ('a'), ('b')", 26, "INSERT INTO t VALUES ('a')"},
+		{"INSERT INTO t VALUES ('a'), ('b')", 25, "INSERT INTO t VALUES ("},
+		{"SELECT 'äö'", 10, "SELECT "},
+	}
+	for _, test := range tests {
+		if got := capQuery([]byte(test.query), test.n); got != test.want {
+			t.Errorf("capQuery(%q, %d) = %q, want %q", test.query, test.n, got, test.want)
+		}
+	}
+}
+
+func TestRecordUnsampledErrors(t *testing.T) {
+	sr := pgexttest.RecordSpans(t)
+
+	parent := trace.SpanContext{
+		TraceID: trace.ID{1},
+		SpanID:  trace.SpanID{1},
+	}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+
+	for _, record := range []bool{false, true} {
+		h := &OpenTelemetryHook{RecordUnsampledErrors: record}
+		evt := &pg.QueryEvent{
+			Query:     "SELECT 1",
+			StartTime: time.Now(),
+		}
+		qctx, err := h.BeforeQuery(ctx, evt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evt.Err = errors.New("boom")
+		if err := h.AfterQuery(qctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := sr.Completed()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1 for the error recorded with RecordUnsampledErrors", len(spans))
+	}
+	span := spans[0]
+	if _, ok := span.Links()[parent]; !ok {
+		t.Errorf("got links %v, want a link to the unsampled parent", span.Links())
+	}
+	if span.ParentSpanID().IsValid() {
+		t.Errorf("got parent %s, want a root span", span.ParentSpanID())
+	}
+	if span.StatusCode() == codes.OK {
+		t.Error("got status OK, want an error status")
+	}
+}
+
+func TestCanceledQueries(t *testing.T) {
+	mr := pgexttest.RecordMetrics(t)
+	pgexttest.RecordSpans(t)
+	h := &OpenTelemetryHook{AllowMetric: true}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	parent, span := global.Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+	traced, cancel := context.WithCancel(parent)
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		reason string
+	}{
+		{"Canceled", canceled, "canceled"},
+		{"Deadline", expired, "deadline"},
+		{"Span", traced, "canceled"},
+		{"Error", context.Background(), ""},
+	}
+
+	for _, test := range tests {
+		evt := pgexttest.NewQueryEvent(`SELECT * FROM users WHERE name = $1`).
+			Err(errors.New("boom")).
+			Build()
+		if _, err := pgexttest.Run(test.ctx, h, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ms := mr.Measurements()
+	for _, test := range tests {
+		if test.reason == "" {
+			continue
+		}
+		m := pgexttest.AssertMeasurement(t, ms,
+			pgexttest.WithMetricName("go.sql.canceled"),
+			pgexttest.WithLabel("sql.cancel_reason", test.reason),
+			pgexttest.WithLabel("sql.status", "Canceled"),
+		)
+		if m.Labels["sql.fingerprint"].Emit() == "" {
+			t.Errorf("%s: got no fingerprint", test.name)
+		}
+	}
+	pgexttest.AssertMeasurement(t, ms,
+		pgexttest.WithMetricName("go.sql.latency"),
+		pgexttest.WithLabel("sql.status", "Error"),
+	)
+
+	var n int
+	for _, m := range ms {
+		if m.Name == "go.sql.canceled" {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Errorf("got %d canceled queries, want 3", n)
+	}
 }
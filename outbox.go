@@ -0,0 +1,198 @@
+package pgext
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	topicKey = label.Key("outbox.topic")
+
+	outboxBacklogRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.outbox.backlog",
+		metric.WithDescription("The number of unpublished outbox events"),
+	)
+	outboxLatencyRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.outbox.publish_latency",
+		metric.WithDescription("The time from adding to publishing an outbox event in microsecond"),
+	)
+	outboxErrorCounter, _ = meter.NewInt64Counter(
+		"go.sql.outbox.publish_errors",
+		metric.WithDescription("The number of outbox events that failed to publish"),
+	)
+)
+
+// OutboxEvent is an event stored in the outbox table.
+type OutboxEvent struct {
+	ID        int64
+	Topic     string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// Outbox implements the transactional outbox pattern: events are written
+// to a table in the same transaction as the business writes and published
+// by a poller, so they are published if and only if the transaction commits.
+// The table must have the following schema:
+//
+//   CREATE TABLE outbox (
+//       id           bigserial PRIMARY KEY,
+//       topic        text NOT NULL,
+//       payload      jsonb NOT NULL,
+//       created_at   timestamptz NOT NULL DEFAULT now(),
+//       published_at timestamptz
+//   );
+//
+// Usage:
+//
+//   outbox := &pgext.Outbox{Publish: publishToKafka}
+//   err := db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+//       ...
+//       return outbox.Add(ctx, tx, "user.created", user)
+//   })
+//
+//   go outbox.Run(ctx, db)
+type Outbox struct {
+	// Table is the name of the outbox table. Defaults to "outbox".
+	Table string
+	// Publish publishes an event, e.g. to a message broker. Events are
+	// published at least once. A single poller publishes them in order, but
+	// several pollers skip each other's locked events with SKIP LOCKED, so
+	// their events may be published out of order.
+	Publish func(ctx context.Context, evt OutboxEvent) error
+	// BatchSize is the maximum number of events published per poll.
+	// Defaults to 100.
+	BatchSize int
+	// Interval is the time between polls when the outbox is drained.
+	// Defaults to 1s.
+	Interval time.Duration
+	// Logger is used to print poll errors. Defaults to the standard logger.
+	Logger *log.Logger
+}
+
+func (o *Outbox) table() pg.Ident {
+	if o.Table != "" {
+		return pg.Ident(o.Table)
+	}
+	return "outbox"
+}
+
+// Add writes an event with the JSON encoded payload to the outbox within
+// the transaction.
+func (o *Outbox) Add(ctx context.Context, tx *pg.Tx, topic string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO ? (topic, payload) VALUES (?, ?)`,
+		o.table(), topic, string(b))
+	return err
+}
+
+// Run polls and publishes events until the context is canceled.
+func (o *Outbox) Run(ctx context.Context, db *pg.DB) error {
+	interval := o.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for {
+		n, err := o.Poll(ctx, db)
+		if err != nil {
+			printf := log.Printf
+			if o.Logger != nil {
+				printf = o.Logger.Printf
+			}
+			printf("pgext: polling outbox failed: %s", err)
+		}
+
+		wait := interval
+		if err == nil && n == o.batchSize() {
+			wait = 0
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Poll publishes a batch of events and marks them as published. It stops at
+// the first event that fails to publish and returns the number of published
+// events.
+func (o *Outbox) Poll(ctx context.Context, db *pg.DB) (n int, err error) {
+	ctx, span := tracer.Start(ctx, "pgext.outbox.poll")
+	defer func() {
+		setAttributes(span, label.Int("outbox.published", n))
+		if err != nil {
+			span.RecordError(ctx, err, trace.WithErrorStatus(codes.Internal))
+		}
+		span.End()
+	}()
+
+	var backlog int
+	if _, err := db.QueryOneContext(ctx, pg.Scan(&backlog),
+		`SELECT count(*) FROM ? WHERE published_at IS NULL`, o.table()); err != nil {
+		return 0, err
+	}
+	outboxBacklogRecorder.Record(ctx, int64(backlog))
+	if backlog == 0 {
+		return 0, nil
+	}
+
+	var publishErr error
+	err = db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		var events []OutboxEvent
+		if _, err := tx.QueryContext(ctx, &events, `
+			SELECT id, topic, payload, created_at FROM ?
+			WHERE published_at IS NULL
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED`, o.table(), o.batchSize()); err != nil {
+			return err
+		}
+
+		ids := make([]int64, 0, len(events))
+		for _, evt := range events {
+			if publishErr = o.Publish(ctx, evt); publishErr != nil {
+				outboxErrorCounter.Add(ctx, 1, topicKey.String(evt.Topic))
+				break
+			}
+			outboxLatencyRecorder.Record(ctx, time.Since(evt.CreatedAt).Microseconds(),
+				topicKey.String(evt.Topic))
+			ids = append(ids, evt.ID)
+		}
+
+		if len(ids) > 0 {
+			if _, err := tx.ExecContext(ctx, `UPDATE ? SET published_at = now() WHERE id IN (?)`,
+				o.table(), pg.In(ids)); err != nil {
+				return err
+			}
+		}
+		n = len(ids)
+		// Commit the published events even if a later one failed.
+		return nil
+	})
+	if err == nil {
+		err = publishErr
+	}
+	return n, err
+}
+
+func (o *Outbox) batchSize() int {
+	if o.BatchSize > 0 {
+		return o.BatchSize
+	}
+	return 100
+}
@@ -0,0 +1,81 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOutboxPoll(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries []string
+		backlog = "2"
+	)
+	db := fakeDB(t, func(query string) fakeResult {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, query)
+
+		switch {
+		case strings.HasPrefix(query, "SELECT count(*)"):
+			return fakeResult{Columns: []string{"count"}, Rows: [][]string{{backlog}}}
+		case strings.Contains(query, "FOR UPDATE SKIP LOCKED"):
+			return fakeResult{
+				Columns: []string{"id", "topic", "payload", "created_at"},
+				Rows: [][]string{
+					{"1", "user.created", `{"id": 1}`, "2020-01-01 00:00:00+00"},
+					{"2", "user.created", `{"id": 2}`, "2020-01-01 00:00:01+00"},
+				},
+			}
+		case strings.HasPrefix(query, "UPDATE"):
+			return fakeResult{Tag: "UPDATE 1"}
+		}
+		return fakeResult{Tag: strings.ToUpper(strings.Fields(query)[0])}
+	})
+
+	errPublish := errors.New("broker unavailable")
+	var published []int64
+	o := &Outbox{
+		BatchSize: 10,
+		Publish: func(_ context.Context, evt OutboxEvent) error {
+			if evt.ID == 2 {
+				return errPublish
+			}
+			published = append(published, evt.ID)
+			return nil
+		},
+	}
+
+	ctx := context.Background()
+	n, err := o.Poll(ctx, db)
+	if !errors.Is(err, errPublish) {
+		t.Errorf("got error %v, want %v", err, errPublish)
+	}
+	if n != 1 || len(published) != 1 || published[0] != 1 {
+		t.Errorf("published %d events %v, want the first one", n, published)
+	}
+
+	want := []string{"BEGIN", `UPDATE "outbox" SET published_at = now() WHERE id IN (1)`, "COMMIT"}
+	var got []string
+	for _, query := range queries {
+		if query == want[0] || query == want[1] || query == want[2] {
+			got = append(got, query)
+		}
+	}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("got queries %q, want the published event committed", queries)
+	}
+
+	mu.Lock()
+	backlog, queries = "0", nil
+	mu.Unlock()
+	if n, err := o.Poll(ctx, db); n != 0 || err != nil {
+		t.Errorf("got %d, %v polling an empty outbox", n, err)
+	}
+	if len(queries) != 1 {
+		t.Errorf("got queries %q polling an empty outbox, want the backlog only", queries)
+	}
+}
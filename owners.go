@@ -0,0 +1,54 @@
+package pgext
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+var ownerKey = label.Key("sql.owner")
+
+// ownerPrefix is an entry of OpenTelemetryHook.Owners.
+type ownerPrefix struct {
+	prefix, owner string
+}
+
+// ownerPrefixes returns the entries of owners, longest prefix first.
+func ownerPrefixes(owners map[string]string) []ownerPrefix {
+	prefixes := make([]ownerPrefix, 0, len(owners))
+	for prefix, owner := range owners {
+		prefixes = append(prefixes, ownerPrefix{prefix: prefix, owner: owner})
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i].prefix) != len(prefixes[j].prefix) {
+			return len(prefixes[i].prefix) > len(prefixes[j].prefix)
+		}
+		return prefixes[i].prefix < prefixes[j].prefix
+	})
+	return prefixes
+}
+
+// matchOwner returns the owner of the longest prefix of the function, e.g.
+// github.com/acme/shop/billing.Charge, or of the file.
+func matchOwner(prefixes []ownerPrefix, fn, file string) (string, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(fn, p.prefix) || strings.HasPrefix(file, p.prefix) {
+			return p.owner, true
+		}
+	}
+	return "", false
+}
+
+// owner returns the owner of the code that issued the query, matching the
+// caller frame against Owners.
+func (h *OpenTelemetryHook) owner(caller runtime.Frame) (string, bool) {
+	if len(h.Owners) == 0 {
+		return "", false
+	}
+	h.ownersOnce.Do(func() {
+		h.owners = ownerPrefixes(h.Owners)
+	})
+	return matchOwner(h.owners, caller.Function, caller.File)
+}
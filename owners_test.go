@@ -0,0 +1,39 @@
+package pgext
+
+import "testing"
+
+func TestMatchOwner(t *testing.T) {
+	prefixes := ownerPrefixes(map[string]string{
+		"github.com/acme/shop":         "platform",
+		"github.com/acme/shop/billing": "payments",
+		"/src/jobs/":                   "data",
+	})
+
+	for _, test := range []struct {
+		fn, file string
+		owner    string
+		ok       bool
+	}{
+		{"github.com/acme/shop/billing.Charge", "/src/billing/charge.go", "payments", true},
+		{"github.com/acme/shop/cart.(*Cart).Save", "/src/cart/cart.go", "platform", true},
+		{"main.run", "/src/jobs/nightly/main.go", "data", true},
+		{"github.com/other/lib.Do", "/go/pkg/mod/lib/do.go", "", false},
+	} {
+		owner, ok := matchOwner(prefixes, test.fn, test.file)
+		if owner != test.owner || ok != test.ok {
+			t.Errorf("%s: got %q %v, want %q %v", test.fn, owner, ok, test.owner, test.ok)
+		}
+	}
+}
+
+func TestOwnerOfCaller(t *testing.T) {
+	h := &OpenTelemetryHook{Owners: map[string]string{"github.com/j2gg0s/pgext": "pgext"}}
+	// Frames of this package are skipped, so the caller is the test runner.
+	if owner, ok := h.owner(callerFrame("github.com/go-pg/pg")); ok {
+		t.Errorf("got owner %q, want none", owner)
+	}
+	h = &OpenTelemetryHook{Owners: map[string]string{"testing.": "go"}}
+	if owner, ok := h.owner(callerFrame("github.com/go-pg/pg")); !ok || owner != "go" {
+		t.Errorf("got %q %v, want go", owner, ok)
+	}
+}
@@ -0,0 +1,145 @@
+package pgext
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// ErrInvalidCursor is returned for cursors that were not created by Cursor.String.
+var ErrInvalidCursor = errors.New("pgext: invalid cursor")
+
+// Cursor is the position after the last row of a page: the value of the sort
+// column and the key of the row.
+type Cursor struct {
+	Value string
+	Key   string
+}
+
+// NewCursor returns the cursor after the row with the sort column value and
+// key, e.g. NewCursor(last.CreatedAt, last.ID).
+func NewCursor(value, key interface{}) Cursor {
+	return Cursor{Value: cursorValue(value), Key: cursorValue(key)}
+}
+
+func cursorValue(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// String returns the opaque representation of the cursor for clients.
+func (c Cursor) String() string {
+	b, _ := json.Marshal([2]string{c.Value, c.Key})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor parses a cursor returned by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var v [2]string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{Value: v[0], Key: v[1]}, nil
+}
+
+// Paginator implements keyset pagination: instead of OFFSET, which reads and
+// discards all previous rows, pages continue after the last row of the
+// previous page, so deep pages are as fast as the first one:
+//
+//   p := &pgext.Paginator{Column: "created_at", Limit: 50}
+//   q, err := p.Apply(ctx, db.ModelContext(ctx, &books), req.Cursor)
+//   ...
+//   err = q.Select()
+//   n, more := p.Page(ctx, len(books))
+//   books = books[:n]
+//   if more {
+//       next := pgext.NewCursor(books[n-1].CreatedAt, books[n-1].ID).String()
+//   }
+//
+// The page size and position are added to the span in ctx.
+type Paginator struct {
+	// Column is the column rows are sorted by.
+	Column string
+	// KeyColumn breaks ties between rows with the same Column value. It must
+	// be unique. Defaults to "id".
+	KeyColumn string
+	// Limit is the page size. Defaults to 50.
+	Limit int
+	// Desc sorts rows in descending order.
+	Desc bool
+}
+
+// Apply adds the condition, order and limit of the page after the cursor to
+// the query. An empty cursor is the first page.
+func (p *Paginator) Apply(ctx context.Context, q *orm.Query, cursor string) (*orm.Query, error) {
+	col, key := pg.Ident(p.Column), pg.Ident(p.keyColumn())
+
+	span := trace.SpanFromContext(ctx)
+	setAttributes(span,
+		label.String("pagination.column", p.Column),
+		label.Int("pagination.limit", p.limit()),
+		label.Bool("pagination.first_page", cursor == ""),
+	)
+
+	op, dir := ">", "ASC"
+	if p.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if cursor != "" {
+		c, err := ParseCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("(?, ?) "+op+" (?, ?)", col, key, c.Value, c.Key)
+	}
+
+	// One more row tells whether there is a next page.
+	return q.
+		OrderExpr("? "+dir+", ? "+dir, col, key).
+		Limit(p.limit() + 1), nil
+}
+
+// Page returns the number of the n selected rows that belong to the page and
+// whether there is a next page.
+func (p *Paginator) Page(ctx context.Context, n int) (int, bool) {
+	more := n > p.limit()
+	if more {
+		n = p.limit()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	setAttributes(span,
+		label.Int("pagination.page_size", n),
+		label.Bool("pagination.has_more", more),
+	)
+	return n, more
+}
+
+func (p *Paginator) keyColumn() string {
+	if p.KeyColumn != "" {
+		return p.KeyColumn
+	}
+	return "id"
+}
+
+func (p *Paginator) limit() int {
+	if p.Limit > 0 {
+		return p.Limit
+	}
+	return 50
+}
@@ -0,0 +1,28 @@
+package pgext
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	created := time.Date(2020, 10, 1, 12, 30, 0, 500, time.UTC)
+	c := NewCursor(created, int64(42))
+
+	got, err := ParseCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != c {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if got.Value != "2020-10-01T12:30:00.0000005Z" || got.Key != "42" {
+		t.Errorf("got %+v", got)
+	}
+
+	for _, s := range []string{"!", "bm90IGpzb24"} {
+		if _, err := ParseCursor(s); err != ErrInvalidCursor {
+			t.Errorf("ParseCursor(%q) = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
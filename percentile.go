@@ -0,0 +1,146 @@
+package pgext
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+var percentileKey = label.Key("sql.percentile")
+
+const (
+	// latencySubBuckets is the number of buckets per power of two. Values are
+	// recorded with a relative error of at most 1/latencySubBuckets.
+	latencySubBuckets = 16
+	latencyBuckets    = latencySubBuckets + 60*latencySubBuckets
+	// latencySlots is the number of slots the window is divided into. The
+	// window advances one slot at a time.
+	latencySlots = 6
+)
+
+// latencyBucket returns the HDR histogram bucket of the latency in
+// microseconds: exact below latencySubBuckets, then latencySubBuckets
+// buckets per power of two.
+func latencyBucket(us int64) int {
+	if us < latencySubBuckets {
+		if us < 0 {
+			return 0
+		}
+		return int(us)
+	}
+	shift := bits.Len64(uint64(us)) - 5
+	sub := int(us>>uint(shift)) - latencySubBuckets
+	return latencySubBuckets + shift*latencySubBuckets + sub
+}
+
+// latencyBucketValue returns the middle of the bucket in microseconds.
+func latencyBucketValue(bucket int) int64 {
+	if bucket < latencySubBuckets {
+		return int64(bucket)
+	}
+	shift := uint(bucket/latencySubBuckets - 1)
+	sub := int64(bucket%latencySubBuckets + latencySubBuckets)
+	return sub<<shift + (int64(1)<<shift)/2
+}
+
+type latencySlot struct {
+	epoch  int64
+	total  int64
+	counts [latencyBuckets]uint32
+}
+
+// LatencyPercentiles are latency percentiles estimated over a sliding window.
+type LatencyPercentiles struct {
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Count int64
+}
+
+// LatencyWindow estimates latency percentiles over a sliding window in
+// process, for metrics backends that only support gauges. Latencies are kept
+// in an HDR histogram with an error of at most 1/16, so the memory does not
+// grow with the number of queries. Wrap maintains one with
+// WithLatencyPercentiles.
+type LatencyWindow struct {
+	// Window is the period the percentiles are estimated over. Defaults to
+	// one minute.
+	Window time.Duration
+	// Clock, if set, is used instead of the system clock.
+	Clock Clock
+
+	mu    sync.Mutex
+	slots [latencySlots]latencySlot
+}
+
+func (w *LatencyWindow) epoch() int64 {
+	window := w.Window
+	if window <= 0 {
+		window = time.Minute
+	}
+	now := time.Now()
+	if w.Clock != nil {
+		now = w.Clock.Now()
+	}
+	return now.UnixNano() / int64(window/latencySlots)
+}
+
+// Record adds a latency to the window.
+func (w *LatencyWindow) Record(d time.Duration) {
+	epoch := w.epoch()
+	bucket := latencyBucket(d.Microseconds())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := &w.slots[epoch%latencySlots]
+	if s.epoch != epoch {
+		*s = latencySlot{epoch: epoch}
+	}
+	s.counts[bucket]++
+	s.total++
+}
+
+// Percentiles returns the p50, p95 and p99 latency of the window.
+func (w *LatencyWindow) Percentiles() LatencyPercentiles {
+	epoch := w.epoch()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var counts [latencyBuckets]int64
+	var total int64
+	for i := range w.slots {
+		s := &w.slots[i]
+		if s.total == 0 || s.epoch <= epoch-latencySlots {
+			continue
+		}
+		for b, n := range s.counts {
+			counts[b] += int64(n)
+		}
+		total += s.total
+	}
+	if total == 0 {
+		return LatencyPercentiles{}
+	}
+
+	p := LatencyPercentiles{Count: total}
+	targets := []struct {
+		q   float64
+		dst *time.Duration
+	}{{0.5, &p.P50}, {0.95, &p.P95}, {0.99, &p.P99}}
+	var seen int64
+	for b, n := range counts {
+		seen += n
+		for len(targets) > 0 && float64(seen) >= targets[0].q*float64(total) {
+			*targets[0].dst = time.Duration(latencyBucketValue(b)) * time.Microsecond
+			targets = targets[1:]
+		}
+		if len(targets) == 0 {
+			break
+		}
+	}
+	return p
+}
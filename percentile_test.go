@@ -0,0 +1,53 @@
+package pgext
+
+import (
+	"testing"
+	"time"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	for _, us := range []int64{0, 1, 15, 16, 31, 32, 1000, 123456, 1e9} {
+		got := latencyBucketValue(latencyBucket(us))
+		if diff := got - us; diff < -us/16 || diff > us/16+1 {
+			t.Errorf("%dµs: got bucket value %d", us, got)
+		}
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	clock := pgexttest.NewClock(time.Unix(0, 0))
+	w := &LatencyWindow{Window: time.Minute, Clock: clock}
+
+	if p := w.Percentiles(); p.Count != 0 || p.P99 != 0 {
+		t.Errorf("got %+v, want no percentiles", p)
+	}
+
+	for i := 1; i <= 100; i++ {
+		w.Record(time.Duration(i) * time.Millisecond)
+	}
+	p := w.Percentiles()
+	if p.Count != 100 {
+		t.Errorf("got count %d, want 100", p.Count)
+	}
+	for _, c := range []struct {
+		got, want time.Duration
+	}{{p.P50, 50 * time.Millisecond}, {p.P95, 95 * time.Millisecond}, {p.P99, 99 * time.Millisecond}} {
+		if diff := c.got - c.want; diff < -c.want/16 || diff > c.want/16 {
+			t.Errorf("got %s, want about %s", c.got, c.want)
+		}
+	}
+
+	clock.Advance(30 * time.Second)
+	w.Record(time.Second)
+	if p := w.Percentiles(); p.Count != 101 {
+		t.Errorf("got count %d, want 101 within the window", p.Count)
+	}
+
+	clock.Advance(40 * time.Second)
+	p = w.Percentiles()
+	if p.Count != 1 || p.P50 < 900*time.Millisecond {
+		t.Errorf("got %+v, want only the latest query", p)
+	}
+}
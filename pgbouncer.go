@@ -0,0 +1,93 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// PoolMode is the pooling mode of PgBouncer.
+type PoolMode string
+
+const (
+	PoolModeSession     PoolMode = "session"
+	PoolModeTransaction PoolMode = "transaction"
+	PoolModeStatement   PoolMode = "statement"
+)
+
+// ErrPoolModeUnsupported is returned by features that need a session, e.g.
+// PreparedStatements, when the database is PgBouncer in transaction or
+// statement pooling mode.
+var ErrPoolModeUnsupported = errors.New("pgext: not supported by the PgBouncer pool mode")
+
+// pgBouncers maps the address of databases behind PgBouncer to PoolMode.
+var pgBouncers sync.Map
+
+// SetPgBouncer records that the database is PgBouncer with the pool mode.
+// Query spans get the db.pgbouncer and db.pgbouncer.pool_mode attributes and
+// features that need a session fail with ErrPoolModeUnsupported in
+// transaction and statement pooling mode. An empty mode clears the record.
+func SetPgBouncer(db *pg.DB, mode PoolMode) {
+	if mode == "" {
+		pgBouncers.Delete(db.Options().Addr)
+		return
+	}
+	pgBouncers.Store(db.Options().Addr, mode)
+}
+
+// DetectPgBouncer reads the pool mode from the PgBouncer admin console, i.e.
+// a connection to the pgbouncer database, and records it with SetPgBouncer
+// for db:
+//
+//   admin := pg.Connect(&pg.Options{Addr: "pgbouncer:6432", Database: "pgbouncer", User: "admin"})
+//   mode, err := pgext.DetectPgBouncer(ctx, db, admin)
+//
+// An error means admin is not a PgBouncer admin console.
+func DetectPgBouncer(ctx context.Context, db, admin *pg.DB) (PoolMode, error) {
+	var config []struct {
+		tableName struct{} `pg:",discard_unknown_columns"`
+
+		Key   string
+		Value string
+	}
+	if _, err := admin.QueryContext(ctx, &config, `SHOW CONFIG`); err != nil {
+		return "", fmt.Errorf("pgext: detecting PgBouncer failed: %w", err)
+	}
+	for _, c := range config {
+		if c.Key == "pool_mode" {
+			mode := PoolMode(c.Value)
+			SetPgBouncer(db, mode)
+			return mode, nil
+		}
+	}
+	return "", errors.New("pgext: detecting PgBouncer failed: pool_mode is missing")
+}
+
+type optioner interface {
+	Options() *pg.Options
+}
+
+// pgBouncerMode returns the pool mode recorded for the database.
+func pgBouncerMode(db interface{}) (PoolMode, bool) {
+	o, ok := db.(optioner)
+	if !ok {
+		return "", false
+	}
+	mode, ok := pgBouncers.Load(o.Options().Addr)
+	if !ok {
+		return "", false
+	}
+	return mode.(PoolMode), true
+}
+
+// requireSession returns ErrPoolModeUnsupported if the database is PgBouncer
+// without session pooling.
+func requireSession(db interface{}, feature string) error {
+	if mode, ok := pgBouncerMode(db); ok && mode != PoolModeSession {
+		return fmt.Errorf("%w: %s needs session pooling, got %s pooling", ErrPoolModeUnsupported, feature, mode)
+	}
+	return nil
+}
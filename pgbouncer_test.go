@@ -0,0 +1,34 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestPgBouncerPreparedStatements(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "pgbouncer:6432"})
+	SetPgBouncer(db, PoolModeTransaction)
+	defer SetPgBouncer(db, "")
+
+	tr := &PrepareTracker{Threshold: 1, Logger: log.New(ioutil.Discard, "", 0)}
+	for i := 0; i < 2; i++ {
+		if err := tr.AfterQuery(context.Background(), &pg.QueryEvent{Query: "SELECT 1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ps := &PreparedStatements{DB: db, Conn: db.Conn(), Tracker: tr}
+	if _, err := ps.ExecContext(context.Background(), "SELECT 1"); !errors.Is(err, ErrPoolModeUnsupported) {
+		t.Errorf("got error %v, want ErrPoolModeUnsupported", err)
+	}
+
+	SetPgBouncer(db, PoolModeSession)
+	if err := requireSession(db, "PreparedStatements"); err != nil {
+		t.Errorf("session pooling is rejected: %s", err)
+	}
+}
@@ -0,0 +1,43 @@
+package pgexttest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a manually advanced clock that can be set as the Clock of pgext
+// hooks to make latency deterministic.
+//
+//   clock := pgexttest.NewClock(evt.StartTime)
+//   hook := &pgext.OpenTelemetryHook{AllowMetric: true, Clock: clock}
+//   clock.Advance(time.Second)
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the current time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
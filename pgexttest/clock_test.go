@@ -0,0 +1,21 @@
+package pgexttest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+
+	clock.Advance(time.Second)
+	if got := clock.Now().Sub(start); got != time.Second {
+		t.Errorf("got %s, want 1s", got)
+	}
+
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("got %s, want %s", clock.Now(), start)
+	}
+}
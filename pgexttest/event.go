@@ -0,0 +1,193 @@
+package pgexttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var (
+	defaultDBOnce sync.Once
+	defaultDB     *pg.DB
+)
+
+// DB returns the database used by QueryEventBuilder by default. It never
+// connects, so it can be used without a running PostgreSQL.
+func DB() *pg.DB {
+	defaultDBOnce.Do(func() {
+		defaultDB = pg.Connect(&pg.Options{
+			Addr:     "localhost:5432",
+			User:     "pgexttest",
+			Database: "pgexttest",
+		})
+	})
+	return defaultDB
+}
+
+// QueryEventBuilder synthesizes pg.QueryEvent for unit tests of hooks.
+//
+//   evt := pgexttest.NewQueryEvent("SELECT * FROM users WHERE id = ?", 1).
+//       Operation(orm.SelectOp).
+//       Model(&User{}).
+//       Result(0, 1).
+//       Build()
+type QueryEventBuilder struct {
+	query  string
+	params []interface{}
+	op     orm.QueryOp
+	model  interface{}
+	db     orm.DB
+	result pg.Result
+	err    error
+	start  time.Time
+	dur    time.Duration
+}
+
+// NewQueryEvent returns a builder for an event of the query formatted with params.
+func NewQueryEvent(query string, params ...interface{}) *QueryEventBuilder {
+	return &QueryEventBuilder{
+		query:  query,
+		params: params,
+	}
+}
+
+// Operation makes the event look like it was produced by an ORM query.
+func (b *QueryEventBuilder) Operation(op orm.QueryOp) *QueryEventBuilder {
+	b.op = op
+	return b
+}
+
+// Model sets the model of the query, e.g. a pointer to a struct.
+func (b *QueryEventBuilder) Model(model interface{}) *QueryEventBuilder {
+	b.model = model
+	return b
+}
+
+// DB sets the database that executed the query. Defaults to DB().
+func (b *QueryEventBuilder) DB(db orm.DB) *QueryEventBuilder {
+	b.db = db
+	return b
+}
+
+// Result sets the number of affected and returned rows.
+func (b *QueryEventBuilder) Result(affected, returned int) *QueryEventBuilder {
+	b.result = result{affected: affected, returned: returned}
+	return b
+}
+
+// Err sets the error of the query.
+func (b *QueryEventBuilder) Err(err error) *QueryEventBuilder {
+	b.err = err
+	return b
+}
+
+// Duration makes the query start the duration before Build is called.
+func (b *QueryEventBuilder) Duration(d time.Duration) *QueryEventBuilder {
+	b.dur = d
+	return b
+}
+
+// StartTime sets the time the query started. Defaults to the time Build is
+// called minus Duration.
+func (b *QueryEventBuilder) StartTime(t time.Time) *QueryEventBuilder {
+	b.start = t
+	return b
+}
+
+// Build returns the event.
+//
+// go-pg keeps the formatted query of an event unexported, so FormattedQuery
+// of a built event is always empty. Hooks under test see the query through
+// UnformattedQuery, with its placeholders, e.g. "SELECT * FROM users WHERE
+// id = ?". Use a real pg.DB to test hooks that depend on formatted parameters.
+func (b *QueryEventBuilder) Build() *pg.QueryEvent {
+	start := b.start
+	if start.IsZero() {
+		start = time.Now().Add(-b.dur)
+	}
+
+	evt := &pg.QueryEvent{
+		StartTime: start,
+		DB:        b.db,
+		Model:     b.model,
+		Query:     b.query,
+		Params:    b.params,
+		Result:    b.result,
+		Err:       b.err,
+		Stash:     make(map[interface{}]interface{}),
+	}
+	if evt.DB == nil {
+		evt.DB = DB()
+	}
+
+	if b.op != "" || b.model != nil {
+		evt.Query = &query{
+			op:     b.op,
+			query:  b.query,
+			params: b.params,
+		}
+		evt.Params = nil
+		if b.model != nil {
+			if model, err := orm.NewModel(b.model); err == nil {
+				evt.Params = []interface{}{model}
+			}
+		}
+	}
+
+	return evt
+}
+
+// Run passes the event through the hook like go-pg does and returns the
+// context produced by BeforeQuery.
+func Run(ctx context.Context, hook pg.QueryHook, evt *pg.QueryEvent) (context.Context, error) {
+	ctx, err := hook.BeforeQuery(ctx, evt)
+	if err != nil {
+		return ctx, err
+	}
+	return ctx, hook.AfterQuery(ctx, evt)
+}
+
+type query struct {
+	op     orm.QueryOp
+	query  string
+	params []interface{}
+}
+
+var (
+	_ orm.QueryAppender    = (*query)(nil)
+	_ orm.TemplateAppender = (*query)(nil)
+)
+
+func (q *query) Operation() orm.QueryOp {
+	return q.op
+}
+
+func (q *query) AppendQuery(fmter orm.QueryFormatter, b []byte) ([]byte, error) {
+	return fmter.FormatQuery(b, q.query, q.params...), nil
+}
+
+func (q *query) AppendTemplate(b []byte) ([]byte, error) {
+	return append(b, q.query...), nil
+}
+
+type result struct {
+	affected int
+	returned int
+}
+
+var _ pg.Result = result{}
+
+func (result) Model() orm.Model {
+	return nil
+}
+
+func (r result) RowsAffected() int {
+	return r.affected
+}
+
+func (r result) RowsReturned() int {
+	return r.returned
+}
@@ -0,0 +1,44 @@
+package pgexttest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+func TestQueryEventBuilder(t *testing.T) {
+	errTest := errors.New("test")
+	evt := NewQueryEvent("SELECT * FROM users WHERE id = ?", 1).
+		Operation(orm.SelectOp).
+		Result(0, 1).
+		Err(errTest).
+		Duration(time.Second).
+		Build()
+
+	op, ok := evt.Query.(interface{ Operation() orm.QueryOp })
+	if !ok || op.Operation() != orm.SelectOp {
+		t.Errorf("query does not report the operation")
+	}
+	if evt.Result.RowsReturned() != 1 {
+		t.Errorf("got %d returned rows, want 1", evt.Result.RowsReturned())
+	}
+	if evt.Err != errTest {
+		t.Errorf("got error %v, want %v", evt.Err, errTest)
+	}
+	if d := time.Since(evt.StartTime); d < time.Second {
+		t.Errorf("got duration %s, want at least 1s", d)
+	}
+	if evt.DB != DB() {
+		t.Errorf("event does not use the default DB")
+	}
+
+	b, err := evt.UnformattedQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT * FROM users WHERE id = ?"; string(b) != want {
+		t.Errorf("got unformatted query %q, want %q", b, want)
+	}
+}
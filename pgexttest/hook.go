@@ -0,0 +1,47 @@
+package pgexttest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// RecordingHook is a pg.QueryHook that captures every executed query event.
+//
+//   hook := new(pgexttest.RecordingHook)
+//   db.AddQueryHook(hook)
+type RecordingHook struct {
+	mu     sync.Mutex
+	events []*pg.QueryEvent
+}
+
+var _ pg.QueryHook = (*RecordingHook)(nil)
+
+func (h *RecordingHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *RecordingHook) AfterQuery(_ context.Context, evt *pg.QueryEvent) error {
+	h.mu.Lock()
+	h.events = append(h.events, evt)
+	h.mu.Unlock()
+	return nil
+}
+
+// Events returns the captured events in the order the queries finished.
+func (h *RecordingHook) Events() []*pg.QueryEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make([]*pg.QueryEvent, len(h.events))
+	copy(events, h.events)
+	return events
+}
+
+// Reset forgets the captured events.
+func (h *RecordingHook) Reset() {
+	h.mu.Lock()
+	h.events = nil
+	h.mu.Unlock()
+}
@@ -0,0 +1,32 @@
+package pgexttest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestRecordingHook(t *testing.T) {
+	hook := new(RecordingHook)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		evt := &pg.QueryEvent{Query: "SELECT 1"}
+		if _, err := hook.BeforeQuery(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+		if err := hook.AfterQuery(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(hook.Events()); n != 3 {
+		t.Errorf("got %d events, want 3", n)
+	}
+
+	hook.Reset()
+	if n := len(hook.Events()); n != 0 {
+		t.Errorf("got %d events after Reset, want 0", n)
+	}
+}
@@ -0,0 +1,286 @@
+package pgexttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/metric/registry"
+	"go.opentelemetry.io/otel/label"
+)
+
+// Measurement is a value recorded by a synchronous instrument, i.e.
+// a counter, an up-down counter or a value recorder, or observed by an
+// observer run by Observe.
+type Measurement struct {
+	Name   string
+	Value  float64
+	Labels map[label.Key]label.Value
+}
+
+// MetricRecorder records the measurements of synchronous instruments.
+// Observers are only run by Observe.
+type MetricRecorder struct {
+	mu           sync.Mutex
+	measurements []Measurement
+}
+
+// Measurements returns the recorded measurements in the order they were
+// recorded.
+func (r *MetricRecorder) Measurements() []Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ms := make([]Measurement, len(r.measurements))
+	copy(ms, r.measurements)
+	return ms
+}
+
+// Observe runs every observer registered so far, like a collection of an
+// SDK, and records the observations.
+func (r *MetricRecorder) Observe(ctx context.Context) {
+	meterImpl.observe(ctx, r)
+}
+
+func (r *MetricRecorder) record(desc metric.Descriptor, n metric.Number, labels []label.KeyValue) {
+	m := Measurement{
+		Name:   desc.Name(),
+		Value:  n.CoerceToFloat64(desc.NumberKind()),
+		Labels: make(map[label.Key]label.Value, len(labels)),
+	}
+	for _, kv := range labels {
+		m.Labels[kv.Key] = kv.Value
+	}
+
+	r.mu.Lock()
+	r.measurements = append(r.measurements, m)
+	r.mu.Unlock()
+}
+
+var (
+	meterOnce     sync.Once
+	meterProvider metric.Provider
+	meterErr      error
+	meterImpl     = &recordingMeter{}
+)
+
+// RecordMetrics returns a recorder of the measurements made during the test.
+//
+//   mr := pgexttest.RecordMetrics(t)
+//   db.ExecContext(ctx, "SELECT 1")
+//   pgexttest.AssertMeasurement(t, mr.Measurements(), pgexttest.WithMetricName("go.sql.latency"))
+//
+// The global meter provider can only be delegated once and instruments
+// created before keep their meter, so the provider is installed by the first
+// call and must be the first one installed in the test binary.
+// RecordMetrics fails the test otherwise, instead of recording nothing. Tests
+// recording metrics must not run in parallel.
+func RecordMetrics(t testing.TB) *MetricRecorder {
+	t.Helper()
+
+	meterOnce.Do(func() {
+		if !defaultProvider(global.MeterProvider()) {
+			meterErr = errors.New("pgexttest: a meter provider was installed before RecordMetrics")
+			return
+		}
+		meterProvider = registry.NewProvider(meterImpl)
+		global.SetMeterProvider(meterProvider)
+	})
+	if meterErr != nil {
+		t.Fatal(meterErr)
+	}
+	if global.MeterProvider() != meterProvider {
+		t.Fatal("pgexttest: the meter provider of RecordMetrics was replaced")
+	}
+
+	r := new(MetricRecorder)
+	meterImpl.set(r)
+	t.Cleanup(func() {
+		meterImpl.set(nil)
+	})
+	return r
+}
+
+// recordingMeter is a metric.MeterImpl forwarding measurements to the
+// recorder of the running test.
+type recordingMeter struct {
+	mu        sync.RWMutex
+	recorder  *MetricRecorder
+	observers []*asyncInstrument
+}
+
+var _ metric.MeterImpl = (*recordingMeter)(nil)
+
+func (m *recordingMeter) set(r *MetricRecorder) {
+	m.mu.Lock()
+	m.recorder = r
+	m.mu.Unlock()
+}
+
+func (m *recordingMeter) record(desc metric.Descriptor, n metric.Number, labels []label.KeyValue) {
+	m.mu.RLock()
+	r := m.recorder
+	m.mu.RUnlock()
+	if r != nil {
+		r.record(desc, n, labels)
+	}
+}
+
+func (m *recordingMeter) RecordBatch(_ context.Context, labels []label.KeyValue, ms ...metric.Measurement) {
+	for _, meas := range ms {
+		m.record(meas.SyncImpl().Descriptor(), meas.Number(), labels)
+	}
+}
+
+func (m *recordingMeter) NewSyncInstrument(desc metric.Descriptor) (metric.SyncImpl, error) {
+	return &syncInstrument{meter: m, desc: desc}, nil
+}
+
+func (m *recordingMeter) NewAsyncInstrument(desc metric.Descriptor, runner metric.AsyncRunner) (metric.AsyncImpl, error) {
+	i := &asyncInstrument{desc: desc, runner: runner}
+	m.mu.Lock()
+	m.observers = append(m.observers, i)
+	m.mu.Unlock()
+	return i, nil
+}
+
+// observe runs the observers and records their observations in r. The
+// instruments of a batch observer share its runner, which is run once.
+func (m *recordingMeter) observe(ctx context.Context, r *MetricRecorder) {
+	m.mu.RLock()
+	observers := m.observers
+	m.mu.RUnlock()
+
+	capture := func(labels []label.KeyValue, obs ...metric.Observation) {
+		for _, o := range obs {
+			r.record(o.AsyncImpl().Descriptor(), o.Number(), labels)
+		}
+	}
+	batches := make(map[metric.AsyncBatchRunner]bool)
+	for _, i := range observers {
+		switch runner := i.runner.(type) {
+		case metric.AsyncSingleRunner:
+			runner.Run(ctx, i, capture)
+		case metric.AsyncBatchRunner:
+			if !batches[runner] {
+				batches[runner] = true
+				runner.Run(ctx, capture)
+			}
+		}
+	}
+}
+
+type syncInstrument struct {
+	meter *recordingMeter
+	desc  metric.Descriptor
+}
+
+func (i *syncInstrument) Implementation() interface{}    { return i }
+func (i *syncInstrument) Descriptor() metric.Descriptor { return i.desc }
+
+func (i *syncInstrument) Bind(labels []label.KeyValue) metric.BoundSyncImpl {
+	return &boundInstrument{inst: i, labels: labels}
+}
+
+func (i *syncInstrument) RecordOne(_ context.Context, n metric.Number, labels []label.KeyValue) {
+	i.meter.record(i.desc, n, labels)
+}
+
+type boundInstrument struct {
+	inst   *syncInstrument
+	labels []label.KeyValue
+}
+
+func (b *boundInstrument) RecordOne(_ context.Context, n metric.Number) {
+	b.inst.meter.record(b.inst.desc, n, b.labels)
+}
+
+func (b *boundInstrument) Unbind() {}
+
+type asyncInstrument struct {
+	desc   metric.Descriptor
+	runner metric.AsyncRunner
+}
+
+func (i *asyncInstrument) Implementation() interface{}    { return i }
+func (i *asyncInstrument) Descriptor() metric.Descriptor { return i.desc }
+
+// MetricOption is a condition a measurement must satisfy.
+type MetricOption func(Measurement) error
+
+// WithMetricName requires the measurement to be of the instrument.
+func WithMetricName(name string) MetricOption {
+	return func(m Measurement) error {
+		if m.Name != name {
+			return fmt.Errorf("name is %q, not %q", m.Name, name)
+		}
+		return nil
+	}
+}
+
+// WithLabel requires the measurement to have the label with the value.
+// Values are compared by their string representation.
+func WithLabel(key string, value interface{}) MetricOption {
+	want := fmt.Sprint(value)
+	return func(m Measurement) error {
+		v, ok := m.Labels[label.Key(key)]
+		if !ok {
+			return fmt.Errorf("label %s is missing", key)
+		}
+		if got := v.Emit(); got != want {
+			return fmt.Errorf("label %s is %q, not %q", key, got, want)
+		}
+		return nil
+	}
+}
+
+// WithValue requires the measurement to have the value.
+func WithValue(value float64) MetricOption {
+	return func(m Measurement) error {
+		if m.Value != value {
+			return fmt.Errorf("value is %v, not %v", m.Value, value)
+		}
+		return nil
+	}
+}
+
+// FindMeasurement returns the first measurement that satisfies all options.
+func FindMeasurement(ms []Measurement, opts ...MetricOption) (Measurement, bool) {
+	for _, m := range ms {
+		if matchMeasurement(m, opts) == nil {
+			return m, true
+		}
+	}
+	return Measurement{}, false
+}
+
+// AssertMeasurement fails the test unless one of the measurements satisfies
+// all options and returns the matching measurement.
+func AssertMeasurement(t testing.TB, ms []Measurement, opts ...MetricOption) Measurement {
+	t.Helper()
+
+	if m, ok := FindMeasurement(ms, opts...); ok {
+		return m
+	}
+
+	var b strings.Builder
+	for _, m := range ms {
+		fmt.Fprintf(&b, "\n\t%s: %s", m.Name, matchMeasurement(m, opts))
+	}
+	t.Errorf("pgexttest: no matching measurement among %d:%s", len(ms), b.String())
+	return Measurement{}
+}
+
+func matchMeasurement(m Measurement, opts []MetricOption) error {
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package pgexttest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/label"
+)
+
+// testCounter is created before any provider is installed, like the
+// instruments of pgext.
+var testCounter = metric.Must(global.Meter("pgexttest")).NewInt64Counter("test.queries")
+
+var testObserver = metric.Must(global.Meter("pgexttest")).NewInt64ValueObserver("test.conns",
+	func(_ context.Context, result metric.Int64ObserverResult) {
+		result.Observe(3, label.String("sql.instance", "main"))
+	})
+
+func TestRecordMetrics(t *testing.T) {
+	for _, status := range []string{"OK", "Error"} {
+		t.Run(status, func(t *testing.T) {
+			mr := RecordMetrics(t)
+			testCounter.Add(context.Background(), 2, label.String("sql.status", status))
+
+			ms := mr.Measurements()
+			if len(ms) != 1 {
+				t.Fatalf("got %d measurements, want 1", len(ms))
+			}
+			AssertMeasurement(t, ms, WithMetricName("test.queries"), WithLabel("sql.status", status), WithValue(2))
+			if _, ok := FindMeasurement(ms, WithLabel("sql.status", "Canceled")); ok {
+				t.Error("found a measurement with a label never recorded")
+			}
+		})
+	}
+}
+
+func TestObserve(t *testing.T) {
+	mr := RecordMetrics(t)
+
+	var idle, total metric.Int64ValueObserver
+	batch := metric.Must(global.Meter("pgexttest")).NewBatchObserver(
+		func(_ context.Context, result metric.BatchObserverResult) {
+			result.Observe([]label.KeyValue{label.String("sql.instance", "main")},
+				idle.Observation(1),
+				total.Observation(2),
+			)
+		})
+	idle = batch.NewInt64ValueObserver("test.pool.idle")
+	total = batch.NewInt64ValueObserver("test.pool.total")
+
+	if ms := mr.Measurements(); len(ms) != 0 {
+		t.Fatalf("got measurements %v before Observe, want none", ms)
+	}
+	mr.Observe(context.Background())
+
+	ms := mr.Measurements()
+	if len(ms) != 3 {
+		t.Fatalf("got %d measurements, want 3", len(ms))
+	}
+	AssertMeasurement(t, ms, WithMetricName("test.conns"), WithLabel("sql.instance", "main"), WithValue(3))
+	AssertMeasurement(t, ms, WithMetricName("test.pool.idle"), WithValue(1))
+	AssertMeasurement(t, ms, WithMetricName("test.pool.total"), WithValue(2))
+}
+
+func TestRecordSpans(t *testing.T) {
+	tracer := global.Tracer("pgexttest")
+	for _, name := range []string{"SELECT", "INSERT"} {
+		t.Run(name, func(t *testing.T) {
+			sr := RecordSpans(t)
+			_, span := tracer.Start(context.Background(), name)
+			span.End()
+
+			spans := sr.Completed()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			AssertSpan(t, spans, WithName(name))
+		})
+	}
+}
+
+func TestDefaultProvider(t *testing.T) {
+	if defaultProvider(tracetest.NewProvider()) {
+		t.Error("a tracetest provider is reported as the default global provider")
+	}
+}
@@ -0,0 +1,203 @@
+package pgexttest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	traceOnce     sync.Once
+	traceProvider trace.Provider
+	traceErr      error
+	spanForwarder = &forwardingRecorder{}
+)
+
+// defaultProvider reports whether p is the default global provider, which
+// delegates to the first provider installed.
+func defaultProvider(p interface{}) bool {
+	t := reflect.TypeOf(p)
+	return t.Kind() == reflect.Ptr && t.Elem().PkgPath() == "go.opentelemetry.io/otel/api/global/internal"
+}
+
+// RecordSpans returns a recorder of the spans started during the test.
+//
+//   sr := pgexttest.RecordSpans(t)
+//   db.ExecContext(ctx, "SELECT 1")
+//   pgexttest.AssertSpan(t, sr.Completed(), pgexttest.WithName("SELECT"))
+//
+// The global trace provider can only be delegated once and tracers created
+// before keep their provider, so the provider is installed by the first call
+// and must be the first one installed in the test binary. RecordSpans fails
+// the test otherwise, instead of recording nothing. Tests recording spans
+// must not run in parallel.
+func RecordSpans(t testing.TB) *tracetest.StandardSpanRecorder {
+	t.Helper()
+
+	traceOnce.Do(func() {
+		if !defaultProvider(global.TraceProvider()) {
+			traceErr = errors.New("pgexttest: a trace provider was installed before RecordSpans")
+			return
+		}
+		traceProvider = tracetest.NewProvider(tracetest.WithSpanRecorder(spanForwarder))
+		global.SetTraceProvider(traceProvider)
+	})
+	if traceErr != nil {
+		t.Fatal(traceErr)
+	}
+	if global.TraceProvider() != traceProvider {
+		t.Fatal("pgexttest: the trace provider of RecordSpans was replaced")
+	}
+
+	sr := new(tracetest.StandardSpanRecorder)
+	spanForwarder.set(sr)
+	t.Cleanup(func() {
+		spanForwarder.set(nil)
+	})
+	return sr
+}
+
+// forwardingRecorder forwards spans to the recorder of the running test.
+type forwardingRecorder struct {
+	mu sync.RWMutex
+	sr *tracetest.StandardSpanRecorder
+}
+
+func (f *forwardingRecorder) set(sr *tracetest.StandardSpanRecorder) {
+	f.mu.Lock()
+	f.sr = sr
+	f.mu.Unlock()
+}
+
+func (f *forwardingRecorder) get() *tracetest.StandardSpanRecorder {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.sr
+}
+
+func (f *forwardingRecorder) OnStart(span *tracetest.Span) {
+	if sr := f.get(); sr != nil {
+		sr.OnStart(span)
+	}
+}
+
+func (f *forwardingRecorder) OnEnd(span *tracetest.Span) {
+	if sr := f.get(); sr != nil {
+		sr.OnEnd(span)
+	}
+}
+
+// SpanOption is a condition a span must satisfy.
+type SpanOption func(*tracetest.Span) error
+
+// WithName requires the span to have the name.
+func WithName(name string) SpanOption {
+	return func(span *tracetest.Span) error {
+		if span.Name() != name {
+			return fmt.Errorf("name is %q, not %q", span.Name(), name)
+		}
+		return nil
+	}
+}
+
+// WithAttr requires the span to have the attribute with the value. Values are
+// compared by their string representation.
+func WithAttr(key string, value interface{}) SpanOption {
+	want := fmt.Sprint(value)
+	return func(span *tracetest.Span) error {
+		v, ok := span.Attributes()[label.Key(key)]
+		if !ok {
+			return fmt.Errorf("attribute %s is missing", key)
+		}
+		if got := v.Emit(); got != want {
+			return fmt.Errorf("attribute %s is %q, not %q", key, got, want)
+		}
+		return nil
+	}
+}
+
+// WithoutAttr requires the span not to have the attribute.
+func WithoutAttr(key string) SpanOption {
+	return func(span *tracetest.Span) error {
+		if _, ok := span.Attributes()[label.Key(key)]; ok {
+			return fmt.Errorf("attribute %s is present", key)
+		}
+		return nil
+	}
+}
+
+// WithStatus requires the span to have the status code.
+func WithStatus(code codes.Code) SpanOption {
+	return func(span *tracetest.Span) error {
+		if span.StatusCode() != code {
+			return fmt.Errorf("status is %v, not %v", span.StatusCode(), code)
+		}
+		return nil
+	}
+}
+
+// WithEvent requires the span to have an event with the name.
+func WithEvent(name string) SpanOption {
+	return func(span *tracetest.Span) error {
+		for _, event := range span.Events() {
+			if event.Name == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("event %s is missing", name)
+	}
+}
+
+// FindSpan returns the first span that satisfies all options or nil.
+func FindSpan(spans []*tracetest.Span, opts ...SpanOption) *tracetest.Span {
+	for _, span := range spans {
+		if matchSpan(span, opts) == nil {
+			return span
+		}
+	}
+	return nil
+}
+
+// AssertSpan fails the test unless one of the spans satisfies all options and
+// returns the matching span.
+func AssertSpan(t testing.TB, spans []*tracetest.Span, opts ...SpanOption) *tracetest.Span {
+	t.Helper()
+
+	if span := FindSpan(spans, opts...); span != nil {
+		return span
+	}
+
+	var b strings.Builder
+	for _, span := range spans {
+		fmt.Fprintf(&b, "\n\t%s: %s", span.Name(), matchSpan(span, opts))
+	}
+	t.Errorf("pgexttest: no matching span among %d:%s", len(spans), b.String())
+	return nil
+}
+
+// AssertNoSpan fails the test if one of the spans satisfies all options.
+func AssertNoSpan(t testing.TB, spans []*tracetest.Span, opts ...SpanOption) {
+	t.Helper()
+
+	if span := FindSpan(spans, opts...); span != nil {
+		t.Errorf("pgexttest: unexpected span %s", span.Name())
+	}
+}
+
+func matchSpan(span *tracetest.Span, opts []SpanOption) error {
+	for _, opt := range opts {
+		if err := opt(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+module github.com/j2gg0s/pgext/pgquery
+
+go 1.16
+
+require (
+	github.com/go-pg/pg/v10 v10.0.6
+	github.com/pganalyze/pg_query_go/v2 v2.0.0
+)
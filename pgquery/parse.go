@@ -0,0 +1,80 @@
+// Package pgquery validates queries with the PostgreSQL parser of
+// pg_query_go. It is a module of its own, so pgext does not need cgo.
+package pgquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	pg_query "github.com/pganalyze/pg_query_go/v2"
+)
+
+// ErrUnsafeQuery is returned by ValidateQuery for statements that parse but
+// are considered unsafe, e.g. DELETE or UPDATE without WHERE.
+var ErrUnsafeQuery = errors.New("pgquery: unsafe query")
+
+// ValidateQuery parses the query with the PostgreSQL parser and returns an
+// error if it is invalid or unsafe. It does not need a database connection.
+func ValidateQuery(query string) error {
+	result, err := pg_query.Parse(query)
+	if err != nil {
+		return fmt.Errorf("pgquery: invalid query: %w", err)
+	}
+
+	for _, raw := range result.GetStmts() {
+		stmt := raw.GetStmt()
+		if del := stmt.GetDeleteStmt(); del != nil && del.GetWhereClause() == nil {
+			return fmt.Errorf("%w: DELETE without WHERE", ErrUnsafeQuery)
+		}
+		if upd := stmt.GetUpdateStmt(); upd != nil && upd.GetWhereClause() == nil {
+			return fmt.Errorf("%w: UPDATE without WHERE", ErrUnsafeQuery)
+		}
+	}
+
+	return nil
+}
+
+// ParseHook is a pg.QueryHook that validates every query with ValidateQuery
+// before it is sent and fails the query on error. It is meant for tests and
+// CI:
+//
+//   db.AddQueryHook(pgquery.ParseHook{})
+type ParseHook struct {
+	// AllowUnsafe disables the checks for unsafe statements and only reports
+	// syntax errors.
+	AllowUnsafe bool
+}
+
+var _ pg.QueryHook = (*ParseHook)(nil)
+
+func (h ParseHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+
+	if err := ValidateQuery(string(b)); err != nil {
+		if h.AllowUnsafe && errors.Is(err, ErrUnsafeQuery) {
+			return ctx, nil
+		}
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+func (ParseHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
+
+// formattedQuery returns the formatted query of the event or, if it is empty,
+// the unformatted one. go-pg does not format prepared statements and events
+// built outside of pg.DB, e.g. in tests, have no formatted query.
+func formattedQuery(evt *pg.QueryEvent) ([]byte, error) {
+	if b, err := evt.FormattedQuery(); err != nil || len(b) > 0 {
+		return b, err
+	}
+	return evt.UnformattedQuery()
+}
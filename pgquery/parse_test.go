@@ -0,0 +1,43 @@
+package pgquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestParseHook(t *testing.T) {
+	tests := []struct {
+		query       string
+		allowUnsafe bool
+		invalid     bool
+		unsafe      bool
+	}{
+		{query: "SELECT id FROM users WHERE id = 1"},
+		{query: "SELEC id FROM users", invalid: true},
+		{query: "DELETE FROM users", unsafe: true},
+		{query: "UPDATE users SET name = 'x'", unsafe: true},
+		{query: "DELETE FROM users", allowUnsafe: true},
+		{query: "DELETE FROM users WHERE id = 1"},
+	}
+
+	for _, test := range tests {
+		// Events built outside of pg.DB are validated by their unformatted
+		// query.
+		_, err := ParseHook{AllowUnsafe: test.allowUnsafe}.BeforeQuery(context.Background(), &pg.QueryEvent{Query: test.query})
+		switch {
+		case test.unsafe:
+			if !errors.Is(err, ErrUnsafeQuery) {
+				t.Errorf("%q: got %v, want ErrUnsafeQuery", test.query, err)
+			}
+		case test.invalid:
+			if err == nil || errors.Is(err, ErrUnsafeQuery) {
+				t.Errorf("%q: got %v, want a syntax error", test.query, err)
+			}
+		case err != nil:
+			t.Errorf("%q: got %v, want no error", test.query, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package pgext
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// fakeNull is sent as NULL when used as a value in fakeResult.Rows.
+const fakeNull = "\x00NULL"
+
+// fakeResult is the response of fakeDB to a query.
+type fakeResult struct {
+	Columns []string
+	Rows    [][]string
+	// Tag is the command tag, e.g. "INSERT 0 1". Defaults to "SELECT n".
+	Tag string
+	// Err is sent as an error with the SQLSTATE code of the sqlStateError.
+	Err sqlStateError
+}
+
+var fakeDBs int32
+
+// fakeDB returns a database backed by an in-memory server that speaks enough
+// of the PostgreSQL protocol for simple queries. Every query is answered by
+// handle, which must be safe for concurrent use.
+func fakeDB(t *testing.T, handle func(query string) fakeResult) *pg.DB {
+	t.Helper()
+
+	db := pg.Connect(&pg.Options{
+		// Every database is a different instance, e.g. to HealthTracker.
+		Addr: fmt.Sprintf("fake%d:5432", atomic.AddInt32(&fakeDBs, 1)),
+		Dialer: func(context.Context, string, string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveFake(server, handle)
+			return client, nil
+		},
+	})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func serveFake(conn net.Conn, handle func(query string) fakeResult) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	// The startup message has no type byte.
+	if _, err := readFakeMessage(r); err != nil {
+		return
+	}
+	writeFakeMessage(w, 'R', fakeInt32(0))
+	writeFakeMessage(w, 'Z', []byte{'I'})
+	if w.Flush() != nil {
+		return
+	}
+
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		body, err := readFakeMessage(r)
+		if err != nil || typ == 'X' {
+			return
+		}
+		if typ != 'Q' {
+			writeFakeError(w, "0A000", fmt.Sprintf("fake server: unsupported message %q", typ))
+			writeFakeMessage(w, 'Z', []byte{'I'})
+			if w.Flush() != nil {
+				return
+			}
+			continue
+		}
+
+		res := handle(string(body[:len(body)-1]))
+		if res.Err != "" {
+			writeFakeError(w, string(res.Err), res.Err.Error())
+		} else {
+			writeFakeResult(w, res)
+		}
+		writeFakeMessage(w, 'Z', []byte{'I'})
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func readFakeMessage(r *bufio.Reader) ([]byte, error) {
+	var n int32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	body := make([]byte, n-4)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func writeFakeResult(w *bufio.Writer, res fakeResult) {
+	if len(res.Columns) > 0 {
+		b := fakeInt16(len(res.Columns))
+		for _, col := range res.Columns {
+			b = append(b, col...)
+			b = append(b, 0)
+			b = append(b, fakeInt32(0)...)  // table OID
+			b = append(b, fakeInt16(0)...)  // column number
+			b = append(b, fakeInt32(25)...) // text
+			b = append(b, fakeInt16(-1)...) // type size
+			b = append(b, fakeInt32(-1)...) // type modifier
+			b = append(b, fakeInt16(0)...)  // text format
+		}
+		writeFakeMessage(w, 'T', b)
+
+		for _, row := range res.Rows {
+			b := fakeInt16(len(row))
+			for _, v := range row {
+				if v == fakeNull {
+					b = append(b, fakeInt32(-1)...)
+					continue
+				}
+				b = append(b, fakeInt32(len(v))...)
+				b = append(b, v...)
+			}
+			writeFakeMessage(w, 'D', b)
+		}
+	}
+
+	tag := res.Tag
+	if tag == "" {
+		tag = "SELECT " + strconv.Itoa(len(res.Rows))
+	}
+	writeFakeMessage(w, 'C', append([]byte(tag), 0))
+}
+
+func writeFakeError(w *bufio.Writer, code, msg string) {
+	var b []byte
+	for _, f := range []struct {
+		typ byte
+		val string
+	}{{'S', "ERROR"}, {'C', code}, {'M', msg}} {
+		b = append(b, f.typ)
+		b = append(b, f.val...)
+		b = append(b, 0)
+	}
+	writeFakeMessage(w, 'E', append(b, 0))
+}
+
+func writeFakeMessage(w *bufio.Writer, typ byte, body []byte) {
+	w.WriteByte(typ)
+	w.Write(fakeInt32(len(body) + 4))
+	w.Write(body)
+}
+
+func fakeInt16(n int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(n))
+	return b
+}
+
+func fakeInt32(n int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	return b
+}
@@ -0,0 +1,8 @@
+module github.com/j2gg0s/pgext/pgv9
+
+go 1.16
+
+require (
+	github.com/go-pg/pg/v10 v10.0.6
+	github.com/go-pg/pg/v9 v9.2.1
+)
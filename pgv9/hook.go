@@ -0,0 +1,168 @@
+// Package pgv9 runs the hooks of pgext on go-pg v9.
+package pgv9
+
+import (
+	"context"
+	"sync"
+
+	pg10 "github.com/go-pg/pg/v10"
+	orm10 "github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
+)
+
+// Hook is a go-pg v9 pg.QueryHook that runs a hook written for go-pg v10,
+// so services that can not upgrade yet get the same instrumentation:
+//
+//   db.AddQueryHook(&pgv9.Hook{Hook: &pgext.OpenTelemetryHook{AllowMetric: true}})
+//
+// Queries are formatted by go-pg v9 before they are passed to the hook, so
+// the sql.table label of the model is missing. pg.ErrNoRows and
+// pg.ErrMultiRows are translated in both directions and an error replaced
+// by the hook, e.g. by MiddlewareHook, replaces the error of the query.
+// Features that run their own queries on the v10 *pg.DB, such as ExplainHook,
+// ShadowHook and the server version detection, are not available.
+type Hook struct {
+	Hook pg10.QueryHook
+}
+
+var _ pg.QueryHook = (*Hook)(nil)
+
+type eventKey struct{ hook *Hook }
+
+func (h *Hook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	if h.Hook == nil {
+		return ctx, nil
+	}
+	query, err := evt.FormattedQuery()
+	if err != nil {
+		// go-pg fails the query with the same error.
+		return ctx, nil
+	}
+
+	e := &pg10.QueryEvent{
+		StartTime: evt.StartTime,
+		DB:        newDB(evt.DB),
+		Model:     evt.Model,
+		Query:     query,
+		Stash:     make(map[interface{}]interface{}),
+	}
+	ctx, err = h.Hook.BeforeQuery(ctx, e)
+	return context.WithValue(ctx, eventKey{h}, e), err
+}
+
+func (h *Hook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	e, ok := ctx.Value(eventKey{h}).(*pg10.QueryEvent)
+	if !ok {
+		return nil
+	}
+	if evt.Result != nil {
+		e.Result = result{evt.Result}
+	}
+	e.Err = toV10Error(evt.Err)
+
+	queryErr := e.Err
+	err := h.Hook.AfterQuery(ctx, e)
+	if e.Err != queryErr {
+		evt.Err = toV9Error(e.Err)
+	}
+	return toV9Error(err)
+}
+
+func toV10Error(err error) error {
+	switch err {
+	case pg.ErrNoRows:
+		return pg10.ErrNoRows
+	case pg.ErrMultiRows:
+		return pg10.ErrMultiRows
+	}
+	// pg.Error of v9 has the methods of pg.Error of v10, so SQLSTATE codes
+	// are still recognized.
+	return err
+}
+
+func toV9Error(err error) error {
+	switch err {
+	case pg10.ErrNoRows:
+		return pg.ErrNoRows
+	case pg10.ErrMultiRows:
+		return pg.ErrMultiRows
+	}
+	return err
+}
+
+// result is the result of a query as seen by the hook. The model is not
+// passed on.
+type result struct {
+	res pg.Result
+}
+
+func (r result) Model() orm10.Model { return nil }
+func (r result) RowsAffected() int  { return r.res.RowsAffected() }
+func (r result) RowsReturned() int  { return r.res.RowsReturned() }
+
+// formatter leaves the queries, which are already formatted by go-pg v9,
+// unchanged.
+var formatter = orm10.NewFormatter()
+
+// db is the go-pg v10 database of the event. Only the methods used by hooks
+// to format queries are implemented.
+type db struct {
+	orm10.DB
+	v9 orm.DB
+}
+
+func (db *db) Context() context.Context {
+	if db.v9 == nil {
+		return context.Background()
+	}
+	return db.v9.Context()
+}
+
+func (db *db) Formatter() orm10.QueryFormatter {
+	return formatter
+}
+
+// optionsDB is a db that also exposes the connection options, which hooks
+// use for the address, user and database attributes.
+type optionsDB struct {
+	*db
+	opt *pg10.Options
+}
+
+func (db *optionsDB) Options() *pg10.Options {
+	return db.opt
+}
+
+func newDB(v9 orm.DB) orm10.DB {
+	d := &db{v9: v9}
+	if opt := optionsOf(v9); opt != nil {
+		return &optionsDB{db: d, opt: opt}
+	}
+	return d
+}
+
+// options maps the options of go-pg v9 to the options of go-pg v10.
+var options sync.Map
+
+func optionsOf(db orm.DB) *pg10.Options {
+	o, ok := db.(interface{ Options() *pg.Options })
+	if !ok {
+		return nil
+	}
+	opt := o.Options()
+	if opt == nil {
+		return nil
+	}
+	if v, ok := options.Load(opt); ok {
+		return v.(*pg10.Options)
+	}
+	v, _ := options.LoadOrStore(opt, &pg10.Options{
+		Addr:            opt.Addr,
+		User:            opt.User,
+		Database:        opt.Database,
+		ApplicationName: opt.ApplicationName,
+		TLSConfig:       opt.TLSConfig,
+	})
+	return v.(*pg10.Options)
+}
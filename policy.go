@@ -0,0 +1,234 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// ErrPolicyDenied is returned by PolicyHook for queries the policy denies.
+var ErrPolicyDenied = errors.New("pgext: query denied by policy")
+
+var policyDeniedCounter, _ = meter.NewInt64Counter(
+	"go.sql.policy.denied",
+	metric.WithDescription("The number of queries denied by the policy"),
+)
+
+// PolicyInput describes a query evaluated by a Policy.
+type PolicyInput struct {
+	Operation string `json:"operation"`
+	Table     string `json:"table,omitempty"`
+	Statement string `json:"statement"`
+	Database  string `json:"database,omitempty"`
+	User      string `json:"user,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+}
+
+// PolicyDecision is the result of evaluating a query.
+type PolicyDecision struct {
+	Allow bool
+	// Reason explains a denial.
+	Reason string
+	// Annotations are added to the query span as policy.* attributes.
+	Annotations map[string]string
+}
+
+// Policy decides whether a query may run. The opapolicy module implements
+// it with an embedded OPA policy.
+type Policy interface {
+	Evaluate(ctx context.Context, input *PolicyInput) (*PolicyDecision, error)
+}
+
+// PolicyHook is a pg.QueryHook that evaluates every query against the policy
+// and fails the denied ones with ErrPolicyDenied, so rules such as "the
+// billing service may never DELETE from payments" are enforced in one place.
+// Every statement of a multi-statement query and every data-modifying part
+// of a WITH query is evaluated on its own. Statements whose effect can not
+// be told from their text, e.g. DO blocks, are denied:
+//
+//   db.AddQueryHook(&pgext.PolicyHook{
+//       Policy:  policy,
+//       Service: "billing",
+//   })
+type PolicyHook struct {
+	Policy Policy
+	// Service names the application in the input.
+	Service string
+	// Tenant, if set, extracts the tenant from the query context.
+	Tenant func(context.Context) string
+	// Subject, if set, extracts the acting user from the query context.
+	Subject func(context.Context) string
+	// LogOnly causes the hook to log denied queries instead of failing them.
+	LogOnly bool
+	// FailOpen causes the hook to run queries the policy fails to evaluate.
+	FailOpen bool
+	// Logger is used to print denials and errors. Defaults to the standard
+	// logger.
+	Logger *log.Logger
+}
+
+var _ pg.QueryHook = (*PolicyHook)(nil)
+
+var (
+	fromTableRe = regexp.MustCompile(`(?i)\bFROM\s+("[^"]+"|[\w.]+)`)
+	// withWriteRe matches the writes of data-modifying WITH queries. The first
+	// group is set for FOR UPDATE and ON CONFLICT DO UPDATE, which do not
+	// write another table.
+	withWriteRe = regexp.MustCompile(
+		`(?i)(?:^|[^"\w])((?:FOR\s+(?:NO\s+KEY\s+)?|DO\s+))?(INSERT\s+INTO|UPDATE|DELETE\s+FROM|MERGE\s+INTO)\s+(?:ONLY\s+)?("[^"]+"|[\w.]+)`)
+)
+
+// knownOperations are the statements whose effect is told by their first
+// keyword.
+var knownOperations = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true,
+	"VALUES": true, "TABLE": true, "COPY": true, "LOCK": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "COMMENT": true,
+	"GRANT": true, "REVOKE": true, "REFRESH": true, "REINDEX": true, "CLUSTER": true,
+	"VACUUM": true, "ANALYZE": true, "CHECKPOINT": true,
+	"BEGIN": true, "START": true, "COMMIT": true, "END": true, "ROLLBACK": true,
+	"SAVEPOINT": true, "RELEASE": true, "SET": true, "RESET": true, "SHOW": true,
+	"DECLARE": true, "FETCH": true, "MOVE": true, "CLOSE": true, "DISCARD": true,
+	"LISTEN": true, "UNLISTEN": true, "NOTIFY": true,
+}
+
+// queryTable returns the table written by the query or the first table it
+// reads from.
+func queryTable(query string) string {
+	if table, ok := writeTable(query); ok {
+		return table
+	}
+	if m := fromTableRe.FindStringSubmatch(query); m != nil {
+		return strings.Trim(m[1], `"`)
+	}
+	return ""
+}
+
+// statementOperation is an operation of a statement on a table.
+type statementOperation struct {
+	Operation string
+	Table     string
+	Statement string
+}
+
+// queryOperations returns the operations of every statement of the query.
+// A WITH query has the operations of its data-modifying parts, or SELECT.
+// It returns false together with the unknown operation if a statement can
+// not be classified by its text, e.g. DO, CALL or EXPLAIN ANALYZE.
+func queryOperations(query string) ([]statementOperation, bool) {
+	var ops []statementOperation
+	for _, stmt := range splitStatements(query) {
+		normalized := normalizeQuery(stmt)
+		operation := strings.ToUpper(spanName(normalized))
+		if strings.HasPrefix(normalized, "(") {
+			operation = "SELECT"
+		}
+
+		if operation == "WITH" {
+			var writes int
+			for _, m := range withWriteRe.FindAllStringSubmatch(normalized, -1) {
+				if m[1] != "" {
+					continue
+				}
+				writes++
+				ops = append(ops, statementOperation{
+					Operation: strings.ToUpper(strings.Fields(m[2])[0]),
+					Table:     strings.Trim(m[3], `"`),
+					Statement: stmt,
+				})
+			}
+			if writes == 0 {
+				ops = append(ops, statementOperation{Operation: "SELECT", Table: queryTable(stmt), Statement: stmt})
+			}
+			continue
+		}
+
+		op := statementOperation{Operation: operation, Table: queryTable(stmt), Statement: stmt}
+		if !knownOperations[operation] {
+			return []statementOperation{op}, false
+		}
+		ops = append(ops, op)
+	}
+	return ops, true
+}
+
+func (h *PolicyHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+	query := strings.TrimSpace(string(b))
+
+	base := PolicyInput{Service: h.Service}
+	if db, ok := evt.DB.(*pg.DB); ok {
+		opt := db.Options()
+		base.Database, base.User = opt.Database, opt.User
+	}
+	if h.Tenant != nil {
+		base.Tenant = h.Tenant(ctx)
+	}
+	if h.Subject != nil {
+		base.Subject = h.Subject(ctx)
+	}
+
+	ops, known := queryOperations(query)
+	if !known {
+		input := base
+		input.Operation, input.Table, input.Statement = ops[0].Operation, ops[0].Table, ops[0].Statement
+		return h.deny(ctx, &input, "unknown operation "+input.Operation)
+	}
+	if v, ok := evt.Query.(queryOperation); ok && len(ops) == 1 {
+		ops[0].Operation = strings.ToUpper(string(v.Operation()))
+	}
+
+	span := trace.SpanFromContext(ctx)
+	for _, op := range ops {
+		input := base
+		input.Operation, input.Table, input.Statement = op.Operation, op.Table, op.Statement
+
+		decision, err := h.Policy.Evaluate(ctx, &input)
+		if err != nil {
+			if h.FailOpen {
+				logf(h.Logger, "pgext: evaluating policy failed: %s", err)
+				continue
+			}
+			return ctx, fmt.Errorf("%w: %s", ErrPolicyDenied, err)
+		}
+
+		for k, v := range decision.Annotations {
+			setAttributes(span, label.String("policy."+k, v))
+		}
+		if !decision.Allow {
+			return h.deny(ctx, &input, decision.Reason)
+		}
+	}
+	return ctx, nil
+}
+
+func (h *PolicyHook) deny(ctx context.Context, input *PolicyInput, reason string) (context.Context, error) {
+	policyDeniedCounter.Add(ctx, 1,
+		methodLabel(input.Operation),
+		tableKey.String(input.Table),
+	)
+	addEvent(ctx, trace.SpanFromContext(ctx), "pgext.policy_denied", label.String("policy.reason", reason))
+
+	if h.LogOnly {
+		logf(h.Logger, "pgext: policy denies %s on %s: %s", input.Operation, input.Table, reason)
+		return ctx, nil
+	}
+	return ctx, fmt.Errorf("%w: %s", ErrPolicyDenied, reason)
+}
+
+func (h *PolicyHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
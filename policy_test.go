@@ -0,0 +1,93 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+type policyFunc func(input *PolicyInput) *PolicyDecision
+
+func (fn policyFunc) Evaluate(_ context.Context, input *PolicyInput) (*PolicyDecision, error) {
+	return fn(input), nil
+}
+
+func TestPolicyHook(t *testing.T) {
+	h := &PolicyHook{
+		Service: "billing",
+		Policy: policyFunc(func(input *PolicyInput) *PolicyDecision {
+			if input.Service == "billing" && input.Operation == "DELETE" && input.Table == "payments" {
+				return &PolicyDecision{Reason: "billing may not delete payments"}
+			}
+			return &PolicyDecision{Allow: true}
+		}),
+	}
+
+	tests := []struct {
+		query  string
+		denied bool
+	}{
+		{`DELETE FROM "payments" WHERE id = 1`, true},
+		{`DELETE FROM invoices WHERE id = 1`, false},
+		{`SELECT * FROM payments`, false},
+		{`SELECT * FROM payments FOR UPDATE`, false},
+		{`SELECT 'DELETE FROM payments'`, false},
+		{`SELECT 1; DELETE FROM payments`, true},
+		{`/* cleanup */ DELETE FROM payments`, true},
+		{`WITH d AS (DELETE FROM payments RETURNING *) SELECT * FROM d`, true},
+		{`DO $$ BEGIN DELETE FROM payments; END $$`, true},
+	}
+	for _, test := range tests {
+		_, err := pgexttest.Run(context.Background(), h, pgexttest.NewQueryEvent(test.query).Build())
+		if denied := errors.Is(err, ErrPolicyDenied); denied != test.denied {
+			t.Errorf("%q: got error %v, want denied %t", test.query, err, test.denied)
+		}
+	}
+}
+
+func TestQueryOperations(t *testing.T) {
+	tests := []struct {
+		query string
+		ops   string
+		known bool
+	}{
+		{`SELECT * FROM users`, "SELECT users", true},
+		{`(SELECT 1) UNION (SELECT 2)`, "SELECT ", true},
+		{`INSERT INTO a VALUES (1); UPDATE b SET n = 1`, "INSERT a, UPDATE b", true},
+		{`WITH u AS (UPDATE a SET n = 1 RETURNING id) DELETE FROM b USING u`, "UPDATE a, DELETE b", true},
+		{`WITH s AS (SELECT * FROM a FOR UPDATE) SELECT * FROM s`, "SELECT a", true},
+		{`WITH v AS (SELECT 1) INSERT INTO a SELECT * FROM v ON CONFLICT (id) DO UPDATE SET n = 1`, "INSERT a", true},
+		{`BEGIN; DELETE FROM a; COMMIT`, "BEGIN , DELETE a, COMMIT ", true},
+		{`EXPLAIN ANALYZE DELETE FROM a`, "EXPLAIN a", false},
+		{`SELECT 1; CALL purge()`, "CALL ", false},
+		{``, "", true},
+	}
+
+	for _, test := range tests {
+		ops, known := queryOperations(test.query)
+		var got []string
+		for _, op := range ops {
+			got = append(got, op.Operation+" "+op.Table)
+		}
+		if strings.Join(got, ", ") != test.ops || known != test.known {
+			t.Errorf("queryOperations(%q) = %q, %t, want %q, %t", test.query, got, known, test.ops, test.known)
+		}
+	}
+}
+
+func TestQueryTable(t *testing.T) {
+	tests := map[string]string{
+		`SELECT * FROM "users" AS "u" WHERE id = 1`: "users",
+		`SELECT count(*) FROM public.orders`:        "public.orders",
+		`UPDATE accounts SET balance = 0`:           "accounts",
+		`SELECT 1`:                                  "",
+	}
+	for query, want := range tests {
+		if got := queryTable(query); got != want {
+			t.Errorf("queryTable(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
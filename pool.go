@@ -0,0 +1,87 @@
+package pgext
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+// PoolStatsObserver reports connection pool statistics of a database as
+// go.sql.pool.* metrics.
+type PoolStatsObserver struct {
+	db     *pg.DB
+	remove func()
+}
+
+var _ Shutdowner = (*PoolStatsObserver)(nil)
+
+// ObservePoolStats starts reporting pool statistics of the database until
+// Close is called. Metrics are labeled with the database name.
+func ObservePoolStats(db *pg.DB) *PoolStatsObserver {
+	return observePoolStats(db, "", nil)
+}
+
+type poolInstruments struct {
+	hits, misses, timeouts metric.Int64SumObserver
+	total, idle, stale     metric.Int64ValueObserver
+}
+
+// observePoolStats is ObservePoolStats with the instance label, which
+// defaults to the database name, and the go.sql.pool.* names passed through
+// rename, if set. The pools of every database are reported by one observer.
+func observePoolStats(db *pg.DB, instance string, rename func(string) string) *PoolStatsObserver {
+	if rename == nil {
+		rename = func(name string) string { return name }
+	}
+	labels := []label.KeyValue{instanceKey.String(instanceName(db, instance))}
+
+	o := &PoolStatsObserver{db: db}
+	o.remove = observeBatch(rename("go.sql.pool.hits"),
+		func(batch metric.BatchObserver) interface{} {
+			var i poolInstruments
+			i.hits, _ = batch.NewInt64SumObserver(rename("go.sql.pool.hits"),
+				metric.WithDescription("The number of times a free connection was found in the pool"))
+			i.misses, _ = batch.NewInt64SumObserver(rename("go.sql.pool.misses"),
+				metric.WithDescription("The number of times a free connection was not found in the pool"))
+			i.timeouts, _ = batch.NewInt64SumObserver(rename("go.sql.pool.timeouts"),
+				metric.WithDescription("The number of times a wait for a connection timed out"))
+			i.total, _ = batch.NewInt64ValueObserver(rename("go.sql.pool.total_conns"),
+				metric.WithDescription("The number of connections in the pool"))
+			i.idle, _ = batch.NewInt64ValueObserver(rename("go.sql.pool.idle_conns"),
+				metric.WithDescription("The number of idle connections in the pool"))
+			i.stale, _ = batch.NewInt64ValueObserver(rename("go.sql.pool.stale_conns"),
+				metric.WithDescription("The number of stale connections removed from the pool"))
+			return &i
+		},
+		func(_ context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			i := instruments.(*poolInstruments)
+			stats := db.PoolStats()
+			result.Observe(labels,
+				i.hits.Observation(int64(stats.Hits)),
+				i.misses.Observation(int64(stats.Misses)),
+				i.timeouts.Observation(int64(stats.Timeouts)),
+				i.total.Observation(int64(stats.TotalConns)),
+				i.idle.Observation(int64(stats.IdleConns)),
+				i.stale.Observation(int64(stats.StaleConns)),
+			)
+		})
+	return o
+}
+
+// Stats returns the current pool statistics.
+func (o *PoolStatsObserver) Stats() *pg.PoolStats {
+	return o.db.PoolStats()
+}
+
+// Close stops reporting the pool statistics of the database.
+func (o *PoolStatsObserver) Close() error {
+	o.remove()
+	return nil
+}
+
+// Shutdown is Close that satisfies Shutdowner.
+func (o *PoolStatsObserver) Shutdown(context.Context) error {
+	return o.Close()
+}
@@ -0,0 +1,235 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// HotStatement is a statement executed often enough to benefit from being
+// prepared.
+type HotStatement struct {
+	Query string
+	Count int
+}
+
+// PrepareTracker is a pg.QueryHook that counts executions of every
+// unformatted statement and reports the ones executed more than Threshold
+// times, which would benefit from prepared statements. Every statement is
+// reported once.
+//
+//   tracker := &pgext.PrepareTracker{Threshold: 1000}
+//   db.AddQueryHook(tracker)
+type PrepareTracker struct {
+	// Threshold is the number of executions that makes a statement hot.
+	// Defaults to 100.
+	Threshold int
+	// Logger is used to report hot statements. Defaults to the standard logger.
+	Logger *log.Logger
+
+	mu sync.Mutex
+	// counts maps statements to their executions. It is bounded by the
+	// memory budget, see SetMemoryLimit.
+	counts *lruCache
+}
+
+var _ pg.QueryHook = (*PrepareTracker)(nil)
+
+func (t *PrepareTracker) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (t *PrepareTracker) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if evt.Err != nil {
+		return nil
+	}
+	b, err := evt.UnformattedQuery()
+	if err != nil {
+		return err
+	}
+	query := string(b)
+
+	t.mu.Lock()
+	if t.counts == nil {
+		t.counts = newLRUCache("prepare_tracker")
+	}
+	v, _ := t.counts.load(query)
+	n, _ := v.(int)
+	n++
+	t.counts.store(query, n)
+	t.mu.Unlock()
+
+	if n != t.threshold()+1 {
+		return nil
+	}
+
+	printf := log.Printf
+	if t.Logger != nil {
+		printf = t.Logger.Printf
+	}
+	printf("pgext: statement executed %d times would benefit from being prepared:\n%s", n, query)
+
+	return nil
+}
+
+// Hot returns the statements executed more than Threshold times, the most
+// frequent first.
+func (t *PrepareTracker) Hot() []HotStatement {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var hot []HotStatement
+	if t.counts != nil {
+		t.counts.rangeEntries(func(query string, v interface{}) {
+			if n := v.(int); n > t.threshold() {
+				hot = append(hot, HotStatement{Query: query, Count: n})
+			}
+		})
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Count != hot[j].Count {
+			return hot[i].Count > hot[j].Count
+		}
+		return hot[i].Query < hot[j].Query
+	})
+	return hot
+}
+
+func (t *PrepareTracker) isHot(query string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.counts == nil {
+		return false
+	}
+	v, _ := t.counts.load(query)
+	n, _ := v.(int)
+	return n > t.threshold()
+}
+
+func (t *PrepareTracker) threshold() int {
+	if t.Threshold > 0 {
+		return t.Threshold
+	}
+	return 100
+}
+
+// PreparedStatements executes statements on a dedicated connection and
+// transparently prepares the ones the tracker reports as hot. Statements
+// use go-pg's ? placeholders:
+//
+//   ps := &pgext.PreparedStatements{DB: db, Conn: db.Conn(), Tracker: tracker}
+//   defer ps.Close()
+//   _, err := ps.ExecContext(ctx, `UPDATE counters SET n = n + 1 WHERE id = ?`, id)
+//
+// A pg.Conn is a single connection, so PreparedStatements should be used by
+// one goroutine at a time. Behind PgBouncer it needs session pooling.
+type PreparedStatements struct {
+	// DB is the database Conn was taken from. A pg.Conn does not expose its
+	// options, so PgBouncer pool modes recorded by SetPgBouncer are only
+	// checked if DB is set.
+	DB *pg.DB
+	// Conn is the dedicated connection statements are prepared on.
+	Conn *pg.Conn
+	// Tracker decides which statements are hot.
+	Tracker *PrepareTracker
+
+	mu    sync.Mutex
+	stmts map[string]*pg.Stmt
+}
+
+// ExecContext executes the statement, using a prepared statement if it is hot.
+func (p *PreparedStatements) ExecContext(ctx context.Context, query string, params ...interface{}) (pg.Result, error) {
+	stmt, err := p.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return p.Conn.ExecContext(ctx, query, params...)
+	}
+	return stmt.ExecContext(ctx, params...)
+}
+
+// QueryContext executes the query into the model, using a prepared
+// statement if it is hot.
+func (p *PreparedStatements) QueryContext(
+	ctx context.Context, model interface{}, query string, params ...interface{},
+) (pg.Result, error) {
+	stmt, err := p.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return p.Conn.QueryContext(ctx, model, query, params...)
+	}
+	return stmt.QueryContext(ctx, model, params...)
+}
+
+// stmt returns the prepared statement for the query or nil if it is not hot.
+func (p *PreparedStatements) stmt(query string) (*pg.Stmt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if stmt, ok := p.stmts[query]; ok {
+		return stmt, nil
+	}
+	if p.Tracker == nil || !p.Tracker.isHot(query) {
+		return nil, nil
+	}
+	if p.DB != nil {
+		if err := requireSession(p.DB, "PreparedStatements"); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := p.Conn.Prepare(positionalParams(query))
+	if err != nil {
+		return nil, err
+	}
+	if p.stmts == nil {
+		p.stmts = make(map[string]*pg.Stmt)
+	}
+	p.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Close closes the prepared statements. It does not close the connection.
+func (p *PreparedStatements) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range p.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.stmts, query)
+	}
+	return firstErr
+}
+
+// positionalParams replaces go-pg's ? placeholders outside of quotes with
+// PostgreSQL's $1, $2, ...
+func positionalParams(query string) string {
+	var b strings.Builder
+	var n int
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"':
+			j := skipQuoted(query, i, c)
+			b.WriteString(query[i : j+1])
+			i = j
+		case '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
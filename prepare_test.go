@@ -0,0 +1,42 @@
+package pgext
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestPositionalParams(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`SELECT 1`, `SELECT 1`},
+		{`UPDATE t SET a = ? WHERE id = ?`, `UPDATE t SET a = $1 WHERE id = $2`},
+		{`SELECT '?' FROM "t?" WHERE a = ?`, `SELECT '?' FROM "t?" WHERE a = $1`},
+	}
+
+	for _, test := range tests {
+		if got := positionalParams(test.query); got != test.want {
+			t.Errorf("positionalParams(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestPrepareTracker(t *testing.T) {
+	tr := &PrepareTracker{Threshold: 2, Logger: log.New(ioutil.Discard, "", 0)}
+	ctx := context.Background()
+
+	for _, query := range []string{"SELECT 1", "SELECT 1", "SELECT 1", "SELECT 2", "SELECT 2"} {
+		if err := tr.AfterQuery(ctx, &pg.QueryEvent{Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hot := tr.Hot()
+	if len(hot) != 1 || hot[0] != (HotStatement{Query: "SELECT 1", Count: 3}) {
+		t.Errorf("got hot statements %+v", hot)
+	}
+}
@@ -0,0 +1,147 @@
+package pgext
+
+import (
+	"strings"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorGray   = "\x1b[90m"
+	colorBold   = "\x1b[1m"
+)
+
+// clauseKeywords start a new line when a query is pretty printed.
+var clauseKeywords = map[string]bool{
+	"FROM":      true,
+	"WHERE":     true,
+	"JOIN":      true,
+	"LEFT":      true,
+	"RIGHT":     true,
+	"INNER":     true,
+	"FULL":      true,
+	"CROSS":     true,
+	"GROUP":     true,
+	"ORDER":     true,
+	"HAVING":    true,
+	"LIMIT":     true,
+	"OFFSET":    true,
+	"RETURNING": true,
+	"VALUES":    true,
+	"SET":       true,
+	"UNION":     true,
+}
+
+var joinModifiers = map[string]bool{
+	"LEFT":  true,
+	"RIGHT": true,
+	"INNER": true,
+	"FULL":  true,
+	"CROSS": true,
+	"OUTER": true,
+}
+
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true, "INTO": true,
+	"FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "NULL": true,
+	"IS": true, "IN": true, "AS": true, "ON": true, "JOIN": true, "LEFT": true,
+	"RIGHT": true, "INNER": true, "OUTER": true, "FULL": true, "CROSS": true,
+	"GROUP": true, "ORDER": true, "BY": true, "HAVING": true, "LIMIT": true,
+	"OFFSET": true, "RETURNING": true, "VALUES": true, "SET": true, "UNION": true,
+	"ALL": true, "DISTINCT": true, "CASE": true, "WHEN": true, "THEN": true,
+	"ELSE": true, "END": true, "ASC": true, "DESC": true, "LIKE": true,
+	"ILIKE": true, "BETWEEN": true, "EXISTS": true, "CONFLICT": true, "DO": true,
+	"NOTHING": true, "WITH": true, "CREATE": true, "DROP": true, "TABLE": true,
+	"ALTER": true, "INDEX": true, "IF": true, "DEFAULT": true, "TRUE": true,
+	"FALSE": true, "BEGIN": true, "COMMIT": true, "ROLLBACK": true,
+}
+
+// prettyQuery breaks the query into lines at the main clauses and, if color
+// is true, highlights keywords, strings and numbers with ANSI escapes.
+func prettyQuery(query string, color bool) string {
+	var b strings.Builder
+	b.Grow(len(query) + len(query)/4)
+
+	paint := func(c, s string) {
+		if color {
+			b.WriteString(c)
+			b.WriteString(s)
+			b.WriteString(colorReset)
+		} else {
+			b.WriteString(s)
+		}
+	}
+
+	depth := 0
+	prev := ""
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			end := skipQuoted(query, i, '\'')
+			paint(colorGreen, query[i:end+1])
+			i = end
+		case c == '"':
+			end := skipQuoted(query, i, '"')
+			b.WriteString(query[i : end+1])
+			i = end
+		case c == '(':
+			depth++
+			b.WriteByte(c)
+		case c == ')':
+			depth--
+			b.WriteByte(c)
+		case isDigit(c) && !prevIsIdent(query, i):
+			end := i
+			for end+1 < len(query) && (isDigit(query[end+1]) || query[end+1] == '.') {
+				end++
+			}
+			paint(colorYellow, query[i:end+1])
+			i = end
+		case isIdentStart(c):
+			end := i
+			for end+1 < len(query) && isIdentPart(query[end+1]) {
+				end++
+			}
+			word := query[i : end+1]
+			upper := strings.ToUpper(word)
+			joined := (upper == "JOIN" || upper == "OUTER") && joinModifiers[prev]
+			if depth == 0 && clauseKeywords[upper] && !joined && b.Len() > 0 {
+				trimTrailingSpace(&b)
+				b.WriteString("\n")
+			}
+			if sqlKeywords[upper] {
+				paint(colorBlue, word)
+			} else {
+				b.WriteString(word)
+			}
+			prev = upper
+			i = end
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func trimTrailingSpace(b *strings.Builder) {
+	s := b.String()
+	trimmed := strings.TrimRight(s, " \t")
+	if len(trimmed) == len(s) {
+		return
+	}
+	b.Reset()
+	b.WriteString(trimmed)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
@@ -0,0 +1,14 @@
+package pgext
+
+import "testing"
+
+func TestPrettyQuery(t *testing.T) {
+	query := `SELECT u.id FROM users AS u LEFT JOIN books AS b ON b.user_id = u.id ` +
+		`WHERE u.id IN (SELECT user_id FROM orders) AND u.name = 'from' ORDER BY u.id LIMIT 10`
+	want := "SELECT u.id\nFROM users AS u\nLEFT JOIN books AS b ON b.user_id = u.id\n" +
+		"WHERE u.id IN (SELECT user_id FROM orders) AND u.name = 'from'\nORDER BY u.id\nLIMIT 10"
+
+	if got := prettyQuery(query, false); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package pgext
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var priorityKey = label.Key("sql.priority")
+
+var (
+	queueDepthCounter, _ = meter.NewInt64UpDownCounter(
+		"go.sql.queue.depth",
+		metric.WithDescription("The number of queries waiting in the PriorityHook queue"),
+	)
+	queueWaitRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.queue.wait",
+		metric.WithDescription("The time queries waited in the PriorityHook queue in microsecond"),
+	)
+)
+
+// Priority is the scheduling class of a query.
+type Priority int
+
+const (
+	// PriorityInteractive is for queries serving users. It is the default.
+	PriorityInteractive Priority = iota
+	// PriorityBatch is for background and batch jobs that can wait.
+	PriorityBatch
+)
+
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+type priorityCtxKey struct{}
+
+// WithPriority returns a context in which queries run with priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityCtxKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by WithPriority, or
+// PriorityInteractive.
+func PriorityFromContext(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityCtxKey{}).(Priority)
+	return p
+}
+
+type admittedKey struct{}
+
+// PriorityHook is a pg.QueryHook that limits the queries in flight. Under
+// pressure batch queries wait while interactive queries proceed, so a batch
+// job can not starve requests of connections:
+//
+//   db.AddQueryHook(&pgext.PriorityHook{MaxConcurrent: 20, BatchConcurrent: 10})
+//
+//   ctx = pgext.WithPriority(ctx, pgext.PriorityBatch)
+//   _, err := db.ExecContext(ctx, "DELETE FROM events WHERE created_at < ?", cutoff)
+//
+// Waiting queries fail with the error of their context. Queries in a
+// transaction are admitted one by one, so size the limits well below the pool
+// size if batch transactions hold connections.
+type PriorityHook struct {
+	// MaxConcurrent is the maximum number of queries in flight. Interactive
+	// queries wait only at this limit and are admitted before batch queries.
+	// Zero means no limit.
+	MaxConcurrent int
+	// BatchConcurrent is the number of queries in flight at which batch
+	// queries wait. Defaults to half of MaxConcurrent.
+	BatchConcurrent int
+
+	mu          sync.Mutex
+	running     int
+	interactive []chan struct{}
+	batch       []chan struct{}
+}
+
+var _ pg.QueryHook = (*PriorityHook)(nil)
+
+func (h *PriorityHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	p := PriorityFromContext(ctx)
+	labels := []label.KeyValue{priorityKey.String(p.String())}
+	start := time.Now()
+
+	h.mu.Lock()
+	waiting := len(h.interactive)
+	if p == PriorityBatch {
+		waiting += len(h.batch)
+	}
+	if waiting == 0 && h.running < h.limit(p) {
+		h.running++
+		h.mu.Unlock()
+		queueWaitRecorder.Record(ctx, 0, labels...)
+		return context.WithValue(ctx, admittedKey{}, h), nil
+	}
+	ready := make(chan struct{})
+	if p == PriorityBatch {
+		h.batch = append(h.batch, ready)
+	} else {
+		h.interactive = append(h.interactive, ready)
+	}
+	h.mu.Unlock()
+
+	queueDepthCounter.Add(ctx, 1, labels...)
+	defer queueDepthCounter.Add(ctx, -1, labels...)
+
+	select {
+	case <-ready:
+		queueWaitRecorder.Record(ctx, time.Since(start).Microseconds(), labels...)
+		return context.WithValue(ctx, admittedKey{}, h), nil
+	case <-ctx.Done():
+	}
+
+	h.mu.Lock()
+	select {
+	case <-ready:
+		// Admitted while giving up.
+		h.running--
+		h.admit()
+	default:
+		h.remove(ready)
+		h.admit()
+	}
+	h.mu.Unlock()
+	return ctx, ctx.Err()
+}
+
+func (h *PriorityHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if ctx.Value(admittedKey{}) != h {
+		return nil
+	}
+	h.mu.Lock()
+	h.running--
+	h.admit()
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *PriorityHook) limit(p Priority) int {
+	max := h.MaxConcurrent
+	if max <= 0 {
+		max = int(^uint(0) >> 1)
+	}
+	if p != PriorityBatch {
+		return max
+	}
+	batch := h.BatchConcurrent
+	if batch <= 0 {
+		if h.MaxConcurrent <= 0 {
+			return max
+		}
+		batch = h.MaxConcurrent / 2
+		if batch < 1 {
+			batch = 1
+		}
+	}
+	if batch > max {
+		batch = max
+	}
+	return batch
+}
+
+// admit admits waiting queries, interactive ones first. h.mu must be held.
+func (h *PriorityHook) admit() {
+	for len(h.interactive) > 0 && h.running < h.limit(PriorityInteractive) {
+		close(h.interactive[0])
+		h.interactive = h.interactive[1:]
+		h.running++
+	}
+	for len(h.interactive) == 0 && len(h.batch) > 0 && h.running < h.limit(PriorityBatch) {
+		close(h.batch[0])
+		h.batch = h.batch[1:]
+		h.running++
+	}
+}
+
+// remove removes a waiting query from the queue. h.mu must be held.
+func (h *PriorityHook) remove(ready chan struct{}) {
+	for _, q := range []*[]chan struct{}{&h.interactive, &h.batch} {
+		for i, c := range *q {
+			if c == ready {
+				*q = append((*q)[:i:i], (*q)[i+1:]...)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestPriorityHook(t *testing.T) {
+	h := &PriorityHook{MaxConcurrent: 2, BatchConcurrent: 1}
+	bg := context.Background()
+	batch := WithPriority(bg, PriorityBatch)
+
+	ctx1, err := h.BeforeQuery(batch, &pg.QueryEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second batch query waits while an interactive query proceeds.
+	admitted := make(chan context.Context)
+	go func() {
+		ctx, err := h.BeforeQuery(batch, &pg.QueryEvent{})
+		if err != nil {
+			t.Error(err)
+		}
+		admitted <- ctx
+	}()
+
+	ctx2, err := h.BeforeQuery(bg, &pg.QueryEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// At MaxConcurrent interactive queries wait too.
+	timeout, cancel := context.WithTimeout(bg, 10*time.Millisecond)
+	defer cancel()
+	if _, err := h.BeforeQuery(timeout, &pg.QueryEvent{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want DeadlineExceeded", err)
+	}
+
+	select {
+	case <-admitted:
+		t.Fatal("batch query admitted above BatchConcurrent")
+	default:
+	}
+
+	_ = h.AfterQuery(ctx2, &pg.QueryEvent{})
+	select {
+	case <-admitted:
+		t.Fatal("batch query admitted above BatchConcurrent")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	_ = h.AfterQuery(ctx1, &pg.QueryEvent{})
+	ctx3 := <-admitted
+	_ = h.AfterQuery(ctx3, &pg.QueryEvent{})
+
+	if h.running != 0 {
+		t.Errorf("got %d queries running, want 0", h.running)
+	}
+}
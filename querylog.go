@@ -0,0 +1,277 @@
+package pgext
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// QueryLogFormat is the file format of QueryLogHook.
+type QueryLogFormat int
+
+const (
+	// QueryLogJSON writes one JSON object per line.
+	QueryLogJSON QueryLogFormat = iota
+	// QueryLogCSV writes CSV with a header.
+	QueryLogCSV
+)
+
+var queryLogHeader = []string{"time", "fingerprint", "statement", "duration_us", "rows", "error", "trace_id"}
+
+type queryLogEntry struct {
+	Time        time.Time `json:"time"`
+	Fingerprint string    `json:"fingerprint"`
+	Statement   string    `json:"statement"`
+	DurationUS  int64     `json:"duration_us"`
+	Rows        int       `json:"rows"`
+	Error       string    `json:"error,omitempty"`
+	TraceID     string    `json:"trace_id,omitempty"`
+}
+
+func (e *queryLogEntry) record() []string {
+	return []string{
+		e.Time.Format(time.RFC3339Nano),
+		e.Fingerprint,
+		e.Statement,
+		strconv.FormatInt(e.DurationUS, 10),
+		strconv.Itoa(e.Rows),
+		e.Error,
+		e.TraceID,
+	}
+}
+
+// QueryLogHook is a pg.QueryHook that writes every query to a file for
+// offline analysis and audits: the normalized statement without literals,
+// its fingerprint, duration, number of rows, error and trace ID. Files are
+// rotated by size and age and rotated files can be compressed:
+//
+//   h := &pgext.QueryLogHook{Path: "/var/log/app/queries.jsonl", Compress: true}
+//   db.AddQueryHook(h)
+//   defer h.Shutdown(ctx)
+//
+// Rotated files are named after the time of rotation, e.g.
+// queries.jsonl.20201001T120000.000000000.gz.
+type QueryLogHook struct {
+	// Path is the file queries are written to.
+	Path string
+	// Format is the file format. Defaults to JSON Lines.
+	Format QueryLogFormat
+	// MaxSize is the size in bytes after which the file is rotated.
+	// Defaults to 100MB.
+	MaxSize int64
+	// MaxAge is the age after which the file is rotated. Zero disables
+	// rotation by age.
+	MaxAge time.Duration
+	// Compress compresses rotated files with gzip.
+	Compress bool
+	// Clock, if set, is used to measure duration instead of the system clock.
+	Clock Clock
+	// Logger is used to print errors. Defaults to the standard logger.
+	Logger *log.Logger
+
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	size   int64
+	opened time.Time
+	wg     sync.WaitGroup
+}
+
+var (
+	_ pg.QueryHook = (*QueryLogHook)(nil)
+	_ Shutdowner   = (*QueryLogHook)(nil)
+)
+
+func (h *QueryLogHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *QueryLogHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	b, err := evt.UnformattedQuery()
+	if err != nil {
+		return err
+	}
+
+	statement := redact(normalizeQuery(string(b)))
+	entry := queryLogEntry{
+		Time:        evt.StartTime,
+		Fingerprint: fingerprint(statement),
+		Statement:   statement,
+		DurationUS:  since(h.Clock, evt.StartTime).Microseconds(),
+	}
+	if evt.Result != nil {
+		entry.Rows = evt.Result.RowsAffected()
+	}
+	if evt.Err != nil {
+		entry.Error = evt.Err.Error()
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID.String()
+	}
+
+	if err := h.write(&entry); err != nil {
+		logf(h.Logger, "pgext: writing query log failed: %s", err)
+	}
+	return nil
+}
+
+func (h *QueryLogHook) write(entry *queryLogEntry) error {
+	var line []byte
+	switch h.Format {
+	case QueryLogCSV:
+		line = csvLine(entry.record())
+	default:
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		line = append(b, '\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file != nil && h.shouldRotate(int64(len(line))) {
+		if err := h.rotate(); err != nil {
+			return err
+		}
+	}
+	if h.file == nil {
+		if err := h.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := h.w.Write(line)
+	h.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return h.w.Flush()
+}
+
+func (h *QueryLogHook) shouldRotate(n int64) bool {
+	maxSize := h.MaxSize
+	if maxSize <= 0 {
+		maxSize = 100 << 20
+	}
+	if h.size+n > maxSize {
+		return true
+	}
+	return h.MaxAge > 0 && time.Since(h.opened) >= h.MaxAge
+}
+
+func (h *QueryLogHook) open() error {
+	f, err := os.OpenFile(h.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	h.file, h.w = f, bufio.NewWriter(f)
+	h.size, h.opened = fi.Size(), time.Now()
+
+	if h.Format == QueryLogCSV && h.size == 0 {
+		n, err := h.w.Write(csvLine(queryLogHeader))
+		h.size += int64(n)
+		return err
+	}
+	return nil
+}
+
+func (h *QueryLogHook) rotate() error {
+	if err := h.close(); err != nil {
+		return err
+	}
+
+	rotated := h.Path + "." + time.Now().Format("20060102T150405.000000000")
+	if err := os.Rename(h.Path, rotated); err != nil {
+		return err
+	}
+
+	if h.Compress {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			if err := gzipFile(rotated); err != nil {
+				logf(h.Logger, "pgext: compressing query log failed: %s", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (h *QueryLogHook) close() error {
+	if h.file == nil {
+		return nil
+	}
+	err := h.w.Flush()
+	if err2 := h.file.Close(); err == nil {
+		err = err2
+	}
+	h.file, h.w = nil, nil
+	return err
+}
+
+// Shutdown closes the file and waits for rotated files to be compressed.
+func (h *QueryLogHook) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	err := h.close()
+	h.mu.Unlock()
+
+	if err2 := waitGroup(ctx, &h.wg); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func csvLine(record []string) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write(record)
+	w.Flush()
+	return b.Bytes()
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,64 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestQueryLogHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := &QueryLogHook{
+		Path:     filepath.Join(dir, "queries.csv"),
+		Format:   QueryLogCSV,
+		MaxSize:  200,
+		Compress: true,
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		evt := &pg.QueryEvent{
+			Query:     "SELECT * FROM users WHERE id = 42",
+			StartTime: time.Now(),
+			Err:       errors.New("boom"),
+		}
+		if err := h.AfterQuery(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(h.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if lines[0] != strings.Join(queryLogHeader, ",") {
+		t.Errorf("got header %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "SELECT * FROM users WHERE id = ?") || !strings.Contains(lines[1], "boom") {
+		t.Errorf("got line %q", lines[1])
+	}
+
+	rotated, err := filepath.Glob(h.Path + ".*.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) == 0 {
+		t.Error("log is not rotated and compressed")
+	}
+}
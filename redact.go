@@ -0,0 +1,181 @@
+package pgext
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Redactor masks sensitive values in statements before they are recorded.
+//
+//   pgext.SetRedactor(&pgext.Redactor{
+//       Columns:  []string{"password", "ssn", "email"},
+//       Patterns: []*regexp.Regexp{regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`)},
+//   })
+type Redactor struct {
+	// Columns lists column names whose values are masked, both when compared
+	// to a literal, e.g. email = '...', and when inserted.
+	Columns []string
+	// Patterns lists regular expressions whose matches are masked.
+	Patterns []*regexp.Regexp
+	// Secrets, if set to true, masks secrets found by
+	// DefaultSecretDetectors.
+	Secrets bool
+	// Mask replaces the redacted values. Defaults to '?'.
+	Mask string
+
+	once       sync.Once
+	columns    map[string]bool
+	comparison *regexp.Regexp
+}
+
+var insertValuesRe = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+[^(]+\(([^)]*)\)\s*VALUES\s*`)
+
+func (r *Redactor) init() {
+	r.once.Do(func() {
+		if len(r.Columns) == 0 {
+			return
+		}
+		r.columns = make(map[string]bool, len(r.Columns))
+		names := make([]string, len(r.Columns))
+		for i, col := range r.Columns {
+			r.columns[strings.ToLower(col)] = true
+			names[i] = regexp.QuoteMeta(col)
+		}
+		r.comparison = regexp.MustCompile(`(?i)((?:^|[^\w])"?(?:` + strings.Join(names, "|") +
+			`)"?\s*(?:=|<>|!=|\bI?LIKE\b)\s*)('(?:[^']|'')*'|-?\d+(?:\.\d+)?)`)
+	})
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask != "" {
+		return r.Mask
+	}
+	return "?"
+}
+
+// Redact returns the query with sensitive values masked.
+func (r *Redactor) Redact(query string) string {
+	if r == nil {
+		return query
+	}
+	r.init()
+
+	mask := r.mask()
+	if r.comparison != nil {
+		query = r.redactInsert(query, mask)
+		query = r.comparison.ReplaceAllString(query, "${1}"+strings.ReplaceAll(mask, "$", "$$"))
+	}
+	for _, re := range r.Patterns {
+		query = re.ReplaceAllLiteralString(query, mask)
+	}
+	if r.Secrets {
+		for _, d := range DefaultSecretDetectors {
+			query = d.Pattern.ReplaceAllLiteralString(query, mask)
+		}
+	}
+	return query
+}
+
+// redactInsert masks the values of sensitive columns in the VALUES list of
+// an INSERT statement.
+func (r *Redactor) redactInsert(query, mask string) string {
+	m := insertValuesRe.FindStringSubmatchIndex(query)
+	if m == nil {
+		return query
+	}
+
+	var sensitive []bool
+	found := false
+	for _, col := range strings.Split(query[m[2]:m[3]], ",") {
+		col = strings.ToLower(strings.Trim(strings.TrimSpace(col), `"`))
+		sensitive = append(sensitive, r.columns[col])
+		found = found || r.columns[col]
+	}
+	if !found {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query))
+	b.WriteString(query[:m[1]])
+
+	i := m[1]
+	for i < len(query) && query[i] == '(' {
+		b.WriteByte('(')
+		i++
+		for col := 0; ; col++ {
+			end := skipValue(query, i)
+			if col < len(sensitive) && sensitive[col] {
+				value := query[i:end]
+				b.WriteString(value[:len(value)-len(strings.TrimLeft(value, " \t\n"))])
+				b.WriteString(mask)
+			} else {
+				b.WriteString(query[i:end])
+			}
+			if end >= len(query) {
+				return b.String()
+			}
+			b.WriteByte(query[end])
+			i = end + 1
+			if query[end] == ')' {
+				break
+			}
+		}
+
+		// Skip to the next tuple, if any.
+		j := i
+		for j < len(query) && (isSpace(query[j]) || query[j] == ',') {
+			j++
+		}
+		if j >= len(query) || query[j] != '(' {
+			break
+		}
+		b.WriteString(query[i:j])
+		i = j
+	}
+	b.WriteString(query[i:])
+	return b.String()
+}
+
+// skipValue returns the index of the ',' or ')' ending the value starting
+// at i, skipping quoted strings and nested parentheses.
+func skipValue(query string, i int) int {
+	depth := 0
+	for ; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"':
+			i = skipQuoted(query, i, c)
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+var redactor atomic.Value
+
+// SetRedactor sets the Redactor applied to statements recorded by all hooks
+// of the package: span attributes, logs, audit events and slow queries.
+// Passing nil turns redaction off.
+func SetRedactor(r *Redactor) {
+	redactor.Store(&r)
+}
+
+// redact masks the query with the Redactor set by SetRedactor.
+func redact(query string) string {
+	if r, ok := redactor.Load().(**Redactor); ok {
+		return (*r).Redact(query)
+	}
+	return query
+}
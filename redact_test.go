@@ -0,0 +1,58 @@
+package pgext
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := &Redactor{
+		Columns:  []string{"password", "email"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`)},
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			`SELECT * FROM users WHERE email = 'a@b.c' AND id = 1`,
+			`SELECT * FROM users WHERE email = ? AND id = 1`,
+		},
+		{
+			`UPDATE "users" SET "password" = 'it''s secret', "name" = 'bob' WHERE "u"."email" ILIKE '%@b.c'`,
+			`UPDATE "users" SET "password" = ?, "name" = 'bob' WHERE "u"."email" ILIKE ?`,
+		},
+		{
+			`INSERT INTO "users" ("id", "email", "name") VALUES (DEFAULT, 'a@b.c', 'bob'), (DEFAULT, lower('X@B.C'), 'al, ice') RETURNING "id"`,
+			`INSERT INTO "users" ("id", "email", "name") VALUES (DEFAULT, ?, 'bob'), (DEFAULT, ?, 'al, ice') RETURNING "id"`,
+		},
+		{
+			`INSERT INTO payments (card) VALUES ('4111-1111-1111-1111')`,
+			`INSERT INTO payments (card) VALUES ('?')`,
+		},
+		{
+			`SELECT username FROM users WHERE username = 'bob'`,
+			`SELECT username FROM users WHERE username = 'bob'`,
+		},
+	}
+	for _, test := range tests {
+		if got := r.Redact(test.query); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSetRedactor(t *testing.T) {
+	defer SetRedactor(nil)
+
+	query := `SELECT 1 FROM users WHERE ssn = '123'`
+	if got := redact(query); got != query {
+		t.Errorf("redact without Redactor = %q", got)
+	}
+
+	SetRedactor(&Redactor{Columns: []string{"ssn"}, Mask: "***"})
+	if got, want := redact(query), `SELECT 1 FROM users WHERE ssn = ***`; got != want {
+		t.Errorf("redact = %q, want %q", got, want)
+	}
+}
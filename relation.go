@@ -0,0 +1,48 @@
+package pgext
+
+import (
+	"reflect"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var (
+	relationType = reflect.TypeOf((*orm.Relation)(nil))
+	tableType    = reflect.TypeOf((*orm.Table)(nil))
+)
+
+// preloadRelation returns the relation and the parent model of a query
+// go-pg runs to preload a has-many or many-to-many Relation. go-pg does not
+// expose them, so they are read from the unexported fields of the table
+// model of the query, rel and baseTable.
+func preloadRelation(evt *pg.QueryEvent) (relation, parent string, ok bool) {
+	if len(evt.Params) == 0 {
+		return "", "", false
+	}
+	tm, ok := evt.Params[0].(orm.TableModel)
+	if !ok {
+		return "", "", false
+	}
+
+	v := reflect.ValueOf(tm)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return "", "", false
+	}
+	v = v.Elem()
+
+	rel := v.FieldByName("rel")
+	if !rel.IsValid() || rel.Type() != relationType || rel.IsNil() {
+		return "", "", false
+	}
+	field := rel.Elem().FieldByName("Field")
+	if field.IsNil() {
+		return "", "", false
+	}
+	relation = field.Elem().FieldByName("GoName").String()
+
+	if base := v.FieldByName("baseTable"); base.IsValid() && base.Type() == tableType && !base.IsNil() {
+		parent = base.Elem().FieldByName("ModelName").String()
+	}
+	return relation, parent, relation != ""
+}
@@ -0,0 +1,37 @@
+package pgext
+
+import (
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// hasManyModel has the fields of the table model go-pg uses to preload
+// a has-many relation.
+type hasManyModel struct {
+	orm.TableModel
+	baseTable *orm.Table
+	rel       *orm.Relation
+}
+
+func TestPreloadRelation(t *testing.T) {
+	model := &hasManyModel{
+		baseTable: &orm.Table{ModelName: "author"},
+		rel:       &orm.Relation{Field: &orm.Field{GoName: "Books"}},
+	}
+	relation, parent, ok := preloadRelation(&pg.QueryEvent{Params: []interface{}{model}})
+	if !ok || relation != "Books" || parent != "author" {
+		t.Errorf("got %q %q %v, want the Books relation of author", relation, parent, ok)
+	}
+
+	for _, params := range [][]interface{}{
+		nil,
+		{"author"},
+		{&hasManyModel{}},
+	} {
+		if _, _, ok := preloadRelation(&pg.QueryEvent{Params: params}); ok {
+			t.Errorf("%v: got a relation, want none", params)
+		}
+	}
+}
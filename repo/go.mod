@@ -0,0 +1,8 @@
+module github.com/j2gg0s/pgext/repo
+
+go 1.16
+
+require (
+	github.com/go-pg/pg/v10 v10.0.6
+	go.opentelemetry.io/otel v0.11.0
+)
@@ -0,0 +1,197 @@
+//go:build go1.18
+// +build go1.18
+
+// Package repo provides a typed repository for go-pg models whose methods
+// are instrumented with OpenTelemetry. It needs Go 1.18 and is a module of
+// its own, so pgext itself builds with older versions.
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	tracer = global.Tracer("github.com/j2gg0s/pgext/repo")
+	meter  = global.Meter("github.com/j2gg0s/pgext/repo")
+
+	latencyRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.repo.latency",
+		metric.WithDescription("The latency of repository calls in microsecond"),
+	)
+
+	methodKey        = label.Key("sql.method")
+	tableKey         = label.Key("sql.table")
+	statusOKLabel    = label.String("sql.status", "OK")
+	statusErrorLabel = label.String("sql.status", "Error")
+)
+
+// QueryOption modifies the query of Select and Count.
+type QueryOption func(q *orm.Query) *orm.Query
+
+// Where adds a WHERE condition.
+func Where(condition string, params ...interface{}) QueryOption {
+	return func(q *orm.Query) *orm.Query { return q.Where(condition, params...) }
+}
+
+// WhereIn adds a WHERE condition with an IN list of the slice.
+func WhereIn(condition string, slice interface{}) QueryOption {
+	return func(q *orm.Query) *orm.Query { return q.WhereIn(condition, slice) }
+}
+
+// Order adds ORDER BY columns, e.g. "created_at DESC".
+func Order(orders ...string) QueryOption {
+	return func(q *orm.Query) *orm.Query { return q.Order(orders...) }
+}
+
+// Limit sets the LIMIT.
+func Limit(n int) QueryOption {
+	return func(q *orm.Query) *orm.Query { return q.Limit(n) }
+}
+
+// Offset sets the OFFSET.
+func Offset(n int) QueryOption {
+	return func(q *orm.Query) *orm.Query { return q.Offset(n) }
+}
+
+// Relation preloads a relation of the model.
+func Relation(name string) QueryOption {
+	return func(q *orm.Query) *orm.Query { return q.Relation(name) }
+}
+
+// Repo is a repository of the go-pg model T. Every call is recorded as
+// a span named after the table and the method, e.g. users.Select, with the
+// db.operation and sql.table attributes, and its latency as
+// go.sql.repo.latency labeled by sql.method, sql.table and sql.status. The
+// query spans of pgext.OpenTelemetryHook are its children:
+//
+//   users := repo.New[User](db)
+//   user, err := users.Get(ctx, 42)
+//   active, err := users.Select(ctx, repo.Where("active"), repo.Order("name"), repo.Limit(100))
+type Repo[T any] struct {
+	DB orm.DB
+}
+
+// New returns a repository of T on the database.
+func New[T any](db orm.DB) *Repo[T] {
+	return &Repo[T]{DB: db}
+}
+
+// Get returns the model with the primary key. T must have a single primary
+// key column. It returns pg.ErrNoRows if there is no such model.
+func (r *Repo[T]) Get(ctx context.Context, pk interface{}) (*T, error) {
+	model := new(T)
+	err := r.run(ctx, "Get", orm.SelectOp, model, func(q *orm.Query) error {
+		var pks []*orm.Field
+		if tm := q.TableModel(); tm != nil {
+			pks = tm.Table().PKs
+		}
+		if len(pks) != 1 {
+			return fmt.Errorf("repo: Get(%T) needs a single primary key", model)
+		}
+		return q.Where("?TableAlias.? = ?", pks[0].Column, pk).Select()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Select returns the models matching the options.
+func (r *Repo[T]) Select(ctx context.Context, opts ...QueryOption) ([]T, error) {
+	var models []T
+	err := r.run(ctx, "Select", orm.SelectOp, &models, func(q *orm.Query) error {
+		return apply(q, opts).Select()
+	})
+	return models, err
+}
+
+// Count returns the number of models matching the options.
+func (r *Repo[T]) Count(ctx context.Context, opts ...QueryOption) (int, error) {
+	var n int
+	err := r.run(ctx, "Count", orm.SelectOp, new(T), func(q *orm.Query) (err error) {
+		n, err = apply(q, opts).Count()
+		return err
+	})
+	return n, err
+}
+
+// Insert inserts the model.
+func (r *Repo[T]) Insert(ctx context.Context, model *T) error {
+	return r.run(ctx, "Insert", orm.InsertOp, model, func(q *orm.Query) error {
+		_, err := q.Insert()
+		return err
+	})
+}
+
+// Update updates the model by its primary key. It returns pg.ErrNoRows if
+// there is no such model.
+func (r *Repo[T]) Update(ctx context.Context, model *T) error {
+	return r.run(ctx, "Update", orm.UpdateOp, model, func(q *orm.Query) error {
+		res, err := q.WherePK().Update()
+		if err == nil && res != nil && res.RowsAffected() == 0 {
+			err = pg.ErrNoRows
+		}
+		return err
+	})
+}
+
+// Delete deletes the model by its primary key, softly if the model supports
+// soft deletes. It returns pg.ErrNoRows if there is no such model.
+func (r *Repo[T]) Delete(ctx context.Context, model *T) error {
+	return r.run(ctx, "Delete", orm.DeleteOp, model, func(q *orm.Query) error {
+		res, err := q.WherePK().Delete()
+		if err == nil && res != nil && res.RowsAffected() == 0 {
+			err = pg.ErrNoRows
+		}
+		return err
+	})
+}
+
+func apply(q *orm.Query, opts []QueryOption) *orm.Query {
+	for _, opt := range opts {
+		q = opt(q)
+	}
+	return q
+}
+
+func (r *Repo[T]) run(ctx context.Context, method string, op orm.QueryOp, model interface{}, fn func(q *orm.Query) error) error {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, method)
+	defer span.End()
+
+	q := r.DB.ModelContext(ctx, model)
+	var table string
+	if tm := q.TableModel(); tm != nil {
+		table = tm.Table().ModelName
+	}
+	span.SetName(table + "." + method)
+	span.SetAttributes(
+		label.String("db.system", "postgres"),
+		label.String("db.operation", string(op)),
+		tableKey.String(table),
+	)
+
+	err := fn(q)
+
+	status := statusOKLabel
+	switch {
+	case err == pg.ErrNoRows:
+		span.SetStatus(codes.NotFound, "")
+	case err != nil:
+		status = statusErrorLabel
+		span.RecordError(ctx, err, trace.WithErrorStatus(codes.Internal))
+	}
+	latencyRecorder.Record(ctx, time.Since(start).Microseconds(),
+		methodKey.String(method), tableKey.String(table), status)
+	return err
+}
@@ -0,0 +1,63 @@
+//go:build go1.18
+// +build go1.18
+
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+func TestQueryOptions(t *testing.T) {
+	var applied []string
+	record := func(name string) QueryOption {
+		return func(q *orm.Query) *orm.Query {
+			applied = append(applied, name)
+			return q
+		}
+	}
+	apply(&orm.Query{}, []QueryOption{record("where"), record("order"), Limit(10), record("limit")})
+	if len(applied) != 3 || applied[0] != "where" || applied[2] != "limit" {
+		t.Errorf("got %v, want the options applied in order", applied)
+	}
+}
+
+// testDB returns a database on localhost or skips the test if PostgreSQL is
+// not available.
+func testDB(t *testing.T) *pg.DB {
+	t.Helper()
+
+	db := pg.Connect(&pg.Options{})
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.Ping(ctx); err != nil {
+		t.Skipf("PostgreSQL is not available: %s", err)
+	}
+	return db
+}
+
+func TestRepo(t *testing.T) {
+	users := New[user](testDB(t))
+	ctx := context.Background()
+
+	if err := users.Insert(ctx, &user{ID: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Select(ctx, Where("name = ?", "a"), Order("id"), Limit(10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Get(ctx, 1); err == nil {
+		t.Error("got no error for a model without table, want an error")
+	}
+}
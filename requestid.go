@@ -0,0 +1,108 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+var requestIDKey = label.Key("request.id")
+
+type requestIDCtxKey struct{}
+
+// WithRequestID returns a context carrying the request ID, e.g. set by
+// middleware of a framework without a convention of its own.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// commonRequestIDKeys are the string context keys HTTP middleware commonly
+// store request IDs under.
+var commonRequestIDKeys = []interface{}{
+	"request_id",
+	"requestID",
+	"requestId",
+	"X-Request-ID",
+	"x-request-id",
+}
+
+// RequestIDFromContext returns the request ID set with WithRequestID or
+// stored by HTTP middleware under one of the common string keys, e.g.
+// request_id or X-Request-ID, or an empty string. Use it as the RequestID of
+// OpenTelemetryHook and SlowQueryHook.
+func RequestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDCtxKey{}).(string); ok && id != "" {
+		return id
+	}
+	for _, key := range commonRequestIDKeys {
+		if id := contextString(ctx, key); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// RequestIDFromContextKey returns an extractor of the request ID stored
+// under the first of the keys with a value, e.g. the RequestIDKey of the chi
+// middleware:
+//
+//   RequestID: pgext.RequestIDFromContextKey(middleware.RequestIDKey),
+func RequestIDFromContextKey(keys ...interface{}) func(context.Context) string {
+	return func(ctx context.Context) string {
+		for _, key := range keys {
+			if id := contextString(ctx, key); id != "" {
+				return id
+			}
+		}
+		return ""
+	}
+}
+
+// RequestIDFromMetadata returns an extractor of the request ID in the
+// metadata returned by md, e.g. the incoming gRPC metadata, under the first
+// of the keys with a value. The keys default to x-request-id and request-id:
+//
+//   RequestID: pgext.RequestIDFromMetadata(func(ctx context.Context) map[string][]string {
+//       md, _ := metadata.FromIncomingContext(ctx)
+//       return md
+//   }),
+func RequestIDFromMetadata(md func(context.Context) map[string][]string, keys ...string) func(context.Context) string {
+	if len(keys) == 0 {
+		keys = []string{"x-request-id", "request-id"}
+	}
+	return func(ctx context.Context) string {
+		m := md(ctx)
+		for _, key := range keys {
+			if vs := m[key]; len(vs) > 0 && vs[0] != "" {
+				return vs[0]
+			}
+		}
+		return ""
+	}
+}
+
+// FirstRequestID returns an extractor of the first request ID found by the
+// extractors, e.g. to serve HTTP and gRPC from one database.
+func FirstRequestID(extractors ...func(context.Context) string) func(context.Context) string {
+	return func(ctx context.Context) string {
+		for _, fn := range extractors {
+			if id := fn(ctx); id != "" {
+				return id
+			}
+		}
+		return ""
+	}
+}
+
+// contextString returns the value of the key if it is a string or
+// a fmt.Stringer.
+func contextString(ctx context.Context, key interface{}) string {
+	switch v := ctx.Value(key).(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+)
+
+type chiRequestIDKey int
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	if id := RequestIDFromContext(ctx); id != "" {
+		t.Errorf("got %q, want none", id)
+	}
+	if id := RequestIDFromContext(context.WithValue(ctx, "X-Request-ID", "http")); id != "http" {
+		t.Errorf("got %q, want http", id)
+	}
+	if id := RequestIDFromContext(WithRequestID(ctx, "set")); id != "set" {
+		t.Errorf("got %q, want set", id)
+	}
+
+	chi := RequestIDFromContextKey(chiRequestIDKey(0))
+	if id := chi(context.WithValue(ctx, chiRequestIDKey(0), "chi")); id != "chi" {
+		t.Errorf("got %q, want chi", id)
+	}
+
+	type mdKey struct{}
+	grpc := RequestIDFromMetadata(func(ctx context.Context) map[string][]string {
+		md, _ := ctx.Value(mdKey{}).(map[string][]string)
+		return md
+	})
+	grpcCtx := context.WithValue(ctx, mdKey{}, map[string][]string{"x-request-id": {"grpc"}})
+	if id := grpc(grpcCtx); id != "grpc" {
+		t.Errorf("got %q, want grpc", id)
+	}
+
+	first := FirstRequestID(chi, grpc)
+	if id := first(grpcCtx); id != "grpc" {
+		t.Errorf("got %q, want grpc", id)
+	}
+	if id := first(ctx); id != "" {
+		t.Errorf("got %q, want none", id)
+	}
+}
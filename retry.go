@@ -0,0 +1,115 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	sqlStateKey = label.Key("db.sqlstate")
+
+	retryExhaustedCounter, _ = meter.NewInt64Counter(
+		"go.sql.tx.retries_exhausted",
+		metric.WithDescription("The number of transactions that failed after all retries"),
+	)
+)
+
+// RetryPolicy controls how RunInTxWithRetry retries transactions.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the transaction is run.
+	// Defaults to 3.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every
+	// attempt and is jittered. Defaults to 10ms.
+	Backoff time.Duration
+	// MaxBackoff limits the delay between attempts. Defaults to 1s.
+	MaxBackoff time.Duration
+	// Budget, if set, limits the rate of retries. Transactions fail without
+	// retrying once it is exhausted.
+	Budget *RetryBudget
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return 3
+}
+
+// backoff returns the jittered delay before the attempt, starting from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d, max := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = 10 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryableSQLState returns the SQLSTATE of serialization failures (40001)
+// and deadlocks (40P01), which succeed when the transaction is run again.
+func retryableSQLState(err error) (string, bool) {
+	var pgErr pg.Error
+	if !errors.As(err, &pgErr) {
+		return "", false
+	}
+	switch code := pgErr.Field('C'); code {
+	case "40001", "40P01":
+		return code, true
+	}
+	return "", false
+}
+
+// RunInTxWithRetry runs fn in a transaction and runs it again when it fails
+// with a serialization failure or a deadlock, the standard pattern for
+// SERIALIZABLE workloads. fn must be safe to run more than once. Every retry
+// is recorded as a pgext.tx_retry event on the span in ctx:
+//
+//   err := pgext.RunInTxWithRetry(db, ctx, func(tx *pg.Tx) error {
+//       _, err := tx.ExecContext(ctx, `SET TRANSACTION ISOLATION LEVEL SERIALIZABLE`)
+//       ...
+//   }, pgext.RetryPolicy{MaxAttempts: 5})
+func RunInTxWithRetry(db *pg.DB, ctx context.Context, fn func(*pg.Tx) error, policy RetryPolicy) error {
+	span := trace.SpanFromContext(ctx)
+	max := policy.maxAttempts()
+
+	for attempt := 1; ; attempt++ {
+		err := db.RunInTransaction(ctx, fn)
+		code, ok := retryableSQLState(err)
+		if !ok {
+			return err
+		}
+		if attempt >= max || (policy.Budget != nil && !policy.Budget.take(ctx)) {
+			retryExhaustedCounter.Add(ctx, 1, sqlStateKey.String(code))
+			return err
+		}
+
+		addEvent(ctx, span, "pgext.tx_retry",
+			label.Int("tx.attempt", attempt),
+			sqlStateKey.String(code),
+		)
+
+		t := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
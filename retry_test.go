@@ -0,0 +1,82 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string            { return "ERROR #" + string(e) }
+func (e sqlStateError) IntegrityViolation() bool { return false }
+
+func (e sqlStateError) Field(field byte) string {
+	if field == 'C' {
+		return string(e)
+	}
+	return ""
+}
+
+// testDB returns a database connected to the PostgreSQL on localhost and
+// skips the test if there is none.
+func testDB(t *testing.T) *pg.DB {
+	t.Helper()
+
+	db := pg.Connect(&pg.Options{})
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.Ping(ctx); err != nil {
+		t.Skipf("PostgreSQL is not available: %s", err)
+	}
+	return db
+}
+
+func TestRunInTxWithRetry(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Microsecond}
+
+	tests := []struct {
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{[]error{nil}, 1, nil},
+		{[]error{sqlStateError("40001"), nil}, 2, nil},
+		{[]error{sqlStateError("40P01"), sqlStateError("40001"), sqlStateError("40001")}, 3, sqlStateError("40001")},
+		{[]error{sqlStateError("23505")}, 1, sqlStateError("23505")},
+		{[]error{pg.ErrNoRows}, 1, pg.ErrNoRows},
+	}
+
+	for _, test := range tests {
+		var attempts int
+		err := RunInTxWithRetry(db, ctx, func(*pg.Tx) error {
+			attempts++
+			return test.errs[attempts-1]
+		}, policy)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("got error %v, want %v", err, test.err)
+		}
+		if attempts != test.attempts {
+			t.Errorf("got %d attempts, want %d", attempts, test.attempts)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+
+	for attempt, max := range []time.Duration{10, 20, 40, 40} {
+		max *= time.Millisecond
+		if d := p.backoff(attempt + 1); d < max/2 || d > max {
+			t.Errorf("attempt %d: got backoff %s, want between %s and %s", attempt+1, d, max/2, max)
+		}
+	}
+}
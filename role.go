@@ -0,0 +1,152 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/label"
+)
+
+var roleKey = label.Key("sql.role")
+
+// ErrOperationDenied is returned by RoleHook for operations the role may not
+// run. It matches ErrPolicyDenied with errors.Is.
+type ErrOperationDenied struct {
+	Role      string
+	Operation string
+	Table     string
+}
+
+func (e *ErrOperationDenied) Error() string {
+	return "pgext: role " + e.Role + " may not " + e.Operation + " " + e.Table
+}
+
+func (e *ErrOperationDenied) Is(target error) bool {
+	return target == ErrPolicyDenied
+}
+
+type roleCtxKey struct{}
+
+// WithRole returns a context in which queries run with the role.
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleCtxKey{}, role)
+}
+
+// RoleFromContext returns the role set by WithRole.
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleCtxKey{}).(string)
+	return role
+}
+
+// RolePermission allows operations on tables. Empty lists allow all.
+type RolePermission struct {
+	// Operations lists statements, e.g. "SELECT" or "DELETE".
+	Operations []string
+	// Tables lists table names.
+	Tables []string
+}
+
+func (p RolePermission) allows(operation, table string) bool {
+	return containsFold(p.Operations, operation) && containsFold(p.Tables, table)
+}
+
+func containsFold(list []string, s string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == "*" || strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleHook is a pg.QueryHook that restricts the operations of the role in
+// the query context, a lightweight alternative to PolicyHook:
+//
+//   db.AddQueryHook(&pgext.RoleHook{Roles: map[string][]pgext.RolePermission{
+//       "readonly": {{Operations: []string{"SELECT"}}},
+//       "support":  {{Operations: []string{"SELECT", "UPDATE"}, Tables: []string{"tickets"}}},
+//   }})
+//
+//   _, err := db.ExecContext(pgext.WithRole(ctx, "readonly"), `DELETE FROM users`)
+//   var denied *pgext.ErrOperationDenied
+//   errors.As(err, &denied) // true
+//
+// Every statement of a multi-statement query and every data-modifying part
+// of a WITH query must be allowed. Transaction control statements are always
+// allowed, statements whose effect can not be told from their text, e.g. DO
+// blocks, never. Roles missing from Roles are denied everything.
+type RoleHook struct {
+	Roles map[string][]RolePermission
+	// Role extracts the role from the query context. Defaults to
+	// RoleFromContext.
+	Role func(context.Context) string
+	// DefaultRole is used when the context has no role. If empty, queries
+	// without a role are not restricted.
+	DefaultRole string
+}
+
+var _ pg.QueryHook = (*RoleHook)(nil)
+
+func (h *RoleHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	role := RoleFromContext
+	if h.Role != nil {
+		role = h.Role
+	}
+	r := role(ctx)
+	if r == "" {
+		r = h.DefaultRole
+	}
+	if r == "" {
+		return ctx, nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+
+	ops, known := queryOperations(strings.TrimSpace(string(b)))
+	if !known {
+		return ctx, h.deny(ctx, r, ops[0])
+	}
+	if v, ok := evt.Query.(queryOperation); ok && len(ops) == 1 {
+		ops[0].Operation = strings.ToUpper(string(v.Operation()))
+	}
+
+	for _, op := range ops {
+		if !h.allows(r, op) {
+			return ctx, h.deny(ctx, r, op)
+		}
+	}
+	return ctx, nil
+}
+
+func (h *RoleHook) allows(role string, op statementOperation) bool {
+	switch op.Operation {
+	case "BEGIN", "START", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return true
+	}
+	for _, p := range h.Roles[role] {
+		if p.allows(op.Operation, op.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *RoleHook) deny(ctx context.Context, role string, op statementOperation) error {
+	policyDeniedCounter.Add(ctx, 1,
+		roleKey.String(role),
+		methodLabel(op.Operation),
+		tableKey.String(op.Table),
+	)
+	return &ErrOperationDenied{Role: role, Operation: op.Operation, Table: op.Table}
+}
+
+func (h *RoleHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestRoleHook(t *testing.T) {
+	h := &RoleHook{Roles: map[string][]RolePermission{
+		"readonly": {{Operations: []string{"SELECT"}}},
+		"support":  {{Operations: []string{"SELECT", "UPDATE"}, Tables: []string{"tickets"}}},
+	}}
+
+	tests := []struct {
+		role   string
+		query  string
+		denied bool
+	}{
+		{"", `DELETE FROM users`, false},
+		{"readonly", `SELECT * FROM users`, false},
+		{"readonly", `BEGIN`, false},
+		{"readonly", `DELETE FROM users`, true},
+		{"support", `UPDATE "tickets" SET state = 'closed'`, false},
+		{"support", `UPDATE users SET name = 'x'`, true},
+		{"unknown", `SELECT 1`, true},
+		{"readonly", `SELECT 1; DELETE FROM users`, true},
+		{"readonly", `WITH d AS (DELETE FROM users RETURNING id) SELECT * FROM d`, true},
+		{"readonly", `DO $$ BEGIN DELETE FROM users; END $$`, true},
+		{"readonly", `BEGIN; SELECT * FROM users; COMMIT`, false},
+		{"support", `SELECT * FROM tickets; UPDATE tickets SET state = 'open'`, false},
+		{"support", `UPDATE tickets SET state = 'open'; UPDATE users SET name = 'x'`, true},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.role != "" {
+			ctx = WithRole(ctx, test.role)
+		}
+		_, err := pgexttest.Run(ctx, h, pgexttest.NewQueryEvent(test.query).Build())
+
+		var denied *ErrOperationDenied
+		if errors.As(err, &denied) != test.denied {
+			t.Errorf("%s %q: got error %v, want denied %t", test.role, test.query, err, test.denied)
+			continue
+		}
+		if test.denied && (denied.Role != test.role || !errors.Is(err, ErrPolicyDenied)) {
+			t.Errorf("%s %q: unexpected error %#v", test.role, test.query, denied)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package pgext
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var routerLatencyRecorder, _ = meter.NewInt64ValueRecorder(
+	"go.sql.router.latency",
+	metric.WithDescription("The latency of queries per routing target in microsecond"),
+)
+
+// RouterOption configures NewRouter.
+type RouterOption func(*Router)
+
+// WithCanary routes the percentage (0-100) of reads to the canary, e.g.
+// a replica on new infrastructure.
+func WithCanary(canary *pg.DB, percent float64) RouterOption {
+	return func(r *Router) {
+		r.canary = canary
+		r.SetCanaryPercent(percent)
+	}
+}
+
+// WithHealthTracker installs the tracker on all databases of the router and
+// skips unhealthy replicas and canaries. They get reads again once the probes
+// of the tracker reach them.
+func WithHealthTracker(t *HealthTracker) RouterOption {
+	return func(r *Router) {
+		r.health = t
+	}
+}
+
+// Router routes writes to the primary and reads to the replicas. It records
+// the latency and status of queries per target in go.sql.router.latency, so
+// a canary can be compared with the replicas during a gradual rollout:
+//
+//   r := pgext.NewRouter(primary, replicas, pgext.WithCanary(canary, 5))
+//   err := r.Read().ModelContext(ctx, &users).Select()
+type Router struct {
+	primary  *pg.DB
+	replicas []*pg.DB
+	canary   *pg.DB
+	health   *HealthTracker
+
+	canaryPercent uint64
+	next          uint32
+}
+
+// NewRouter returns a router and installs its hooks on the databases.
+func NewRouter(primary *pg.DB, replicas []*pg.DB, opts ...RouterOption) *Router {
+	r := &Router{primary: primary, replicas: replicas}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.install(primary, "primary")
+	for _, db := range replicas {
+		r.install(db, "replica")
+	}
+	if r.canary != nil {
+		r.install(r.canary, "canary")
+	}
+	return r
+}
+
+func (r *Router) install(db *pg.DB, target string) {
+	db.AddQueryHook(routerHook{target: target})
+	if r.health != nil {
+		db.AddQueryHook(r.health)
+	}
+}
+
+// SetCanaryPercent changes the percentage of reads routed to the canary.
+func (r *Router) SetCanaryPercent(percent float64) {
+	atomic.StoreUint64(&r.canaryPercent, math.Float64bits(percent))
+}
+
+// Write returns the primary.
+func (r *Router) Write() *pg.DB {
+	return r.primary
+}
+
+// Read returns the canary for its percentage of reads and a healthy replica
+// otherwise. It falls back to the primary when no replica is healthy.
+func (r *Router) Read() *pg.DB {
+	if r.canary != nil && r.healthy(r.canary) {
+		percent := math.Float64frombits(atomic.LoadUint64(&r.canaryPercent))
+		if rand.Float64()*100 < percent {
+			return r.canary
+		}
+	}
+
+	n := uint32(len(r.replicas))
+	start := atomic.AddUint32(&r.next, 1)
+	for i := uint32(0); i < n; i++ {
+		if db := r.replicas[(start+i)%n]; r.healthy(db) {
+			return db
+		}
+	}
+	return r.primary
+}
+
+func (r *Router) healthy(db *pg.DB) bool {
+	return r.health == nil || r.health.Healthy(db.Options().Addr)
+}
+
+// routerHook records the latency of queries per target.
+type routerHook struct {
+	target string
+}
+
+var _ pg.QueryHook = routerHook{}
+
+func (h routerHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h routerHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	status := statusOKLabel
+	if isQueryError(evt.Err) {
+		status = statusErrorLabel
+	}
+	routerLatencyRecorder.Record(ctx, since(nil, evt.StartTime).Microseconds(),
+		targetKey.String(h.target), status)
+	return nil
+}
@@ -0,0 +1,72 @@
+package pgext
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestRouter(t *testing.T) {
+	primary := pg.Connect(&pg.Options{Addr: "primary:5432"})
+	replica1 := pg.Connect(&pg.Options{Addr: "replica1:5432"})
+	replica2 := pg.Connect(&pg.Options{Addr: "replica2:5432"})
+	canary := pg.Connect(&pg.Options{Addr: "canary:5432"})
+	var recovered int32
+	health := &HealthTracker{
+		FailureThreshold: 1,
+		ProbeInterval:    time.Millisecond,
+		Probe: func(_ context.Context, db *pg.DB) error {
+			if db == replica1 && atomic.LoadInt32(&recovered) != 0 {
+				return nil
+			}
+			return io.EOF
+		},
+	}
+	defer health.Shutdown(context.Background())
+
+	r := NewRouter(primary, []*pg.DB{replica1, replica2},
+		WithCanary(canary, 100), WithHealthTracker(health))
+
+	if r.Write() != primary {
+		t.Error("writes are not routed to the primary")
+	}
+	if r.Read() != canary {
+		t.Error("reads are not routed to the canary")
+	}
+
+	fail := func(db *pg.DB) {
+		_ = health.AfterQuery(context.Background(), &pg.QueryEvent{DB: db, Err: io.EOF})
+	}
+
+	fail(canary)
+	seen := make(map[*pg.DB]bool)
+	for i := 0; i < 4; i++ {
+		seen[r.Read()] = true
+	}
+	if len(seen) != 2 || !seen[replica1] || !seen[replica2] {
+		t.Errorf("reads are not spread over the replicas when the canary is unhealthy")
+	}
+
+	r.SetCanaryPercent(0)
+	fail(replica1)
+	fail(replica2)
+	if r.Read() != primary {
+		t.Error("reads do not fall back to the primary")
+	}
+
+	atomic.StoreInt32(&recovered, 1)
+	deadline := time.Now().Add(time.Second)
+	for r.Read() != replica1 {
+		if time.Now().After(deadline) {
+			t.Fatal("reads are not routed to the recovered replica")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !health.Healthy(replica1.Options().Addr) || health.Healthy(replica2.Options().Addr) {
+		t.Errorf("got unhealthy %q, want only replica2 and the canary", health.Unhealthy())
+	}
+}
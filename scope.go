@@ -0,0 +1,84 @@
+package pgext
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type requestScopeKey struct{}
+
+// requestScope collects per-request query statistics used by the
+// development hooks.
+type requestScope struct {
+	mu         sync.Mutex
+	queries    map[string]int
+	statements map[string][]string
+}
+
+func newRequestScope() *requestScope {
+	return &requestScope{
+		queries:    make(map[string]int),
+		statements: make(map[string][]string),
+	}
+}
+
+// WithRequestScope returns a copy of ctx that marks the boundary of a single
+// request. Hooks that aggregate queries per request use it to tell requests
+// apart. Without it they fall back to grouping queries by trace ID.
+//
+//   ctx = pgext.WithRequestScope(req.Context())
+func WithRequestScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestScopeKey{}, newRequestScope())
+}
+
+func requestScopeFromContext(ctx context.Context) *requestScope {
+	scope, _ := ctx.Value(requestScopeKey{}).(*requestScope)
+	return scope
+}
+
+// traceScopes maps trace IDs to request scopes for queries executed without
+// an explicit WithRequestScope. It keeps at most max traces and forgets the
+// oldest one when full.
+type traceScopes struct {
+	mu     sync.Mutex
+	max    int
+	scopes map[trace.ID]*requestScope
+	order  []trace.ID
+}
+
+func (s *traceScopes) get(ctx context.Context) *requestScope {
+	if scope := requestScopeFromContext(ctx); scope != nil {
+		return scope
+	}
+
+	sc := trace.SpanFromContext(ctx).SpanContext()
+	if !sc.HasTraceID() {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scopes == nil {
+		s.scopes = make(map[trace.ID]*requestScope)
+	}
+	if scope, ok := s.scopes[sc.TraceID]; ok {
+		return scope
+	}
+
+	max := s.max
+	if max <= 0 {
+		max = 1000
+	}
+	for len(s.order) >= max {
+		delete(s.scopes, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	scope := newRequestScope()
+	s.scopes[sc.TraceID] = scope
+	s.order = append(s.order, sc.TraceID)
+	return scope
+}
@@ -0,0 +1,90 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"regexp"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	secretKindKey = label.Key("secret.kind")
+
+	secretCounter, _ = meter.NewInt64Counter(
+		"go.sql.secrets_detected",
+		metric.WithDescription("The number of statements containing likely secrets"),
+	)
+)
+
+// SecretDetector finds one kind of secret in statements.
+type SecretDetector struct {
+	// Kind names the secret, e.g. "jwt". It is used as the secret.kind label.
+	Kind    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultSecretDetectors detect JWTs, AWS access keys, bcrypt hashes and
+// PEM private keys.
+var DefaultSecretDetectors = []SecretDetector{
+	{"jwt", regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"bcrypt", regexp.MustCompile(`\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}`)},
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// detectSecrets returns the kinds of secrets found in the query.
+func detectSecrets(query string, detectors []SecretDetector) []string {
+	var kinds []string
+	for _, d := range detectors {
+		if d.Pattern.MatchString(query) {
+			kinds = append(kinds, d.Kind)
+		}
+	}
+	return kinds
+}
+
+// SecretHook is a pg.QueryHook that warns about statements containing likely
+// secrets, e.g. a token accidentally written to a plaintext column. Every
+// detection is logged together with the caller and counted. Set
+// Redactor.Secrets to also keep the secrets out of telemetry.
+//
+//   db.AddQueryHook(&pgext.SecretHook{})
+type SecretHook struct {
+	// Detectors are the secrets to look for. Defaults to
+	// DefaultSecretDetectors.
+	Detectors []SecretDetector
+	// Logger is used to print warnings. Defaults to the standard logger.
+	Logger *log.Logger
+}
+
+var _ pg.QueryHook = (*SecretHook)(nil)
+
+func (h *SecretHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return ctx, err
+	}
+
+	detectors := h.Detectors
+	if detectors == nil {
+		detectors = DefaultSecretDetectors
+	}
+	kinds := detectSecrets(string(b), detectors)
+	if len(kinds) == 0 {
+		return ctx, nil
+	}
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+	for _, kind := range kinds {
+		secretCounter.Add(ctx, 1, secretKindKey.String(kind))
+		logf(h.Logger, "pgext: statement contains a likely secret (%s) at %s (%s:%d)", kind, fn, file, line)
+	}
+	return ctx, nil
+}
+
+func (h *SecretHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
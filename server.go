@@ -0,0 +1,127 @@
+package pgext
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/label"
+)
+
+var serverVersionKey = label.Key("sql.server_version")
+
+type serverInfo struct {
+	version int32
+	// name is the formatted version, so query metrics do not format it for
+	// every query.
+	name atomic.Value
+}
+
+func (s *serverInfo) setVersion(version int) {
+	s.name.Store(formatServerVersion(version))
+	atomic.StoreInt32(&s.version, int32(version))
+}
+
+// serverVersionBackoff spaces out retries of failed detections of Wrap.
+var serverVersionBackoff = RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Minute}
+
+// serverVersionQueryKey marks the context of the detection query of Wrap,
+// which is not instrumented.
+type serverVersionQueryKey struct{}
+
+func isServerVersionQuery(ctx context.Context) bool {
+	return ctx.Value(serverVersionQueryKey{}) != nil
+}
+
+// servers maps database addresses to *serverInfo.
+var servers sync.Map
+
+func serverInfoOf(addr string) *serverInfo {
+	if v, ok := servers.Load(addr); ok {
+		return v.(*serverInfo)
+	}
+	v, _ := servers.LoadOrStore(addr, new(serverInfo))
+	return v.(*serverInfo)
+}
+
+// ServerVersion returns the server_version_num of the database, e.g. 130004
+// for 13.4, so features can be gated by server version. It is 0 until the
+// version was detected by DetectServerVersion or by Wrap with
+// WithServerVersion.
+func ServerVersion(db *pg.DB) int {
+	return serverVersion(db)
+}
+
+func serverVersion(db interface{}) int {
+	o, ok := db.(optioner)
+	if !ok {
+		return 0
+	}
+	v, ok := servers.Load(o.Options().Addr)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt32(&v.(*serverInfo).version))
+}
+
+// serverVersionName returns the server version of the database formatted
+// like server_version, or false if it was not captured yet.
+func serverVersionName(db interface{}) (string, bool) {
+	o, ok := db.(optioner)
+	if !ok {
+		return "", false
+	}
+	v, ok := servers.Load(o.Options().Addr)
+	if !ok {
+		return "", false
+	}
+	name, ok := v.(*serverInfo).name.Load().(string)
+	return name, ok
+}
+
+// DetectServerVersion queries and records the server_version_num of the
+// database.
+func DetectServerVersion(ctx context.Context, db *pg.DB) (int, error) {
+	var version int
+	if _, err := db.QueryOneContext(ctx, pg.Scan(&version),
+		`SELECT current_setting('server_version_num')::int`); err != nil {
+		return 0, err
+	}
+	serverInfoOf(db.Options().Addr).setVersion(version)
+	return version, nil
+}
+
+// detectServerVersion detects the server version of the database, retrying
+// with backoff until it succeeds or done is closed.
+func detectServerVersion(db *pg.DB, done <-chan struct{}) {
+	info := serverInfoOf(db.Options().Addr)
+	for attempt := 1; atomic.LoadInt32(&info.version) == 0; attempt++ {
+		ctx := context.WithValue(context.Background(), serverVersionQueryKey{}, true)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		_, err := DetectServerVersion(ctx, db)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		timer := time.NewTimer(serverVersionBackoff.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// formatServerVersion formats server_version_num like server_version, e.g.
+// 130004 as 13.4 and 90624 as 9.6.24.
+func formatServerVersion(version int) string {
+	if version >= 100000 {
+		return strconv.Itoa(version/10000) + "." + strconv.Itoa(version%10000)
+	}
+	return strconv.Itoa(version/10000) + "." + strconv.Itoa(version/100%100) + "." + strconv.Itoa(version%100)
+}
@@ -0,0 +1,110 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestServerVersion(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "version:5432"})
+	if v := ServerVersion(db); v != 0 {
+		t.Errorf("got version %d before capture, want 0", v)
+	}
+
+	serverInfoOf("version:5432").setVersion(130004)
+	defer servers.Delete("version:5432")
+	if v := ServerVersion(db); v != 130004 {
+		t.Errorf("got version %d, want 130004", v)
+	}
+}
+
+func TestWrapServerVersion(t *testing.T) {
+	mr := pgexttest.RecordMetrics(t)
+
+	backoff := serverVersionBackoff
+	serverVersionBackoff = RetryPolicy{Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer func() { serverVersionBackoff = backoff }()
+
+	var detections int32
+	db := fakeDB(t, func(query string) fakeResult {
+		if !strings.Contains(query, "server_version_num") {
+			return fakeResult{Columns: []string{"?column?"}, Rows: [][]string{{"1"}}}
+		}
+		if atomic.AddInt32(&detections, 1) == 1 {
+			return fakeResult{Err: "57P03"}
+		}
+		return fakeResult{Columns: []string{"current_setting"}, Rows: [][]string{{"130004"}}}
+	})
+	defer servers.Delete(db.Options().Addr)
+	h := Wrap(db, WithServerVersion(true), WithPoolStats(false))
+	defer h.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for ServerVersion(db) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("server version was not detected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&detections); n != 2 {
+		t.Errorf("got %d detections, want 2", n)
+	}
+
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if q := h.Snapshot().Queries; q != 1 {
+		t.Errorf("got %d queries, want the detection queries not counted", q)
+	}
+	var latencies int
+	for _, m := range mr.Measurements() {
+		if m.Name == "go.sql.latency" {
+			latencies++
+		}
+	}
+	if latencies != 1 {
+		t.Errorf("got %d latency measurements, want the detection queries not instrumented", latencies)
+	}
+	pgexttest.AssertMeasurement(t, mr.Measurements(),
+		pgexttest.WithMetricName("go.sql.latency"),
+		pgexttest.WithLabel("sql.server_version", "13.4"),
+	)
+}
+
+func TestServerVersionOptIn(t *testing.T) {
+	pgexttest.RecordMetrics(t)
+
+	var queries int32
+	db := fakeDB(t, func(string) fakeResult {
+		atomic.AddInt32(&queries, 1)
+		return fakeResult{Columns: []string{"?column?"}, Rows: [][]string{{"1"}}}
+	})
+	h := Wrap(db, WithPoolStats(false))
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("got %d queries, want no detection without WithServerVersion", n)
+	}
+}
+
+func TestFormatServerVersion(t *testing.T) {
+	for version, want := range map[int]string{
+		130004: "13.4",
+		100000: "10.0",
+		90624:  "9.6.24",
+	} {
+		if got := formatServerVersion(version); got != want {
+			t.Errorf("formatServerVersion(%d) = %q, want %q", version, got, want)
+		}
+	}
+}
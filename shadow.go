@@ -0,0 +1,236 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	targetKey = label.Key("sql.target")
+
+	shadowLatencyRecorder, _ = meter.NewInt64ValueRecorder(
+		"go.sql.shadow.latency",
+		metric.WithDescription("The latency of mirrored queries on the primary and the shadow in microsecond"),
+	)
+	shadowErrorCounter, _ = meter.NewInt64Counter(
+		"go.sql.shadow.errors",
+		metric.WithDescription("The number of mirrored queries that failed on the shadow"),
+	)
+	shadowMismatchCounter, _ = meter.NewInt64Counter(
+		"go.sql.shadow.mismatches",
+		metric.WithDescription("The number of mirrored queries whose results differ between the primary and the shadow"),
+	)
+)
+
+// ShadowCompare controls how ShadowHook compares the results of the primary
+// and the shadow.
+type ShadowCompare int
+
+const (
+	// ShadowCompareNone does not compare results.
+	ShadowCompareNone ShadowCompare = iota
+	// ShadowCompareRows compares the number of returned rows.
+	ShadowCompareRows
+	// ShadowCompareHash compares a hash of the returned rows. The query runs
+	// once more on the primary to compute it.
+	ShadowCompareHash
+)
+
+func (c ShadowCompare) String() string {
+	switch c {
+	case ShadowCompareRows:
+		return "rows"
+	case ShadowCompareHash:
+		return "hash"
+	}
+	return "none"
+}
+
+type shadowQueryKey struct{}
+
+// ShadowHook is a pg.QueryHook that mirrors a sample of successful SELECTs
+// to a shadow database, e.g. a new PostgreSQL version or a different set of
+// indexes, while they are served from the primary. It records the latency on
+// both in go.sql.shadow.latency and counts shadow errors and differences in
+// the number of returned rows, to validate an upgrade before cutover.
+//
+// With Compare set, results are compared as well and divergences are counted
+// in go.sql.shadow.mismatches and logged, e.g. to validate logical
+// replication or a rewritten query path.
+//
+// Mirrored queries run in the background and are dropped when too many are
+// in flight, so the shadow never slows down the primary.
+//
+//   db.AddQueryHook(&pgext.ShadowHook{DB: pg.Connect(shadowOpt), SampleRate: 0.1})
+type ShadowHook struct {
+	// DB is the shadow database. It must not have the hook installed.
+	DB *pg.DB
+	// SampleRate is the fraction of SELECTs that are mirrored. Defaults to 0.01.
+	SampleRate float64
+	// MaxInFlight is the maximum number of mirrored queries running at once.
+	// Defaults to 10.
+	MaxInFlight int
+	// Timeout limits mirrored queries. Defaults to 10s.
+	Timeout time.Duration
+	// Compare enables comparing results of the primary and the shadow.
+	Compare ShadowCompare
+	// Logger is used to print shadow errors and divergences. Defaults to the
+	// standard logger.
+	Logger *log.Logger
+
+	inFlight int32
+	closed   int32
+	wg       sync.WaitGroup
+}
+
+var (
+	_ pg.QueryHook = (*ShadowHook)(nil)
+	_ Shutdowner   = (*ShadowHook)(nil)
+)
+
+// Shutdown stops mirroring and waits for the mirrored queries to finish.
+func (h *ShadowHook) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&h.closed, 1)
+	return waitGroup(ctx, &h.wg)
+}
+
+func (h *ShadowHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *ShadowHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if h.DB == nil || evt.Err != nil || atomic.LoadInt32(&h.closed) != 0 {
+		return nil
+	}
+	if ctx.Value(shadowQueryKey{}) != nil {
+		return nil
+	}
+	if v, ok := evt.Query.(queryOperation); ok && v.Operation() != orm.SelectOp {
+		return nil
+	}
+
+	rate := h.SampleRate
+	if rate <= 0 {
+		rate = 0.01
+	}
+	if rand.Float64() >= rate {
+		return nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return nil
+	}
+	query := string(b)
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		return nil
+	}
+
+	primary := since(nil, evt.StartTime)
+	returned := -1
+	if evt.Result != nil {
+		returned = evt.Result.RowsReturned()
+	}
+
+	max := int32(h.MaxInFlight)
+	if max <= 0 {
+		max = 10
+	}
+	if atomic.AddInt32(&h.inFlight, 1) > max {
+		atomic.AddInt32(&h.inFlight, -1)
+		return nil
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer atomic.AddInt32(&h.inFlight, -1)
+
+		timeout := h.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// Transactions are done by the time the query is mirrored.
+		db, _ := evt.DB.(*pg.DB)
+		h.mirror(ctx, db, query, primary, returned)
+	}()
+
+	return nil
+}
+
+func (h *ShadowHook) mirror(
+	ctx context.Context, db *pg.DB, query string, primary time.Duration, returned int,
+) {
+	start := time.Now()
+	res, err := h.DB.ExecContext(ctx, rawQuery, pg.Safe(query))
+	shadow := time.Since(start)
+
+	if err != nil {
+		shadowErrorCounter.Add(ctx, 1)
+		h.printf("pgext: shadow query failed: %s:\n%s", err, query)
+		return
+	}
+
+	shadowLatencyRecorder.Record(ctx, primary.Microseconds(), targetKey.String("primary"))
+	shadowLatencyRecorder.Record(ctx, shadow.Microseconds(), targetKey.String("shadow"))
+
+	switch h.Compare {
+	case ShadowCompareRows:
+		if returned >= 0 && res != nil && res.RowsReturned() != returned {
+			h.diverged(ctx, query, "primary returned %d rows, shadow returned %d", returned, res.RowsReturned())
+		}
+	case ShadowCompareHash:
+		if db == nil {
+			return
+		}
+		want, err := hashResult(context.WithValue(ctx, shadowQueryKey{}, true), db, query)
+		if err != nil {
+			h.printf("pgext: hashing primary result failed: %s:\n%s", err, query)
+			return
+		}
+		got, err := hashResult(ctx, h.DB, query)
+		if err != nil {
+			shadowErrorCounter.Add(ctx, 1)
+			h.printf("pgext: hashing shadow result failed: %s:\n%s", err, query)
+			return
+		}
+		if got != want {
+			h.diverged(ctx, query, "primary result hash %s, shadow result hash %s", want, got)
+		}
+	}
+}
+
+func (h *ShadowHook) diverged(ctx context.Context, query, format string, args ...interface{}) {
+	shadowMismatchCounter.Add(ctx, 1, label.String("sql.compare", h.Compare.String()))
+	h.printf("pgext: shadow result differs, "+format+":\n%s", append(args, query)...)
+}
+
+func (h *ShadowHook) printf(format string, args ...interface{}) {
+	if h.Logger != nil {
+		h.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// hashResult returns the MD5 of the rows returned by the query, independent
+// of their order.
+func hashResult(ctx context.Context, db orm.DB, query string) (string, error) {
+	var hash string
+	_, err := db.QueryOneContext(ctx, pg.Scan(&hash), rawQuery, pg.Safe(
+		"SELECT coalesce(md5(string_agg(t::text, ',' ORDER BY t::text)), '') FROM ("+
+			strings.TrimRight(strings.TrimSpace(query), ";")+") AS t"))
+	return hash, err
+}
@@ -0,0 +1,112 @@
+package pgext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestShadowHook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		mirrored []string
+	)
+	shadow := fakeDB(t, func(query string) fakeResult {
+		mu.Lock()
+		mirrored = append(mirrored, query)
+		mu.Unlock()
+		if strings.Contains(query, "missing") {
+			return fakeResult{Err: "42P01"}
+		}
+		return fakeResult{Columns: []string{"id"}, Rows: [][]string{{"1"}}}
+	})
+
+	var buf bytes.Buffer
+	h := &ShadowHook{DB: shadow, SampleRate: 1, Logger: log.New(&buf, "", 0)}
+
+	ctx := context.Background()
+	for _, evt := range []*pgexttest.QueryEventBuilder{
+		pgexttest.NewQueryEvent("SELECT id FROM users"),
+		pgexttest.NewQueryEvent("UPDATE users SET name = 'x'"),
+		pgexttest.NewQueryEvent("SELECT id FROM users WHERE id = 2").Err(errors.New("boom")),
+		pgexttest.NewQueryEvent("SELECT id FROM missing"),
+	} {
+		if _, err := pgexttest.Run(ctx, h, evt.Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pgexttest.Run(ctx, h, pgexttest.NewQueryEvent("SELECT 1").Build()); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(mirrored)
+	want := []string{"SELECT id FROM missing", "SELECT id FROM users"}
+	if !reflect.DeepEqual(mirrored, want) {
+		t.Errorf("got mirrored %q, want %q", mirrored, want)
+	}
+	if !strings.Contains(buf.String(), "shadow query failed") {
+		t.Errorf("shadow error is not logged, got %q", buf.String())
+	}
+}
+
+func TestShadowHookCompare(t *testing.T) {
+	hashDB := func(hash string) *pg.DB {
+		return fakeDB(t, func(query string) fakeResult {
+			if strings.HasPrefix(query, "SELECT coalesce(md5(") {
+				return fakeResult{Columns: []string{"hash"}, Rows: [][]string{{hash}}}
+			}
+			return fakeResult{Columns: []string{"id"}, Rows: [][]string{{"1"}}}
+		})
+	}
+
+	tests := []struct {
+		compare ShadowCompare
+		primary *pg.DB
+		shadow  *pg.DB
+		want    string
+	}{
+		{ShadowCompareNone, hashDB("a"), hashDB("b"), ""},
+		{ShadowCompareRows, hashDB("a"), hashDB("a"), "primary returned 2 rows, shadow returned 1"},
+		{ShadowCompareHash, hashDB("a"), hashDB("a"), ""},
+		{ShadowCompareHash, hashDB("a"), hashDB("b"), "primary result hash a, shadow result hash b"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		h := &ShadowHook{
+			DB:         test.shadow,
+			SampleRate: 1,
+			Compare:    test.compare,
+			Logger:     log.New(&buf, "", 0),
+		}
+
+		ctx := context.Background()
+		evt := pgexttest.NewQueryEvent("SELECT id FROM users").DB(test.primary).Result(0, 2).Build()
+		if _, err := pgexttest.Run(ctx, h, evt); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		got := buf.String()
+		if test.want == "" && got != "" {
+			t.Errorf("%s: got %q, want no divergence", test.compare, got)
+		}
+		if test.want != "" && !strings.Contains(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.compare, got, test.want)
+		}
+	}
+}
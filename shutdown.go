@@ -0,0 +1,43 @@
+package pgext
+
+import (
+	"context"
+	"sync"
+)
+
+// Shutdowner is implemented by hooks and helpers that run background
+// goroutines or buffer telemetry.
+type Shutdowner interface {
+	// Shutdown stops background goroutines and flushes pending telemetry.
+	// It returns ctx.Err() if ctx is done before that.
+	Shutdown(ctx context.Context) error
+}
+
+// Shutdown shuts the components down in order and returns the first error.
+//
+//   defer pgext.Shutdown(ctx, handle, explainHook)
+func Shutdown(ctx context.Context, components ...Shutdowner) error {
+	var firstErr error
+	for _, c := range components {
+		if err := c.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// waitGroup waits for wg until ctx is done.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
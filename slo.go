@@ -0,0 +1,227 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var windowKey = label.Key("sql.window")
+
+// SLO is an objective for the queries of a database.
+type SLO struct {
+	// Objective is the fraction of queries that must be good, e.g. 0.999.
+	Objective float64
+	// Latency, if set, counts queries slower than it as bad. Failed queries
+	// are always bad.
+	Latency time.Duration
+}
+
+// BurnRateAlert fires when the burn rate over both windows is above the
+// threshold. The short window makes it resolve quickly once the problem is
+// gone.
+type BurnRateAlert struct {
+	Long      time.Duration
+	Short     time.Duration
+	Threshold float64
+}
+
+// DefaultBurnRateAlerts are the multiwindow alerts of the Google SRE
+// workbook: 2% of a 30 day error budget spent in one hour and 5% in six
+// hours.
+var DefaultBurnRateAlerts = []BurnRateAlert{
+	{Long: time.Hour, Short: 5 * time.Minute, Threshold: 14.4},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Threshold: 6},
+}
+
+// BurnRateEvent is a BurnRateAlert that fired or resolved.
+type BurnRateEvent struct {
+	Alert BurnRateAlert
+	// LongRate and ShortRate are the burn rates of the windows.
+	LongRate  float64
+	ShortRate float64
+	Resolved  bool
+}
+
+type sloBucket struct {
+	epoch int64
+	total int64
+	bad   int64
+}
+
+// SLOTracker is a pg.QueryHook that computes the burn rate of an SLO, the
+// rate at which its error budget is spent, over multiple windows in process.
+// Small services get burn-rate alerts on the health of their database
+// without an alerting stack:
+//
+//   slo := &pgext.SLOTracker{SLO: pgext.SLO{Objective: 0.999, Latency: 100 * time.Millisecond}}
+//   db.AddQueryHook(slo)
+//
+// The burn rates are reported as go.sql.slo.burn_rate labeled by sql.window.
+// Alerts are checked as queries are executed, at most once per bucket of
+// a fifth of the shortest window.
+type SLOTracker struct {
+	SLO SLO
+	// Alerts defaults to DefaultBurnRateAlerts.
+	Alerts []BurnRateAlert
+	// Notify is called when an alert fires and when it resolves. Defaults to
+	// logging.
+	Notify func(ctx context.Context, event BurnRateEvent)
+	// Logger is used by the default Notify. Defaults to the standard logger.
+	Logger *log.Logger
+	// Clock, if set, is used instead of the system clock.
+	Clock Clock
+
+	once       sync.Once
+	resolution time.Duration
+	mu         sync.Mutex
+	buckets    []sloBucket
+	checked    int64
+	firing     []bool
+}
+
+var _ pg.QueryHook = (*SLOTracker)(nil)
+
+func (t *SLOTracker) alerts() []BurnRateAlert {
+	if len(t.Alerts) > 0 {
+		return t.Alerts
+	}
+	return DefaultBurnRateAlerts
+}
+
+func (t *SLOTracker) init() {
+	t.once.Do(func() {
+		alerts := t.alerts()
+		shortest, longest := alerts[0].Short, alerts[0].Long
+		windows := make(map[time.Duration]bool)
+		for _, a := range alerts {
+			for _, w := range []time.Duration{a.Long, a.Short} {
+				if w < shortest {
+					shortest = w
+				}
+				if w > longest {
+					longest = w
+				}
+				windows[w] = true
+			}
+		}
+		t.resolution = shortest / 5
+		if t.resolution < time.Second {
+			t.resolution = time.Second
+		}
+		t.buckets = make([]sloBucket, longest/t.resolution+1)
+		t.firing = make([]bool, len(alerts))
+
+		_, _ = meter.NewFloat64ValueObserver("go.sql.slo.burn_rate",
+			func(_ context.Context, result metric.Float64ObserverResult) {
+				for w := range windows {
+					result.Observe(t.BurnRate(w), windowKey.String(w.String()))
+				}
+			},
+			metric.WithDescription("The rate at which the error budget of the SLO is spent"),
+		)
+	})
+}
+
+func (t *SLOTracker) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock.Now()
+	}
+	return time.Now()
+}
+
+func (t *SLOTracker) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (t *SLOTracker) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	t.init()
+
+	bad := isQueryError(evt.Err) || (t.SLO.Latency > 0 && since(t.Clock, evt.StartTime) > t.SLO.Latency)
+	epoch := t.now().UnixNano() / int64(t.resolution)
+
+	t.mu.Lock()
+	b := &t.buckets[epoch%int64(len(t.buckets))]
+	if b.epoch != epoch {
+		*b = sloBucket{epoch: epoch}
+	}
+	b.total++
+	if bad {
+		b.bad++
+	}
+	check := t.checked != epoch
+	t.checked = epoch
+	t.mu.Unlock()
+
+	if check {
+		t.check(ctx)
+	}
+	return nil
+}
+
+// BurnRate returns the burn rate over the window: the fraction of bad
+// queries divided by the fraction allowed by the objective. A burn rate of
+// 1 spends the error budget exactly over the SLO period.
+func (t *SLOTracker) BurnRate(window time.Duration) float64 {
+	t.init()
+	budget := 1 - t.SLO.Objective
+	if budget <= 0 {
+		return 0
+	}
+
+	epoch := t.now().UnixNano() / int64(t.resolution)
+	n := int64(window / t.resolution)
+	if n < 1 {
+		n = 1
+	}
+
+	var total, bad int64
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.epoch > epoch-n && b.epoch <= epoch {
+			total += b.total
+			bad += b.bad
+		}
+	}
+	t.mu.Unlock()
+
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / budget
+}
+
+func (t *SLOTracker) check(ctx context.Context) {
+	var events []BurnRateEvent
+	for i, a := range t.alerts() {
+		long, short := t.BurnRate(a.Long), t.BurnRate(a.Short)
+		firing := long > a.Threshold && short > a.Threshold
+
+		t.mu.Lock()
+		changed := firing != t.firing[i]
+		t.firing[i] = firing
+		t.mu.Unlock()
+
+		if changed {
+			events = append(events, BurnRateEvent{Alert: a, LongRate: long, ShortRate: short, Resolved: !firing})
+		}
+	}
+
+	for _, e := range events {
+		if t.Notify != nil {
+			t.Notify(ctx, e)
+			continue
+		}
+		state := "firing"
+		if e.Resolved {
+			state = "resolved"
+		}
+		logf(t.Logger, "pgext: SLO burn rate %s: %.1f over %s, %.1f over %s (threshold %g)",
+			state, e.LongRate, e.Alert.Long, e.ShortRate, e.Alert.Short, e.Alert.Threshold)
+	}
+}
@@ -0,0 +1,55 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestSLOTracker(t *testing.T) {
+	clock := pgexttest.NewClock(time.Unix(0, 0))
+	var events []BurnRateEvent
+	slo := &SLOTracker{
+		SLO:    SLO{Objective: 0.99, Latency: 100 * time.Millisecond},
+		Alerts: []BurnRateAlert{{Long: time.Hour, Short: 5 * time.Minute, Threshold: 10}},
+		Notify: func(_ context.Context, e BurnRateEvent) { events = append(events, e) },
+		Clock:  clock,
+	}
+	ctx := context.Background()
+	run := func(n int, err error, dur time.Duration) {
+		for i := 0; i < n; i++ {
+			evt := pgexttest.NewQueryEvent("SELECT 1").StartTime(clock.Now().Add(-dur)).Err(err).Build()
+			if _, err := pgexttest.Run(ctx, slo, evt); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	run(90, nil, time.Millisecond)
+	run(5, errors.New("test"), time.Millisecond)
+	run(5, nil, time.Second)
+	if rate := slo.BurnRate(time.Hour); rate < 9.9 || rate > 10.1 {
+		t.Errorf("got burn rate %g, want 10", rate)
+	}
+	if len(events) != 0 {
+		t.Fatalf("got %v before the next bucket, want no events", events)
+	}
+
+	clock.Advance(time.Minute)
+	run(10, errors.New("test"), time.Millisecond)
+	if len(events) != 1 || events[0].Resolved {
+		t.Fatalf("got %+v, want the alert firing", events)
+	}
+
+	clock.Advance(10 * time.Minute)
+	run(100, nil, time.Millisecond)
+	if rate := slo.BurnRate(5 * time.Minute); rate != 0 {
+		t.Errorf("got short burn rate %g, want 0", rate)
+	}
+	if len(events) != 2 || !events[1].Resolved {
+		t.Errorf("got %+v, want the alert resolved", events)
+	}
+}
@@ -0,0 +1,130 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SlowQueryFormat is the format of the lines logged by SlowQueryHook.
+type SlowQueryFormat int
+
+const (
+	// SlowQueryFormatDefault logs the duration, the caller and the query.
+	SlowQueryFormatDefault SlowQueryFormat = iota
+	// SlowQueryFormatPgBadger writes lines in the format PostgreSQL uses for
+	// log_min_duration_statement with the log_line_prefix
+	// '%t [%p]: [%l-1] user=%u,db=%d,app=%a ', so they can be analyzed with
+	// pgBadger when the server logs are not accessible.
+	SlowQueryFormatPgBadger
+)
+
+// SlowQueryHook is a pg.QueryHook that logs queries that take longer than
+// the threshold together with the caller.
+//
+//   db.AddQueryHook(&pgext.SlowQueryHook{Threshold: time.Second})
+//
+// To feed every query to pgBadger:
+//
+//   db.AddQueryHook(&pgext.SlowQueryHook{
+//       Threshold: time.Nanosecond,
+//       Format:    pgext.SlowQueryFormatPgBadger,
+//       Writer:    logFile,
+//   })
+type SlowQueryHook struct {
+	// Threshold is the duration after which a query is slow. Defaults to 1s.
+	Threshold time.Duration
+	// Logger is used to print slow queries. Defaults to the standard logger.
+	Logger *log.Logger
+	// Clock, if set, is used to measure duration instead of the system clock.
+	Clock Clock
+	// Format is the format of logged queries.
+	Format SlowQueryFormat
+	// Writer is where SlowQueryFormatPgBadger lines go. Defaults to os.Stderr.
+	Writer io.Writer
+	// RequestID, if set, extracts the request ID from the query context,
+	// e.g. RequestIDFromContext. It is logged with the default format.
+	RequestID func(context.Context) string
+
+	line int64
+}
+
+var _ pg.QueryHook = (*SlowQueryHook)(nil)
+
+func (h *SlowQueryHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *SlowQueryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	dur := since(h.Clock, evt.StartTime)
+	if dur < h.threshold() {
+		return nil
+	}
+
+	b, err := formattedQuery(evt)
+	if err != nil {
+		return err
+	}
+
+	query := redact(string(b))
+	if h.Format == SlowQueryFormatPgBadger {
+		return h.writePgBadger(evt, dur, query)
+	}
+
+	fn, file, line := funcFileLine("github.com/go-pg/pg")
+
+	printf := log.Printf
+	if h.Logger != nil {
+		printf = h.Logger.Printf
+	}
+	var requestID string
+	if h.RequestID != nil {
+		if id := h.RequestID(ctx); id != "" {
+			requestID = " request.id=" + id
+		}
+	}
+	printf("pgext: slow query took %s at %s (%s:%d)%s:\n%s", dur, fn, file, line, requestID, query)
+
+	return nil
+}
+
+func (h *SlowQueryHook) writePgBadger(evt *pg.QueryEvent, dur time.Duration, query string) error {
+	var user, database, app string
+	if db, ok := evt.DB.(*pg.DB); ok {
+		opt := db.Options()
+		user, database, app = opt.User, opt.Database, opt.ApplicationName
+	}
+
+	now := time.Now()
+	if h.Clock != nil {
+		now = h.Clock.Now()
+	}
+
+	line := fmt.Sprintf("%s [%d]: [%d-1] user=%s,db=%s,app=%s LOG:  duration: %.3f ms  statement: %s\n",
+		now.Format("2006-01-02 15:04:05 MST"), os.Getpid(), atomic.AddInt64(&h.line, 1),
+		user, database, app,
+		float64(dur)/float64(time.Millisecond),
+		// Continuation lines of a statement start with a tab in server logs.
+		strings.ReplaceAll(query, "\n", "\n\t"))
+
+	w := h.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+	_, err := io.WriteString(w, line)
+	return err
+}
+
+func (h *SlowQueryHook) threshold() time.Duration {
+	if h.Threshold > 0 {
+		return h.Threshold
+	}
+	return time.Second
+}
@@ -0,0 +1,39 @@
+package pgext
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestSlowQueryHookPgBadger(t *testing.T) {
+	clock := pgexttest.NewClock(time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC))
+	var b strings.Builder
+	h := &SlowQueryHook{
+		Threshold: time.Millisecond,
+		Clock:     clock,
+		Format:    SlowQueryFormatPgBadger,
+		Writer:    &b,
+	}
+
+	evt := &pg.QueryEvent{
+		DB:        pg.Connect(&pg.Options{User: "app", Database: "shop", ApplicationName: "api"}),
+		Query:     "SELECT 1\nFROM users",
+		StartTime: clock.Now().Add(-1500 * time.Microsecond),
+	}
+	if err := h.AfterQuery(context.Background(), evt); err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("2020-10-01 12:00:00 UTC [%d]: [1-1] user=app,db=shop,app=api "+
+		"LOG:  duration: 1.500 ms  statement: SELECT 1\n\tFROM users\n", os.Getpid())
+	if b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
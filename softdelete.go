@@ -0,0 +1,83 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+// ErrNotUnscoped is returned by ForceDelete when the context is not marked
+// with WithUnscoped.
+var ErrNotUnscoped = errors.New("pgext: deleting soft-deleted models permanently requires WithUnscoped")
+
+var unscopedCounter, _ = meter.NewInt64Counter(
+	"go.sql.soft_delete.unscoped",
+	metric.WithDescription("The number of queries that include or permanently delete soft-deleted rows"),
+)
+
+type unscopedKey struct{}
+
+// WithUnscoped returns a context in which the queries of SoftDeleteModel
+// include soft-deleted rows and ForceDelete is allowed. Mark only the code
+// paths that really need deleted rows, e.g. restores and retention jobs.
+func WithUnscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// IsUnscoped reports whether the context is marked with WithUnscoped.
+func IsUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey{}).(bool)
+	return unscoped
+}
+
+func softDeleteTable(q *orm.Query) (string, bool) {
+	tm := q.TableModel()
+	if tm == nil {
+		return "", false
+	}
+	table := tm.Table()
+	return table.ModelName, table.SoftDeleteField != nil
+}
+
+// SoftDeleteModel returns a query for the model that follows the soft delete
+// conventions of go-pg: soft-deleted rows are filtered out unless the
+// context is marked with WithUnscoped. Unscoped queries are counted in
+// go.sql.soft_delete.unscoped labeled by sql.table:
+//
+//   err := pgext.SoftDeleteModel(ctx, db, &users).Where("team_id = ?", teamID).Select()
+//
+//   ctx = pgext.WithUnscoped(ctx)
+//   err := pgext.SoftDeleteModel(ctx, db, &user).WherePK().Select() // includes deleted
+func SoftDeleteModel(ctx context.Context, db orm.DB, model ...interface{}) *orm.Query {
+	q := db.ModelContext(ctx, model...)
+	if !IsUnscoped(ctx) {
+		return q
+	}
+	table, ok := softDeleteTable(q)
+	if !ok {
+		return q
+	}
+	unscopedCounter.Add(ctx, 1, tableKey.String(table), methodLabel(string(orm.SelectOp)))
+	return q.AllWithDeleted()
+}
+
+// ForceDelete permanently deletes the model by its primary key, including
+// a soft-deleted row. It returns ErrNotUnscoped unless the context is marked
+// with WithUnscoped, so rows are not lost by mistake, and counts the delete
+// in go.sql.soft_delete.unscoped:
+//
+//   _, err := pgext.ForceDelete(pgext.WithUnscoped(ctx), db, &user)
+func ForceDelete(ctx context.Context, db orm.DB, model interface{}) (pg.Result, error) {
+	q := db.ModelContext(ctx, model)
+	table, ok := softDeleteTable(q)
+	if ok {
+		if !IsUnscoped(ctx) {
+			return nil, ErrNotUnscoped
+		}
+		unscopedCounter.Add(ctx, 1, tableKey.String(table), methodLabel(string(orm.DeleteOp)))
+	}
+	return q.WherePK().ForceDelete()
+}
@@ -0,0 +1,16 @@
+package pgext
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithUnscoped(t *testing.T) {
+	ctx := context.Background()
+	if IsUnscoped(ctx) {
+		t.Error("got unscoped context, want scoped")
+	}
+	if !IsUnscoped(WithUnscoped(ctx)) {
+		t.Error("got scoped context, want unscoped")
+	}
+}
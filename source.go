@@ -0,0 +1,116 @@
+package pgext
+
+import (
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+// mainModule is the module path of the main package, if known.
+var mainModule = func() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return bi.Main.Path
+}()
+
+// funcPackage returns the package path of a function name, e.g.
+// github.com/acme/shop/billing of github.com/acme/shop/billing.(*Svc).Charge.
+func funcPackage(fn string) string {
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+// moduleFile returns the path of file relative to the root of module, using
+// the package of fn, which holds no matter where the module was built or
+// whether it was built with -trimpath.
+func moduleFile(module, fn, file string) (string, bool) {
+	if module == "" {
+		return "", false
+	}
+	pkg := funcPackage(fn)
+	if pkg == module {
+		return path.Base(file), true
+	}
+	if !strings.HasPrefix(pkg, module+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(pkg, module+"/") + "/" + path.Base(file), true
+}
+
+// sourceURL expands the {file} and {line} placeholders of the template.
+func sourceURL(template, file string, line int) string {
+	return strings.NewReplacer(
+		"{file}", file,
+		"{line}", strconv.Itoa(line),
+	).Replace(template)
+}
+
+// callerAttributes returns the frame attributes of f, the code issuing the
+// query. frame.file is relative to the root of SourceModule for code of the
+// module, which is also linked as frame.url if SourceURL is set.
+func (h *OpenTelemetryHook) callerAttributes(f runtime.Frame) []label.KeyValue {
+	fn, file := f.Function, f.File
+
+	module := h.SourceModule
+	if module == "" {
+		module = mainModule
+	}
+	rel, ok := moduleFile(module, fn, file)
+	if ok {
+		file = rel
+	}
+	if ind := strings.LastIndexByte(fn, '/'); ind != -1 {
+		fn = fn[ind+1:]
+	}
+
+	attrs := []label.KeyValue{
+		label.String("frame.func", fn),
+		label.String("frame.file", file),
+		label.Int("frame.line", f.Line),
+	}
+	if ok && h.SourceURL != "" {
+		attrs = append(attrs, label.String("frame.url", sourceURL(h.SourceURL, rel, f.Line)))
+	}
+	return attrs
+}
+
+// callerFrame returns the first frame outside of pkg and this package.
+func callerFrame(pkg string) runtime.Frame {
+	const depth = 16
+	var pcs [depth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	ff := runtime.CallersFrames(pcs[:n])
+
+	var frame runtime.Frame
+	for {
+		f, ok := ff.Next()
+		if !ok {
+			break
+		}
+		frame = f
+		// Hooks can call each other, so frames of this package are skipped too.
+		if !strings.Contains(f.Function, pkg) && !strings.HasPrefix(f.Function, instrumentationName+".") {
+			break
+		}
+	}
+	return frame
+}
+
+func funcFileLine(pkg string) (string, string, int) {
+	f := callerFrame(pkg)
+	fn := f.Function
+	if ind := strings.LastIndexByte(fn, '/'); ind != -1 {
+		fn = fn[ind+1:]
+	}
+
+	return fn, f.File, f.Line
+}
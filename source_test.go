@@ -0,0 +1,29 @@
+package pgext
+
+import "testing"
+
+func TestModuleFile(t *testing.T) {
+	for _, test := range []struct {
+		fn, file string
+		want     string
+		ok       bool
+	}{
+		{"github.com/acme/shop/billing.(*Svc).Charge", "/home/ci/shop/billing/charge.go", "billing/charge.go", true},
+		{"github.com/acme/shop/billing.Charge", "github.com/acme/shop/billing/charge.go", "billing/charge.go", true},
+		{"github.com/acme/shop.main", "/src/main.go", "main.go", true},
+		{"github.com/acme/shopping.Do", "/src/shopping/do.go", "", false},
+		{"main.main", "/src/main.go", "", false},
+	} {
+		got, ok := moduleFile("github.com/acme/shop", test.fn, test.file)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: got %q %v, want %q %v", test.fn, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	got := sourceURL("https://github.com/acme/shop/blob/v1.2.0/{file}#L{line}", "billing/charge.go", 42)
+	if want := "https://github.com/acme/shop/blob/v1.2.0/billing/charge.go#L42"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
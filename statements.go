@@ -0,0 +1,111 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// maxStatementEvents limits the pgext.statement events of a query.
+const maxStatementEvents = 100
+
+// splitStatements splits a query into its statements at semicolons outside
+// of string literals, quoted identifiers, dollar-quoted strings and
+// comments. Empty statements are dropped.
+func splitStatements(query string) []string {
+	var stmts []string
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(query[start:end]); s != "" {
+			stmts = append(stmts, s)
+		}
+	}
+
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"':
+			for i++; i < len(query); i++ {
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case '-':
+			if i+1 < len(query) && query[i+1] == '-' {
+				if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+					i += end
+				} else {
+					i = len(query)
+				}
+			}
+		case '/':
+			if i+1 < len(query) && query[i+1] == '*' {
+				if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+					i += end + 3
+				} else {
+					i = len(query)
+				}
+			}
+		case '$':
+			tag := dollarTag(query[i:])
+			if tag == "" {
+				continue
+			}
+			if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag) - 1
+			} else {
+				i = len(query)
+			}
+		case ';':
+			add(i)
+			start = i + 1
+		}
+	}
+	if start < len(query) {
+		add(len(query))
+	}
+	return stmts
+}
+
+// dollarTag returns the opening tag of a dollar-quoted string, e.g. $$ or
+// $body$, at the start of s, or an empty string.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80,
+			c >= '0' && c <= '9' && i > 1:
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// addStatementEvents adds a pgext.statement event for every statement of
+// a multi-statement query. PostgreSQL runs them in one round trip, so they
+// have no durations of their own. statement returns the recorded text of
+// a statement, or false if statements are not recorded. filter is the
+// attribute filter of the hook.
+func addStatementEvents(ctx context.Context, span trace.Span, stmts []string, statement func(string) (string, bool), filter *AttributeFilter) {
+	for i, stmt := range stmts {
+		if i == maxStatementEvents {
+			break
+		}
+		kvs := []label.KeyValue{
+			label.Int("db.statement.index", i),
+			label.String("db.operation", spanName(stmt)),
+		}
+		if s, ok := statement(stmt); ok {
+			kvs = append(kvs, label.String("db.statement", s))
+		}
+		span.AddEvent(ctx, "pgext.statement", filterAttributes(kvs, filter)...)
+	}
+}
@@ -0,0 +1,25 @@
+package pgext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"INSERT INTO t VALUES ('a;b''c'); DELETE FROM \"x;y\"", []string{"INSERT INTO t VALUES ('a;b''c')", "DELETE FROM \"x;y\""}},
+		{"SELECT 1 -- a; b\n; SELECT /* ; */ 2", []string{"SELECT 1 -- a; b", "SELECT /* ; */ 2"}},
+		{"DO $body$ BEGIN PERFORM 1; END $body$; SELECT $1", []string{"DO $body$ BEGIN PERFORM 1; END $body$", "SELECT $1"}},
+		{"CREATE FUNCTION f() AS $$ SELECT 1; $$; ;", []string{"CREATE FUNCTION f() AS $$ SELECT 1; $$"}},
+		{"SELECT 'unterminated; SELECT 2", []string{"SELECT 'unterminated; SELECT 2"}},
+	} {
+		if got := splitStatements(c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.query, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+type tableSize struct {
+	Schema     string
+	Table      string
+	TotalBytes int64
+	IndexBytes int64
+}
+
+// TableSizeCollector periodically samples the total and index size of the
+// tables and reports them as go.sql.table.total_bytes and
+// go.sql.table.index_bytes, labeled by instance, schema and table, to alert
+// on runaway growth:
+//
+//   c := &pgext.TableSizeCollector{DB: db, Tables: []string{"events", "users"}}
+//   c.Start()
+//   defer c.Shutdown(ctx)
+type TableSizeCollector struct {
+	// DB is the database the tables are in.
+	DB *pg.DB
+	// Tables lists the tables to sample, optionally qualified by schema.
+	Tables []string
+	// Instance is the sql.instance label. Defaults to the database name.
+	Instance string
+	// Interval is the time between samples. Defaults to 1m.
+	Interval time.Duration
+	// Logger is used to print sampling errors. Defaults to the standard logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the sampled values against threshold rules.
+	Alerter *Alerter
+
+	poller poller
+	mu     sync.Mutex
+	sizes  []tableSize
+}
+
+var _ Shutdowner = (*TableSizeCollector)(nil)
+
+type tableSizeInstruments struct {
+	total, index metric.Int64ValueObserver
+}
+
+// Start starts sampling in the background and reporting the metrics.
+func (c *TableSizeCollector) Start() {
+	if !c.poller.start(c.Interval, c.collect) {
+		return
+	}
+
+	c.poller.onShutdown(observeBatch("go.sql.table.total_bytes",
+		func(batch metric.BatchObserver) interface{} {
+			var i tableSizeInstruments
+			i.total, _ = batch.NewInt64ValueObserver("go.sql.table.total_bytes",
+				metric.WithDescription("The size of the table including indexes and TOAST in bytes"))
+			i.index, _ = batch.NewInt64ValueObserver("go.sql.table.index_bytes",
+				metric.WithDescription("The size of the indexes of the table in bytes"))
+			return &i
+		},
+		func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			i := instruments.(*tableSizeInstruments)
+			c.mu.Lock()
+			sizes := c.sizes
+			c.mu.Unlock()
+
+			instance := instanceName(c.DB, c.Instance)
+			for _, s := range sizes {
+				result.Observe(tableLabels(instance, s.Schema, s.Table),
+					i.total.Observation(s.TotalBytes),
+					i.index.Observation(s.IndexBytes),
+				)
+			}
+		}))
+}
+
+// Shutdown stops sampling and reporting the metrics.
+func (c *TableSizeCollector) Shutdown(ctx context.Context) error {
+	return c.poller.shutdown(ctx)
+}
+
+func (c *TableSizeCollector) collect(ctx context.Context) {
+	if len(c.Tables) == 0 {
+		return
+	}
+
+	var sizes []tableSize
+	_, err := c.DB.QueryContext(ctx, &sizes, `
+		SELECT n.nspname AS schema,
+			c.relname AS "table",
+			pg_total_relation_size(c.oid) AS total_bytes,
+			pg_indexes_size(c.oid) AS index_bytes
+		FROM unnest(ARRAY[?]::text[]) AS t
+		JOIN pg_class AS c ON c.oid = to_regclass(t)
+		JOIN pg_namespace AS n ON n.oid = c.relnamespace`, pg.In(c.Tables))
+	if err != nil {
+		if ctx.Err() == nil {
+			logf(c.Logger, "pgext: sampling table sizes failed: %s", err)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	c.sizes = sizes
+	c.mu.Unlock()
+
+	instance := instanceName(c.DB, c.Instance)
+	samples := make([]sample, 0, 2*len(sizes))
+	for _, s := range sizes {
+		labels := tableLabels(instance, s.Schema, s.Table)
+		samples = append(samples,
+			sample{"go.sql.table.total_bytes", labels, float64(s.TotalBytes)},
+			sample{"go.sql.table.index_bytes", labels, float64(s.IndexBytes)},
+		)
+	}
+	c.Alerter.check(ctx, samples)
+}
+
+// tableLabels returns the labels of the metrics of a table.
+func tableLabels(instance, schema, table string) []label.KeyValue {
+	return []label.KeyValue{
+		instanceKey.String(instance),
+		schemaKey.String(schema),
+		tableKey.String(table),
+	}
+}
@@ -0,0 +1,32 @@
+package pgext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableSizeCollector(t *testing.T) {
+	db := fakeDB(t, func(query string) fakeResult {
+		if !strings.Contains(query, `ARRAY['users','audit.events']`) {
+			t.Errorf("got query %q, want the tables filtered", query)
+		}
+		return fakeResult{
+			Columns: []string{"schema", "table", "total_bytes", "index_bytes"},
+			Rows: [][]string{
+				{"public", "users", "16384", "8192"},
+				{"audit", "events", "65536", "0"},
+			},
+		}
+	})
+
+	testCollectorMetrics(t, "go.sql.table.total_bytes", map[string]string{"sql.schema": "audit", "sql.table": "events"},
+		func(instance string) (Shutdowner, func() bool) {
+			c := &TableSizeCollector{DB: db, Tables: []string{"users", "audit.events"}, Instance: instance}
+			c.Start()
+			return c, func() bool {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return c.sizes != nil
+			}
+		})
+}
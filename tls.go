@@ -0,0 +1,226 @@
+package pgext
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+// tlsStates maps database addresses to the tls.ConnectionState of their
+// latest connection.
+var tlsStates sync.Map
+
+// RecordTLS records the negotiated TLS version and cipher suite of the
+// connections opened with opt, so query spans get the db.tls.version and
+// db.tls.cipher attributes. It has no effect if opt.TLSConfig is nil.
+//
+//   pgext.RecordTLS(opt)
+//   db := pg.Connect(opt)
+func RecordTLS(opt *pg.Options) {
+	if opt.TLSConfig == nil {
+		return
+	}
+	addr := opt.Addr
+	verify := opt.TLSConfig.VerifyConnection
+	opt.TLSConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		tlsStates.Store(addr, cs)
+		return nil
+	}
+}
+
+// tlsAttributes returns the TLS attributes recorded for the database.
+func tlsAttributes(db interface{}) []label.KeyValue {
+	o, ok := db.(optioner)
+	if !ok {
+		return nil
+	}
+	v, ok := tlsStates.Load(o.Options().Addr)
+	if !ok {
+		return nil
+	}
+	cs := v.(tls.ConnectionState)
+	return []label.KeyValue{
+		label.String("db.tls.version", tlsVersionName(cs.Version)),
+		label.String("db.tls.cipher", tls.CipherSuiteName(cs.CipherSuite)),
+	}
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+// TLSExpiryCollector periodically connects to the server, reads its
+// certificate and reports the time until it expires as
+// go.sql.tls.cert_expiry_seconds. It warns when the certificate expires
+// within WarnBefore, long before it causes a total outage:
+//
+//   c := &pgext.TLSExpiryCollector{DB: db}
+//   c.Start()
+//   defer c.Shutdown(ctx)
+type TLSExpiryCollector struct {
+	// DB is the database whose certificate is checked. Its Options must
+	// have a TLSConfig.
+	DB *pg.DB
+	// Interval is the time between checks. Defaults to 1h.
+	Interval time.Duration
+	// WarnBefore is how long before the expiry warnings are logged.
+	// Defaults to 14 days.
+	WarnBefore time.Duration
+	// Logger is used to print warnings and errors. Defaults to the standard
+	// logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the sampled values against threshold rules.
+	Alerter *Alerter
+
+	poller   poller
+	mu       sync.Mutex
+	notAfter time.Time
+}
+
+var _ Shutdowner = (*TLSExpiryCollector)(nil)
+
+// Start starts checking in the background and reporting the metric.
+func (c *TLSExpiryCollector) Start() {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if !c.poller.start(interval, c.collect) {
+		return
+	}
+
+	_, _ = meter.NewInt64ValueObserver("go.sql.tls.cert_expiry_seconds",
+		func(ctx context.Context, result metric.Int64ObserverResult) {
+			c.mu.Lock()
+			notAfter := c.notAfter
+			c.mu.Unlock()
+
+			if !notAfter.IsZero() {
+				result.Observe(int64(time.Until(notAfter).Seconds()), instanceKey.String(c.DB.Options().Addr))
+			}
+		},
+		metric.WithDescription("The time until the server certificate expires in seconds"))
+}
+
+// Shutdown stops checking. The metric reports the last check.
+func (c *TLSExpiryCollector) Shutdown(ctx context.Context) error {
+	return c.poller.shutdown(ctx)
+}
+
+func (c *TLSExpiryCollector) collect(ctx context.Context) {
+	notAfter, err := serverCertificateExpiry(ctx, c.DB.Options())
+	if err != nil {
+		if ctx.Err() == nil {
+			logf(c.Logger, "pgext: checking the server certificate failed: %s", err)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	c.notAfter = notAfter
+	c.mu.Unlock()
+
+	warn := c.WarnBefore
+	if warn <= 0 {
+		warn = 14 * 24 * time.Hour
+	}
+	left := time.Until(notAfter)
+	if left < warn {
+		logf(c.Logger, "pgext: the server certificate of %s expires in %s at %s",
+			c.DB.Options().Addr, left.Round(time.Minute), notAfter.Format(time.RFC3339))
+	}
+
+	c.Alerter.check(ctx, []sample{{
+		"go.sql.tls.cert_expiry_seconds",
+		[]label.KeyValue{instanceKey.String(c.DB.Options().Addr)},
+		left.Seconds(),
+	}})
+}
+
+// sslRequestCode asks the server to switch to TLS.
+const sslRequestCode = 80877103
+
+// serverCertificateExpiry returns the expiry of the certificate the server
+// presents. The certificate is not verified, only inspected.
+func serverCertificateExpiry(ctx context.Context, opt *pg.Options) (time.Time, error) {
+	if opt.TLSConfig == nil {
+		return time.Time{}, errors.New("TLS is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	dial := opt.Dialer
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	network := opt.Network
+	if network == "" {
+		network = "tcp"
+	}
+	cn, err := dial(ctx, network, opt.Addr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer cn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = cn.SetDeadline(deadline)
+	}
+
+	var req [8]byte
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], sslRequestCode)
+	if _, err := cn.Write(req[:]); err != nil {
+		return time.Time{}, err
+	}
+	var resp [1]byte
+	if _, err := cn.Read(resp[:]); err != nil {
+		return time.Time{}, err
+	}
+	if resp[0] != 'S' {
+		return time.Time{}, errors.New("the server does not support TLS")
+	}
+
+	cfg := opt.TLSConfig.Clone()
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyPeerCertificate = nil
+	cfg.VerifyConnection = nil
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(opt.Addr)
+	}
+
+	tlsCn := tls.Client(cn, cfg)
+	if err := tlsCn.Handshake(); err != nil {
+		return time.Time{}, err
+	}
+	certs := tlsCn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return time.Time{}, errors.New("the server sent no certificate")
+	}
+	return certs[0].NotAfter, nil
+}
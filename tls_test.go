@@ -0,0 +1,88 @@
+package pgext
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// fakeTLSServer accepts one connection, answers the SSLRequest and completes
+// the handshake with a certificate expiring at notAfter.
+func fakeTLSServer(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		cn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer cn.Close()
+
+		var req [8]byte
+		if _, err := cn.Read(req[:]); err != nil {
+			return
+		}
+		if _, err := cn.Write([]byte{'S'}); err != nil {
+			return
+		}
+		srv := tls.Server(cn, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		})
+		_ = srv.Handshake()
+	}()
+	return ln.Addr().String()
+}
+
+func TestServerCertificateExpiry(t *testing.T) {
+	notAfter := time.Now().Add(72 * time.Hour).Truncate(time.Second).UTC()
+	addr := fakeTLSServer(t, notAfter)
+
+	got, err := serverCertificateExpiry(context.Background(), &pg.Options{
+		Addr:      addr,
+		TLSConfig: &tls.Config{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(notAfter) {
+		t.Errorf("got expiry %s, want %s", got, notAfter)
+	}
+}
+
+func TestTLSVersionName(t *testing.T) {
+	if got := tlsVersionName(tls.VersionTLS13); got != "TLS 1.3" {
+		t.Errorf("got %q", got)
+	}
+	if got := tlsVersionName(0x0200); got != "0x0200" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package pgext
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// The go-pg pool errors are internal, so they are recognized by message.
+const (
+	poolTimeoutMessage = "pg: connection pool timeout"
+	poolClosedMessage  = "pg: database is closed"
+)
+
+// Error classes of failed queries, reported as the db.error_class attribute
+// and the sql.error_class metric label, as in pgext v1.
+const (
+	errorClassPoolTimeout = "pool_timeout"
+	errorClassClosed      = "closed"
+	errorClassConnection  = "connection"
+	errorClassServer      = "server"
+	errorClassNoRows      = "no_rows"
+	errorClassOther       = "other"
+)
+
+// errorClass tells client side capacity problems, i.e. pool timeouts and
+// closed databases, and unreachable servers apart from errors returned by
+// the server, so a pool that is too small is not mistaken for a failing
+// database.
+func errorClass(err error) string {
+	switch err {
+	case pg.ErrNoRows, pg.ErrMultiRows:
+		return errorClassNoRows
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e.Error() {
+		case poolTimeoutMessage:
+			return errorClassPoolTimeout
+		case poolClosedMessage:
+			return errorClassClosed
+		}
+	}
+	if isConnectionError(err) {
+		return errorClassConnection
+	}
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		return errorClassServer
+	}
+	return errorClassOther
+}
+
+// isConnectionError reports whether err means the server could not be
+// reached or dropped the connection.
+func isConnectionError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exception, 57P01-57P03 are shutdown and
+		// startup of the server.
+		code := pgErr.Field('C')
+		return strings.HasPrefix(code, "08") ||
+			code == "57P01" || code == "57P02" || code == "57P03"
+	}
+	return false
+}
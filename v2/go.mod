@@ -0,0 +1,12 @@
+module github.com/j2gg0s/pgext/v2
+
+go 1.20
+
+require (
+	github.com/go-pg/pg/v10 v10.11.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/metric v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/sdk/metric v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
@@ -0,0 +1,65 @@
+package pgext
+
+import (
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/j2gg0s/pgext/v2"
+
+// instrumentationVersion is the version of pgext in the build, reported as
+// the instrumentation version so backends can tell releases apart.
+var instrumentationVersion = moduleVersion(instrumentationName)
+
+// moduleVersion returns the version of the module from the build info, or
+// an empty string if it is unknown.
+func moduleVersion(path string) string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if bi.Main.Path == path {
+		return bi.Main.Version
+	}
+	for _, m := range bi.Deps {
+		if m.Path != path {
+			continue
+		}
+		if m.Replace != nil && m.Replace.Version != "" {
+			return m.Replace.Version
+		}
+		return m.Version
+	}
+	return ""
+}
+
+// instruments are the query instruments of OpenTelemetryHook. Only the
+// instruments of the conventions in use are created.
+type instruments struct {
+	// latency and slowQueries are the go.sql.* instruments of pgext v1.
+	latency     metric.Int64Histogram
+	slowQueries metric.Int64Counter
+	// duration is db.client.operation.duration of the semantic conventions.
+	duration metric.Float64Histogram
+}
+
+func newInstruments(meter metric.Meter, conv Conventions) *instruments {
+	var i instruments
+	if conv.v1() {
+		i.latency, _ = meter.Int64Histogram("go.sql.latency",
+			metric.WithDescription("The latency of calls in microsecond"),
+			metric.WithUnit("us"),
+		)
+		i.slowQueries, _ = meter.Int64Counter("go.sql.slow_queries",
+			metric.WithDescription("The number of queries slower than the slow query threshold"),
+		)
+	}
+	if conv.semantic() {
+		i.duration, _ = meter.Float64Histogram("db.client.operation.duration",
+			metric.WithDescription("Duration of database client operations"),
+			metric.WithUnit("s"),
+		)
+	}
+	return &i
+}
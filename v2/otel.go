@@ -0,0 +1,328 @@
+// Package pgext instruments go-pg with the stable OpenTelemetry 1.x API.
+//
+// It is the successor of github.com/j2gg0s/pgext, which is built on
+// OpenTelemetry v0.11 and can not be used in the same build as OpenTelemetry
+// 1.x. The hooks record the attributes and go.sql.* metrics of pgext v1 by
+// default, so dashboards and alerts keep working after the upgrade, see
+// Conventions for the migration to the semantic conventions.
+package pgext
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	instanceKey   = attribute.Key("sql.instance")
+	methodKey     = attribute.Key("sql.method")
+	tableKey      = attribute.Key("sql.table")
+	errorClassKey = attribute.Key("sql.error_class")
+
+	statusOKLabel    = attribute.String("sql.status", "OK")
+	statusErrorLabel = attribute.String("sql.status", "Error")
+)
+
+// queryLimit limits the recorded query in bytes.
+const queryLimit = 5000
+
+type queryOperation interface {
+	Operation() orm.QueryOp
+}
+
+// optioner is a database with options, e.g. *pg.DB and *pg.Tx.
+type optioner interface {
+	Options() *pg.Options
+}
+
+// OpenTelemetryHook is a pg.QueryHook that adds OpenTelemetry instrumentation.
+//
+//   db.AddQueryHook(&pgext.OpenTelemetryHook{AllowMetric: true})
+type OpenTelemetryHook struct {
+	// TracerProvider creates the tracer of the query spans. Defaults to the
+	// global provider.
+	TracerProvider trace.TracerProvider
+	// MeterProvider creates the query instruments. Defaults to the global
+	// provider.
+	MeterProvider metric.MeterProvider
+	// Conventions selects the names of the attributes and metrics. Defaults
+	// to the names of pgext v1.
+	Conventions Conventions
+	// Caller, if set to true, adds the code issuing the query to the span.
+	Caller bool
+	// AllowMetric, if set to true, records the latency of the queries.
+	AllowMetric bool
+	// Statement controls how the query is recorded. Defaults to the full query.
+	Statement StatementCapture
+	// SlowQueryThreshold, if set, marks queries that take longer with
+	// a pgext.slow_query span event and counts them.
+	SlowQueryThreshold time.Duration
+	// Instance, if set, is used as the sql.instance metric label instead of
+	// the database name.
+	Instance string
+	// ContextAttributes maps attribute keys to functions extracting request
+	// scoped values, e.g. user ID or route, from the query context. Empty
+	// values are skipped.
+	ContextAttributes map[attribute.Key]func(context.Context) string
+	// ContextMetricLabels lists keys of ContextAttributes that are also added
+	// to metrics. Keep their cardinality low.
+	ContextMetricLabels []attribute.Key
+
+	once        sync.Once
+	tracer      trace.Tracer
+	instruments *instruments
+}
+
+var _ pg.QueryHook = (*OpenTelemetryHook)(nil)
+
+// querySpanKey marks the span started by OpenTelemetryHook in the context,
+// so AfterQuery never touches the parent span.
+type querySpanKey struct{}
+
+func (h *OpenTelemetryHook) init() {
+	h.once.Do(func() {
+		tp := h.TracerProvider
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+		h.tracer = tp.Tracer(instrumentationName, trace.WithInstrumentationVersion(instrumentationVersion))
+
+		mp := h.MeterProvider
+		if mp == nil {
+			mp = otel.GetMeterProvider()
+		}
+		h.instruments = newInstruments(
+			mp.Meter(instrumentationName, metric.WithInstrumentationVersion(instrumentationVersion)),
+			h.Conventions,
+		)
+	})
+}
+
+func (h *OpenTelemetryHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	h.init()
+	ctx, span := h.tracer.Start(ctx, "",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(evt.StartTime),
+	)
+	return context.WithValue(ctx, querySpanKey{}, span), nil
+}
+
+func (h *OpenTelemetryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	h.init()
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		span = trace.SpanFromContext(context.Background())
+	}
+	if !span.IsRecording() && !h.AllowMetric {
+		return nil
+	}
+	defer span.End()
+
+	query, err := formattedQuery(evt)
+	if err != nil {
+		// go-pg fails the query with the same error.
+		return nil
+	}
+	method := queryMethod(evt, query)
+	span.SetName(method)
+
+	var database string
+	if db, ok := evt.DB.(optioner); ok {
+		database = db.Options().Database
+	}
+	var class string
+	if evt.Err != nil {
+		class = errorClass(evt.Err)
+	}
+	dur := time.Since(evt.StartTime)
+	slow := h.SlowQueryThreshold > 0 && dur >= h.SlowQueryThreshold
+
+	if span.IsRecording() {
+		h.recordSpan(ctx, span, evt, method, query, class)
+		if slow {
+			span.AddEvent("pgext.slow_query", trace.WithAttributes(
+				attribute.Int64("db.duration_us", dur.Microseconds()),
+			))
+		}
+	}
+	if h.AllowMetric {
+		h.recordMetrics(ctx, evt, method, database, class, dur, slow)
+	}
+	return nil
+}
+
+func (h *OpenTelemetryHook) recordSpan(
+	ctx context.Context, span trace.Span, evt *pg.QueryEvent, method, query, class string,
+) {
+	attrs := make([]attribute.KeyValue, 0, 12)
+	if h.Caller {
+		attrs = append(attrs, callerAttributes(callerFrame("github.com/go-pg/pg"))...)
+	}
+	attrs = append(attrs, attribute.String("db.system", "postgres"))
+	if stmt, ok := h.Statement.record(query); ok {
+		attrs = append(attrs, attribute.String("db.statement", stmt))
+	}
+	if db, ok := evt.DB.(optioner); ok {
+		opt := db.Options()
+		attrs = append(attrs,
+			attribute.String("db.connection_string", opt.Addr),
+			attribute.String("db.user", opt.User),
+			attribute.String("db.name", opt.Database),
+		)
+	}
+	for key, fn := range h.ContextAttributes {
+		if v := fn(ctx); v != "" {
+			attrs = append(attrs, key.String(v))
+		}
+	}
+
+	if evt.Err != nil {
+		attrs = append(attrs, attribute.String("db.error_class", class))
+		// OpenTelemetry 1.x has no status for a missing row, which is not a
+		// failure of the query.
+		if class != errorClassNoRows {
+			span.RecordError(evt.Err)
+			span.SetStatus(codes.Error, evt.Err.Error())
+		}
+	} else if evt.Result != nil {
+		// PostgreSQL reports the number of selected rows as affected, so it
+		// is only meaningful for statements that change data.
+		if method != string(orm.SelectOp) {
+			attrs = append(attrs, attribute.Int("db.rows_affected", evt.Result.RowsAffected()))
+		}
+		if returned := evt.Result.RowsReturned(); returned > 0 || method == string(orm.SelectOp) {
+			attrs = append(attrs, attribute.Int("db.rows_returned", returned))
+		}
+	}
+
+	span.SetAttributes(h.Conventions.attributes(attrs)...)
+}
+
+func (h *OpenTelemetryHook) recordMetrics(
+	ctx context.Context, evt *pg.QueryEvent, method, database, class string, dur time.Duration, slow bool,
+) {
+	var table string
+	if len(evt.Params) > 0 {
+		if tableModel, ok := evt.Params[0].(orm.TableModel); ok {
+			table = tableModel.Table().ModelName
+		}
+	}
+
+	var contextLabels []attribute.KeyValue
+	for _, key := range h.ContextMetricLabels {
+		if fn := h.ContextAttributes[key]; fn != nil {
+			if v := fn(ctx); v != "" {
+				contextLabels = append(contextLabels, key.String(v))
+			}
+		}
+	}
+
+	if h.Conventions.v1() {
+		labels := make([]attribute.KeyValue, 0, 6+len(contextLabels))
+		labels = append(labels, methodKey.String(method))
+		if h.Instance != "" {
+			labels = append(labels, instanceKey.String(h.Instance))
+		} else if database != "" {
+			labels = append(labels, instanceKey.String(database))
+		}
+		if table != "" {
+			labels = append(labels, tableKey.String(table))
+		}
+		labels = append(labels, contextLabels...)
+		if slow {
+			h.instruments.slowQueries.Add(ctx, 1, metric.WithAttributes(labels...))
+		}
+		if evt.Err != nil {
+			labels = append(labels, statusErrorLabel, errorClassKey.String(class))
+		} else {
+			labels = append(labels, statusOKLabel)
+		}
+		h.instruments.latency.Record(ctx, dur.Microseconds(), metric.WithAttributes(labels...))
+	}
+
+	if h.Conventions.semantic() {
+		attrs := semanticMetricAttributes(method, database, table, class)
+		attrs = append(attrs, contextLabels...)
+		h.instruments.duration.Record(ctx, dur.Seconds(), metric.WithAttributes(attrs...))
+	}
+}
+
+// formattedQuery returns the formatted query of the event or, if it is empty,
+// the unformatted one, limited to queryLimit bytes. go-pg does not format
+// prepared statements and events built outside of pg.DB, e.g. in tests, have
+// no formatted query. Multi-row inserts can be megabytes long, so they are
+// recorded unformatted.
+func formattedQuery(evt *pg.QueryEvent) (string, error) {
+	var b []byte
+	var err error
+	if v, ok := evt.Query.(queryOperation); ok && v.Operation() == orm.InsertOp {
+		b, err = evt.UnformattedQuery()
+	} else if b, err = evt.FormattedQuery(); err == nil && len(b) == 0 {
+		b, err = evt.UnformattedQuery()
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncate(string(b), queryLimit), nil
+}
+
+// queryMethod returns the operation of the query, e.g. SELECT, or the first
+// word of the query if the operation is unknown.
+func queryMethod(evt *pg.QueryEvent, query string) string {
+	if v, ok := evt.Query.(queryOperation); ok {
+		if op := v.Operation(); op != "" {
+			return string(op)
+		}
+	}
+	name := query
+	if idx := strings.IndexByte(name, ' '); idx > 0 {
+		name = name[:idx]
+	}
+	return strings.TrimSpace(truncate(name, 20))
+}
+
+// callerFrame returns the first frame outside of pkg and this package.
+func callerFrame(pkg string) runtime.Frame {
+	const depth = 16
+	var pcs [depth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	ff := runtime.CallersFrames(pcs[:n])
+
+	var frame runtime.Frame
+	for {
+		f, ok := ff.Next()
+		if !ok {
+			break
+		}
+		frame = f
+		// Hooks can call each other, so frames of this package are skipped too.
+		if !strings.Contains(f.Function, pkg) && !strings.HasPrefix(f.Function, instrumentationName+".") {
+			break
+		}
+	}
+	return frame
+}
+
+// callerAttributes returns the frame attributes of f, the code issuing the
+// query.
+func callerAttributes(f runtime.Frame) []attribute.KeyValue {
+	fn := f.Function
+	if ind := strings.LastIndexByte(fn, '/'); ind != -1 {
+		fn = fn[ind+1:]
+	}
+	return []attribute.KeyValue{
+		attribute.String("frame.func", fn),
+		attribute.String("frame.file", f.File),
+		attribute.Int("frame.line", f.Line),
+	}
+}
@@ -0,0 +1,170 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testHook returns a hook recording to the returned span recorder and
+// metric reader.
+func testHook(conv Conventions) (*OpenTelemetryHook, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	sr := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	h := &OpenTelemetryHook{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		Conventions:    conv,
+		AllowMetric:    true,
+	}
+	return h, sr, reader
+}
+
+func testDB(t *testing.T) *pg.DB {
+	db := pg.Connect(&pg.Options{Addr: "db.local:5432", User: "app", Database: "orders"})
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func runQuery(t *testing.T, h *OpenTelemetryHook, db *pg.DB, query string, err error) {
+	t.Helper()
+	evt := &pg.QueryEvent{DB: db, Query: query, StartTime: time.Now()}
+	ctx, e := h.BeforeQuery(context.Background(), evt)
+	if e != nil {
+		t.Fatal(e)
+	}
+	evt.Err = err
+	if e := h.AfterQuery(ctx, evt); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// collect returns the data of the metrics by name.
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	ms := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			ms[m.Name] = m.Data
+		}
+	}
+	return ms
+}
+
+func TestOpenTelemetryHook(t *testing.T) {
+	h, sr, reader := testHook(ConventionsV1)
+	db := testDB(t)
+
+	runQuery(t, h, db, "SELECT 1", nil)
+	runQuery(t, h, db, "SELECT 2", pg.ErrNoRows)
+	runQuery(t, h, db, "SELECT 3", errors.New("boom"))
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	for _, span := range spans {
+		if span.Name() != "SELECT" {
+			t.Errorf("got span %q, want SELECT", span.Name())
+		}
+		for key, want := range map[attribute.Key]string{
+			"db.system":            "postgres",
+			"db.name":              "orders",
+			"db.connection_string": "db.local:5432",
+		} {
+			if v, _ := spanAttr(span, key); v.AsString() != want {
+				t.Errorf("got %s=%q, want %q", key, v.AsString(), want)
+			}
+		}
+	}
+	if v, _ := spanAttr(spans[0], "db.statement"); v.AsString() != "SELECT 1" {
+		t.Errorf("got db.statement %q, want SELECT 1", v.AsString())
+	}
+	if code := spans[1].Status().Code; code != codes.Unset {
+		t.Errorf("got status %v for pg.ErrNoRows, want unset", code)
+	}
+	if code := spans[2].Status().Code; code != codes.Error {
+		t.Errorf("got status %v for a failed query, want error", code)
+	}
+
+	latency, ok := collect(t, reader)["go.sql.latency"].(metricdata.Histogram[int64])
+	if !ok {
+		t.Fatal("go.sql.latency is not recorded")
+	}
+	statuses := make(map[string]uint64)
+	for _, dp := range latency.DataPoints {
+		if v, _ := dp.Attributes.Value(instanceKey); v.AsString() != "orders" {
+			t.Errorf("got sql.instance %q, want orders", v.AsString())
+		}
+		v, _ := dp.Attributes.Value("sql.status")
+		statuses[v.AsString()] += dp.Count
+	}
+	if statuses["OK"] != 1 || statuses["Error"] != 2 {
+		t.Errorf("got latencies by status %v, want 1 OK and 2 Error", statuses)
+	}
+}
+
+func TestOpenTelemetryHookConventions(t *testing.T) {
+	tests := []struct {
+		conv           Conventions
+		v1, semantic   bool
+		v1Metric       bool
+		semanticMetric bool
+	}{
+		{ConventionsV1, true, false, true, false},
+		{ConventionsBoth, true, true, true, true},
+		{ConventionsSemantic, false, true, false, true},
+	}
+
+	for _, test := range tests {
+		h, sr, reader := testHook(test.conv)
+		runQuery(t, h, testDB(t), "SELECT 1", nil)
+
+		span := sr.Ended()[0]
+		if _, ok := spanAttr(span, "db.statement"); ok != test.v1 {
+			t.Errorf("conventions %d: got db.statement %v, want %v", test.conv, ok, test.v1)
+		}
+		if v, ok := spanAttr(span, "db.query.text"); ok != test.semantic || (ok && v.AsString() != "SELECT 1") {
+			t.Errorf("conventions %d: got db.query.text %q %v, want %v", test.conv, v.AsString(), ok, test.semantic)
+		}
+		if v, ok := spanAttr(span, "server.port"); ok != test.semantic || (ok && v.AsInt64() != 5432) {
+			t.Errorf("conventions %d: got server.port %d %v, want %v", test.conv, v.AsInt64(), ok, test.semantic)
+		}
+
+		ms := collect(t, reader)
+		if _, ok := ms["go.sql.latency"]; ok != test.v1Metric {
+			t.Errorf("conventions %d: got go.sql.latency %v, want %v", test.conv, ok, test.v1Metric)
+		}
+		duration, ok := ms["db.client.operation.duration"].(metricdata.Histogram[float64])
+		if ok != test.semanticMetric {
+			t.Errorf("conventions %d: got db.client.operation.duration %v, want %v", test.conv, ok, test.semanticMetric)
+		}
+		for _, dp := range duration.DataPoints {
+			if v, _ := dp.Attributes.Value("db.namespace"); v.AsString() != "orders" {
+				t.Errorf("conventions %d: got db.namespace %q, want orders", test.conv, v.AsString())
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package pgext
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// PoolStatsObserver reports connection pool statistics of a database as
+// go.sql.pool.* metrics, labeled by sql.instance as in pgext v1.
+type PoolStatsObserver struct {
+	db           *pg.DB
+	registration metric.Registration
+}
+
+// PoolOption configures ObservePoolStats.
+type PoolOption func(*poolConfig)
+
+type poolConfig struct {
+	meterProvider metric.MeterProvider
+	instance      string
+}
+
+// WithMeterProvider sets the provider of the pool instruments. Defaults to
+// the global provider.
+func WithMeterProvider(mp metric.MeterProvider) PoolOption {
+	return func(c *poolConfig) {
+		c.meterProvider = mp
+	}
+}
+
+// WithInstance sets the sql.instance label. Defaults to the database name.
+func WithInstance(instance string) PoolOption {
+	return func(c *poolConfig) {
+		c.instance = instance
+	}
+}
+
+// ObservePoolStats starts reporting pool statistics of the database until
+// Close is called. Every database registers its own callback, so the pools
+// of several databases are reported side by side.
+func ObservePoolStats(db *pg.DB, opts ...PoolOption) (*PoolStatsObserver, error) {
+	var cfg poolConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.meterProvider == nil {
+		cfg.meterProvider = otel.GetMeterProvider()
+	}
+	if cfg.instance == "" {
+		cfg.instance = db.Options().Database
+	}
+	meter := cfg.meterProvider.Meter(instrumentationName,
+		metric.WithInstrumentationVersion(instrumentationVersion))
+
+	hits, err := meter.Int64ObservableCounter("go.sql.pool.hits",
+		metric.WithDescription("The number of times a free connection was found in the pool"))
+	if err != nil {
+		return nil, err
+	}
+	misses, err := meter.Int64ObservableCounter("go.sql.pool.misses",
+		metric.WithDescription("The number of times a free connection was not found in the pool"))
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := meter.Int64ObservableCounter("go.sql.pool.timeouts",
+		metric.WithDescription("The number of times a wait for a connection timed out"))
+	if err != nil {
+		return nil, err
+	}
+	total, err := meter.Int64ObservableGauge("go.sql.pool.total_conns",
+		metric.WithDescription("The number of connections in the pool"))
+	if err != nil {
+		return nil, err
+	}
+	idle, err := meter.Int64ObservableGauge("go.sql.pool.idle_conns",
+		metric.WithDescription("The number of idle connections in the pool"))
+	if err != nil {
+		return nil, err
+	}
+	stale, err := meter.Int64ObservableGauge("go.sql.pool.stale_conns",
+		metric.WithDescription("The number of stale connections removed from the pool"))
+	if err != nil {
+		return nil, err
+	}
+
+	labels := metric.WithAttributes(instanceKey.String(cfg.instance))
+	registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := db.PoolStats()
+		o.ObserveInt64(hits, int64(stats.Hits), labels)
+		o.ObserveInt64(misses, int64(stats.Misses), labels)
+		o.ObserveInt64(timeouts, int64(stats.Timeouts), labels)
+		o.ObserveInt64(total, int64(stats.TotalConns), labels)
+		o.ObserveInt64(idle, int64(stats.IdleConns), labels)
+		o.ObserveInt64(stale, int64(stats.StaleConns), labels)
+		return nil
+	}, hits, misses, timeouts, total, idle, stale)
+	if err != nil {
+		return nil, err
+	}
+	return &PoolStatsObserver{db: db, registration: registration}, nil
+}
+
+// Stats returns the current pool statistics.
+func (o *PoolStatsObserver) Stats() *pg.PoolStats {
+	return o.db.PoolStats()
+}
+
+// Close stops reporting the pool statistics of the database.
+func (o *PoolStatsObserver) Close() error {
+	return o.registration.Unregister()
+}
@@ -0,0 +1,46 @@
+package pgext
+
+import (
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestObservePoolStats(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	a, err := ObservePoolStats(testDB(t), WithMeterProvider(mp), WithInstance("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ObservePoolStats(testDB(t), WithMeterProvider(mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	instances := func() map[string]bool {
+		total, ok := collect(t, reader)["go.sql.pool.total_conns"].(metricdata.Gauge[int64])
+		if !ok {
+			t.Fatal("go.sql.pool.total_conns is not reported")
+		}
+		m := make(map[string]bool)
+		for _, dp := range total.DataPoints {
+			v, _ := dp.Attributes.Value(instanceKey)
+			m[v.AsString()] = true
+		}
+		return m
+	}
+
+	if got := instances(); !got["a"] || !got["orders"] {
+		t.Errorf("got instances %v, want a and orders", got)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := instances(); got["a"] || !got["orders"] {
+		t.Errorf("got instances %v after closing a, want orders", got)
+	}
+}
@@ -0,0 +1,111 @@
+package pgext
+
+import (
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Conventions selects the names of the attributes and metrics recorded by
+// OpenTelemetryHook. It is the migration path from pgext v1: the default
+// keeps the names of v1, ConventionsBoth records both names while dashboards
+// and alerts are moved, and ConventionsSemantic only records the
+// OpenTelemetry database semantic conventions.
+type Conventions int
+
+const (
+	// ConventionsV1 records the attributes, e.g. db.statement, and the
+	// go.sql.* metrics of pgext v1.
+	ConventionsV1 Conventions = iota
+	// ConventionsBoth records the names of pgext v1 and of the semantic
+	// conventions.
+	ConventionsBoth
+	// ConventionsSemantic records the semantic conventions, e.g. db.query.text
+	// and db.client.operation.duration.
+	ConventionsSemantic
+)
+
+func (c Conventions) v1() bool {
+	return c != ConventionsSemantic
+}
+
+func (c Conventions) semantic() bool {
+	return c != ConventionsV1
+}
+
+// semanticKeys maps the attributes of pgext v1 to the semantic conventions.
+// db.system and db.connection_string are converted by attributes. Other
+// attributes, e.g. db.rows_affected and those of ContextAttributes, have no
+// counterpart and are kept.
+var semanticKeys = map[attribute.Key]attribute.Key{
+	"db.statement":     "db.query.text",
+	"db.name":          "db.namespace",
+	"db.rows_returned": "db.response.returned_rows",
+	"db.error_class":   "error.type",
+	"frame.func":       "code.function.name",
+	"frame.file":       "code.file.path",
+	"frame.line":       "code.line.number",
+}
+
+var dbSystemName = attribute.String("db.system.name", "postgresql")
+
+// attributes returns the span attributes, built with the names of pgext v1,
+// in the conventions. db.user is dropped from the semantic conventions.
+func (c Conventions) attributes(kvs []attribute.KeyValue) []attribute.KeyValue {
+	if !c.semantic() {
+		return kvs
+	}
+
+	out := make([]attribute.KeyValue, 0, 2*len(kvs))
+	if c.v1() {
+		out = append(out, kvs...)
+	}
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "db.system":
+			out = append(out, dbSystemName)
+		case "db.connection_string":
+			out = append(out, serverAttributes(kv.Value.AsString())...)
+		case "db.user":
+		default:
+			if key, ok := semanticKeys[kv.Key]; ok {
+				out = append(out, attribute.KeyValue{Key: key, Value: kv.Value})
+			} else if !c.v1() {
+				out = append(out, kv)
+			}
+		}
+	}
+	return out
+}
+
+// serverAttributes returns server.address and server.port of the address
+// of the database, e.g. localhost:5432.
+func serverAttributes(addr string) []attribute.KeyValue {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []attribute.KeyValue{attribute.String("server.address", addr)}
+	}
+	attrs := []attribute.KeyValue{attribute.String("server.address", host)}
+	if n, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, attribute.Int("server.port", n))
+	}
+	return attrs
+}
+
+// semanticMetricAttributes returns the attributes of
+// db.client.operation.duration. error.type is only set for failed queries.
+func semanticMetricAttributes(method, database, table, class string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 5)
+	attrs = append(attrs, dbSystemName, attribute.String("db.operation.name", method))
+	if database != "" {
+		attrs = append(attrs, attribute.String("db.namespace", database))
+	}
+	if table != "" {
+		attrs = append(attrs, attribute.String("db.collection.name", table))
+	}
+	if class != "" && class != errorClassNoRows {
+		attrs = append(attrs, attribute.String("error.type", class))
+	}
+	return attrs
+}
@@ -0,0 +1,76 @@
+package pgext
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestConventionsAttributes(t *testing.T) {
+	kvs := []attribute.KeyValue{
+		attribute.String("db.system", "postgres"),
+		attribute.String("db.statement", "SELECT 1"),
+		attribute.String("db.connection_string", "db.local:5432"),
+		attribute.String("db.user", "app"),
+		attribute.Int("db.rows_affected", 1),
+		attribute.Int("frame.line", 42),
+		attribute.String("enduser.id", "42"),
+	}
+
+	tests := []struct {
+		conv Conventions
+		want []attribute.KeyValue
+	}{
+		{ConventionsV1, kvs},
+		{ConventionsSemantic, []attribute.KeyValue{
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.query.text", "SELECT 1"),
+			attribute.String("server.address", "db.local"),
+			attribute.Int("server.port", 5432),
+			attribute.Int("db.rows_affected", 1),
+			attribute.Int("code.line.number", 42),
+			attribute.String("enduser.id", "42"),
+		}},
+		{ConventionsBoth, append(append([]attribute.KeyValue(nil), kvs...),
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.query.text", "SELECT 1"),
+			attribute.String("server.address", "db.local"),
+			attribute.Int("server.port", 5432),
+			attribute.Int("code.line.number", 42),
+		)},
+	}
+
+	for _, test := range tests {
+		got := test.conv.attributes(kvs)
+		if len(got) != len(test.want) {
+			t.Errorf("conventions %d: got %v, want %v", test.conv, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("conventions %d: got %v, want %v", test.conv, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSemanticMetricAttributes(t *testing.T) {
+	attrs := attribute.NewSet(semanticMetricAttributes("SELECT", "orders", "book", errorClassServer)...)
+	for key, want := range map[attribute.Key]string{
+		"db.system.name":     "postgresql",
+		"db.operation.name":  "SELECT",
+		"db.namespace":       "orders",
+		"db.collection.name": "book",
+		"error.type":         "server",
+	} {
+		if v, _ := attrs.Value(key); v.AsString() != want {
+			t.Errorf("got %s=%q, want %q", key, v.AsString(), want)
+		}
+	}
+
+	attrs = attribute.NewSet(semanticMetricAttributes("SELECT", "orders", "", errorClassNoRows)...)
+	if _, ok := attrs.Value("error.type"); ok {
+		t.Error("got error.type for pg.ErrNoRows, want none")
+	}
+}
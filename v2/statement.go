@@ -0,0 +1,158 @@
+package pgext
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// StatementCapture controls how the query is recorded in the db.statement
+// attribute.
+type StatementCapture int
+
+const (
+	// StatementCaptureFull records the formatted query with its parameters.
+	StatementCaptureFull StatementCapture = iota
+	// StatementCaptureNormalized records the query with literals replaced by '?'.
+	StatementCaptureNormalized
+	// StatementCaptureNone does not record the query.
+	StatementCaptureNone
+)
+
+// record returns the query as recorded in db.statement, or false if the
+// query is not recorded.
+func (c StatementCapture) record(query string) (string, bool) {
+	switch c {
+	case StatementCaptureFull:
+		return query, true
+	case StatementCaptureNormalized:
+		return normalizeQuery(query), true
+	}
+	return "", false
+}
+
+var inListRe = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+
+// normalizeQuery returns the shape of the query: literals and placeholders
+// are replaced with '?', comments are dropped, whitespace is collapsed and
+// lists of values are folded into a single '(?)'.
+func normalizeQuery(query string) string {
+	q := replaceLiterals(query, func(string) string { return "?" })
+	return inListRe.ReplaceAllString(q, "(?)")
+}
+
+// replaceLiterals drops comments, collapses whitespace and replaces string
+// and numeric literals and placeholders with the result of replace.
+func replaceLiterals(query string, replace func(lit string) string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case isSpace(c):
+			space = true
+			continue
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+			space = true
+			continue
+		}
+
+		if space {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+		}
+
+		start := i
+		switch {
+		case c == '\'':
+			i = skipQuoted(query, i, '\'')
+			b.WriteString(replace(query[start : i+1]))
+		case c == '"':
+			end := skipQuoted(query, i, '"')
+			b.WriteString(query[i : end+1])
+			i = end
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			b.WriteString(replace(query[start : i+1]))
+		case isDigit(c) && !prevIsIdent(query, i):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteString(replace(query[start : i+1]))
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// skipQuoted returns the index of the closing quote for the quoted section
+// starting at i. Doubled quotes are treated as escapes.
+func skipQuoted(s string, i int, quote byte) int {
+	for i++; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(s) - 1
+}
+
+func prevIsIdent(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	c := s[i-1]
+	return c == '_' || isDigit(c) || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// truncate returns s limited to n bytes without splitting a multi-byte
+// character. Invalid UTF-8 sequences are replaced, so the result is always
+// valid UTF-8. A negative n yields an empty string.
+func truncate(s string, n int) string {
+	if n < 0 {
+		n = 0
+	}
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "\uFFFD")
+	}
+	if len(s) > n {
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	return s
+}
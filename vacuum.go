@@ -0,0 +1,161 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+type vacuumStats struct {
+	Schema          string
+	Table           string
+	LiveTuples      int64
+	DeadTuples      int64
+	BloatBytes      int64
+	LastAutovacuum  *time.Time
+	LastAutoanalyze *time.Time
+}
+
+// VacuumCollector periodically reads pg_stat_user_tables and reports vacuum
+// debt per table: live and dead tuples, the time since the last autovacuum
+// and autoanalyze and the estimated bloat, i.e. the share of the table size
+// taken by dead tuples. The metrics are labeled by instance, schema and
+// table:
+//
+//   c := &pgext.VacuumCollector{DB: db}
+//   c.Start()
+//   defer c.Shutdown(ctx)
+type VacuumCollector struct {
+	// DB is the database the tables are in.
+	DB *pg.DB
+	// Tables lists the tables to report, optionally qualified by schema.
+	// Defaults to all user tables.
+	Tables []string
+	// Instance is the sql.instance label. Defaults to the database name.
+	Instance string
+	// Interval is the time between samples. Defaults to 1m.
+	Interval time.Duration
+	// Logger is used to print sampling errors. Defaults to the standard logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the sampled values against threshold rules.
+	Alerter *Alerter
+
+	poller poller
+	mu     sync.Mutex
+	stats  []vacuumStats
+}
+
+var _ Shutdowner = (*VacuumCollector)(nil)
+
+type vacuumInstruments struct {
+	live, dead, bloat, vacuumAge, analyzeAge metric.Int64ValueObserver
+}
+
+// Start starts sampling in the background and reporting the metrics.
+func (c *VacuumCollector) Start() {
+	if !c.poller.start(c.Interval, c.collect) {
+		return
+	}
+
+	c.poller.onShutdown(observeBatch("go.sql.table.live_tuples",
+		func(batch metric.BatchObserver) interface{} {
+			var i vacuumInstruments
+			i.live, _ = batch.NewInt64ValueObserver("go.sql.table.live_tuples",
+				metric.WithDescription("The estimated number of live rows"))
+			i.dead, _ = batch.NewInt64ValueObserver("go.sql.table.dead_tuples",
+				metric.WithDescription("The estimated number of dead rows"))
+			i.bloat, _ = batch.NewInt64ValueObserver("go.sql.table.bloat_bytes",
+				metric.WithDescription("The estimated size of dead rows in bytes"))
+			i.vacuumAge, _ = batch.NewInt64ValueObserver("go.sql.table.autovacuum_age",
+				metric.WithDescription("The time since the last autovacuum in seconds"))
+			i.analyzeAge, _ = batch.NewInt64ValueObserver("go.sql.table.autoanalyze_age",
+				metric.WithDescription("The time since the last autoanalyze in seconds"))
+			return &i
+		},
+		func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			i := instruments.(*vacuumInstruments)
+			c.mu.Lock()
+			stats := c.stats
+			c.mu.Unlock()
+
+			instance := instanceName(c.DB, c.Instance)
+			now := time.Now()
+			for _, s := range stats {
+				labels := tableLabels(instance, s.Schema, s.Table)
+				result.Observe(labels,
+					i.live.Observation(s.LiveTuples),
+					i.dead.Observation(s.DeadTuples),
+					i.bloat.Observation(s.BloatBytes),
+				)
+				if s.LastAutovacuum != nil {
+					result.Observe(labels, i.vacuumAge.Observation(int64(now.Sub(*s.LastAutovacuum).Seconds())))
+				}
+				if s.LastAutoanalyze != nil {
+					result.Observe(labels, i.analyzeAge.Observation(int64(now.Sub(*s.LastAutoanalyze).Seconds())))
+				}
+			}
+		}))
+}
+
+// Shutdown stops sampling and reporting the metrics.
+func (c *VacuumCollector) Shutdown(ctx context.Context) error {
+	return c.poller.shutdown(ctx)
+}
+
+func (c *VacuumCollector) collect(ctx context.Context) {
+	query := `
+		SELECT schemaname AS schema,
+			relname AS "table",
+			n_live_tup AS live_tuples,
+			n_dead_tup AS dead_tuples,
+			CASE WHEN n_live_tup + n_dead_tup > 0
+				THEN (pg_relation_size(relid) * n_dead_tup / (n_live_tup + n_dead_tup))::bigint
+				ELSE 0
+			END AS bloat_bytes,
+			last_autovacuum,
+			last_autoanalyze
+		FROM pg_stat_user_tables`
+	var params []interface{}
+	if len(c.Tables) > 0 {
+		query += `
+		WHERE relid IN (SELECT to_regclass(t) FROM unnest(ARRAY[?]::text[]) AS t)`
+		params = append(params, pg.In(c.Tables))
+	}
+
+	var stats []vacuumStats
+	if _, err := c.DB.QueryContext(ctx, &stats, query, params...); err != nil {
+		if ctx.Err() == nil {
+			logf(c.Logger, "pgext: sampling vacuum statistics failed: %s", err)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	c.stats = stats
+	c.mu.Unlock()
+
+	instance := instanceName(c.DB, c.Instance)
+	now := time.Now()
+	samples := make([]sample, 0, 5*len(stats))
+	for _, s := range stats {
+		labels := tableLabels(instance, s.Schema, s.Table)
+		samples = append(samples,
+			sample{"go.sql.table.live_tuples", labels, float64(s.LiveTuples)},
+			sample{"go.sql.table.dead_tuples", labels, float64(s.DeadTuples)},
+			sample{"go.sql.table.bloat_bytes", labels, float64(s.BloatBytes)},
+		)
+		if s.LastAutovacuum != nil {
+			samples = append(samples,
+				sample{"go.sql.table.autovacuum_age", labels, now.Sub(*s.LastAutovacuum).Seconds()})
+		}
+		if s.LastAutoanalyze != nil {
+			samples = append(samples,
+				sample{"go.sql.table.autoanalyze_age", labels, now.Sub(*s.LastAutoanalyze).Seconds()})
+		}
+	}
+	c.Alerter.check(ctx, samples)
+}
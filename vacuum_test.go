@@ -0,0 +1,71 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestVacuumCollector(t *testing.T) {
+	var queries []string
+	db := fakeDB(t, func(query string) fakeResult {
+		queries = append(queries, query)
+		return fakeResult{
+			Columns: []string{"schema", "table", "live_tuples", "dead_tuples", "bloat_bytes", "last_autovacuum", "last_autoanalyze"},
+			Rows: [][]string{
+				{"public", "users", "90", "10", "8192", "2020-01-01 00:00:00+00", fakeNull},
+				{"public", "books", "100", "0", "0", fakeNull, fakeNull},
+			},
+		}
+	})
+
+	var alerts []Alert
+	c := &VacuumCollector{
+		DB:     db,
+		Tables: []string{"users", "public.books"},
+		Alerter: &Alerter{
+			Rules: []AlertRule{
+				{Name: "dead tuples", Metric: "go.sql.table.dead_tuples", Threshold: 5},
+				{Name: "autoanalyze", Metric: "go.sql.table.autoanalyze_age", Threshold: 0},
+			},
+			Notify: func(_ context.Context, alert Alert) {
+				alerts = append(alerts, alert)
+			},
+		},
+	}
+	c.collect(context.Background())
+
+	if len(queries) != 1 || !strings.Contains(queries[0], `ARRAY['users','public.books']`) {
+		t.Errorf("got queries %q, want the tables filtered", queries)
+	}
+	if len(c.stats) != 2 || c.stats[0].LastAutovacuum == nil || c.stats[0].LastAutoanalyze != nil {
+		t.Errorf("got stats %+v", c.stats)
+	}
+	if len(alerts) != 1 || alerts[0].Rule.Name != "dead tuples" ||
+		alerts[0].Labels["sql.schema"] != "public" || alerts[0].Labels["sql.table"] != "users" || alerts[0].Value != 10 {
+		t.Errorf("got alerts %+v, want the dead tuples of users", alerts)
+	}
+}
+
+func TestVacuumCollectorMetrics(t *testing.T) {
+	db := fakeDB(t, func(string) fakeResult {
+		return fakeResult{
+			Columns: []string{"schema", "table", "live_tuples", "dead_tuples", "bloat_bytes", "last_autovacuum", "last_autoanalyze"},
+			Rows: [][]string{
+				{"public", "events", "90", "10", "8192", fakeNull, fakeNull},
+				{"audit", "events", "100", "0", "0", fakeNull, fakeNull},
+			},
+		}
+	})
+
+	testCollectorMetrics(t, "go.sql.table.dead_tuples", map[string]string{"sql.schema": "public", "sql.table": "events"},
+		func(instance string) (Shutdowner, func() bool) {
+			c := &VacuumCollector{DB: db, Instance: instance}
+			c.Start()
+			return c, func() bool {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return c.stats != nil
+			}
+		})
+}
@@ -0,0 +1,10 @@
+module github.com/j2gg0s/pgext/vaultcreds
+
+go 1.16
+
+require (
+	github.com/hashicorp/vault/api v1.0.4
+	github.com/j2gg0s/pgext v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/j2gg0s/pgext => ../
@@ -0,0 +1,56 @@
+// Package vaultcreds issues database credentials from the HashiCorp Vault
+// database secrets engine for pgext.CredentialRotator.
+package vaultcreds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/j2gg0s/pgext"
+)
+
+// Provider reads dynamic credentials from a Vault role, e.g.
+// database/creds/orders. Every call creates a new lease; the credentials
+// expire with the lease.
+//
+//   r := &pgext.CredentialRotator{Provider: &vaultcreds.Provider{
+//       Client: client,
+//       Path:   "database/creds/orders",
+//   }}
+type Provider struct {
+	Client *api.Client
+	Path   string
+}
+
+var _ pgext.CredentialsProvider = (*Provider)(nil)
+
+// Credentials reads new credentials from Vault.
+func (p *Provider) Credentials(ctx context.Context) (*pgext.Credentials, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	secret, err := p.Client.Logical().Read(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("vaultcreds: reading %s failed: %w", p.Path, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("vaultcreds: no secret at %s", p.Path)
+	}
+
+	user, _ := secret.Data["username"].(string)
+	password, _ := secret.Data["password"].(string)
+	if user == "" || password == "" {
+		return nil, errors.New("vaultcreds: secret has no username or password")
+	}
+
+	creds := &pgext.Credentials{User: user, Password: password}
+	if secret.LeaseDuration > 0 {
+		creds.Expiry = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+	}
+	return creds, nil
+}
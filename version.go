@@ -0,0 +1,62 @@
+package pgext
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+// ErrVersionConflict is returned by UpdateVersioned when the row was changed
+// concurrently.
+var ErrVersionConflict = errors.New("pgext: version conflict")
+
+var versionConflictCounter, _ = meter.NewInt64Counter(
+	"go.sql.version_conflicts",
+	metric.WithDescription("The number of optimistic locking conflicts"),
+)
+
+// Versioned is a model with a version column for optimistic locking.
+type Versioned interface {
+	// Version returns the version the model was loaded with.
+	Version() int64
+	// SetVersion is called with the new version after a successful update.
+	SetVersion(int64)
+}
+
+// UpdateVersioned updates the model by its primary key only if the version
+// column still has the version the model was loaded with and increments it.
+// Otherwise it returns ErrVersionConflict and counts the conflict in
+// go.sql.version_conflicts:
+//
+//   err := pgext.UpdateVersioned(ctx, db, book, "version")
+//   if errors.Is(err, pgext.ErrVersionConflict) {
+//       // reload and retry
+//   }
+func UpdateVersioned(ctx context.Context, db orm.DB, model Versioned, column string) error {
+	version := model.Version()
+
+	q := db.ModelContext(ctx, model)
+	res, err := q.
+		WherePK().
+		Where("? = ?", pg.Ident(column), version).
+		Value(column, "?", version+1).
+		Update()
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		var table string
+		if tm := q.TableModel(); tm != nil {
+			table = tm.Table().ModelName
+		}
+		versionConflictCounter.Add(ctx, 1, tableKey.String(table))
+		return ErrVersionConflict
+	}
+
+	model.SetVersion(version + 1)
+	return nil
+}
@@ -0,0 +1,204 @@
+package pgext
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	slotKey    = label.Key("sql.slot")
+	replicaKey = label.Key("sql.replica")
+)
+
+type replicationSlot struct {
+	Name          string
+	Type          string
+	Active        bool
+	RetainedBytes int64
+}
+
+type replicaLag struct {
+	Name       string
+	LagBytes   int64
+	LagSeconds float64
+}
+
+type walStats struct {
+	bytes    *int64
+	slots    []replicationSlot
+	replicas []replicaLag
+}
+
+// WALCollector periodically reports the WAL written by the primary, the WAL
+// retained by every replication slot and the replay lag of every replica in
+// bytes, so services using logical decoding notice slot bloat before the
+// disk fills. Replay lag in seconds needs PostgreSQL 10 or later. It reports
+// nothing when connected to a standby. The metrics are labeled by instance:
+//
+//   c := &pgext.WALCollector{DB: db}
+//   c.Start()
+//   defer c.Shutdown(ctx)
+type WALCollector struct {
+	// DB is the primary.
+	DB *pg.DB
+	// Instance is the sql.instance label. Defaults to the database name.
+	Instance string
+	// Interval is the time between samples. Defaults to 1m.
+	Interval time.Duration
+	// Logger is used to print sampling errors. Defaults to the standard logger.
+	Logger *log.Logger
+	// Alerter, if set, checks the sampled values against threshold rules.
+	Alerter *Alerter
+
+	poller poller
+	mu     sync.Mutex
+	stats  walStats
+}
+
+var _ Shutdowner = (*WALCollector)(nil)
+
+type walInstruments struct {
+	written       metric.Int64SumObserver
+	retained, lag metric.Int64ValueObserver
+	lagSeconds    metric.Float64ValueObserver
+}
+
+// Start starts sampling in the background and reporting the metrics.
+func (c *WALCollector) Start() {
+	if !c.poller.start(c.Interval, c.collect) {
+		return
+	}
+
+	c.poller.onShutdown(observeBatch("go.sql.wal.bytes",
+		func(batch metric.BatchObserver) interface{} {
+			var i walInstruments
+			i.written, _ = batch.NewInt64SumObserver("go.sql.wal.bytes",
+				metric.WithDescription("The amount of WAL written in bytes"))
+			i.retained, _ = batch.NewInt64ValueObserver("go.sql.replication.slot_retained_bytes",
+				metric.WithDescription("The amount of WAL retained by the replication slot in bytes"))
+			i.lag, _ = batch.NewInt64ValueObserver("go.sql.replication.lag_bytes",
+				metric.WithDescription("The amount of WAL not yet replayed by the replica in bytes"))
+			i.lagSeconds, _ = batch.NewFloat64ValueObserver("go.sql.replication.lag_seconds",
+				metric.WithDescription("The time since the replica last replayed WAL the primary flushed in seconds"))
+			return &i
+		},
+		func(ctx context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			i := instruments.(*walInstruments)
+			c.mu.Lock()
+			stats := c.stats
+			c.mu.Unlock()
+
+			instance := instanceKey.String(instanceName(c.DB, c.Instance))
+			if stats.bytes != nil {
+				result.Observe([]label.KeyValue{instance}, i.written.Observation(*stats.bytes))
+			}
+			for _, s := range stats.slots {
+				result.Observe([]label.KeyValue{
+					instance,
+					slotKey.String(s.Name),
+					label.String("sql.slot_type", s.Type),
+					label.Bool("sql.slot_active", s.Active),
+				}, i.retained.Observation(s.RetainedBytes))
+			}
+			for _, r := range stats.replicas {
+				result.Observe([]label.KeyValue{instance, replicaKey.String(r.Name)},
+					i.lag.Observation(r.LagBytes),
+					i.lagSeconds.Observation(r.LagSeconds),
+				)
+			}
+		}))
+}
+
+// Shutdown stops sampling and reporting the metrics.
+func (c *WALCollector) Shutdown(ctx context.Context) error {
+	return c.poller.shutdown(ctx)
+}
+
+func (c *WALCollector) collect(ctx context.Context) {
+	var stats walStats
+
+	var standby bool
+	if _, err := c.DB.QueryOneContext(ctx, pg.Scan(&standby), `SELECT pg_is_in_recovery()`); err != nil {
+		c.failed(ctx, err)
+		return
+	}
+
+	version := ServerVersion(c.DB)
+	if version == 0 {
+		var err error
+		if version, err = DetectServerVersion(ctx, c.DB); err != nil {
+			c.failed(ctx, err)
+			return
+		}
+	}
+	// WAL was called xlog before PostgreSQL 10. The names are spliced into
+	// the queries because go-pg does not format a placeholder followed by
+	// a parenthesis.
+	diff, current, replay, lag := "pg_wal_lsn_diff", "pg_current_wal_lsn()", "replay_lsn", "replay_lag"
+	if version < 100000 {
+		diff, current, replay, lag = "pg_xlog_location_diff", "pg_current_xlog_location()", "replay_location", "NULL::interval"
+	}
+
+	if !standby {
+		var bytes int64
+		if _, err := c.DB.QueryOneContext(ctx, pg.Scan(&bytes),
+			`SELECT `+diff+`(`+current+`, '0/0')::bigint`); err != nil {
+			c.failed(ctx, err)
+			return
+		}
+		stats.bytes = &bytes
+
+		if _, err := c.DB.QueryContext(ctx, &stats.slots, `
+			SELECT slot_name AS name,
+				slot_type AS type,
+				active,
+				coalesce(`+diff+`(`+current+`, restart_lsn), 0)::bigint AS retained_bytes
+			FROM pg_replication_slots`); err != nil {
+			c.failed(ctx, err)
+			return
+		}
+
+		if _, err := c.DB.QueryContext(ctx, &stats.replicas, `
+			SELECT coalesce(nullif(application_name, ''), host(client_addr), pid::text) AS name,
+				coalesce(`+diff+`(`+current+`, `+replay+`), 0)::bigint AS lag_bytes,
+				coalesce(extract(epoch FROM `+lag+`), 0) AS lag_seconds
+			FROM pg_stat_replication`); err != nil {
+			c.failed(ctx, err)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	c.stats = stats
+	c.mu.Unlock()
+
+	instance := instanceKey.String(instanceName(c.DB, c.Instance))
+	var samples []sample
+	if stats.bytes != nil {
+		samples = append(samples, sample{"go.sql.wal.bytes", []label.KeyValue{instance}, float64(*stats.bytes)})
+	}
+	for _, s := range stats.slots {
+		samples = append(samples, sample{"go.sql.replication.slot_retained_bytes",
+			[]label.KeyValue{instance, slotKey.String(s.Name)}, float64(s.RetainedBytes)})
+	}
+	for _, r := range stats.replicas {
+		labels := []label.KeyValue{instance, replicaKey.String(r.Name)}
+		samples = append(samples,
+			sample{"go.sql.replication.lag_bytes", labels, float64(r.LagBytes)},
+			sample{"go.sql.replication.lag_seconds", labels, r.LagSeconds},
+		)
+	}
+	c.Alerter.check(ctx, samples)
+}
+
+func (c *WALCollector) failed(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		logf(c.Logger, "pgext: sampling WAL statistics failed: %s", err)
+	}
+}
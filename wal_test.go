@@ -0,0 +1,117 @@
+package pgext
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWALCollector(t *testing.T) {
+	tests := []struct {
+		version string
+		standby bool
+		diff    string
+	}{
+		{"130004", false, "pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0')"},
+		{"90624", false, "pg_xlog_location_diff(pg_current_xlog_location(), '0/0')"},
+		{"130004", true, ""},
+	}
+
+	for _, test := range tests {
+		var (
+			mu      sync.Mutex
+			queries []string
+		)
+		db := fakeDB(t, func(query string) fakeResult {
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+
+			switch {
+			case strings.Contains(query, "pg_is_in_recovery()"):
+				standby := "f"
+				if test.standby {
+					standby = "t"
+				}
+				return fakeResult{Columns: []string{"standby"}, Rows: [][]string{{standby}}}
+			case strings.Contains(query, "server_version_num"):
+				return fakeResult{Columns: []string{"version"}, Rows: [][]string{{test.version}}}
+			case strings.Contains(query, "pg_replication_slots"):
+				return fakeResult{
+					Columns: []string{"name", "type", "active", "retained_bytes"},
+					Rows:    [][]string{{"debezium", "logical", "f", "1073741824"}},
+				}
+			case strings.Contains(query, "pg_stat_replication"):
+				return fakeResult{
+					Columns: []string{"name", "lag_bytes", "lag_seconds"},
+					Rows:    [][]string{{"replica1", "4096", "42.5"}},
+				}
+			}
+			return fakeResult{Columns: []string{"bytes"}, Rows: [][]string{{"65536"}}}
+		})
+
+		var alerts []Alert
+		c := &WALCollector{
+			DB: db,
+			Alerter: &Alerter{
+				Rules: []AlertRule{{Name: "lag", Metric: "go.sql.replication.lag_seconds", Threshold: 30}},
+				Notify: func(_ context.Context, alert Alert) {
+					alerts = append(alerts, alert)
+				},
+			},
+		}
+		c.collect(context.Background())
+
+		if test.standby {
+			if c.stats.bytes != nil || len(c.stats.slots) > 0 || len(alerts) > 0 {
+				t.Errorf("standby: got stats %+v and alerts %+v, want none", c.stats, alerts)
+			}
+			continue
+		}
+
+		if !strings.Contains(strings.Join(queries, "\n"), test.diff) {
+			t.Errorf("%s: got queries %q, want %s", test.version, queries, test.diff)
+		}
+		if c.stats.bytes == nil || *c.stats.bytes != 65536 {
+			t.Errorf("%s: got WAL bytes %v, want 65536", test.version, c.stats.bytes)
+		}
+		if len(c.stats.slots) != 1 || c.stats.slots[0].RetainedBytes != 1<<30 {
+			t.Errorf("%s: got slots %+v", test.version, c.stats.slots)
+		}
+		if len(alerts) != 1 || alerts[0].Labels["sql.replica"] != "replica1" || alerts[0].Value != 42.5 {
+			t.Errorf("%s: got alerts %+v, want the lag of replica1", test.version, alerts)
+		}
+	}
+}
+
+func TestWALCollectorMetrics(t *testing.T) {
+	db := fakeDB(t, func(query string) fakeResult {
+		switch {
+		case strings.Contains(query, "pg_is_in_recovery()"):
+			return fakeResult{Columns: []string{"standby"}, Rows: [][]string{{"f"}}}
+		case strings.Contains(query, "server_version_num"):
+			return fakeResult{Columns: []string{"version"}, Rows: [][]string{{"130004"}}}
+		case strings.Contains(query, "pg_replication_slots"):
+			return fakeResult{Columns: []string{"name", "type", "active", "retained_bytes"}}
+		case strings.Contains(query, "pg_stat_replication"):
+			return fakeResult{
+				Columns: []string{"name", "lag_bytes", "lag_seconds"},
+				Rows:    [][]string{{"replica1", "4096", "42.5"}},
+			}
+		}
+		return fakeResult{Columns: []string{"bytes"}, Rows: [][]string{{"65536"}}}
+	})
+	defer servers.Delete(db.Options().Addr)
+
+	testCollectorMetrics(t, "go.sql.replication.lag_bytes", map[string]string{"sql.replica": "replica1"},
+		func(instance string) (Shutdowner, func() bool) {
+			c := &WALCollector{DB: db, Instance: instance}
+			c.Start()
+			return c, func() bool {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return c.stats.bytes != nil
+			}
+		})
+}
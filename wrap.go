@@ -0,0 +1,497 @@
+package pgext
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+type wrapConfig struct {
+	tracing   bool
+	metrics   bool
+	caller    bool
+	poolStats bool
+	slowQuery time.Duration
+	instance  string
+	logger    *log.Logger
+
+	contextAttrs  map[label.Key]func(context.Context) string
+	contextLabels []label.Key
+	baggageKeys   []label.Key
+	costTags      CostTags
+	tenant        func(context.Context) string
+	owners        map[string]string
+	sourceURL     string
+	requestID     func(context.Context) string
+	decorator     func(trace.Span, *pg.QueryEvent)
+	metricQueue   *MetricQueue
+	metricSample  float64
+	scopeName     string
+	scopeVersion  string
+	metricPrefix  string
+	metricName    func(string) string
+	percentiles   time.Duration
+	serverVersion bool
+}
+
+// Option configures Wrap and NewOpenTelemetryHook.
+type Option func(*wrapConfig)
+
+// WithTracing enables query spans. Enabled by default.
+func WithTracing(enabled bool) Option {
+	return func(c *wrapConfig) {
+		c.tracing = enabled
+	}
+}
+
+// WithMetrics enables latency metrics. Enabled by default.
+func WithMetrics(enabled bool) Option {
+	return func(c *wrapConfig) {
+		c.metrics = enabled
+	}
+}
+
+// WithCaller adds the caller to query spans. Disabled by default.
+func WithCaller(enabled bool) Option {
+	return func(c *wrapConfig) {
+		c.caller = enabled
+	}
+}
+
+// WithSourceURL links the callers of the main module on query spans using
+// the template, e.g. https://github.com/acme/shop/blob/v1.2.0/{file}#L{line}.
+// It implies WithCaller(true).
+func WithSourceURL(template string) Option {
+	return func(c *wrapConfig) {
+		c.caller = true
+		c.sourceURL = template
+	}
+}
+
+// WithPoolStats enables connection pool metrics. Enabled by default.
+func WithPoolStats(enabled bool) Option {
+	return func(c *wrapConfig) {
+		c.poolStats = enabled
+	}
+}
+
+// WithSlowQueryThreshold sets the duration after which queries are logged
+// as slow. Zero disables slow query logging. Defaults to 1s.
+func WithSlowQueryThreshold(d time.Duration) Option {
+	return func(c *wrapConfig) {
+		c.slowQuery = d
+	}
+}
+
+// WithInstance sets the sql.instance metric label. Defaults to the database name.
+func WithInstance(instance string) Option {
+	return func(c *wrapConfig) {
+		c.instance = instance
+	}
+}
+
+// WithLogger sets the logger for slow queries. Defaults to the standard logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *wrapConfig) {
+		c.logger = logger
+	}
+}
+
+// WithContextAttributes stamps values extracted from the query context on
+// every query span, e.g. the user ID or route:
+//
+//   pgext.WithContextAttributes(map[label.Key]func(context.Context) string{
+//       "http.route": routeFromContext,
+//   })
+func WithContextAttributes(attrs map[label.Key]func(context.Context) string) Option {
+	return func(c *wrapConfig) {
+		if c.contextAttrs == nil {
+			c.contextAttrs = make(map[label.Key]func(context.Context) string, len(attrs))
+		}
+		for k, fn := range attrs {
+			c.contextAttrs[k] = fn
+		}
+	}
+}
+
+// WithContextMetricLabels adds the context attributes with the keys to
+// metrics as well. Keep their cardinality low.
+func WithContextMetricLabels(keys ...label.Key) Option {
+	return func(c *wrapConfig) {
+		c.contextLabels = append(c.contextLabels, keys...)
+	}
+}
+
+// WithBaggageKeys copies the baggage entries with the keys to query spans.
+func WithBaggageKeys(keys ...label.Key) Option {
+	return func(c *wrapConfig) {
+		c.baggageKeys = append(c.baggageKeys, keys...)
+	}
+}
+
+// WithDefaultCostTags sets the default cost attribution tags, e.g. the
+// service name. Tags set on the context with WithCostTags take precedence.
+func WithDefaultCostTags(tags CostTags) Option {
+	return func(c *wrapConfig) {
+		c.costTags = tags
+	}
+}
+
+// WithTenant adds the tenant extracted from the query context as the
+// sql.tenant label, limited to 100 distinct values.
+func WithTenant(fn func(context.Context) string) Option {
+	return func(c *wrapConfig) {
+		c.tenant = fn
+	}
+}
+
+// WithRequestIDExtractor stamps the request ID extracted by fn, e.g.
+// RequestIDFromContext, on query spans and slow query logs.
+func WithRequestIDExtractor(fn func(context.Context) string) Option {
+	return func(c *wrapConfig) {
+		c.requestID = fn
+	}
+}
+
+// WithSpanDecorator sets a callback that can modify every query span just
+// before it ends.
+func WithSpanDecorator(fn func(span trace.Span, evt *pg.QueryEvent)) Option {
+	return func(c *wrapConfig) {
+		c.decorator = fn
+	}
+}
+
+// WithAsyncMetrics records query metrics in the background through
+// a MetricQueue holding up to size measurements. The queue is flushed by
+// Handle.Shutdown.
+func WithAsyncMetrics(size int) Option {
+	return func(c *wrapConfig) {
+		c.metricQueue = &MetricQueue{Size: size}
+	}
+}
+
+// WithMetricSampling records the latency of only a fraction of the queries,
+// e.g. 0.01 for 1%. Counters such as slow queries stay exact.
+func WithMetricSampling(rate float64) Option {
+	return func(c *wrapConfig) {
+		c.metricSample = rate
+	}
+}
+
+// WithInstrumentationScope sets the instrumentation name and version of the
+// query spans and metrics, e.g. for a company library wrapping pgext. An
+// empty version defaults to the version of pgext.
+func WithInstrumentationScope(name, version string) Option {
+	return func(c *wrapConfig) {
+		c.scopeName, c.scopeVersion = name, version
+	}
+}
+
+// WithMetricPrefix replaces the go.sql prefix of the query metrics and of
+// the pool and latency percentile metrics of Wrap, e.g. myapp.db reports
+// go.sql.latency as myapp.db.latency.
+func WithMetricPrefix(prefix string) Option {
+	return func(c *wrapConfig) {
+		c.metricPrefix = prefix
+	}
+}
+
+// WithMetricName renames the metrics WithMetricPrefix applies to. fn is
+// called with the name after WithMetricPrefix is applied.
+func WithMetricName(fn func(name string) string) Option {
+	return func(c *wrapConfig) {
+		c.metricName = fn
+	}
+}
+
+// WithOwners maps prefixes of the package paths or files of the code issuing
+// queries to their owners, added as the sql.owner attribute and metric label.
+func WithOwners(owners map[string]string) Option {
+	return func(c *wrapConfig) {
+		c.owners = owners
+	}
+}
+
+// WithLatencyPercentiles estimates the p50, p95 and p99 latency over
+// a sliding window of the duration, e.g. time.Minute. They are included in
+// Snapshot and reported as the go.sql.latency.percentile gauge. Disabled by
+// default.
+func WithLatencyPercentiles(window time.Duration) Option {
+	return func(c *wrapConfig) {
+		c.percentiles = window
+	}
+}
+
+// WithServerVersion detects the server version in the background, retrying
+// with backoff until it succeeds or the handle is closed. Query spans and
+// metrics are labeled with it once detected and ServerVersion returns it.
+// The detection query is not instrumented. Disabled by default.
+func WithServerVersion(enabled bool) Option {
+	return func(c *wrapConfig) {
+		c.serverVersion = enabled
+	}
+}
+
+// Snapshot is a point-in-time view of the queries executed since Wrap.
+type Snapshot struct {
+	Queries     int64
+	Errors      int64
+	SlowQueries int64
+	Pool        pg.PoolStats
+	// Latency is only set with WithLatencyPercentiles.
+	Latency LatencyPercentiles
+}
+
+// Handle controls the instrumentation installed by Wrap.
+type Handle struct {
+	// Counters are first to be 64-bit aligned for atomic access.
+	queries     int64
+	errors      int64
+	slowQueries int64
+
+	// Hook is the installed OpenTelemetryHook. It can be used to change
+	// settings at runtime.
+	Hook *OpenTelemetryHook
+
+	db      *pg.DB
+	slow    *SlowQueryHook
+	pool    *PoolStatsObserver
+	latency *LatencyWindow
+	closed  int32
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// unobserveLatency stops reporting the latency percentiles.
+	unobserveLatency func()
+
+	mu       sync.Mutex
+	attached []Shutdowner
+}
+
+var _ Shutdowner = (*Handle)(nil)
+
+// Wrap installs a curated set of hooks on the database: tracing, latency
+// metrics, slow query logging and pool statistics, with sane defaults.
+//
+//   h := pgext.Wrap(db, pgext.WithSlowQueryThreshold(500*time.Millisecond))
+//   defer h.Close()
+func Wrap(db *pg.DB, opts ...Option) *Handle {
+	cfg := newWrapConfig(opts)
+	h := &Handle{
+		db:   db,
+		done: make(chan struct{}),
+		Hook: newOpenTelemetryHook(cfg),
+	}
+	if cfg.metricQueue != nil {
+		h.attached = append(h.attached, cfg.metricQueue)
+	}
+	if cfg.slowQuery > 0 {
+		h.slow = &SlowQueryHook{Threshold: cfg.slowQuery, Logger: cfg.logger, RequestID: cfg.requestID}
+	}
+
+	db.AddQueryHook(h.Hook)
+	db.AddQueryHook(handleHook{h})
+
+	if cfg.poolStats {
+		h.pool = observePoolStats(db, cfg.instance, h.Hook.metricName)
+	}
+	if cfg.percentiles > 0 {
+		h.latency = &LatencyWindow{Window: cfg.percentiles}
+		h.observeLatency()
+	}
+	if cfg.serverVersion {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			detectServerVersion(db, h.done)
+		}()
+	}
+
+	return h
+}
+
+// NewOpenTelemetryHook returns an OpenTelemetryHook configured by the same
+// options and with the same defaults as Wrap, for databases whose hooks are
+// installed by hand. Options of the Handle, e.g. WithPoolStats, are ignored.
+//
+//   db.AddQueryHook(pgext.NewOpenTelemetryHook(pgext.WithCaller(true)))
+func NewOpenTelemetryHook(opts ...Option) *OpenTelemetryHook {
+	return newOpenTelemetryHook(newWrapConfig(opts))
+}
+
+func newWrapConfig(opts []Option) *wrapConfig {
+	cfg := &wrapConfig{
+		tracing:   true,
+		metrics:   true,
+		poolStats: true,
+		slowQuery: time.Second,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func newOpenTelemetryHook(cfg *wrapConfig) *OpenTelemetryHook {
+	h := &OpenTelemetryHook{
+		Caller:             cfg.caller,
+		SourceURL:          cfg.sourceURL,
+		AllowMetric:        cfg.metrics,
+		SlowQueryThreshold: cfg.slowQuery,
+		Instance:           cfg.instance,
+
+		ContextAttributes:   cfg.contextAttrs,
+		ContextMetricLabels: cfg.contextLabels,
+		BaggageKeys:         cfg.baggageKeys,
+		CostTags:            cfg.costTags,
+		Tenant:              cfg.tenant,
+		Owners:              cfg.owners,
+		RequestID:           cfg.requestID,
+		SpanDecorator:       cfg.decorator,
+		MetricQueue:         cfg.metricQueue,
+		MetricSampleRate:    cfg.metricSample,
+
+		InstrumentationName:    cfg.scopeName,
+		InstrumentationVersion: cfg.scopeVersion,
+		MetricPrefix:           cfg.metricPrefix,
+		MetricName:             cfg.metricName,
+	}
+	h.SetTracingEnabled(cfg.tracing)
+	return h
+}
+
+// Snapshot returns the number of queries, errors and slow queries executed
+// since Wrap together with the current pool statistics.
+func (h *Handle) Snapshot() Snapshot {
+	s := Snapshot{
+		Queries:     atomic.LoadInt64(&h.queries),
+		Errors:      atomic.LoadInt64(&h.errors),
+		SlowQueries: atomic.LoadInt64(&h.slowQueries),
+	}
+	if stats := h.db.PoolStats(); stats != nil {
+		s.Pool = *stats
+	}
+	if h.latency != nil {
+		s.Latency = h.latency.Percentiles()
+	}
+	return s
+}
+
+// observeLatency reports the percentiles of the window as gauges, labeled by
+// sql.percentile and the instance. The percentiles of every handle are
+// reported by one observer.
+func (h *Handle) observeLatency() {
+	name := h.Hook.metricName("go.sql.latency.percentile")
+	instance := instanceKey.String(instanceName(h.db, h.Hook.Instance))
+	h.unobserveLatency = observeBatch(name,
+		func(batch metric.BatchObserver) interface{} {
+			percentile, _ := batch.NewInt64ValueObserver(name,
+				metric.WithDescription("The latency percentiles over a sliding window in microsecond"))
+			return percentile
+		},
+		func(_ context.Context, instruments interface{}, result metric.BatchObserverResult) {
+			percentile := instruments.(metric.Int64ValueObserver)
+			p := h.latency.Percentiles()
+			if p.Count == 0 {
+				return
+			}
+			result.Observe([]label.KeyValue{percentileKey.String("p50"), instance}, percentile.Observation(p.P50.Microseconds()))
+			result.Observe([]label.KeyValue{percentileKey.String("p95"), instance}, percentile.Observation(p.P95.Microseconds()))
+			result.Observe([]label.KeyValue{percentileKey.String("p99"), instance}, percentile.Observation(p.P99.Microseconds()))
+		})
+}
+
+// ServeHTTP writes the Snapshot as JSON, so the handle can be mounted as
+// a debug endpoint:
+//
+//   http.Handle("/debug/pgext", h)
+func (h *Handle) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Snapshot())
+}
+
+// Close turns the instrumentation off. go-pg can not remove hooks, so they
+// stay installed but do nothing.
+func (h *Handle) Close() error {
+	if !atomic.CompareAndSwapInt32(&h.closed, 0, 1) {
+		return nil
+	}
+	close(h.done)
+	h.Hook.SetTracingEnabled(false)
+	h.Hook.SetMetricsEnabled(false)
+	if h.unobserveLatency != nil {
+		h.unobserveLatency()
+	}
+	if h.pool != nil {
+		return h.pool.Close()
+	}
+	return nil
+}
+
+// Attach registers a component, e.g. an ExplainHook installed next to
+// Wrap, to be shut down together with the handle.
+func (h *Handle) Attach(s Shutdowner) {
+	h.mu.Lock()
+	h.attached = append(h.attached, s)
+	h.mu.Unlock()
+}
+
+// Shutdown closes the handle, then shuts down the attached components and
+// waits for their background work and pending telemetry to be flushed.
+func (h *Handle) Shutdown(ctx context.Context) error {
+	err := h.Close()
+	if err2 := waitGroup(ctx, &h.wg); err == nil {
+		err = err2
+	}
+
+	h.mu.Lock()
+	attached := h.attached
+	h.attached = nil
+	h.mu.Unlock()
+
+	if err2 := Shutdown(ctx, attached...); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// handleHook counts queries for Snapshot and logs slow queries.
+type handleHook struct {
+	h *Handle
+}
+
+var _ pg.QueryHook = handleHook{}
+
+func (hh handleHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (hh handleHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	h := hh.h
+	if atomic.LoadInt32(&h.closed) != 0 || isServerVersionQuery(ctx) {
+		return nil
+	}
+
+	atomic.AddInt64(&h.queries, 1)
+	if evt.Err != nil {
+		atomic.AddInt64(&h.errors, 1)
+	}
+	if h.latency != nil {
+		h.latency.Record(since(nil, evt.StartTime))
+	}
+
+	if h.slow != nil && since(nil, evt.StartTime) >= h.slow.threshold() {
+		atomic.AddInt64(&h.slowQueries, 1)
+		return h.slow.AfterQuery(ctx, evt)
+	}
+	return nil
+}
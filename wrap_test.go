@@ -0,0 +1,203 @@
+package pgext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/j2gg0s/pgext/pgexttest"
+)
+
+func TestHandleSnapshot(t *testing.T) {
+	h := Wrap(pgexttest.DB(),
+		WithPoolStats(false),
+		WithSlowQueryThreshold(time.Second),
+		WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	hook := handleHook{h}
+	ctx := context.Background()
+
+	events := []*pg.QueryEvent{
+		pgexttest.NewQueryEvent("SELECT 1").Build(),
+		pgexttest.NewQueryEvent("SELECT 2").Err(errors.New("test")).Build(),
+		pgexttest.NewQueryEvent("SELECT pg_sleep(2)").Duration(2 * time.Second).Build(),
+	}
+	for _, evt := range events {
+		if _, err := pgexttest.Run(ctx, hook, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := h.Snapshot()
+	if s.Queries != 3 || s.Errors != 1 || s.SlowQueries != 1 {
+		t.Errorf("got %+v, want 3 queries, 1 error and 1 slow query", s)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pgexttest.Run(ctx, hook, events[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Snapshot().Queries; got != 3 {
+		t.Errorf("got %d queries after Close, want 3", got)
+	}
+}
+
+func TestWrapInstrumentationScope(t *testing.T) {
+	h := Wrap(pgexttest.DB(), WithPoolStats(false), WithInstrumentationScope("example.com/dbkit", "v1.2.0"))
+	if h.Hook.InstrumentationName != "example.com/dbkit" || h.Hook.InstrumentationVersion != "v1.2.0" {
+		t.Fatalf("got scope %q %q", h.Hook.InstrumentationName, h.Hook.InstrumentationVersion)
+	}
+	ins := h.Hook.instruments()
+	if ins == defaultInstruments {
+		t.Error("got the pgext instruments, want the instruments of the scope")
+	}
+	if h.Hook.instruments() != ins {
+		t.Error("instruments are created again")
+	}
+
+	if (&OpenTelemetryHook{}).instruments() != defaultInstruments {
+		t.Error("got new instruments without a scope, want the pgext instruments")
+	}
+}
+
+func TestNewOpenTelemetryHook(t *testing.T) {
+	h := NewOpenTelemetryHook(WithCaller(true), WithTracing(false), WithInstance("orders"))
+	if !h.Caller || !h.AllowMetric || h.Instance != "orders" || h.SlowQueryThreshold != time.Second {
+		t.Errorf("got %+v, want the options applied over the defaults of Wrap", h)
+	}
+	if h.tracingEnabled() {
+		t.Error("got tracing enabled, want it disabled by WithTracing")
+	}
+}
+
+func TestWrapMetricPrefix(t *testing.T) {
+	h := Wrap(pgexttest.DB(),
+		WithPoolStats(false),
+		WithMetricPrefix("myapp.db."),
+		WithMetricName(func(name string) string {
+			if name == "myapp.db.latency" {
+				return "myapp.db.query.duration_us"
+			}
+			return name
+		}),
+	)
+	if h.Hook.instruments() == defaultInstruments {
+		t.Error("got the go.sql instruments, want renamed instruments")
+	}
+
+	for name, want := range map[string]string{
+		"go.sql.latency":            "myapp.db.query.duration_us",
+		"go.sql.slow_queries":       "myapp.db.slow_queries",
+		"go.sql.pool.hits":          "myapp.db.pool.hits",
+		"go.sql.latency.percentile": "myapp.db.latency.percentile",
+	} {
+		if got := h.Hook.metricName(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestHandleLatencyPercentiles(t *testing.T) {
+	h := Wrap(pgexttest.DB(), WithPoolStats(false), WithSlowQueryThreshold(0), WithLatencyPercentiles(time.Minute))
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		evt := pgexttest.NewQueryEvent("SELECT 1").Duration(10 * time.Millisecond).Build()
+		if _, err := pgexttest.Run(ctx, handleHook{h}, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pgext", nil))
+	var s Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Queries != 10 || s.Latency.Count != 10 || s.Latency.P50 < 9*time.Millisecond {
+		t.Errorf("got %+v, want 10 queries of about 10ms", s)
+	}
+}
+
+func TestHandleSharedPoolStats(t *testing.T) {
+	mr := pgexttest.RecordMetrics(t)
+
+	ctx := context.Background()
+	a := Wrap(pgexttest.DB(), WithInstance("shared-a"))
+	defer a.Close()
+	b := Wrap(pgexttest.DB(), WithInstance("shared-b"))
+	defer b.Close()
+
+	mr.Observe(ctx)
+	for _, instance := range []string{"shared-a", "shared-b"} {
+		pgexttest.AssertMeasurement(t, mr.Measurements(),
+			pgexttest.WithMetricName("go.sql.pool.total_conns"),
+			pgexttest.WithLabel("sql.instance", instance),
+		)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mr = pgexttest.RecordMetrics(t)
+	mr.Observe(ctx)
+	if _, ok := pgexttest.FindMeasurement(mr.Measurements(),
+		pgexttest.WithMetricName("go.sql.pool.total_conns"),
+		pgexttest.WithLabel("sql.instance", "shared-a"),
+	); ok {
+		t.Error("got the pool of the closed handle reported")
+	}
+	pgexttest.AssertMeasurement(t, mr.Measurements(),
+		pgexttest.WithMetricName("go.sql.pool.total_conns"),
+		pgexttest.WithLabel("sql.instance", "shared-b"),
+	)
+}
+
+func TestHandleSharedLatencyPercentiles(t *testing.T) {
+	mr := pgexttest.RecordMetrics(t)
+
+	ctx := context.Background()
+	var handles []*Handle
+	for _, instance := range []string{"shared-a", "shared-b"} {
+		h := Wrap(pgexttest.DB(), WithInstance(instance), WithPoolStats(false), WithLatencyPercentiles(time.Minute))
+		defer h.Close()
+		evt := pgexttest.NewQueryEvent("SELECT 1").Duration(10 * time.Millisecond).Build()
+		if _, err := pgexttest.Run(ctx, handleHook{h}, evt); err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, h)
+	}
+
+	mr.Observe(ctx)
+	for _, instance := range []string{"shared-a", "shared-b"} {
+		pgexttest.AssertMeasurement(t, mr.Measurements(),
+			pgexttest.WithMetricName("go.sql.latency.percentile"),
+			pgexttest.WithLabel("sql.instance", instance),
+			pgexttest.WithLabel("sql.percentile", "p99"),
+		)
+	}
+
+	if err := handles[0].Close(); err != nil {
+		t.Fatal(err)
+	}
+	mr = pgexttest.RecordMetrics(t)
+	mr.Observe(ctx)
+	if _, ok := pgexttest.FindMeasurement(mr.Measurements(),
+		pgexttest.WithMetricName("go.sql.latency.percentile"),
+		pgexttest.WithLabel("sql.instance", "shared-a"),
+	); ok {
+		t.Error("got the percentiles of the closed handle reported")
+	}
+	pgexttest.AssertMeasurement(t, mr.Measurements(),
+		pgexttest.WithMetricName("go.sql.latency.percentile"),
+		pgexttest.WithLabel("sql.instance", "shared-b"),
+	)
+}